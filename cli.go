@@ -0,0 +1,664 @@
+//go:build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.zx2c4.com/wireguard/manager"
+	"golang.zx2c4.com/wireguard/manager/client"
+)
+
+// 管理命令的退出码，便于脚本判断
+const (
+	ExitCLIUsage       = 2 // 参数错误 (含服务端 400)，或当前连接方式不支持该操作
+	ExitCLINotFound    = 3 // Peer 或邀请码不存在
+	ExitCLIAuth        = 4 // 未认证或无权限
+	ExitCLIConflict    = 5 // 已存在等冲突
+	ExitCLIUnavailable = 6 // 连不上守护进程
+	ExitCLIPending     = 7 // config plan：有待应用的改动
+	ExitCLIUnhealthy   = 8 // health：检查未通过
+)
+
+// cliCommand 管理子命令，args 不含子命令名
+type cliCommand func(ctx context.Context, o *cliOptions, args []string) error
+
+// cliPrefix 管理子命令的前缀：wireguard-go ctl <命令>
+const cliPrefix = "ctl"
+
+var cliCommands = map[string]cliCommand{
+	"status": cmdStatus,
+	"peer":   cmdPeer,
+	"invite": cmdInvite,
+	"config": cmdConfig,
+	"stun":   cmdStun,
+	"health": cmdHealth,
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintf(w, `Management commands:
+  %[1]s ctl status [--json]
+  %[1]s ctl peer list [--tag TAG] [--json]
+  %[1]s ctl peer add PUBLIC-KEY --allowed-ip CIDR [--endpoint HOST:PORT] [--keepalive SECONDS] [--tag TAG]
+  %[1]s ctl peer remove|disable|enable PUBLIC-KEY
+  %[1]s ctl invite create [--remark TEXT] [--hours N] [--tag TAG] [--json]
+  %[1]s ctl invite list [--json]
+  %[1]s ctl invite revoke TOKEN
+  %[1]s ctl config export
+  %[1]s ctl config import|plan|apply FILE
+  %[1]s ctl stun status|probe [--json]
+  %[1]s ctl stun query [--port N] [--json] SERVER...   (no daemon needed)
+  %[1]s ctl health [--ready] [--json]                 (token optional, shows checks)
+
+Connection (every command):
+  -i, --interface NAME  talk to the daemon over its UAPI socket (changes are not persisted)
+  --api URL             management API base URL (default $WG_API_URL or http://127.0.0.1:8080)
+  --token TOKEN         API token (default $WG_API_TOKEN)
+  --fingerprint SHA256  pin a self-signed WebUI certificate
+  --timeout DURATION    request timeout (default 30s)
+
+Exit codes: 0 ok, 1 error, 2 usage, 3 not found, 4 unauthorized or forbidden,
+5 conflict, 6 daemon unreachable, 7 config plan has pending changes,
+8 health check failed.
+`, os.Args[0])
+}
+
+// usageError 参数错误
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+// errPending config plan 有待应用的改动
+var errPending = errors.New("changes pending")
+
+// errUnhealthy health 检查未通过，结果已输出
+var errUnhealthy = errors.New("unhealthy")
+
+// runCtl 分派 ctl 之后的子命令，返回退出码
+func runCtl(args []string) int {
+	if len(args) == 0 {
+		printCLIUsage(os.Stderr)
+		return ExitCLIUsage
+	}
+	switch args[0] {
+	case "help", "-h", "--help":
+		printCLIUsage(os.Stdout)
+		return ExitSetupSuccess
+	}
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+		printCLIUsage(os.Stderr)
+		return ExitCLIUsage
+	}
+	return runCLI(cmd, args[1:])
+}
+
+// runCLI 执行管理子命令，返回退出码
+func runCLI(cmd cliCommand, args []string) int {
+	o := &cliOptions{}
+	err := cmd(context.Background(), o, args)
+	if err == nil {
+		return ExitSetupSuccess
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		printCLIUsage(os.Stdout)
+		return ExitSetupSuccess
+	}
+	if errors.Is(err, errPending) {
+		return ExitCLIPending
+	}
+	if errors.Is(err, errUnhealthy) {
+		return ExitCLIUnhealthy
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	var usage *usageError
+	var unavailable *unavailableError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &usage):
+		printCLIUsage(os.Stderr)
+		return ExitCLIUsage
+	case errors.Is(err, errUnsupported), errors.Is(err, client.ErrBadRequest):
+		return ExitCLIUsage
+	case errors.Is(err, client.ErrNotFound):
+		return ExitCLINotFound
+	case errors.Is(err, client.ErrUnauthorized), errors.Is(err, client.ErrForbidden):
+		return ExitCLIAuth
+	case errors.Is(err, client.ErrConflict):
+		return ExitCLIConflict
+	case errors.As(err, &unavailable), errors.As(err, &opErr):
+		return ExitCLIUnavailable
+	}
+	return ExitSetupFailed
+}
+
+// ========== 公共参数 ==========
+
+// cliOptions 连接与输出参数
+type cliOptions struct {
+	iface       string
+	api         string
+	token       string
+	fingerprint string
+	timeout     time.Duration
+	json        bool
+}
+
+// flagSet 创建带公共参数的 FlagSet
+func (o *cliOptions) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&o.iface, "i", os.Getenv("WG_INTERFACE"), "")
+	fs.StringVar(&o.iface, "interface", os.Getenv("WG_INTERFACE"), "")
+	api := os.Getenv("WG_API_URL")
+	if api == "" {
+		api = "http://127.0.0.1:8080"
+	}
+	fs.StringVar(&o.api, "api", api, "")
+	fs.StringVar(&o.token, "token", os.Getenv("WG_API_TOKEN"), "")
+	fs.StringVar(&o.fingerprint, "fingerprint", "", "")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "")
+	fs.BoolVar(&o.json, "json", false, "")
+	return fs
+}
+
+// parse 解析参数，允许参数与位置参数交替出现 (peer add KEY --allowed-ip ...)，返回位置参数
+func (o *cliOptions) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usagef("%v", err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// backend 按参数选择 UAPI 或管理 API
+func (o *cliOptions) backend() (cliBackend, error) {
+	if o.iface != "" {
+		return newUAPIBackend(o.iface), nil
+	}
+	return o.apiBackend()
+}
+
+// apiBackend 只能通过管理 API 完成的操作 (邀请码等)
+func (o *cliOptions) apiBackend() (apiBackend, error) {
+	if o.iface != "" {
+		return apiBackend{}, errUnsupported
+	}
+	c, err := client.New(o.api, client.WithToken(o.token), client.WithHTTPClient(manager.APIHTTPClient(o.fingerprint)))
+	if err != nil {
+		return apiBackend{}, usagef("%v", err)
+	}
+	return apiBackend{c}, nil
+}
+
+// stringList 可重复、可逗号分隔的参数
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// ========== 输出 ==========
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table 对齐输出的表格
+func table(header ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	return w
+}
+
+// humanBytes 以 B/KiB/MiB/GiB 显示流量
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func peerState(p client.PeerInfo) string {
+	switch {
+	case p.Disabled:
+		return "disabled"
+	case p.IsOnline:
+		return "online"
+	}
+	return "offline"
+}
+
+func printPeers(peers []client.PeerInfo) error {
+	w := table("PUBLIC KEY", "NAME", "ALLOWED IPS", "ENDPOINT", "HANDSHAKE", "RX", "TX", "STATE", "TAGS")
+	for _, p := range peers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.PublicKey, orDash(p.Remark), orDash(strings.Join(p.AllowedIPs, ",")), orDash(p.Endpoint),
+			orDash(p.LastHandshake), humanBytes(p.RxBytes), humanBytes(p.TxBytes), peerState(p), orDash(strings.Join(p.Tags, ",")))
+	}
+	return w.Flush()
+}
+
+// ========== status ==========
+
+func cmdStatus(ctx context.Context, o *cliOptions, args []string) error {
+	fs := o.flagSet("status")
+	if rest, err := o.parse(fs, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return usagef("status takes no arguments")
+	}
+	b, err := o.backend()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	info, err := b.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return printJSON(info)
+	}
+	fmt.Printf("public key:  %s\nlisten port: %d\npeers:       %d\n\n", orDash(info.PublicKey), info.ListenPort, info.PeerCount)
+	return printPeers(info.Peers)
+}
+
+// ========== peer ==========
+
+func cmdPeer(ctx context.Context, o *cliOptions, args []string) error {
+	if len(args) == 0 {
+		return usagef("missing peer subcommand")
+	}
+	fs := o.flagSet("peer " + args[0])
+	var allowedIPs, tags stringList
+	var endpoint string
+	var keepalive int
+	switch args[0] {
+	case "list":
+		fs.Var(&tags, "tag", "")
+	case "add":
+		fs.Var(&allowedIPs, "allowed-ip", "")
+		fs.StringVar(&endpoint, "endpoint", "", "")
+		fs.IntVar(&keepalive, "keepalive", 0, "")
+		fs.Var(&tags, "tag", "")
+	case "remove", "disable", "enable":
+	default:
+		return usagef("unknown peer subcommand %q", args[0])
+	}
+	rest, err := o.parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if args[0] == "list" && len(rest) != 0 || args[0] != "list" && len(rest) != 1 {
+		return usagef("wrong number of arguments for peer %s", args[0])
+	}
+	b, err := o.backend()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		info, err := b.Status(ctx)
+		if err != nil {
+			return err
+		}
+		peers := []client.PeerInfo{}
+		for _, p := range info.Peers {
+			if len(tags) == 0 || slices.ContainsFunc(p.Tags, func(t string) bool { return slices.Contains(tags, t) }) {
+				peers = append(peers, p)
+			}
+		}
+		if o.json {
+			return printJSON(peers)
+		}
+		return printPeers(peers)
+	case "add":
+		if len(allowedIPs) == 0 {
+			return usagef("peer add needs at least one --allowed-ip")
+		}
+		if err := b.AddPeer(ctx, client.PeerAddRequest{PublicKey: rest[0], AllowedIPs: allowedIPs, Endpoint: endpoint, Keepalive: keepalive, Tags: tags}); err != nil {
+			return err
+		}
+	case "remove":
+		if err := b.RemovePeer(ctx, rest[0]); err != nil {
+			return err
+		}
+	case "disable", "enable":
+		if err := b.SetPeerDisabled(ctx, rest[0], args[0] == "disable"); err != nil {
+			return err
+		}
+	}
+	if !o.json {
+		fmt.Printf("peer %s: %s\n", rest[0], map[string]string{"add": "added", "remove": "removed", "disable": "disabled", "enable": "enabled"}[args[0]])
+	}
+	return nil
+}
+
+// ========== invite ==========
+
+func cmdInvite(ctx context.Context, o *cliOptions, args []string) error {
+	if len(args) == 0 {
+		return usagef("missing invite subcommand")
+	}
+	fs := o.flagSet("invite " + args[0])
+	var remark string
+	var hours int
+	var tags stringList
+	switch args[0] {
+	case "create":
+		fs.StringVar(&remark, "remark", "", "")
+		fs.IntVar(&hours, "hours", 24, "")
+		fs.Var(&tags, "tag", "")
+	case "list", "revoke":
+	default:
+		return usagef("unknown invite subcommand %q", args[0])
+	}
+	rest, err := o.parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if args[0] == "revoke" && len(rest) != 1 || args[0] != "revoke" && len(rest) != 0 {
+		return usagef("wrong number of arguments for invite %s", args[0])
+	}
+	b, err := o.apiBackend()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		inv, err := b.CreateInvite(ctx, client.InviteGenerateRequest{Remark: remark, Duration: hours, Tags: tags})
+		if err != nil {
+			return err
+		}
+		if o.json {
+			return printJSON(inv)
+		}
+		fmt.Printf("token:   %s\nexpires: %s\nurl:     %s\n", inv.Token, inv.ExpiresAt.Local().Format(time.DateTime), inv.URL)
+	case "list":
+		invites, err := b.Invites(ctx)
+		if err != nil {
+			return err
+		}
+		if o.json {
+			return printJSON(invites)
+		}
+		w := table("TOKEN", "REMARK", "EXPIRES", "TAGS")
+		for _, inv := range invites {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", inv.Token, orDash(inv.Remark), inv.ExpiresAt.Local().Format(time.DateTime), orDash(strings.Join(inv.Tags, ",")))
+		}
+		return w.Flush()
+	case "revoke":
+		if err := b.RevokeInvite(ctx, rest[0]); err != nil {
+			return err
+		}
+		if !o.json {
+			fmt.Printf("invite %s: revoked\n", rest[0])
+		}
+	}
+	return nil
+}
+
+// ========== config ==========
+
+// cmdConfig 声明式管理 Peer 集合
+//
+//	export  输出当前 Peer 集合 (JSON)
+//	import  添加或更新文件中的 Peer，不删除其他 Peer
+//	plan    显示 apply 将执行的操作，有改动时以 ExitCLIPending 退出
+//	apply   使 Peer 集合与文件完全一致 (删除文件中没有的 Peer)
+func cmdConfig(ctx context.Context, o *cliOptions, args []string) error {
+	if len(args) == 0 {
+		return usagef("missing config subcommand")
+	}
+	switch args[0] {
+	case "export", "import", "plan", "apply":
+	default:
+		return usagef("unknown config subcommand %q", args[0])
+	}
+	rest, err := o.parse(o.flagSet("config "+args[0]), args[1:])
+	if err != nil {
+		return err
+	}
+	if args[0] == "export" && len(rest) != 0 || args[0] != "export" && len(rest) != 1 {
+		return usagef("wrong number of arguments for config %s", args[0])
+	}
+	b, err := o.backend()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	info, err := b.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if args[0] == "export" {
+		return printJSON(exportConfig(info))
+	}
+
+	doc, err := readConfigDocument(rest[0])
+	if err != nil {
+		return usagef("%v", err)
+	}
+	_, withTags := b.(apiBackend)
+	steps := planConfig(info, doc, args[0] != "import", withTags)
+	if args[0] != "plan" {
+		if err := applyPlan(ctx, b, steps, os.Stdout); err != nil {
+			return err
+		}
+		if !o.json {
+			fmt.Printf("%d change(s) applied\n", len(steps))
+		}
+		return nil
+	}
+	for _, s := range steps {
+		fmt.Println(s)
+	}
+	if len(steps) == 0 {
+		fmt.Println("no changes")
+		return nil
+	}
+	fmt.Printf("%d change(s) pending\n", len(steps))
+	return errPending
+}
+
+// ========== stun ==========
+
+// cmdStun STUN 公网地址与 NAT 类型
+//
+//	status  守护进程最近一次探测的结果
+//	probe   让守护进程立即从 WireGuard 端口探测
+//	query   不经过守护进程，从本地临时端口直接向服务器探测
+func cmdStun(ctx context.Context, o *cliOptions, args []string) error {
+	if len(args) == 0 {
+		return usagef("missing stun subcommand")
+	}
+	fs := o.flagSet("stun " + args[0])
+	var localPort int
+	switch args[0] {
+	case "status", "probe":
+	case "query":
+		fs.IntVar(&localPort, "port", 0, "")
+	default:
+		return usagef("unknown stun subcommand %q", args[0])
+	}
+	rest, err := o.parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	if args[0] == "query" {
+		if len(rest) == 0 {
+			return usagef("stun query needs at least one SERVER (host:port)")
+		}
+		pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", localPort))
+		if err != nil {
+			return err
+		}
+		defer pc.Close()
+		res := manager.ProbeSTUN(ctx, pc, rest)
+		out := client.STUNResult{LocalPort: res.LocalPort, Mapped: res.Mapped, NATType: res.NATType, PortPreserved: res.PortPreserved}
+		for _, s := range res.Servers {
+			out.Servers = append(out.Servers, client.STUNServerResult(s))
+		}
+		if o.json {
+			return printJSON(out)
+		}
+		return printSTUNResult(&out)
+	}
+
+	if len(rest) > 0 {
+		return usagef("stun %s takes no arguments", args[0])
+	}
+	b, err := o.apiBackend()
+	if err != nil {
+		return err
+	}
+	var st client.STUNStatus
+	if args[0] == "probe" {
+		st, err = b.ProbeSTUN(ctx)
+	} else {
+		st, err = b.STUN(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return printJSON(st)
+	}
+	fmt.Printf("mode:            %s\n", st.Mode)
+	if len(st.Responder) > 0 {
+		fmt.Printf("responder:       %s\n", strings.Join(st.Responder, ", "))
+	}
+	if st.PublicEndpoint != "" {
+		source := "configured"
+		if st.Discovered {
+			source = "discovered"
+		}
+		fmt.Printf("public endpoint: %s (%s)\n", st.PublicEndpoint, source)
+	}
+	if st.Error != "" {
+		fmt.Printf("error:           %s\n", st.Error)
+	}
+	if st.Result == nil {
+		fmt.Println("not probed yet")
+		return nil
+	}
+	fmt.Printf("checked:         %s\n", st.Checked.Local().Format(time.DateTime))
+	return printSTUNResult(st.Result)
+}
+
+func printSTUNResult(res *client.STUNResult) error {
+	fmt.Printf("local port:      %d\nmapped:          %s\nNAT type:        %s\nport preserved:  %t\n\n",
+		res.LocalPort, orDash(res.Mapped), res.NATType, res.PortPreserved)
+	w := table("SERVER", "ADDRESS", "MAPPED", "RTT", "ERROR")
+	for _, s := range res.Servers {
+		rtt := "-"
+		if s.Mapped != "" {
+			rtt = fmt.Sprintf("%.1f ms", s.RTT)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Server, orDash(s.Addr), orDash(s.Mapped), rtt, orDash(s.Error))
+	}
+	return w.Flush()
+}
+
+// ========== health ==========
+
+// cmdHealth 查询守护进程的 /healthz (存活) 或 /readyz (就绪)，未通过时退出码为 8
+func cmdHealth(ctx context.Context, o *cliOptions, args []string) error {
+	fs := o.flagSet("health")
+	ready := fs.Bool("ready", false, "")
+	if rest, err := o.parse(fs, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return usagef("health takes no arguments")
+	}
+	b, err := o.apiBackend()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	report, passed, err := b.Health(ctx, *ready)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		err = printJSON(report)
+	} else {
+		fmt.Printf("status: %s\n\n", report.Status)
+		w := table("CHECK", "STATUS", "TIME", "MESSAGE")
+		for _, c := range report.Checks {
+			fmt.Fprintf(w, "%s\t%s\t%.1f ms\t%s\n", c.Name, c.Status, c.Duration, orDash(c.Message))
+		}
+		err = w.Flush()
+	}
+	if err == nil && !passed {
+		return errUnhealthy
+	}
+	return err
+}
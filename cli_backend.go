@@ -0,0 +1,340 @@
+//go:build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.zx2c4.com/wireguard/ipc"
+	"golang.zx2c4.com/wireguard/manager/client"
+)
+
+// errUnsupported 当前连接方式不支持该操作 (如通过 UAPI 管理邀请码)
+var errUnsupported = errors.New("not supported over UAPI, use the management API (--api)")
+
+// cliBackend 命令行操作的守护进程接口：管理 API 或 UAPI 套接字
+type cliBackend interface {
+	Status(ctx context.Context) (client.DeviceInfo, error)
+	// AddPeer 添加 Peer，已存在时返回 client.ErrConflict
+	AddPeer(ctx context.Context, req client.PeerAddRequest) error
+	// PutPeer 创建或整体替换 Peer
+	PutPeer(ctx context.Context, req client.PeerAddRequest) error
+	RemovePeer(ctx context.Context, publicKey string) error
+	SetPeerDisabled(ctx context.Context, publicKey string, disabled bool) error
+}
+
+// ========== 管理 API ==========
+
+// apiBackend 通过管理 API 操作，改动会写入守护进程的配置文件
+type apiBackend struct {
+	*client.Client
+}
+
+func (b apiBackend) AddPeer(ctx context.Context, req client.PeerAddRequest) error {
+	_, err := b.Client.AddPeer(ctx, req)
+	return err
+}
+
+func (b apiBackend) PutPeer(ctx context.Context, req client.PeerAddRequest) error {
+	_, err := b.Client.PutPeer(ctx, req)
+	return err
+}
+
+func (b apiBackend) SetPeerDisabled(ctx context.Context, publicKey string, disabled bool) error {
+	var err error
+	if disabled {
+		_, err = b.DisablePeer(ctx, publicKey)
+	} else {
+		_, err = b.EnablePeer(ctx, publicKey)
+	}
+	return err
+}
+
+// ========== UAPI ==========
+
+// uapiBackend 通过 UAPI 套接字直接操作设备，与 wg(8) 相同，改动不写入配置文件
+type uapiBackend struct {
+	socket string
+}
+
+func newUAPIBackend(interfaceName string) uapiBackend {
+	return uapiBackend{socket: filepath.Join(ipc.SocketDirectory(), interfaceName+".sock")}
+}
+
+// unavailableError 连不上守护进程
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string { return e.err.Error() }
+func (e *unavailableError) Unwrap() error { return e.err }
+
+// uapiErrno UAPI 返回的错误码
+type uapiErrno int64
+
+func (e uapiErrno) Error() string {
+	return fmt.Sprintf("UAPI request failed (errno=%d)", int64(e))
+}
+
+// request 发送一次 UAPI 请求，返回以空行结束前的所有行 (不含 errno)
+func (b uapiBackend) request(ctx context.Context, body string) ([]string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", b.socket)
+	if err != nil {
+		return nil, &unavailableError{err}
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write([]byte(body + "\n")); err != nil {
+		return nil, err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "errno="); ok {
+			if n, _ := strconv.ParseInt(v, 10, 64); n != 0 {
+				return nil, uapiErrno(n)
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func (b uapiBackend) set(ctx context.Context, config string) error {
+	_, err := b.request(ctx, "set=1\n"+config)
+	return err
+}
+
+func (b uapiBackend) Status(ctx context.Context) (client.DeviceInfo, error) {
+	lines, err := b.request(ctx, "get=1\n")
+	if err != nil {
+		return client.DeviceInfo{}, err
+	}
+	var info client.DeviceInfo
+	var peer *client.PeerInfo
+	var handshake time.Time
+	flush := func() {
+		if peer == nil {
+			return
+		}
+		if !handshake.IsZero() {
+			peer.LastHandshake = handshake.Format("2006-01-02 15:04:05")
+			peer.IsOnline = time.Since(handshake) < 135*time.Second
+		}
+		peer.TotalBytes = peer.TxBytes + peer.RxBytes
+		peer.IsRunning = true
+		info.Peers = append(info.Peers, *peer)
+		peer, handshake = nil, time.Time{}
+	}
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, "=")
+		if key == "public_key" {
+			flush()
+			peer = &client.PeerInfo{PublicKey: hexToBase64(value)}
+			continue
+		}
+		if peer == nil {
+			switch key {
+			case "private_key":
+				info.PublicKey = publicKeyOf(value)
+			case "listen_port":
+				port, _ := strconv.ParseUint(value, 10, 16)
+				info.ListenPort = uint16(port)
+			}
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		switch key {
+		case "endpoint":
+			peer.Endpoint = value
+		case "allowed_ip":
+			peer.AllowedIPs = append(peer.AllowedIPs, value)
+		case "last_handshake_time_sec":
+			if n > 0 {
+				handshake = time.Unix(n, 0)
+			}
+		case "last_handshake_time_nsec":
+			if !handshake.IsZero() {
+				handshake = handshake.Add(time.Duration(n))
+			}
+		case "tx_bytes":
+			peer.TxBytes = uint64(n)
+		case "rx_bytes":
+			peer.RxBytes = uint64(n)
+		case "persistent_keepalive_interval":
+			peer.KeepaliveInterval = uint32(n)
+		default:
+			// 扩展计数，旧版守护进程不输出，此时 Counters 保持为 nil
+			counters := peer.Counters
+			if counters == nil {
+				counters = new(client.PeerCounters)
+			}
+			if field := counterField(counters, key); field != nil {
+				*field, _ = strconv.ParseUint(value, 10, 64)
+				peer.Counters = counters
+			}
+		}
+	}
+	flush()
+	info.PeerCount = len(info.Peers)
+	return info, nil
+}
+
+// counterField UAPI 扩展计数键对应的字段，未知的键返回 nil
+func counterField(c *client.PeerCounters, key string) *uint64 {
+	switch key {
+	case "tx_packets":
+		return &c.TxPackets
+	case "rx_packets":
+		return &c.RxPackets
+	case "drop_allowed_ips":
+		return &c.Drops.AllowedIPs
+	case "drop_replay":
+		return &c.Drops.Replay
+	case "drop_decrypt":
+		return &c.Drops.Decrypt
+	case "drop_staged_overflow":
+		return &c.Drops.StagedOverflow
+	case "drop_no_keypair":
+		return &c.Drops.NoKeypair
+	case "drop_oversize":
+		return &c.Drops.Oversize
+	case "handshakes_sent":
+		return &c.HandshakesSent
+	case "handshakes_received":
+		return &c.HandshakesReceived
+	case "handshakes_failed":
+		return &c.HandshakesFailed
+	case "rekeys":
+		return &c.Rekeys
+	}
+	return nil
+}
+
+// hasPeer 判断设备上是否有该 Peer
+func (b uapiBackend) hasPeer(ctx context.Context, publicKey string) (bool, error) {
+	key, err := keyToHex(publicKey)
+	if err != nil {
+		return false, err
+	}
+	info, err := b.Status(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range info.Peers {
+		if p.PublicKey == hexToBase64(key) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b uapiBackend) AddPeer(ctx context.Context, req client.PeerAddRequest) error {
+	exists, err := b.hasPeer(ctx, req.PublicKey)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("peer already exists: %w", client.ErrConflict)
+	}
+	return b.PutPeer(ctx, req)
+}
+
+func (b uapiBackend) PutPeer(ctx context.Context, req client.PeerAddRequest) error {
+	key, err := keyToHex(req.PublicKey)
+	if err != nil {
+		return err
+	}
+	var config strings.Builder
+	fmt.Fprintf(&config, "public_key=%s\nreplace_allowed_ips=true\n", key)
+	if req.Endpoint != "" {
+		fmt.Fprintf(&config, "endpoint=%s\n", req.Endpoint)
+	}
+	fmt.Fprintf(&config, "persistent_keepalive_interval=%d\n", req.Keepalive)
+	for _, ip := range req.AllowedIPs {
+		fmt.Fprintf(&config, "allowed_ip=%s\n", ip)
+	}
+	return b.set(ctx, config.String())
+}
+
+func (b uapiBackend) RemovePeer(ctx context.Context, publicKey string) error {
+	key, err := keyToHex(publicKey)
+	if err != nil {
+		return err
+	}
+	exists, err := b.hasPeer(ctx, publicKey)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("peer not found: %w", client.ErrNotFound)
+	}
+	return b.set(ctx, fmt.Sprintf("public_key=%s\nremove=true\n", key))
+}
+
+func (b uapiBackend) SetPeerDisabled(ctx context.Context, publicKey string, disabled bool) error {
+	return errUnsupported
+}
+
+// ========== 公钥编码 ==========
+
+// keyToHex 把 Base64 (标准或 URL 安全) 或 Hex 公钥转为 UAPI 使用的 Hex
+func keyToHex(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 64 {
+		if _, err := hex.DecodeString(s); err == nil {
+			return strings.ToLower(s), nil
+		}
+	}
+	s = strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(s, "="))
+	key, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("invalid public key %q", s)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func hexToBase64(s string) string {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// publicKeyOf 由 Hex 私钥计算 Base64 公钥
+func publicKeyOf(privateHex string) string {
+	priv, err := hex.DecodeString(privateHex)
+	if err != nil || len(priv) != 32 {
+		return ""
+	}
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(pub)
+}
@@ -0,0 +1,197 @@
+//go:build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/manager/client"
+)
+
+// peerSpec 声明式配置中的 Peer
+type peerSpec struct {
+	PublicKey  string   `json:"public_key"`
+	AllowedIPs []string `json:"allowed_ips"`
+	Endpoint   string   `json:"endpoint,omitempty"` // 为空时不比较 (端点可能是漫游学到的)
+	Keepalive  int      `json:"persistent_keepalive,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Disabled   bool     `json:"disabled,omitempty"`
+}
+
+// configDocument config export/import/plan/apply 使用的声明式配置
+type configDocument struct {
+	Peers []peerSpec `json:"peers"`
+}
+
+// planStep 计划中的一步操作，按顺序执行
+type planStep struct {
+	Op     string // add, change, enable, disable, remove
+	Peer   peerSpec
+	Detail string
+}
+
+func (s planStep) String() string {
+	sign := map[string]string{"add": "+", "change": "~", "enable": "~", "disable": "~", "remove": "-"}[s.Op]
+	line := fmt.Sprintf("%s %-7s %s", sign, s.Op, s.Peer.PublicKey)
+	if s.Detail != "" {
+		line += "  (" + s.Detail + ")"
+	}
+	return line
+}
+
+// exportConfig 将当前的 Peer 集合导出为声明式配置
+func exportConfig(info client.DeviceInfo) configDocument {
+	doc := configDocument{Peers: []peerSpec{}}
+	for _, p := range info.Peers {
+		doc.Peers = append(doc.Peers, peerSpec{
+			PublicKey:  p.PublicKey,
+			AllowedIPs: p.AllowedIPs,
+			Endpoint:   p.Endpoint,
+			Keepalive:  int(p.KeepaliveInterval),
+			Tags:       p.Tags,
+			Disabled:   p.Disabled,
+		})
+	}
+	slices.SortFunc(doc.Peers, func(a, b peerSpec) int { return strings.Compare(a.PublicKey, b.PublicKey) })
+	return doc
+}
+
+// readConfigDocument 读取声明式配置，path 为 "-" 时读标准输入
+func readConfigDocument(path string) (configDocument, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return configDocument{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var doc configDocument
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return configDocument{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i, p := range doc.Peers {
+		hexKey, err := keyToHex(p.PublicKey)
+		if err != nil {
+			return configDocument{}, fmt.Errorf("peer %d: %w", i, err)
+		}
+		doc.Peers[i].PublicKey = hexToBase64(hexKey)
+		if seen[doc.Peers[i].PublicKey] {
+			return configDocument{}, fmt.Errorf("peer %s listed twice", doc.Peers[i].PublicKey)
+		}
+		seen[doc.Peers[i].PublicKey] = true
+	}
+	return doc, nil
+}
+
+// planConfig 计算把当前状态变为 doc 所需的操作
+// prune 为 true 时删除 doc 中没有的 Peer；withTags 为 false 时 (UAPI) 不比较标签与停用状态
+func planConfig(info client.DeviceInfo, doc configDocument, prune, withTags bool) []planStep {
+	current := make(map[string]client.PeerInfo, len(info.Peers))
+	for _, p := range info.Peers {
+		current[p.PublicKey] = p
+	}
+	var steps []planStep
+	for _, want := range doc.Peers {
+		if !withTags {
+			want.Tags, want.Disabled = nil, false
+		}
+		have, ok := current[want.PublicKey]
+		delete(current, want.PublicKey)
+		if !withTags {
+			have.Disabled = false
+		}
+		if !ok {
+			steps = append(steps, planStep{Op: "add", Peer: want, Detail: strings.Join(want.AllowedIPs, ",")})
+			if want.Disabled {
+				steps = append(steps, planStep{Op: "disable", Peer: want})
+			}
+			continue
+		}
+		diffs := peerDiff(have, want, withTags)
+		if have.Disabled && (!want.Disabled || len(diffs) > 0) {
+			steps = append(steps, planStep{Op: "enable", Peer: want})
+		}
+		if len(diffs) > 0 {
+			steps = append(steps, planStep{Op: "change", Peer: want, Detail: strings.Join(diffs, "; ")})
+		}
+		if want.Disabled && (!have.Disabled || len(diffs) > 0) {
+			steps = append(steps, planStep{Op: "disable", Peer: want})
+		}
+	}
+	if prune {
+		var removed []planStep
+		for key := range current {
+			removed = append(removed, planStep{Op: "remove", Peer: peerSpec{PublicKey: key}})
+		}
+		slices.SortFunc(removed, func(a, b planStep) int { return strings.Compare(a.Peer.PublicKey, b.Peer.PublicKey) })
+		steps = append(steps, removed...)
+	}
+	return steps
+}
+
+// peerDiff 列出需要修改的字段
+func peerDiff(have client.PeerInfo, want peerSpec, withTags bool) []string {
+	var diffs []string
+	if !sameSet(have.AllowedIPs, want.AllowedIPs) {
+		diffs = append(diffs, fmt.Sprintf("allowed_ips %s -> %s", strings.Join(have.AllowedIPs, ","), strings.Join(want.AllowedIPs, ",")))
+	}
+	if want.Endpoint != "" && want.Endpoint != have.Endpoint {
+		diffs = append(diffs, fmt.Sprintf("endpoint %s -> %s", have.Endpoint, want.Endpoint))
+	}
+	if int(have.KeepaliveInterval) != want.Keepalive {
+		diffs = append(diffs, fmt.Sprintf("keepalive %d -> %d", have.KeepaliveInterval, want.Keepalive))
+	}
+	if withTags && !sameSet(have.Tags, want.Tags) {
+		diffs = append(diffs, fmt.Sprintf("tags [%s] -> [%s]", strings.Join(have.Tags, ","), strings.Join(want.Tags, ",")))
+	}
+	return diffs
+}
+
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// applyPlan 按顺序执行计划，遇到错误即停止
+func applyPlan(ctx context.Context, b cliBackend, steps []planStep, out io.Writer) error {
+	for _, s := range steps {
+		var err error
+		switch s.Op {
+		case "add", "change":
+			err = b.PutPeer(ctx, client.PeerAddRequest{
+				PublicKey:  s.Peer.PublicKey,
+				AllowedIPs: s.Peer.AllowedIPs,
+				Endpoint:   s.Peer.Endpoint,
+				Keepalive:  s.Peer.Keepalive,
+				Tags:       s.Peer.Tags,
+			})
+		case "enable", "disable":
+			err = b.SetPeerDisabled(ctx, s.Peer.PublicKey, s.Op == "disable")
+		case "remove":
+			err = b.RemovePeer(ctx, s.Peer.PublicKey)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", s.Op, s.Peer.PublicKey, err)
+		}
+		fmt.Fprintln(out, s)
+	}
+	return nil
+}
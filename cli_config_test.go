@@ -0,0 +1,61 @@
+//go:build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"golang.zx2c4.com/wireguard/manager/client"
+)
+
+func TestPlanConfig(t *testing.T) {
+	const (
+		keyA = "dFQ9wGQLb3GmwlNEUEKpjIeI5GOyimwybi3V5kINm0w="
+		keyB = "YRnDDuRGxrBc/o03lTuHZgxZU2VeawqTtrgzZGs8oQk="
+		keyC = "LCIlAlVMoxhf9ctyZTINH/nkFDhWdkvLejhaIePD6A8="
+	)
+	info := client.DeviceInfo{Peers: []client.PeerInfo{
+		{PublicKey: keyA, AllowedIPs: []string{"10.0.0.2/32"}, Endpoint: "198.51.100.7:51820", KeepaliveInterval: 25, Tags: []string{"iot"}},
+		{PublicKey: keyB, AllowedIPs: []string{"10.0.0.3/32"}, Disabled: true},
+	}}
+	doc := configDocument{Peers: []peerSpec{
+		// 端点未声明时不比较，标签顺序无关
+		{PublicKey: keyA, AllowedIPs: []string{"10.0.0.2/32"}, Keepalive: 25, Tags: []string{"iot"}},
+		{PublicKey: keyC, AllowedIPs: []string{"10.0.0.4/32"}, Disabled: true},
+	}}
+
+	ops := func(steps []planStep) []string {
+		var out []string
+		for _, s := range steps {
+			out = append(out, s.Op+" "+s.Peer.PublicKey)
+		}
+		return out
+	}
+	check := func(name string, got, want []string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %q, want %q", name, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got %q, want %q", name, got, want)
+			}
+		}
+	}
+
+	check("apply", ops(planConfig(info, doc, true, true)), []string{"add " + keyC, "disable " + keyC, "remove " + keyB})
+	check("import", ops(planConfig(info, doc, false, true)), []string{"add " + keyC, "disable " + keyC})
+
+	// 已停用的 Peer 需要修改时先启用、改完再停用
+	doc.Peers = append(doc.Peers, peerSpec{PublicKey: keyB, AllowedIPs: []string{"10.0.0.30/32"}, Disabled: true})
+	check("change disabled", ops(planConfig(info, doc, true, true)), []string{"add " + keyC, "disable " + keyC, "enable " + keyB, "change " + keyB, "disable " + keyB})
+
+	// UAPI 不比较标签与停用状态
+	doc.Peers[0].Tags = []string{"lab"}
+	check("uapi", ops(planConfig(info, doc, true, false)), []string{"add " + keyC, "change " + keyB})
+}
@@ -0,0 +1,111 @@
+//go:build !windows
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRunCtlDispatch(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, ExitCLIUsage},
+		{[]string{"help"}, ExitSetupSuccess},
+		{[]string{"--help"}, ExitSetupSuccess},
+		{[]string{"wg0"}, ExitCLIUsage},
+		{[]string{"peer"}, ExitCLIUsage},
+		{[]string{"stun", "query"}, ExitCLIUsage},
+	}
+	for _, tt := range tests {
+		if got := runCtl(tt.args); got != tt.want {
+			t.Errorf("runCtl(%q) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCLIParse(t *testing.T) {
+	o := &cliOptions{}
+	fs := o.flagSet("peer add")
+	var allowedIPs stringList
+	fs.Var(&allowedIPs, "allowed-ip", "")
+	rest, err := o.parse(fs, []string{"KEY", "--allowed-ip", "10.0.0.2/32, 10.0.1.0/24", "--json", "--allowed-ip=fd00::2/128", "extra"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"KEY", "extra"}) || !o.json {
+		t.Errorf("positional %q, json %v", rest, o.json)
+	}
+	if want := (stringList{"10.0.0.2/32", "10.0.1.0/24", "fd00::2/128"}); !reflect.DeepEqual(allowedIPs, want) {
+		t.Errorf("allowed IPs %q, want %q", allowedIPs, want)
+	}
+	if _, err := o.parse(o.flagSet("status"), []string{"--no-such-flag"}); err == nil {
+		t.Error("unknown flag accepted")
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+		{2 << 50, "2.0 PiB"},
+	}
+	for _, tt := range tests {
+		if got := humanBytes(tt.n); got != tt.want {
+			t.Errorf("humanBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	t.Setenv("WG_INTERFACE", "")
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status >= 400 {
+			fmt.Fprintf(w, `{"error":{"status":%d,"code":"x","message":"failed"}}`, status)
+		}
+	}))
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		status int
+		api    string
+		want   int
+	}{
+		{http.StatusNoContent, srv.URL, ExitSetupSuccess},
+		{http.StatusBadRequest, srv.URL, ExitCLIUsage},
+		{http.StatusUnauthorized, srv.URL, ExitCLIAuth},
+		{http.StatusForbidden, srv.URL, ExitCLIAuth},
+		{http.StatusNotFound, srv.URL, ExitCLINotFound},
+		{http.StatusConflict, srv.URL, ExitCLIConflict},
+		{http.StatusInternalServerError, srv.URL, ExitSetupFailed},
+		{0, down.URL, ExitCLIUnavailable},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		if got := runCtl([]string{"peer", "remove", "--api", tt.api, "--json", "KEY"}); got != tt.want {
+			t.Errorf("HTTP %d from %s: exit %d, want %d", tt.status, tt.api, got, tt.want)
+		}
+	}
+	srv.Close()
+}
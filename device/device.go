@@ -103,6 +103,21 @@ type Device struct {
 	ipcMutex sync.RWMutex  // IPC操作互斥锁，保护配置变更
 	closed   chan struct{} // 设备关闭信号通道
 	log      *Logger       // 日志记录器
+
+	stray atomic.Pointer[StrayPacketHandler] // 非 WireGuard 报文的处理函数 (如 STUN 回复)，nil 为丢弃
+
+	// TUN 读取协程的运行状态，供健康检查使用
+	tunReader struct {
+		running atomic.Bool
+		err     atomic.Pointer[error] // 导致读取协程退出的错误
+	}
+
+	// 事件订阅者，写时复制，收发包协程无锁读取
+	events struct {
+		sync.Mutex
+		subs atomic.Pointer[[]*Subscription]
+		mask atomic.Uint32 // 所有订阅者关心的事件类型
+	}
 }
 
 // deviceState 表示设备的状态
@@ -159,6 +174,7 @@ func removePeerLocked(device *Device, peer *Peer, key NoisePublicKey) {
 
 	// 从对等体映射表中移除
 	delete(device.peers.keyMap, key)
+	peer.emit(Event{Type: EventPeerRemoved})
 }
 
 // changeState 尝试将设备状态更改为指定的目标状态
@@ -204,7 +220,15 @@ func (device *Device) changeState(want deviceState) (err error) {
 	}
 
 	// 记录状态转换信息
-	device.log.Verbosef("Interface state was %s, requested %s, now %s", old, want, device.deviceState())
+	now := device.deviceState()
+	device.log.Verbosef("Interface state was %s, requested %s, now %s", old, want, now)
+	if now != old {
+		if now == deviceStateUp {
+			device.emit(Event{Type: EventDeviceUp})
+		} else {
+			device.emit(Event{Type: EventDeviceDown})
+		}
+	}
 	return
 }
 
@@ -489,8 +513,12 @@ func (device *Device) Close() {
 	}
 
 	// 设置设备状态为已关闭，这个状态是不可逆的
+	wasUp := device.isUp()
 	device.state.state.Store(uint32(deviceStateClosed))
 	device.log.Verbosef("Device closing")
+	if wasUp {
+		device.emit(Event{Type: EventDeviceDown})
+	}
 
 	// 关闭TUN设备接口
 	device.tun.device.Close()
@@ -516,6 +544,8 @@ func (device *Device) Close() {
 	device.rate.limiter.Close()
 
 	device.log.Verbosef("Device closed")
+	// 关闭所有事件订阅，订阅者的通道随之关闭
+	device.closeSubscriptions()
 	// 关闭设备的关闭信号通道，通知所有等待者
 	close(device.closed)
 }
@@ -15,6 +15,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -474,3 +475,72 @@ func TestBatchSize(t *testing.T) {
 		t.Errorf("expected batch size %d, got %d", want, got)
 	}
 }
+
+func TestPeerStats(t *testing.T) {
+	pair := genTestPair(t, false)
+	key0, key1 := pair[0].dev.staticIdentity.publicKey, pair[1].dev.staticIdentity.publicKey
+	peer0, peer1 := pair[0].dev.LookupPeer(key1), pair[1].dev.LookupPeer(key0)
+	pair.Send(t, Ping, nil)
+	pair.Send(t, Pong, nil)
+
+	st0, st1 := peer0.GetStats(), peer1.GetStats()
+	if st1.HandshakesSent == 0 || st0.HandshakesReceived == 0 {
+		t.Errorf("handshake not counted: sent %d, received %d", st1.HandshakesSent, st0.HandshakesReceived)
+	}
+	if st0.TxPackets == 0 || st0.RxPackets == 0 || st1.TxPackets == 0 || st1.RxPackets == 0 {
+		t.Errorf("packets not counted: %+v, %+v", st0, st1)
+	}
+
+	// A source address outside dev0's AllowedIPs for peer0 is dropped after decryption.
+	pair[1].tun.Outbound <- tuntest.Ping(pair[0].ip, netip.MustParseAddr("1.0.0.9"))
+	deadline := time.Now().Add(5 * time.Second)
+	for peer0.GetStats().DropAllowedIPs == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("AllowedIPs drop not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cfg, err := pair[0].dev.IpcGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st0 = peer0.GetStats()
+	for _, want := range []string{
+		fmt.Sprintf("rx_packets=%d\n", st0.RxPackets),
+		"drop_allowed_ips=1\n",
+		fmt.Sprintf("handshakes_received=%d\n", st0.HandshakesReceived),
+		"rekeys=0\n",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("IpcGet output missing %q:\n%s", want, cfg)
+		}
+	}
+}
+
+func TestStagedFlushDrops(t *testing.T) {
+	pair := genTestPair(t, false)
+	peer := pair[0].dev.LookupPeer(pair[1].dev.staticIdentity.publicKey)
+	stage := func(n int) {
+		elems := pair[0].dev.GetOutboundElementsContainer()
+		for i := 0; i < n; i++ {
+			elems.elems = append(elems.elems, pair[0].dev.NewOutboundElement())
+		}
+		peer.StagePackets(elems)
+	}
+
+	// Packets still staged when the peer stops are not a failure.
+	stage(3)
+	peer.Stop()
+	if got := peer.GetStats().DropNoKeypair; got != 0 {
+		t.Errorf("DropNoKeypair after Stop = %d, want 0", got)
+	}
+
+	// Giving up on the handshake drops them for lack of a keypair.
+	stage(2)
+	peer.timers.handshakeAttempts.Store(MaxTimerHandshakes + 1)
+	expiredRetransmitHandshake(peer)
+	if got := peer.GetStats().DropNoKeypair; got != 2 {
+		t.Errorf("DropNoKeypair after handshake give-up = %d, want 2", got)
+	}
+}
@@ -0,0 +1,249 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"encoding/base64"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// EventType 设备事件类型
+type EventType uint8
+
+const (
+	EventPeerCreated        EventType = iota + 1 // 添加 Peer
+	EventPeerRemoved                             // 移除 Peer
+	EventHandshakeInitiated                      // 发出握手请求 (含重试)
+	EventHandshakeCompleted                      // 握手完成，新会话可用
+	EventHandshakeFailed                         // 重试次数用尽，放弃握手
+	EventKeypairRotated                          // 新会话密钥替换了仍在使用的旧密钥
+	EventEndpointChanged                         // 端点变化 (漫游或经 UAPI 设置)
+	EventFirstData                               // 空闲后收到的第一个数据包
+	EventKeepaliveReceived                       // 收到 keepalive
+	EventDeviceUp                                // 设备启用
+	EventDeviceDown                              // 设备停用或关闭
+)
+
+// DefaultEventQueueSize Subscribe 未指定队列长度时使用的默认值
+const DefaultEventQueueSize = 256
+
+// eventIdleTimeout 超过该时间没有收到数据包视为空闲，与 WireGuard 判断对端无响应的时间一致
+const eventIdleTimeout = KeepaliveTimeout + RekeyTimeout
+
+var eventTypeNames = [...]string{
+	EventPeerCreated:        "peer-created",
+	EventPeerRemoved:        "peer-removed",
+	EventHandshakeInitiated: "handshake-initiated",
+	EventHandshakeCompleted: "handshake-completed",
+	EventHandshakeFailed:    "handshake-failed",
+	EventKeypairRotated:     "keypair-rotated",
+	EventEndpointChanged:    "endpoint-changed",
+	EventFirstData:          "first-data",
+	EventKeepaliveReceived:  "keepalive-received",
+	EventDeviceUp:           "device-up",
+	EventDeviceDown:         "device-down",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypeNames) && eventTypeNames[t] != "" {
+		return eventTypeNames[t]
+	}
+	return "unknown"
+}
+
+// Event 设备事件；设备级事件 (启用、停用) 的 Peer 为 nil
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	Peer      *Peer  // 事件所属的 Peer，移除后仍可读取统计
+	PublicKey string // Peer 公钥 (Base64)
+
+	Endpoint    string        // EventEndpointChanged: 新端点；EventHandshakeInitiated: 发送目标
+	OldEndpoint string        // EventEndpointChanged: 旧端点，首次设置时为空
+	Attempt     uint32        // EventHandshakeInitiated: 第几次尝试；EventHandshakeFailed: 总尝试次数
+	Initiator   bool          // EventHandshakeCompleted / EventKeypairRotated: 本端是否为发起方
+	Idle        time.Duration // EventFirstData: 距上一个数据包的时间，首次收到时为 0
+}
+
+// Subscription 事件订阅。队列满时新事件被丢弃并计数，不会阻塞收发包协程
+type Subscription struct {
+	device  *Device
+	mask    uint32
+	c       chan Event
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Events 返回事件通道，Close 或设备关闭后通道被关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Dropped 返回因队列已满而丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close 取消订阅并关闭事件通道，可重复调用
+func (s *Subscription) Close() {
+	s.device.unsubscribe(s)
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
+
+// deliver 非阻塞地投递事件
+func (s *Subscription) deliver(ev Event) {
+	if s.mask&(1<<ev.Type) == 0 {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.c <- ev:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Subscribe 订阅设备事件，size 为队列长度 (<= 0 时为 DefaultEventQueueSize)，types 为空时订阅全部类型
+// 设备已关闭时返回的订阅通道已关闭
+func (device *Device) Subscribe(size int, types ...EventType) *Subscription {
+	if size <= 0 {
+		size = DefaultEventQueueSize
+	}
+	s := &Subscription{device: device, c: make(chan Event, size)}
+	for _, t := range types {
+		s.mask |= 1 << t
+	}
+	if len(types) == 0 {
+		s.mask = ^uint32(0)
+	}
+
+	device.events.Lock()
+	defer device.events.Unlock()
+	if device.isClosed() {
+		s.close()
+		return s
+	}
+	subs := append(slices.Clip(device.eventSubscribers()), s)
+	device.events.subs.Store(&subs)
+	device.events.mask.Store(device.events.mask.Load() | s.mask)
+	return s
+}
+
+func (device *Device) unsubscribe(s *Subscription) {
+	device.events.Lock()
+	defer device.events.Unlock()
+	var subs []*Subscription
+	var mask uint32
+	for _, sub := range device.eventSubscribers() {
+		if sub != s {
+			subs = append(subs, sub)
+			mask |= sub.mask
+		}
+	}
+	device.events.subs.Store(&subs)
+	device.events.mask.Store(mask)
+}
+
+// closeSubscriptions 设备关闭时关闭所有订阅
+func (device *Device) closeSubscriptions() {
+	device.events.Lock()
+	defer device.events.Unlock()
+	for _, s := range device.eventSubscribers() {
+		s.close()
+	}
+	device.events.subs.Store(nil)
+	device.events.mask.Store(0)
+}
+
+func (device *Device) eventSubscribers() []*Subscription {
+	if subs := device.events.subs.Load(); subs != nil {
+		return *subs
+	}
+	return nil
+}
+
+// subscribed 是否有订阅者关心该类型，用于在热路径上跳过事件的构造
+func (device *Device) subscribed(t EventType) bool {
+	return device.events.mask.Load()&(1<<t) != 0
+}
+
+// emit 向所有订阅者投递事件，不会阻塞；调用方可能持有设备或 Peer 的锁
+func (device *Device) emit(ev Event) {
+	if !device.subscribed(ev.Type) {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for _, s := range device.eventSubscribers() {
+		s.deliver(ev)
+	}
+}
+
+// emit 投递 Peer 事件
+// remoteStatic 在创建 Peer 后不再修改，因此无需持有握手锁，调用方可能已持有它
+func (peer *Peer) emit(ev Event) {
+	if !peer.device.subscribed(ev.Type) {
+		return
+	}
+	ev.Peer = peer
+	ev.PublicKey = base64.StdEncoding.EncodeToString(peer.handshake.remoteStatic[:])
+	peer.device.emit(ev)
+}
+
+// markDataReceived 记录收到数据包的时间，空闲超过 eventIdleTimeout 后的第一个数据包发布 EventFirstData
+func (peer *Peer) markDataReceived() {
+	now := time.Now().UnixNano()
+	last := peer.lastDataNano.Swap(now)
+	if last == 0 {
+		peer.emit(Event{Type: EventFirstData})
+	} else if idle := time.Duration(now - last); idle > eventIdleTimeout {
+		peer.emit(Event{Type: EventFirstData, Idle: idle})
+	}
+}
+
+// endpointString 端点的地址与端口，nil 为空
+func endpointString(ep conn.Endpoint) string {
+	if ep == nil {
+		return ""
+	}
+	return ep.DstToString()
+}
+
+// sameEndpoint 两个端点的目标地址与端口是否相同
+// 每个入站报文都会调用，常见的 StdNetEndpoint 直接比较地址，避免格式化字符串
+func sameEndpoint(a, b conn.Endpoint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	type addrPort interface{ Port() uint16 }
+	if pa, ok := a.(addrPort); ok {
+		if pb, ok := b.(addrPort); ok {
+			return a.DstIP() == b.DstIP() && pa.Port() == pb.Port()
+		}
+	}
+	return a.DstToString() == b.DstToString()
+}
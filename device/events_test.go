@@ -0,0 +1,284 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// waitEvent reads events from s until one matches, failing after a timeout.
+func waitEvent(t *testing.T, s *Subscription, match func(Event) bool) Event {
+	t.Helper()
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case ev, ok := <-s.Events():
+			if !ok {
+				t.Fatal("subscription closed")
+			}
+			if match(ev) {
+				return ev
+			}
+		case <-timer.C:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func eventIs(typ EventType) func(Event) bool {
+	return func(ev Event) bool { return ev.Type == typ }
+}
+
+func TestDeviceEvents(t *testing.T) {
+	goroutineLeakCheck(t)
+	pair := genTestPair(t, false)
+	var subs [2]*Subscription
+	for i := range pair {
+		subs[i] = pair[i].dev.Subscribe(0)
+	}
+	key0, key1 := pair[0].dev.staticIdentity.publicKey, pair[1].dev.staticIdentity.publicKey
+	peer0, peer1 := pair[0].dev.LookupPeer(key1), pair[1].dev.LookupPeer(key0)
+
+	// dev1 initiates the handshake; dev0 confirms it when the first packet under the new keypair arrives.
+	pair.Send(t, Ping, nil)
+	ev := waitEvent(t, subs[1], eventIs(EventHandshakeInitiated))
+	if ev.Peer != peer1 || ev.Attempt != 1 || ev.Endpoint == "" {
+		t.Errorf("unexpected initiation event: %+v", ev)
+	}
+	if ev := waitEvent(t, subs[1], eventIs(EventHandshakeCompleted)); !ev.Initiator {
+		t.Error("initiator side reported as responder")
+	}
+	ev = waitEvent(t, subs[0], eventIs(EventHandshakeCompleted))
+	if ev.Initiator || ev.Peer != peer0 || ev.PublicKey != pair[1].dev.GetPublicKey() {
+		t.Errorf("unexpected responder completion event: %+v", ev)
+	}
+	if ev := waitEvent(t, subs[0], eventIs(EventFirstData)); ev.Idle != 0 {
+		t.Errorf("first data ever reported idle %v", ev.Idle)
+	}
+
+	peer1.SendKeepalive()
+	waitEvent(t, subs[0], eventIs(EventKeepaliveReceived))
+
+	// A configured endpoint change, then roaming back once dev1 sends again.
+	original := peer0.GetEndpoint()
+	if err := pair[0].dev.IpcSet(uapiCfg("public_key", hex.EncodeToString(key1[:]), "endpoint", "127.0.0.1:9")); err != nil {
+		t.Fatal(err)
+	}
+	ev = waitEvent(t, subs[0], eventIs(EventEndpointChanged))
+	if ev.OldEndpoint != original || ev.Endpoint != "127.0.0.1:9" {
+		t.Errorf("endpoint change = %q -> %q, want %q -> 127.0.0.1:9", ev.OldEndpoint, ev.Endpoint, original)
+	}
+	pair.Send(t, Ping, nil)
+	ev = waitEvent(t, subs[0], eventIs(EventEndpointChanged))
+	if ev.OldEndpoint != "127.0.0.1:9" || ev.Endpoint != peer0.GetEndpoint() {
+		t.Errorf("roaming = %q -> %q, want 127.0.0.1:9 -> %q", ev.OldEndpoint, ev.Endpoint, peer0.GetEndpoint())
+	}
+
+	// Peer lifecycle.
+	extra, _ := newPrivateKey()
+	extraPub := extra.publicKey()
+	if err := pair[0].dev.IpcSet(uapiCfg("public_key", hex.EncodeToString(extraPub[:]))); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, subs[0], func(ev Event) bool { return ev.Type == EventPeerCreated && ev.Peer.handshake.remoteStatic == extraPub })
+	if err := pair[0].dev.IpcSet(uapiCfg("public_key", hex.EncodeToString(extraPub[:]), "remove", "true")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, subs[0], func(ev Event) bool { return ev.Type == EventPeerRemoved && ev.Peer.handshake.remoteStatic == extraPub })
+
+	// Device state, with a filtered subscription alongside.
+	upOnly := pair[0].dev.Subscribe(0, EventDeviceUp)
+	pair[0].dev.Down()
+	waitEvent(t, subs[0], eventIs(EventDeviceDown))
+	pair[0].dev.Up()
+	waitEvent(t, subs[0], eventIs(EventDeviceUp))
+	if ev := waitEvent(t, upOnly, func(Event) bool { return true }); ev.Type != EventDeviceUp {
+		t.Errorf("filtered subscription received %v", ev.Type)
+	}
+	upOnly.Close()
+	upOnly.Close()
+	if _, ok := <-upOnly.Events(); ok {
+		t.Error("closed subscription still delivers events")
+	}
+
+	// Closing the device closes every subscription.
+	pair[0].dev.Close()
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	for closed := false; !closed; {
+		select {
+		case _, ok := <-subs[0].Events():
+			closed = !ok
+		case <-timer.C:
+			t.Fatal("subscription not closed with the device")
+		}
+	}
+	if _, ok := <-pair[0].dev.Subscribe(0).Events(); ok {
+		t.Error("subscribing to a closed device returned an open channel")
+	}
+	subs[1].Close()
+}
+
+func TestDeviceEventsDropWhenFull(t *testing.T) {
+	pair := genTestPair(t, false)
+	key0 := pair[0].dev.staticIdentity.publicKey
+	pair.Send(t, Ping, nil)
+
+	s := pair[0].dev.Subscribe(1, EventKeepaliveReceived)
+	defer s.Close()
+	peer := pair[1].dev.LookupPeer(key0)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Dropped() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no events dropped from a full queue")
+		}
+		peer.SendKeepalive()
+		time.Sleep(time.Millisecond)
+	}
+	if len(s.Events()) != 1 {
+		t.Errorf("queue holds %d events, want 1", len(s.Events()))
+	}
+}
+
+func TestUAPIWatch(t *testing.T) {
+	pair := genTestPair(t, false)
+	dev := pair[0].dev
+	key1 := pair[1].dev.staticIdentity.publicKey
+	client, server := net.Pipe()
+	defer client.Close()
+	go dev.IpcHandle(server)
+	r := bufio.NewReader(client)
+	readRecord := func() map[string]string {
+		t.Helper()
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		rec := make(map[string]string)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return rec
+			}
+			k, v, _ := strings.Cut(strings.TrimSuffix(line, "\n"), "=")
+			rec[k] = v
+		}
+	}
+
+	if _, err := client.Write([]byte("watch=1\npublic_key=" + hex.EncodeToString(key1[:]) + "\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	if rec := readRecord(); rec["errno"] != "0" {
+		t.Fatalf("watch not acknowledged: %v", rec)
+	}
+
+	// Events of peers outside the filter are not streamed.
+	extra, _ := newPrivateKey()
+	extraPub := extra.publicKey()
+	if err := dev.IpcSet(uapiCfg("public_key", hex.EncodeToString(extraPub[:]))); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.IpcSet(uapiCfg("public_key", hex.EncodeToString(key1[:]), "endpoint", "127.0.0.1:9")); err != nil {
+		t.Fatal(err)
+	}
+	rec := readRecord()
+	if rec["event"] != "endpoint" || rec["public_key"] != hex.EncodeToString(key1[:]) || rec["endpoint"] != "127.0.0.1:9" || rec["old_endpoint"] == "" || rec["time_sec"] == "" {
+		t.Errorf("unexpected endpoint record: %v", rec)
+	}
+	if err := dev.IpcSet(uapiCfg("public_key", hex.EncodeToString(key1[:]), "remove", "true")); err != nil {
+		t.Fatal(err)
+	}
+	if rec := readRecord(); rec["event"] != "peer_remove" {
+		t.Errorf("unexpected record: %v", rec)
+	}
+}
+
+func TestUAPIWatchInvalid(t *testing.T) {
+	pair := genTestPair(t, false)
+	client, server := net.Pipe()
+	defer client.Close()
+	go pair[0].dev.IpcHandle(server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	// The rest of an invalid request is consumed, so the connection stays usable.
+	if _, err := client.Write([]byte("watch=1\nlisten_port=1\npublic_key=00\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(client)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("errno=%d\n", ipc.IpcErrorInvalid); line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+	r.ReadString('\n')
+	go client.Write([]byte("get=1\n\n"))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "errno=") {
+			if line != "errno=0\n" {
+				t.Errorf("get after invalid watch returned %q", line)
+			}
+			break
+		}
+	}
+}
+
+func TestReadWatchRequest(t *testing.T) {
+	k1, _ := newPrivateKey()
+	k2, _ := newPrivateKey()
+	pub1, pub2 := k1.publicKey(), k2.publicKey()
+	hex1, hex2 := hex.EncodeToString(pub1[:]), hex.EncodeToString(pub2[:])
+	tests := []struct {
+		name   string
+		input  string
+		filter []NoisePublicKey
+		errno  int64
+		rest   string // what the next read returns
+	}{
+		{"no filter", "\nget=1\n", nil, 0, "get=1\n"},
+		{"one peer", "public_key=" + hex1 + "\n\n", []NoisePublicKey{pub1}, 0, ""},
+		{"repeated key", "public_key=" + hex1 + "\npublic_key=" + hex2 + "\npublic_key=" + hex1 + "\n\n", []NoisePublicKey{pub1, pub2}, 0, ""},
+		{"bad key", "public_key=zz\npublic_key=" + hex1 + "\n\nget=1\n", nil, ipc.IpcErrorInvalid, "get=1\n"},
+		{"other key", "listen_port=1\n\nget=1\n", nil, ipc.IpcErrorInvalid, "get=1\n"},
+		{"no separator", "public_key\n\n", nil, ipc.IpcErrorProtocol, ""},
+		{"truncated", "public_key=" + hex1 + "\n", nil, ipc.IpcErrorIO, ""},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.input))
+		filter, err := readWatchRequest(r)
+		var errno int64
+		if err != nil {
+			errno = err.(*IPCError).ErrorCode()
+		}
+		if errno != tt.errno {
+			t.Errorf("%s: %v, want errno %d", tt.name, err, tt.errno)
+		}
+		if len(filter) != len(tt.filter) {
+			t.Errorf("%s: filter %v", tt.name, filter)
+		}
+		for _, pk := range tt.filter {
+			if !filter[pk] {
+				t.Errorf("%s: %x not in filter", tt.name, pk[:])
+			}
+		}
+		if rest, _ := r.ReadString('\n'); rest != tt.rest {
+			t.Errorf("%s: next line %q, want %q", tt.name, rest, tt.rest)
+		}
+	}
+}
@@ -7,8 +7,12 @@ package device
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/netip"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/conn"
 )
 
 // ========= Device 暴露接口 =========
@@ -57,6 +61,111 @@ func (d *Device) GetAllowedIPs() *AllowedIPs {
 	return &d.allowedips
 }
 
+// IsUp 设备是否处于运行状态
+func (d *Device) IsUp() bool {
+	return d.isUp()
+}
+
+// State 设备状态：up / down / closed
+func (d *Device) State() string {
+	return strings.ToLower(d.deviceState().String())
+}
+
+// BindHealth 设备运行且 UDP 套接字已打开时返回监听端口
+func (d *Device) BindHealth() (uint16, error) {
+	d.net.RLock()
+	defer d.net.RUnlock()
+	if !d.isUp() {
+		return 0, errors.New("device is not up")
+	}
+	if d.net.bind == nil || d.net.port == 0 {
+		return 0, errors.New("bind is not open")
+	}
+	return d.net.port, nil
+}
+
+// TUNHealth TUN 读取协程在运行且网卡仍可查询时返回 nil
+func (d *Device) TUNHealth() error {
+	if !d.tunReader.running.Load() {
+		if err := d.tunReader.err.Load(); err != nil {
+			return fmt.Errorf("TUN reader stopped: %w", *err)
+		}
+		return errors.New("TUN reader is not running")
+	}
+	if _, err := d.tun.device.MTU(); err != nil {
+		return fmt.Errorf("TUN device: %w", err)
+	}
+	return nil
+}
+
+// QueueStat 队列当前长度与容量
+type QueueStat struct {
+	Name string
+	Len  int
+	Cap  int
+}
+
+// GetQueueStats 返回设备级加密、解密、握手队列的占用
+func (d *Device) GetQueueStats() []QueueStat {
+	stats := []QueueStat{{Name: "handshake"}, {Name: "encryption"}, {Name: "decryption"}}
+	if q := d.queue.handshake; q != nil {
+		stats[0].Len, stats[0].Cap = len(q.c), cap(q.c)
+	}
+	if q := d.queue.encryption; q != nil {
+		stats[1].Len, stats[1].Cap = len(q.c), cap(q.c)
+	}
+	if q := d.queue.decryption; q != nil {
+		stats[2].Len, stats[2].Cap = len(q.c), cap(q.c)
+	}
+	return stats
+}
+
+// GetPoolStats 返回各对象池当前借出的数量
+// 不设上限的池子 (PreallocatedBuffersPerPool 为 0 的平台) 不计数，以免在收发路径上增加共享的原子操作，
+// 此时返回空表
+func (d *Device) GetPoolStats() map[string]uint32 {
+	stats := make(map[string]uint32)
+	for name, pool := range map[string]*WaitPool{
+		"inbound_elements_container":  d.pool.inboundElementsContainer,
+		"outbound_elements_container": d.pool.outboundElementsContainer,
+		"message_buffers":             d.pool.messageBuffers,
+		"inbound_elements":            d.pool.inboundElements,
+		"outbound_elements":           d.pool.outboundElements,
+	} {
+		if n, ok := pool.InUse(); ok {
+			stats[name] = n
+		}
+	}
+	return stats
+}
+
+// StrayPacketHandler 处理监听端口上收到的非 WireGuard 报文，packet 在返回后会被复用
+type StrayPacketHandler func(packet []byte, src conn.Endpoint)
+
+// SetStrayPacketHandler 注册非 WireGuard 报文的处理函数，nil 为恢复丢弃
+func (d *Device) SetStrayPacketHandler(h StrayPacketHandler) {
+	if h == nil {
+		d.stray.Store(nil)
+		return
+	}
+	d.stray.Store(&h)
+}
+
+// SendRaw 从 WireGuard 监听套接字向 dst 发送一个原始 UDP 报文
+// 用于 STUN 等需要与 WireGuard 共用 NAT 映射的探测
+func (d *Device) SendRaw(packet []byte, dst netip.AddrPort) error {
+	d.net.RLock()
+	defer d.net.RUnlock()
+	if d.net.bind == nil || !d.isUp() {
+		return errors.New("device is not listening")
+	}
+	ep, err := d.net.bind.ParseEndpoint(dst.String())
+	if err != nil {
+		return err
+	}
+	return d.net.bind.Send([][]byte{packet}, ep)
+}
+
 func (d *Device) GetInterfaceName() (string, error) {
 	return d.tun.device.Name()
 }
@@ -91,6 +200,11 @@ func (p *Peer) GetLastHandshakeNano() int64 {
 	return p.lastHandshakeNano.Load()
 }
 
+// GetLastReceiveNano 返回最后一次收到该对等体数据包的纳秒时间戳，从未收到为 0
+func (p *Peer) GetLastReceiveNano() int64 {
+	return p.lastReceiveNano.Load()
+}
+
 func (p *Peer) GetTrafficStats() (tx, rx uint64) {
 	return p.txBytes.Load(), p.rxBytes.Load()
 }
@@ -102,3 +216,49 @@ func (p *Peer) GetIsRunning() bool {
 func (p *Peer) GetKeepaliveInterval() uint32 {
 	return p.persistentKeepaliveInterval.Load()
 }
+
+// GetHandshakeAttempts 返回当前握手的重试次数，握手成功后清零
+func (p *Peer) GetHandshakeAttempts() uint32 {
+	return p.timers.handshakeAttempts.Load()
+}
+
+// PeerStats Peer 的流量、丢包与握手计数，均从 Peer 创建时开始累计
+type PeerStats struct {
+	TxBytes   uint64
+	RxBytes   uint64
+	TxPackets uint64 // 发出的 UDP 报文数 (含握手)
+	RxPackets uint64 // 收到并通过认证的报文数 (含握手与保活)
+
+	// 按原因统计的丢包数
+	DropAllowedIPs     uint64 // 内层源地址不在该 Peer 的 AllowedIPs 中
+	DropReplay         uint64 // 重放或落在重放窗口之外
+	DropDecrypt        uint64 // 解密或认证失败
+	DropStagedOverflow uint64 // 等待握手的暂存队列已满
+	DropNoKeypair      uint64 // 握手失败，等待会话密钥的包被丢弃
+	DropOversize       uint64 // 内层包过大，无法封装进一个 UDP 报文
+
+	HandshakesSent     uint64 // 发出的握手请求 (含重试)
+	HandshakesReceived uint64 // 收到的有效握手请求
+	HandshakesFailed   uint64 // 重试次数用尽，放弃握手
+	Rekeys             uint64 // 新会话密钥替换旧密钥的次数
+}
+
+// GetStats 返回扩展计数器的快照
+func (p *Peer) GetStats() PeerStats {
+	return PeerStats{
+		TxBytes:            p.txBytes.Load(),
+		RxBytes:            p.rxBytes.Load(),
+		TxPackets:          p.stats.txPackets.Load(),
+		RxPackets:          p.stats.rxPackets.Load(),
+		DropAllowedIPs:     p.stats.dropAllowedIPs.Load(),
+		DropReplay:         p.stats.dropReplay.Load(),
+		DropDecrypt:        p.stats.dropDecrypt.Load(),
+		DropStagedOverflow: p.stats.dropStagedOverflow.Load(),
+		DropNoKeypair:      p.stats.dropNoKeypair.Load(),
+		DropOversize:       p.stats.dropOversize.Load(),
+		HandshakesSent:     p.stats.handshakesSent.Load(),
+		HandshakesReceived: p.stats.handshakesReceived.Load(),
+		HandshakesFailed:   p.stats.handshakesFailed.Load(),
+		Rekeys:             p.stats.rekeys.Load(),
+	}
+}
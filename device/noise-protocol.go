@@ -768,6 +768,10 @@ func (peer *Peer) BeginSymmetricSession() error {
 		}
 		device.DeleteKeypair(previous) // 更老的 Key 销毁
 		keypairs.current = keypair
+		if current != nil {
+			peer.stats.rekeys.Add(1)
+			peer.emit(Event{Type: EventKeypairRotated, Initiator: true})
+		}
 	} else {
 		// === 情况 B：我是 Responder ===
 		// “我很保守”。我虽然发了 Response，但不知道对方收到没。
@@ -836,5 +840,9 @@ func (peer *Peer) ReceivedWithKeypair(receivedKeypair *Keypair) bool {
 	//    在这个位置等待下一次握手产生的新 Key。
 	keypairs.next.Store(nil)
 
+	if keypairs.previous != nil {
+		peer.stats.rekeys.Add(1)
+		peer.emit(Event{Type: EventKeypairRotated})
+	}
 	return true
 }
@@ -30,6 +30,24 @@ type Peer struct {
 	txBytes           atomic.Uint64  // 发送到对等体的字节数统计（原子操作）
 	rxBytes           atomic.Uint64  // 从对等体接收的字节数统计（原子操作）
 	lastHandshakeNano atomic.Int64   // 最后一次握手的纳秒时间戳（从Unix纪元开始）
+	lastReceiveNano   atomic.Int64   // 最后一次收到通过认证的数据包（含握手与保活）的纳秒时间戳
+	lastDataNano      atomic.Int64   // 最后一次收到数据包（不含保活）的纳秒时间戳，用于空闲后首包事件
+
+	// 扩展计数器，用于排查流量不通的原因 (见 GetStats)
+	stats struct {
+		txPackets          atomic.Uint64 // 发出的 UDP 报文数 (含握手)
+		rxPackets          atomic.Uint64 // 收到并通过认证的报文数 (含握手与保活)
+		dropAllowedIPs     atomic.Uint64 // 内层源地址不在该 Peer 的 AllowedIPs 中
+		dropReplay         atomic.Uint64 // 计数器重复或落在重放窗口之外
+		dropDecrypt        atomic.Uint64 // 解密或认证失败
+		dropStagedOverflow atomic.Uint64 // 等待握手的暂存队列已满，最老的包被挤掉
+		dropNoKeypair      atomic.Uint64 // 握手失败时，仍在等待会话密钥的包被丢弃
+		dropOversize       atomic.Uint64 // 内层包超过 MaxContentSize，无法封装进一个 UDP 报文
+		handshakesSent     atomic.Uint64 // 发出的握手请求 (含重试)
+		handshakesReceived atomic.Uint64 // 收到的有效握手请求
+		handshakesFailed   atomic.Uint64 // 重试次数用尽，放弃握手
+		rekeys             atomic.Uint64 // 新会话密钥替换旧密钥的次数
+	}
 
 	// 端点信息结构体，包含网络连接相关配置
 	endpoint struct {
@@ -151,6 +169,7 @@ func (device *Device) NewPeer(pk NoisePublicKey) (*Peer, error) {
 	device.peers.keyMap[pk] = peer
 
 	device.log.Verbosef("%v - 哈基米启动", pkBase64)
+	peer.emit(Event{Type: EventPeerCreated})
 
 	return peer, nil
 }
@@ -198,6 +217,7 @@ func (peer *Peer) SendBuffers(buffers [][]byte) error {
 		}
 		// 原子地更新发送字节数计数器
 		peer.txBytes.Add(totalLen)
+		peer.stats.txPackets.Add(uint64(len(buffers)))
 	}
 	return err
 }
@@ -391,7 +411,16 @@ func (peer *Peer) SetEndpointFromPacket(endpoint conn.Endpoint) {
 
 	// 更新端点配置
 	peer.endpoint.clearSrcOnTx = false // 重置源地址清除标志
-	peer.endpoint.val = endpoint       // 设置新的端点地址
+	peer.setEndpointLocked(endpoint)   // 设置新的端点地址
+}
+
+// setEndpointLocked 设置端点，变化时发布事件；调用方须持有 peer.endpoint 锁
+func (peer *Peer) setEndpointLocked(endpoint conn.Endpoint) {
+	old := peer.endpoint.val
+	peer.endpoint.val = endpoint
+	if peer.device.subscribed(EventEndpointChanged) && !sameEndpoint(old, endpoint) {
+		peer.emit(Event{Type: EventEndpointChanged, Endpoint: endpointString(endpoint), OldEndpoint: endpointString(old)})
+	}
 }
 
 // markEndpointSrcForClearing 标记端点源地址需要在下次发送时清除
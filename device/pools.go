@@ -64,6 +64,16 @@ func (p *WaitPool) Put(x any) {
 	p.cond.Signal()
 }
 
+// InUse 当前借出的对象数量，只有设了上限的池子才计数，不设上限时 ok 为 false
+func (p *WaitPool) InUse() (n uint32, ok bool) {
+	if p.max == 0 {
+		return 0, false
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.count, true
+}
+
 // ==============================
 // Device 池子初始化：一次性把 5 个池子搭起来
 
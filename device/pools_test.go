@@ -68,6 +68,28 @@ func TestWaitPool(t *testing.T) {
 	}
 }
 
+func TestWaitPoolInUse(t *testing.T) {
+	tests := []struct {
+		max    uint32
+		wantOK bool
+	}{
+		{0, false},
+		{4, true},
+	}
+	for _, tt := range tests {
+		p := NewWaitPool(tt.max, func() any { return new(int) })
+		x, y := p.Get(), p.Get()
+		if n, ok := p.InUse(); ok != tt.wantOK || ok && n != 2 {
+			t.Errorf("max %d: InUse() = %d, %v after two Gets", tt.max, n, ok)
+		}
+		p.Put(x)
+		p.Put(y)
+		if n, ok := p.InUse(); ok != tt.wantOK || n != 0 {
+			t.Errorf("max %d: InUse() = %d, %v after Put", tt.max, n, ok)
+		}
+	}
+}
+
 func BenchmarkWaitPool(b *testing.B) {
 	var wg sync.WaitGroup
 	var trials atomic.Int32
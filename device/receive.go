@@ -272,6 +272,11 @@ func (device *Device) RoutineReceiveIncoming(maxBatchSize int, recv conn.Receive
 				}
 
 			default:
+				// 与 WireGuard 共用端口的其他协议 (如 STUN 回复) 交给注册的处理函数
+				if h := device.stray.Load(); h != nil {
+					(*h)(packet, endpoints[i])
+					continue
+				}
 				device.log.Verbosef("Received message with unknown type")
 				continue
 			}
@@ -482,6 +487,9 @@ func (device *Device) RoutineHandshake(id int) {
 
 			device.log.Verbosef("%v - Received handshake initiation", peer)
 			peer.rxBytes.Add(uint64(len(elem.packet)))
+			peer.stats.rxPackets.Add(1)
+			peer.stats.handshakesReceived.Add(1)
+			peer.lastReceiveNano.Store(time.Now().UnixNano())
 
 			peer.SendHandshakeResponse()
 
@@ -509,6 +517,8 @@ func (device *Device) RoutineHandshake(id int) {
 
 			device.log.Verbosef("%v - Received handshake response", peer)
 			peer.rxBytes.Add(uint64(len(elem.packet)))
+			peer.stats.rxPackets.Add(1)
+			peer.lastReceiveNano.Store(time.Now().UnixNano())
 
 			// update timers
 
@@ -526,6 +536,7 @@ func (device *Device) RoutineHandshake(id int) {
 
 			peer.timersSessionDerived()
 			peer.timersHandshakeComplete()
+			peer.emit(Event{Type: EventHandshakeCompleted, Initiator: true})
 			peer.SendKeepalive()
 		}
 	skip:
@@ -570,18 +581,22 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 		validTailPacket := -1
 		dataPacketReceived := false
 		rxBytesLen := uint64(0)
+		rxPackets := uint64(0)
 		for i, elem := range elemsContainer.elems {
 			if elem.packet == nil {
 				// decryption failed
 				// 解密失败（被 Worker 丢弃的包），直接跳过
+				peer.stats.dropDecrypt.Add(1)
 				continue
 			}
 
 			// [防重放] 检查 Counter 是否在滑动窗口内
 			// 如果 Counter 小于当前窗口下限，或者已经在窗口内被标记过（bitset），则视为重放攻击直接丢弃。
 			if !elem.keypair.replayFilter.ValidateCounter(elem.counter, RejectAfterMessages) {
+				peer.stats.dropReplay.Add(1)
 				continue
 			}
+			rxPackets++
 
 			validTailPacket = i
 			// [密钥确认 (Key Confirmation)]
@@ -593,7 +608,8 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 			if peer.ReceivedWithKeypair(elem.keypair) {
 				peer.SetEndpointFromPacket(elem.endpoint) // [漫游] 对方 IP 变了？立刻更新！
 				peer.timersHandshakeComplete()            // 重置握手定时器
-				peer.SendStagedPackets()                  // 之前因为没有 Key 而积压在队列里的包，现在赶紧发出去
+				peer.emit(Event{Type: EventHandshakeCompleted})
+				peer.SendStagedPackets() // 之前因为没有 Key 而积压在队列里的包，现在赶紧发出去
 			}
 			rxBytesLen += uint64(len(elem.packet) + MinMessageSize)
 
@@ -601,6 +617,7 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 				// Keepalive 包 (空负载)
 				// 它的唯一作用就是证明"我还活着"以及"我的 Key 是新的/有效的"。
 				// 到此为止，不需要发给内核。
+				peer.emit(Event{Type: EventKeepaliveReceived})
 				// ... (此处原有 Keepalive 日志逻辑省略，保留原代码) ...
 				// 获取完整公钥
 				peer.handshake.mutex.RLock()
@@ -659,6 +676,7 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 				// 如果客户端A伪造 src 为 0.9，因为服务器查 AllowedIPs 发现 0.9 不属于 A，在这里就会被直接丢弃。
 				if device.allowedips.Lookup(src) != peer {
 					device.log.Verbosef("IPv4 packet with disallowed source address from %v", peer)
+					peer.stats.dropAllowedIPs.Add(1)
 					continue
 				}
 
@@ -676,6 +694,7 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 				src := elem.packet[IPv6offsetSrc : IPv6offsetSrc+net.IPv6len]
 				if device.allowedips.Lookup(src) != peer {
 					device.log.Verbosef("IPv6 packet with disallowed source address from %v", peer)
+					peer.stats.dropAllowedIPs.Add(1)
 					continue
 				}
 
@@ -689,7 +708,9 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 		}
 
 		peer.rxBytes.Add(rxBytesLen)
+		peer.stats.rxPackets.Add(rxPackets)
 		if validTailPacket >= 0 {
+			peer.lastReceiveNano.Store(time.Now().UnixNano())
 			peer.SetEndpointFromPacket(elemsContainer.elems[validTailPacket].endpoint)
 			peer.keepKeyFreshReceiving()                 // 检查密钥是否快过期，是否需要重新握手
 			peer.timersAnyAuthenticatedPacketTraversal() // 记录：包穿过了防火墙
@@ -697,6 +718,7 @@ func (peer *Peer) RoutineSequentialReceiver(maxBatchSize int) {
 		}
 		if dataPacketReceived {
 			peer.timersDataReceived() // 只有包含实际数据的包（非空包）才触发这个计时(免去了频繁的 keepalive)
+			peer.markDataReceived()
 		}
 		// aw-收包出口：Go -> 内核 (写往 TUN)
 		if len(bufs) > 0 {
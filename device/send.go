@@ -135,8 +135,13 @@ func (peer *Peer) SendHandshakeInitiation(isRetry bool) error {
 	err = peer.SendBuffers([][]byte{packet}) // 这里发送握手包
 	if err != nil {
 		peer.device.log.Errorf("%v - Failed to send handshake initiation: %v", peer, err)
+	} else {
+		peer.stats.handshakesSent.Add(1)
 	}
 	peer.timersHandshakeInitiated()
+	if peer.device.subscribed(EventHandshakeInitiated) {
+		peer.emit(Event{Type: EventHandshakeInitiated, Endpoint: peer.GetEndpoint(), Attempt: peer.timers.handshakeAttempts.Load() + 1})
+	}
 
 	return err
 }
@@ -220,6 +225,8 @@ func (device *Device) RoutineReadFromTUN() { // aw-开荒: [读取 TUN]-发包
 	}()
 
 	device.log.Verbosef("Routine: TUN reader - started")
+	device.tunReader.running.Store(true)
+	defer device.tunReader.running.Store(false)
 
 	var (
 		batchSize   = device.BatchSize()
@@ -291,6 +298,10 @@ func (device *Device) RoutineReadFromTUN() { // aw-开荒: [读取 TUN]-发包
 			if peer == nil {
 				continue
 			}
+			if len(elem.packet) > MaxContentSize {
+				peer.stats.dropOversize.Add(1)
+				continue
+			}
 			elemsForPeer, ok := elemsByPeer[peer]
 			if !ok {
 				elemsForPeer = device.GetOutboundElementsContainer()
@@ -332,6 +343,7 @@ func (device *Device) RoutineReadFromTUN() { // aw-开荒: [读取 TUN]-发包
 				if !errors.Is(readErr, os.ErrClosed) {
 					device.log.Errorf("Failed to read packet from TUN device: %v", readErr)
 				}
+				device.tunReader.err.Store(&readErr)
 				go device.Close()
 			}
 			return
@@ -362,6 +374,7 @@ func (peer *Peer) StagePackets(elems *QueueOutboundElementsContainer) {
 			// "<-" 操作符会自动从 channel 头部弹出(Pop)数据。
 			// 因为 channel 是先进先出(FIFO)的，所以弹出的这一个肯定是"最老的"。
 			// 拿到它之后，我们不做处理直接回收内存，就等于把它"踢掉"了。
+			peer.stats.dropStagedOverflow.Add(uint64(len(tooOld.elems)))
 			for _, elem := range tooOld.elems {
 				peer.device.PutMessageBuffer(elem.buffer)
 				peer.device.PutOutboundElement(elem)
@@ -475,16 +488,23 @@ top:
 }
 
 func (peer *Peer) FlushStagedPackets() {
+	peer.flushStagedPackets()
+}
+
+// flushStagedPackets 丢弃暂存队列中的包，返回丢弃的数量
+// 只有握手失败时才计入 dropNoKeypair，Peer 停止 (设备关闭、删除或停用) 时清空队列属于正常退出
+func (peer *Peer) flushStagedPackets() (n int) {
 	for {
 		select {
 		case elemsContainer := <-peer.queue.staged:
+			n += len(elemsContainer.elems)
 			for _, elem := range elemsContainer.elems {
 				peer.device.PutMessageBuffer(elem.buffer)
 				peer.device.PutOutboundElement(elem)
 			}
 			peer.device.PutOutboundElementsContainer(elemsContainer)
 		default:
-			return
+			return n
 		}
 	}
 }
@@ -81,6 +81,8 @@ func (peer *Peer) timersActive() bool {
 func expiredRetransmitHandshake(peer *Peer) {
 	if peer.timers.handshakeAttempts.Load() > MaxTimerHandshakes {
 		peer.device.log.Verbosef("%s - Handshake did not complete after %d attempts, giving up", peer, MaxTimerHandshakes+2)
+		peer.stats.handshakesFailed.Add(1)
+		peer.emit(Event{Type: EventHandshakeFailed, Attempt: MaxTimerHandshakes + 2})
 
 		if peer.timersActive() {
 			peer.timers.sendKeepalive.Del()
@@ -89,7 +91,7 @@ func expiredRetransmitHandshake(peer *Peer) {
 		/* We drop all packets without a keypair and don't try again,
 		 * if we try unsuccessfully for too long to make a handshake.
 		 */
-		peer.FlushStagedPackets()
+		peer.stats.dropNoKeypair.Add(uint64(peer.flushStagedPackets()))
 
 		/* We set a timer for destroying any residue that might be left
 		 * of a partial exchange.
@@ -8,6 +8,7 @@ package device
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -128,6 +129,20 @@ func (device *Device) IpcGetOperation(w io.Writer) error {
 			sendf("last_handshake_time_nsec=%d", nano)
 			sendf("tx_bytes=%d", peer.txBytes.Load())
 			sendf("rx_bytes=%d", peer.rxBytes.Load())
+			// 扩展计数器，原版 wg 工具会忽略这些键
+			stats := peer.GetStats()
+			sendf("tx_packets=%d", stats.TxPackets)
+			sendf("rx_packets=%d", stats.RxPackets)
+			sendf("drop_allowed_ips=%d", stats.DropAllowedIPs)
+			sendf("drop_replay=%d", stats.DropReplay)
+			sendf("drop_decrypt=%d", stats.DropDecrypt)
+			sendf("drop_staged_overflow=%d", stats.DropStagedOverflow)
+			sendf("drop_no_keypair=%d", stats.DropNoKeypair)
+			sendf("drop_oversize=%d", stats.DropOversize)
+			sendf("handshakes_sent=%d", stats.HandshakesSent)
+			sendf("handshakes_received=%d", stats.HandshakesReceived)
+			sendf("handshakes_failed=%d", stats.HandshakesFailed)
+			sendf("rekeys=%d", stats.Rekeys)
 			sendf("persistent_keepalive_interval=%d", peer.persistentKeepaliveInterval.Load())
 
 			device.allowedips.EntriesForPeer(peer, func(prefix netip.Prefix) bool {
@@ -359,7 +374,7 @@ func (device *Device) handlePeerLine(peer *ipcSetPeer, key, value string) error
 		}
 		peer.endpoint.Lock()
 		defer peer.endpoint.Unlock()
-		peer.endpoint.val = endpoint
+		peer.setEndpointLocked(endpoint)
 
 	case "persistent_keepalive_interval":
 		device.log.Verbosef("%v - UAPI: Updating persistent keepalive interval", peer.Peer)
@@ -484,6 +499,14 @@ func (device *Device) IpcHandle(socket net.Conn) {
 				break
 			}
 			err = device.IpcGetOperation(buffered.Writer)
+		case "watch=1\n":
+			var filter map[NoisePublicKey]bool
+			filter, err = readWatchRequest(buffered.Reader)
+			if err == nil {
+				// 持续输出事件，直到客户端断开或设备关闭
+				device.ipcWatch(socket, buffered, filter)
+				return
+			}
 		default:
 			device.log.Errorf("invalid UAPI operation: %v", op)
 			return
@@ -504,3 +527,123 @@ func (device *Device) IpcHandle(socket net.Conn) {
 		buffered.Flush()
 	}
 }
+
+// watchWriteTimeout 向 watch 客户端写入一条事件的最长时间，超时视为客户端已失去响应
+const watchWriteTimeout = 5 * time.Second
+
+// watchEventNames watch 输出的事件及其在记录中的名称
+var watchEventNames = map[EventType]string{
+	EventHandshakeCompleted: "handshake",
+	EventEndpointChanged:    "endpoint",
+	EventPeerCreated:        "peer_add",
+	EventPeerRemoved:        "peer_remove",
+	EventKeypairRotated:     "rekey",
+}
+
+// readWatchRequest 读取 watch 请求到空行为止，可用 public_key=<hex> (可重复) 只关注指定的 Peer
+// 遇到无效的行时仍读完整个请求，以免剩余的行被当作下一个操作
+func readWatchRequest(r *bufio.Reader) (map[NoisePublicKey]bool, error) {
+	var filter map[NoisePublicKey]bool
+	var reqErr error
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, ipcErrorf(ipc.IpcErrorIO, "failed to read input: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return filter, reqErr
+		}
+		if reqErr != nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			reqErr = ipcErrorf(ipc.IpcErrorProtocol, "failed to parse line %q", line)
+			continue
+		}
+		if key != "public_key" {
+			reqErr = ipcErrorf(ipc.IpcErrorInvalid, "invalid UAPI watch key: %v", key)
+			continue
+		}
+		var pk NoisePublicKey
+		if err := pk.FromHex(value); err != nil {
+			reqErr = ipcErrorf(ipc.IpcErrorInvalid, "failed to get peer by public key: %w", err)
+			continue
+		}
+		if filter == nil {
+			filter = make(map[NoisePublicKey]bool)
+		}
+		filter[pk] = true
+	}
+}
+
+// ipcWatch 订阅事件后先回复 errno=0，再以 UAPI 的 key=value 格式逐条输出事件，每条以空行结束：
+//
+//	event=endpoint
+//	public_key=<hex>
+//	time_sec=1760000000
+//	time_nsec=123456789
+//	endpoint=203.0.113.7:51820
+//	old_endpoint=198.51.100.2:51820
+//
+// 客户端读取过慢时事件被丢弃，随后输出 event=dropped 与累计丢弃数 count
+func (device *Device) ipcWatch(socket net.Conn, w *bufio.ReadWriter, filter map[NoisePublicKey]bool) {
+	types := make([]EventType, 0, len(watchEventNames))
+	for t := range watchEventNames {
+		types = append(types, t)
+	}
+	sub := device.Subscribe(0, types...)
+	defer sub.Close()
+	fmt.Fprintf(w, "errno=0\n\n")
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	// 客户端关闭连接 (或写方向) 时结束；watch 期间的其它输入被忽略
+	hangup := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, w.Reader)
+		close(hangup)
+	}()
+
+	var reported uint64
+	for {
+		var ev Event
+		select {
+		case <-hangup:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			ev = e
+		}
+		if filter != nil && !filter[ev.Peer.handshake.remoteStatic] {
+			continue
+		}
+		if dropped := sub.Dropped(); dropped != reported {
+			reported = dropped
+			fmt.Fprintf(w, "event=dropped\ncount=%d\n\n", dropped)
+		}
+		fmt.Fprintf(w, "event=%s\npublic_key=%s\n", watchEventNames[ev.Type], hex.EncodeToString(ev.Peer.handshake.remoteStatic[:]))
+		fmt.Fprintf(w, "time_sec=%d\ntime_nsec=%d\n", ev.Time.Unix(), ev.Time.Nanosecond())
+		switch ev.Type {
+		case EventHandshakeCompleted, EventKeypairRotated:
+			fmt.Fprintf(w, "initiator=%t\n", ev.Initiator)
+		case EventEndpointChanged:
+			if ev.Endpoint != "" {
+				fmt.Fprintf(w, "endpoint=%s\n", ev.Endpoint)
+			}
+			if ev.OldEndpoint != "" {
+				fmt.Fprintf(w, "old_endpoint=%s\n", ev.OldEndpoint)
+			}
+		}
+		w.WriteByte('\n')
+		socket.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+		if err := w.Flush(); err != nil {
+			device.log.Verbosef("UAPI watch: %v", err)
+			return
+		}
+	}
+}
@@ -28,6 +28,11 @@ const (
 // flag in wireguard-android.
 var socketDirectory = "/var/run/wireguard"
 
+// SocketDirectory returns the directory holding the UAPI sockets.
+func SocketDirectory() string {
+	return socketDirectory
+}
+
 func sockPath(iface string) string {
 	return fmt.Sprintf("%s/%s.sock", socketDirectory, iface)
 }
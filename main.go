@@ -8,9 +8,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 
@@ -36,6 +38,7 @@ const (
 func printUsage() {
 	fmt.Printf("Usage: %s [-f/--foreground] INTERFACE-NAME\n", os.Args[0])
 	fmt.Printf("       %s -enroll JOIN-URL [INTERFACE-NAME]\n", os.Args[0])
+	fmt.Printf("       %s ctl status|peer|invite|config|stun|health ... (see %s ctl help)\n", os.Args[0], os.Args[0])
 }
 
 func warning() {
@@ -64,6 +67,11 @@ func main() {
 		fmt.Printf("wireguard-go v%s\n\nUserspace WireGuard daemon for %s-%s.\nInformation available at https://www.wireguard.com.\nCopyright (C) Jason A. Donenfeld <Jason@zx2c4.com>.\n", Version, runtime.GOOS, runtime.GOARCH)
 		return
 	}
+	// 管理子命令：连接已运行的守护进程
+	// 放在 ctl 之后，名为 status、config 等的接口仍按原方式启动
+	if len(os.Args) >= 2 && os.Args[1] == cliPrefix {
+		os.Exit(runCtl(os.Args[2:]))
+	}
 
 	warning()
 
@@ -246,10 +254,21 @@ func main() {
 	// [2. 第二板斧] 初始化 WireGuard 核心 (组装机器)
 	// 将 虚拟网卡(tdev) + 网络绑定(bind) + 核心逻辑 组装在一起。
 	// 注意：此时 UDP 端口还没有被监听，设备处于 Down 状态。
-	dev := device.NewDevice(tdev, conn.NewDefaultBind(), logger)
-
 	// [2.1] 加载持久化配置 (Phase 2)
+	// 需在创建设备之前加载：管理面运行在 netstack 中时要先包装 TUN
 	config, err := manager.LoadConfig()
+	var adminNet *manager.AdminNet
+	if err == nil {
+		wrapped, an, werr := config.WrapAdminTUN(tdev)
+		if werr != nil {
+			logger.Errorf("Failed to create management netstack: %v", werr)
+		} else {
+			tdev, adminNet = wrapped, an
+		}
+	}
+
+	dev := device.NewDevice(tdev, conn.NewDefaultBind(), logger)
+
 	if err != nil {
 		logger.Errorf("Failed to load config: %v", err)
 	} else {
@@ -308,10 +327,15 @@ func main() {
 
 	// 启动 Web UI (manager 包)
 	webUI := manager.NewWebUI(dev, config, ":8080")
+	if adminNet != nil {
+		webUI.SetAdminNet(adminNet)
+	}
+	webUI.SetGRPCSocket(filepath.Join(ipc.SocketDirectory(), manager.GRPCSocketName(interfaceName)))
+	webUI.SetUAPISocket(filepath.Join(ipc.SocketDirectory(), interfaceName+".sock"))
 	if err := webUI.Start(); err != nil {
 		logger.Errorf("Failed to start WebUI: %v", err)
 	} else {
-		logger.Verbosef("WebUI available at http://localhost:8080")
+		logger.Verbosef("WebUI available at %s://localhost:8080", webUI.Scheme())
 	}
 
 	// wait for program to terminate
@@ -325,9 +349,19 @@ func main() {
 	}
 
 	// clean up
+	// 先关闭 UAPI 不再接受外部修改，再在超时内停止 Web UI 并把运行时状态写回配置，最后关闭设备
 
-	webUI.Stop()
+	go func() {
+		<-term
+		logger.Errorf("Received second signal, exiting immediately")
+		os.Exit(ExitSetupFailed)
+	}()
 	uapi.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), webUI.ShutdownTimeout())
+	if err := webUI.Shutdown(ctx); err != nil {
+		logger.Errorf("WebUI shutdown: %v", err)
+	}
+	cancel()
 	dev.Close()
 
 	logger.Verbosef("Shutting down")
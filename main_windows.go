@@ -6,6 +6,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -141,10 +142,14 @@ func main() {
 	}
 
 	// 清理资源
-	webUI.Stop()
 	if uapi != nil {
 		uapi.Close()
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), webUI.ShutdownTimeout())
+	if err := webUI.Shutdown(ctx); err != nil {
+		logger.Errorf("WebUI shutdown: %v", err)
+	}
+	cancel()
 	dev.Close()
 
 	logger.Verbosef("Shutting down")
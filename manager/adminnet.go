@@ -0,0 +1,364 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// adminnet.go - 仅隧道内可达的管理面
+// 公开入口 (/join/、/api/register) 与管理面可以分开监听：管理面绑定隧道地址，
+// 或运行在独立的 netstack 用户态协议栈中，主机网络上不存在该地址。
+
+package manager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+const (
+	defaultAdminPort = 8081
+	adminListenRetry = 5 * time.Second // 隧道地址尚未就绪时的重试间隔
+)
+
+// ManagementConfig 公开入口与管理面的监听设置
+type ManagementConfig struct {
+	Split        bool   `json:"split,omitempty"`          // 公开入口与管理面分开监听
+	PublicAddr   string `json:"public_addr,omitempty"`    // 公开入口监听地址，默认沿用启动参数
+	AdminAddr    string `json:"admin_addr,omitempty"`     // 管理面监听地址，默认 隧道地址:8081
+	Netstack     bool   `json:"netstack,omitempty"`       // 管理面运行在独立的 netstack 协议栈中
+	NetstackAddr string `json:"netstack_addr,omitempty"`  // netstack 管理地址，默认子网中最后一个可用地址
+	AdminPeerTag string `json:"admin_peer_tag,omitempty"` // 仅允许带该标签的 Peer 访问管理面，空为不限制
+}
+
+// tunnelAddr 本机隧道地址 (InternalSubnet 中的主机部分)
+func (s *SystemConfig) tunnelAddr() (netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(s.InternalSubnet)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid internal_subnet %q: %w", s.InternalSubnet, err)
+	}
+	return prefix.Addr(), nil
+}
+
+// netstackAddr 管理面在 netstack 中使用的地址
+func (s *SystemConfig) netstackAddr() (netip.Addr, error) {
+	if s.Management.NetstackAddr != "" {
+		return netip.ParseAddr(s.Management.NetstackAddr)
+	}
+	prefix, err := netip.ParsePrefix(s.InternalSubnet)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid internal_subnet %q: %w", s.InternalSubnet, err)
+	}
+	if !prefix.Addr().Is4() || prefix.Bits() > 30 {
+		return netip.Addr{}, fmt.Errorf("management.netstack_addr is required for subnet %s", prefix)
+	}
+	// 广播地址前一个
+	base := binary.BigEndian.Uint32(prefix.Masked().Addr().AsSlice())
+	last := base | (1<<(32-prefix.Bits()) - 1) - 1
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], last)
+	return netip.AddrFrom4(b), nil
+}
+
+// adminListenAddr 管理面监听地址
+func (s *SystemConfig) adminListenAddr() (string, error) {
+	m := &s.Management
+	if m.AdminAddr != "" {
+		return m.AdminAddr, nil
+	}
+	var addr netip.Addr
+	var err error
+	if m.Netstack {
+		addr, err = s.netstackAddr()
+	} else {
+		addr, err = s.tunnelAddr()
+	}
+	if err != nil {
+		return "", err
+	}
+	return netip.AddrPortFrom(addr, defaultAdminPort).String(), nil
+}
+
+// reservedAddr 判断地址是否被管理面占用，分配 Peer 地址时跳过
+func (s *SystemConfig) reservedAddr(addr netip.Addr) bool {
+	if !s.Management.Netstack {
+		return false
+	}
+	reserved, err := s.netstackAddr()
+	return err == nil && reserved == addr
+}
+
+// PeerForAddr 按 AllowedIPs 查找隧道地址所属的 Peer
+func (c *Config) PeerForAddr(addr netip.Addr) (PeerRecord, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, p := range c.Peers {
+		for _, cidr := range p.AllowedIPs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+				return p, true
+			}
+		}
+	}
+	return PeerRecord{}, false
+}
+
+// adminPeerMiddleware 管理面仅允许带指定标签的 Peer 访问，本机发起的请求不受限制
+func (ui *WebUI) adminPeerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag := ui.config.System.Management.AdminPeerTag
+		if tag == "" || ui.localAddr(remoteAddr(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if peer, ok := ui.config.PeerForAddr(remoteAddr(r)); ok {
+			for _, t := range peer.Tags {
+				if t == tag {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		ui.auditRequest(r, AuditAdminDenied, "peer without tag "+tag)
+		writeForbidden(w, r, ErrCodeForbidden, "Management access requires a peer tagged "+strconv.Quote(tag))
+	})
+}
+
+// publicJoinHost 分离模式下邀请链接指向公开入口 (public_host + 公开端口)
+// 管理面地址只在隧道内可达，新设备无法用它入驻
+func (ui *WebUI) publicJoinHost() string {
+	configLock.RLock()
+	split, host := ui.config.System.Management.Split, ui.config.System.PublicHost
+	configLock.RUnlock()
+	if !split || host == "" {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(ui.server.Addr)
+	if err != nil || port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// localAddr 判断来源是否为本机 (回环或本机隧道地址)
+func (ui *WebUI) localAddr(addr netip.Addr) bool {
+	if addr.IsLoopback() {
+		return true
+	}
+	tunnel, err := ui.config.System.tunnelAddr()
+	return err == nil && tunnel == addr
+}
+
+// ========== netstack 管理地址 ==========
+
+// AdminNet 运行在隧道内部的独立协议栈，只承载管理地址
+type AdminNet struct {
+	addr netip.Addr
+	net  *netstack.Net
+}
+
+// Listen 在管理地址上监听 TCP
+func (a *AdminNet) Listen(port uint16) (net.Listener, error) {
+	return a.net.ListenTCPAddrPort(netip.AddrPortFrom(a.addr, port))
+}
+
+// Addr 管理地址
+func (a *AdminNet) Addr() netip.Addr {
+	return a.addr
+}
+
+// adminTUN 包装真实 TUN：目的地址为管理地址的数据包交给 netstack，其余照常收发
+// 来自 Peer (Write) 与来自本机 (底层 Read) 的数据包都会被分流，因此本机与 VPN 内均可访问管理面
+type adminTUN struct {
+	tun.Device
+	stack tun.Device
+	addr  netip.Addr
+	local netip.Addr // 本机隧道地址，netstack 回给本机的数据包直接写回底层 TUN
+
+	startOnce sync.Once
+	packets   chan []byte
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewAdminTUN 包装 TUN 设备，在 addr 上提供仅隧道内可达的管理协议栈
+// local 为本机隧道地址，可为零值
+func NewAdminTUN(under tun.Device, addr, local netip.Addr) (tun.Device, *AdminNet, error) {
+	mtu, err := under.MTU()
+	if err != nil {
+		mtu = device.DefaultMTU
+	}
+	stackDev, tnet, err := netstack.CreateNetTUN([]netip.Addr{addr}, nil, mtu)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &adminTUN{
+		Device:  under,
+		stack:   stackDev,
+		addr:    addr,
+		local:   local,
+		packets: make(chan []byte, 1024),
+		errs:    make(chan error, 1),
+		closed:  make(chan struct{}),
+	}
+	return t, &AdminNet{addr: addr, net: tnet}, nil
+}
+
+// packetDst 解析 IP 包的目的地址
+func packetDst(pkt []byte) (netip.Addr, bool) {
+	if len(pkt) < 1 {
+		return netip.Addr{}, false
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) >= 20 {
+			return netip.AddrFrom4([4]byte(pkt[16:20])), true
+		}
+	case 6:
+		if len(pkt) >= 40 {
+			return netip.AddrFrom16([16]byte(pkt[24:40])), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// start 启动两个读取协程：底层 TUN 与 netstack 的出站数据包汇入同一队列
+func (t *adminTUN) start(offset int) {
+	batch := t.Device.BatchSize()
+	go func() {
+		bufs := make([][]byte, batch)
+		sizes := make([]int, batch)
+		for i := range bufs {
+			bufs[i] = make([]byte, offset+device.MaxMessageSize)
+		}
+		for {
+			n, err := t.Device.Read(bufs, sizes, offset)
+			for i := 0; i < n; i++ {
+				pkt := bufs[i][offset : offset+sizes[i]]
+				if dst, ok := packetDst(pkt); ok && dst == t.addr {
+					t.stack.Write([][]byte{pkt}, 0)
+					continue
+				}
+				if !t.enqueue(append([]byte(nil), pkt...)) {
+					return
+				}
+			}
+			if err != nil && !errors.Is(err, tun.ErrTooManySegments) {
+				select {
+				case t.errs <- err:
+				case <-t.closed:
+				}
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([][]byte, 1)
+		sizes := make([]int, 1)
+		buf[0] = make([]byte, device.MaxMessageSize)
+		for {
+			n, err := t.stack.Read(buf, sizes, 0)
+			if err != nil {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			pkt := buf[0][:sizes[0]]
+			if dst, ok := packetDst(pkt); ok && dst == t.local {
+				t.Device.Write([][]byte{append(make([]byte, offset), pkt...)}, offset)
+				continue
+			}
+			if !t.enqueue(append([]byte(nil), pkt...)) {
+				return
+			}
+		}
+	}()
+}
+
+func (t *adminTUN) enqueue(pkt []byte) bool {
+	select {
+	case t.packets <- pkt:
+		return true
+	case <-t.closed:
+		return false
+	}
+}
+
+func (t *adminTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	t.startOnce.Do(func() { t.start(offset) })
+
+	var pkt []byte
+	select {
+	case pkt = <-t.packets:
+	case err := <-t.errs:
+		return 0, err
+	case <-t.closed:
+		return 0, os.ErrClosed
+	}
+	n := 0
+	for {
+		sizes[n] = copy(bufs[n][offset:], pkt)
+		n++
+		if n == len(bufs) {
+			return n, nil
+		}
+		select {
+		case pkt = <-t.packets:
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (t *adminTUN) Write(bufs [][]byte, offset int) (int, error) {
+	rest := bufs[:0:0]
+	for _, buf := range bufs {
+		if dst, ok := packetDst(buf[offset:]); ok && dst == t.addr {
+			t.stack.Write([][]byte{buf[offset:]}, 0)
+			continue
+		}
+		rest = append(rest, buf)
+	}
+	if len(rest) == 0 {
+		return len(bufs), nil
+	}
+	if _, err := t.Device.Write(rest, offset); err != nil {
+		return 0, err
+	}
+	return len(bufs), nil
+}
+
+func (t *adminTUN) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	t.stack.Close()
+	return t.Device.Close()
+}
+
+// WrapAdminTUN 按配置为 TUN 挂载 netstack 管理地址，未启用时原样返回
+func (c *Config) WrapAdminTUN(under tun.Device) (tun.Device, *AdminNet, error) {
+	configLock.RLock()
+	m := c.System.Management
+	addr, err := c.System.netstackAddr()
+	local, _ := c.System.tunnelAddr()
+	configLock.RUnlock()
+
+	if !m.Split || !m.Netstack {
+		return under, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewAdminTUN(under, addr, local)
+}
@@ -0,0 +1,155 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminListenAddr(t *testing.T) {
+	tests := []struct {
+		subnet string
+		m      ManagementConfig
+		want   string
+	}{
+		{"10.0.0.1/24", ManagementConfig{}, "10.0.0.1:8081"},
+		{"10.0.0.1/24", ManagementConfig{Netstack: true}, "10.0.0.254:8081"},
+		{"10.8.0.1/16", ManagementConfig{Netstack: true}, "10.8.255.254:8081"},
+		{"10.0.0.1/24", ManagementConfig{Netstack: true, NetstackAddr: "10.0.0.200"}, "10.0.0.200:8081"},
+		{"10.0.0.1/24", ManagementConfig{AdminAddr: "127.0.0.1:9000"}, "127.0.0.1:9000"},
+		{"10.0.0.1/31", ManagementConfig{Netstack: true}, ""},
+		{"fd00::1/64", ManagementConfig{Netstack: true}, ""},
+		{"fd00::1/64", ManagementConfig{}, "[fd00::1]:8081"},
+		{"bogus", ManagementConfig{}, ""},
+	}
+	for _, tt := range tests {
+		s := SystemConfig{InternalSubnet: tt.subnet, Management: tt.m}
+		got, err := s.adminListenAddr()
+		if (err == nil) != (tt.want != "") || got != tt.want {
+			t.Errorf("subnet %s %+v: %q, %v; want %q", tt.subnet, tt.m, got, err, tt.want)
+		}
+	}
+
+	// netstack 管理地址不分配给 Peer
+	s := SystemConfig{InternalSubnet: "10.0.0.1/24", Management: ManagementConfig{Netstack: true}}
+	if !s.reservedAddr(netip.MustParseAddr("10.0.0.254")) || s.reservedAddr(netip.MustParseAddr("10.0.0.253")) {
+		t.Error("reservedAddr does not match the netstack address")
+	}
+	s.Management.Netstack = false
+	if s.reservedAddr(netip.MustParseAddr("10.0.0.254")) {
+		t.Error("address reserved without netstack")
+	}
+}
+
+func TestPacketDst(t *testing.T) {
+	v4 := make([]byte, 20)
+	v4[0] = 0x45
+	copy(v4[16:], []byte{10, 0, 0, 254})
+	v6 := make([]byte, 40)
+	v6[0] = 0x60
+	v6[24], v6[25], v6[39] = 0xfd, 0x00, 0x02
+	tests := []struct {
+		pkt  []byte
+		want string
+	}{
+		{v4, "10.0.0.254"},
+		{v6, "fd00::2"},
+		{v4[:19], ""},
+		{v6[:39], ""},
+		{nil, ""},
+		{[]byte{0x50}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := packetDst(tt.pkt)
+		if ok != (tt.want != "") || (ok && got.String() != tt.want) {
+			t.Errorf("packetDst(% x) = %v, %v; want %q", tt.pkt, got, ok, tt.want)
+		}
+	}
+}
+
+func TestSplitListener(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.System.PublicHost = "vpn.example.com"
+		c.System.Management = ManagementConfig{Split: true, PublicAddr: "0.0.0.0:8443", AdminPeerTag: "admin"}
+		c.Peers = []PeerRecord{
+			{PublicKey: testKey(1), AllowedIPs: []string{"10.0.0.2/32"}, Tags: []string{"admin"}},
+			{PublicKey: testKey(2), AllowedIPs: []string{"10.0.0.3/32"}},
+		}
+	})
+	token := tu.token("root", RoleAdmin, ScopeStatusRead)
+
+	// 公开监听只提供入驻入口
+	for _, path := range []string{"/", "/login", "/api/status", "/api/v1/status", "/metrics", "/healthz"} {
+		if resp, _ := tu.bearer(token, http.MethodGet, path, ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("public listener serves %s: %d", path, resp.StatusCode)
+		}
+	}
+	if resp, _ := tu.do(nil, http.MethodGet, "/join/DEADBEEF", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("public listener join page: %d", resp.StatusCode)
+	}
+
+	invite, err := tu.config.GenerateInvite("kiosk", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 公开注册接口不接受远程入驻参数，邀请码不被消耗
+	resp, body := tu.do(nil, http.MethodPost, "/api/register", fmt.Sprintf(`{"token":%q,"server":"https://attacker.example"}`, invite))
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "/api/v1/enroll") {
+		t.Errorf("register with server: %d %s", resp.StatusCode, body)
+	}
+	resp, body = tu.do(nil, http.MethodPost, "/api/register", fmt.Sprintf(`{"token":%q}`, invite))
+	var reg RegisterResponse
+	json.Unmarshal([]byte(body), &reg)
+	if resp.StatusCode != http.StatusOK || reg.Config.Address != "10.0.0.4/32" || reg.Config.PrivateKey == "" {
+		t.Errorf("register: %d %s", resp.StatusCode, body)
+	}
+	if u := tu.inviteURL("https", tu.publicJoinHost(), "abc"); u != "https://vpn.example.com:8443/join/abc" {
+		t.Errorf("invite URL in split mode: %q", u)
+	}
+
+	// 管理面只对带 admin 标签的 Peer 与本机开放
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"10.0.0.2:40000", http.StatusOK},
+		{"10.0.0.3:40000", http.StatusForbidden},
+		{"10.0.0.9:40000", http.StatusForbidden},
+		{"10.0.0.1:40000", http.StatusOK},
+		{"127.0.0.1:40000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		tu.admin.Handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("admin request from %s: %d %s, want %d", tt.remote, w.Code, w.Body, tt.status)
+		}
+	}
+	if !tu.localAddr(netip.MustParseAddr("::1")) || tu.localAddr(netip.MustParseAddr("10.0.0.2")) {
+		t.Error("localAddr misclassifies sources")
+	}
+}
+
+func TestEnrollRequiresSystemWrite(t *testing.T) {
+	tu := newTestUI(t)
+	operator := tu.token("ops", RoleOperator, ScopePeers, ScopeInvites)
+	const body = `{"token":"abc","server":"https://vpn.example.com"}`
+	for _, path := range []string{"/api/enroll", "/api/v1/enroll"} {
+		if resp, _ := tu.bearer(operator, http.MethodPost, path, body); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("operator POST %s: %d", path, resp.StatusCode)
+		}
+	}
+}
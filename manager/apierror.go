@@ -0,0 +1,90 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// apierror.go - 统一错误响应
+// /api/v1 下的错误返回带机器可读错误码的信封 {"error": {"code": ..., "message": ...}}，
+// 旧接口保持原有的 {"error": "..."} 格式
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 错误码
+const (
+	ErrCodeBadRequest             = "bad_request"
+	ErrCodeInvalidJSON            = "invalid_json"
+	ErrCodeInvalidKey             = "invalid_key"
+	ErrCodeUnauthorized           = "unauthorized"
+	ErrCodeInvalidToken           = "invalid_token"
+	ErrCodeForbidden              = "forbidden"
+	ErrCodeInsufficientScope      = "insufficient_scope"
+	ErrCodeOutOfScope             = "out_of_scope" // 超出角色的 Peer 标签范围
+	ErrCodeCSRF                   = "csrf_failed"
+	ErrCodePasswordChangeRequired = "password_change_required"
+	ErrCodeNotFound               = "not_found"
+	ErrCodeMethodNotAllowed       = "method_not_allowed"
+	ErrCodeConflict               = "conflict"
+	ErrCodeRateLimited            = "rate_limited"
+	ErrCodeUpstream               = "upstream_error"
+	ErrCodeInternal               = "internal_error"
+)
+
+const apiV1Prefix = "/api/v1/"
+
+// APIError 带 HTTP 状态码与错误码的错误
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorEnvelope /api/v1 错误响应体
+type ErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+func apiErrorf(status int, code, format string, args ...any) *APIError {
+	return &APIError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// asAPIError 将任意错误转换为 APIError，未分类的错误视为 500
+func asAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return &APIError{Status: http.StatusInternalServerError, Code: ErrCodeInternal, Message: err.Error()}
+}
+
+// writeAPIError 按请求路径选择错误格式写入响应
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	e := asAPIError(err)
+	apiErrorsTotal.Inc(e.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	if strings.HasPrefix(r.URL.Path, apiV1Prefix) {
+		json.NewEncoder(w).Encode(ErrorEnvelope{Error: *e})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"error": e.Message})
+}
+
+// decodeJSON 解析请求体
+func decodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return apiErrorf(http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON: %v", err)
+	}
+	return nil
+}
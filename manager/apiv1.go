@@ -0,0 +1,775 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// apiv1.go - 版本化 REST 接口 /api/v1
+// 以资源为中心的路由 (/peers/{key}、/invites/{token})，使用标准 HTTP 方法与状态码，
+// 错误统一返回 ErrorEnvelope。路由表同时用于注册处理函数和生成 OpenAPI 文档。
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiHandler /api/v1 处理函数，返回响应体或错误
+// 返回的响应体为 nil 时不写入 body (204)
+type apiHandler func(w http.ResponseWriter, r *http.Request) (any, error)
+
+// errResponseWritten 处理函数已自行写入响应 (如事件流)
+var errResponseWritten = errors.New("response already written")
+
+// apiRoute 单个 /api/v1 操作
+type apiRoute struct {
+	Method  string
+	Path    string     // 相对 /api/v1 的路径，可含 {name} 通配
+	Perm    Permission // 所需权限，permAuthenticated 为任意已登录会话
+	Public  bool       // 无需登录
+	Summary string
+	Request any // 请求体类型样例，仅用于生成 OpenAPI
+	// 响应体类型样例，仅用于生成 OpenAPI；nil 表示无响应体
+	Response any
+	Status   int    // 成功状态码，默认 200
+	Legacy   string // 对应的旧接口 (兼容保留)
+	Handle   apiHandler
+}
+
+// TagsRequest 设置标签请求体
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// UserUpdateRequest 修改账号请求体，字段留空表示不修改
+type UserUpdateRequest struct {
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// apiV1Routes /api/v1 路由表
+func (ui *WebUI) apiV1Routes() []apiRoute {
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/status", Perm: PermStatusRead, Summary: "Device status", Response: DeviceInfo{}, Legacy: "/api/status", Handle: ui.v1Status},
+		{Method: http.MethodGet, Path: "/peers", Perm: PermStatusRead, Summary: "List peers", Response: []PeerInfo{}, Legacy: "/api/peers", Handle: ui.v1ListPeers},
+		{Method: http.MethodPost, Path: "/peers", Perm: PermPeersWrite, Summary: "Create a peer", Request: PeerAddRequest{}, Response: PeerInfo{}, Status: http.StatusCreated, Legacy: "/api/peer/add", Handle: ui.v1CreatePeer},
+		{Method: http.MethodGet, Path: "/peers/{key}", Perm: PermStatusRead, Summary: "Get a peer", Response: PeerInfo{}, Handle: ui.v1GetPeer},
+		{Method: http.MethodPut, Path: "/peers/{key}", Perm: PermPeersWrite, Summary: "Create or replace a peer", Request: PeerAddRequest{}, Response: PeerInfo{}, Handle: ui.v1PutPeer},
+		{Method: http.MethodDelete, Path: "/peers/{key}", Perm: PermPeersWrite, Summary: "Remove a peer", Status: http.StatusNoContent, Legacy: "/api/peer/remove", Handle: ui.v1DeletePeer},
+		{Method: http.MethodGet, Path: "/peers/{key}/history", Perm: PermStatusRead, Summary: "Peer traffic and availability history (CSV with format=csv)", Response: PeerHistory{}, Handle: ui.v1PeerHistory},
+		{Method: http.MethodGet, Path: "/peers/{key}/diagnose", Perm: PermStatusRead, Summary: "Ping the peer's tunnel address and check handshake, endpoint and AllowedIPs (text/event-stream streams each probe)", Response: PeerDiagnosis{}, Legacy: "/api/peers/{key}/diagnose", Handle: ui.v1DiagnosePeer},
+		{Method: http.MethodPost, Path: "/peers/{key}/speedtest", Perm: PermPeersWrite, Summary: "Measure upload/download throughput, latency and jitter to an online peer running in client mode", Request: SpeedtestRequest{}, Response: SpeedtestResult{}, Legacy: "/api/peers/{key}/speedtest", Handle: ui.v1SpeedtestPeer},
+		{Method: http.MethodPost, Path: "/peers/{key}/disable", Perm: PermPeersWrite, Summary: "Disable a peer, keeping its record", Response: PeerInfo{}, Handle: ui.v1DisablePeer},
+		{Method: http.MethodPost, Path: "/peers/{key}/enable", Perm: PermPeersWrite, Summary: "Enable a disabled peer", Response: PeerInfo{}, Handle: ui.v1EnablePeer},
+		{Method: http.MethodPut, Path: "/peers/{key}/tags", Perm: PermPeersWrite, Summary: "Replace peer tags", Request: TagsRequest{}, Response: PeerInfo{}, Legacy: "/api/peer/tags", Handle: ui.v1SetPeerTags},
+
+		{Method: http.MethodGet, Path: "/invites", Perm: PermInvitesRead, Summary: "List invites", Response: []Invite{}, Legacy: "/api/invites/list", Handle: ui.v1ListInvites},
+		{Method: http.MethodPost, Path: "/invites", Perm: PermInvitesWrite, Summary: "Create an invite", Request: InviteGenerateRequest{}, Response: InviteCreateResponse{}, Status: http.StatusCreated, Legacy: "/api/invites/generate", Handle: ui.v1CreateInvite},
+		{Method: http.MethodGet, Path: "/invites/{token}", Perm: PermInvitesRead, Summary: "Get an invite", Response: Invite{}, Handle: ui.v1GetInvite},
+		{Method: http.MethodDelete, Path: "/invites/{token}", Perm: PermInvitesWrite, Summary: "Revoke an invite", Status: http.StatusNoContent, Legacy: "/api/invites/remove", Handle: ui.v1DeleteInvite},
+
+		{Method: http.MethodGet, Path: "/system", Perm: PermSystemRead, Summary: "Get system settings", Response: SystemConfig{}, Legacy: "/api/system/config", Handle: ui.v1GetSystem},
+		{Method: http.MethodPut, Path: "/system", Perm: PermSystemWrite, Summary: "Update system settings", Request: SystemConfig{}, Response: SystemConfig{}, Legacy: "/api/system/config", Handle: ui.v1PutSystem},
+		{Method: http.MethodPost, Path: "/config", Perm: PermConfigRaw, Summary: "Apply raw UAPI configuration", Request: ConfigRequest{}, Status: http.StatusNoContent, Legacy: "/api/config", Handle: ui.v1ApplyConfig},
+		{Method: http.MethodPost, Path: "/enroll", Perm: PermSystemWrite, Summary: "Enroll this node with a remote server", Request: EnrollRequest{}, Response: RegisterResponse{}, Legacy: "/api/enroll", Handle: ui.v1Enroll},
+		{Method: http.MethodGet, Path: "/events", Perm: PermStatusRead, Summary: "Live event stream (text/event-stream, or WebSocket with Upgrade)", Handle: ui.v1Events},
+		{Method: http.MethodGet, Path: "/tls", Perm: PermStatusRead, Summary: "WebUI certificate", Response: TLSInfo{}, Legacy: "/api/tls", Handle: ui.v1TLS},
+
+		{Method: http.MethodGet, Path: "/me", Perm: permAuthenticated, Summary: "Current principal", Response: MeResponse{}, Legacy: "/api/me", Handle: ui.v1Me},
+		{Method: http.MethodGet, Path: "/users", Perm: PermUsersManage, Summary: "List users", Response: []UserInfo{}, Legacy: "/api/users", Handle: ui.v1ListUsers},
+		{Method: http.MethodPost, Path: "/users", Perm: PermUsersManage, Summary: "Create a user", Request: UserRequest{}, Response: UserInfo{}, Status: http.StatusCreated, Legacy: "/api/users", Handle: ui.v1CreateUser},
+		{Method: http.MethodGet, Path: "/users/{username}", Perm: PermUsersManage, Summary: "Get a user", Response: UserInfo{}, Handle: ui.v1GetUser},
+		{Method: http.MethodPatch, Path: "/users/{username}", Perm: PermUsersManage, Summary: "Reset password and/or change role", Request: UserUpdateRequest{}, Response: UserInfo{}, Legacy: "/api/users", Handle: ui.v1UpdateUser},
+		{Method: http.MethodDelete, Path: "/users/{username}", Perm: PermUsersManage, Summary: "Remove a user", Status: http.StatusNoContent, Legacy: "/api/users", Handle: ui.v1DeleteUser},
+		{Method: http.MethodGet, Path: "/roles", Perm: PermUsersManage, Summary: "List roles", Response: []Role{}, Legacy: "/api/roles", Handle: ui.v1ListRoles},
+		{Method: http.MethodPut, Path: "/roles/{name}", Perm: PermUsersManage, Summary: "Create or replace a custom role", Request: Role{}, Response: Role{}, Legacy: "/api/roles", Handle: ui.v1PutRole},
+		{Method: http.MethodDelete, Path: "/roles/{name}", Perm: PermUsersManage, Summary: "Remove a custom role", Status: http.StatusNoContent, Legacy: "/api/roles", Handle: ui.v1DeleteRole},
+		{Method: http.MethodGet, Path: "/tokens", Perm: permAuthenticated, Summary: "List API tokens", Response: []APITokenInfo{}, Legacy: "/api/tokens", Handle: ui.v1ListTokens},
+		{Method: http.MethodPost, Path: "/tokens", Perm: permAuthenticated, Summary: "Create an API token", Request: TokenCreateRequest{}, Response: TokenCreateResponse{}, Status: http.StatusCreated, Legacy: "/api/tokens", Handle: ui.v1CreateToken},
+		{Method: http.MethodDelete, Path: "/tokens/{id}", Perm: permAuthenticated, Summary: "Revoke an API token", Status: http.StatusNoContent, Legacy: "/api/tokens", Handle: ui.v1DeleteToken},
+		{Method: http.MethodGet, Path: "/webhooks", Perm: PermWebhooksManage, Summary: "List webhooks", Response: []WebhookInfo{}, Handle: ui.v1ListWebhooks},
+		{Method: http.MethodPost, Path: "/webhooks", Perm: PermWebhooksManage, Summary: "Create a webhook", Request: WebhookRequest{}, Response: WebhookCreateResponse{}, Status: http.StatusCreated, Handle: ui.v1CreateWebhook},
+		{Method: http.MethodGet, Path: "/webhooks/{id}", Perm: PermWebhooksManage, Summary: "Get a webhook", Response: WebhookInfo{}, Handle: ui.v1GetWebhook},
+		{Method: http.MethodPatch, Path: "/webhooks/{id}", Perm: PermWebhooksManage, Summary: "Update, enable or disable a webhook", Request: WebhookUpdateRequest{}, Response: WebhookInfo{}, Handle: ui.v1UpdateWebhook},
+		{Method: http.MethodDelete, Path: "/webhooks/{id}", Perm: PermWebhooksManage, Summary: "Remove a webhook", Status: http.StatusNoContent, Handle: ui.v1DeleteWebhook},
+		{Method: http.MethodGet, Path: "/webhooks/{id}/deliveries", Perm: PermWebhooksManage, Summary: "Recent deliveries of a webhook", Response: []WebhookDelivery{}, Handle: ui.v1ListDeliveries},
+		{Method: http.MethodPost, Path: "/webhooks/{id}/deliveries/{delivery}/replay", Perm: PermWebhooksManage, Summary: "Send a past delivery again", Response: WebhookDelivery{}, Status: http.StatusAccepted, Handle: ui.v1ReplayDelivery},
+		{Method: http.MethodGet, Path: "/stun", Perm: PermSystemRead, Summary: "STUN responder, public endpoint and NAT type", Response: STUNStatus{}, Handle: ui.v1STUN},
+		{Method: http.MethodPost, Path: "/stun/probe", Perm: PermSystemWrite, Summary: "Probe the STUN servers now from the WireGuard port", Response: STUNStatus{}, Handle: ui.v1ProbeSTUN},
+		{Method: http.MethodGet, Path: "/portmap", Perm: PermSystemRead, Summary: "Router port mapping for the WireGuard port", Response: PortMapStatus{}, Handle: ui.v1PortMap},
+		{Method: http.MethodGet, Path: "/mqtt", Perm: PermStatusRead, Summary: "MQTT bridge status", Response: MQTTBridgeInfo{}, Handle: ui.v1MQTT},
+		{Method: http.MethodGet, Path: "/mqtt/devices", Perm: PermStatusRead, Summary: "Devices reporting over MQTT (server mode)", Response: []MQTTDevice{}, Handle: ui.v1ListMQTTDevices},
+		{Method: http.MethodGet, Path: "/mqtt/devices/{id}", Perm: PermStatusRead, Summary: "Last status of an MQTT device", Response: MQTTDevice{}, Handle: ui.v1GetMQTTDevice},
+		{Method: http.MethodPost, Path: "/mqtt/devices/{id}/commands", Perm: PermPeersWrite, Summary: "Send vpn_up, vpn_down, rotate or config to a device", Request: MQTTCommand{}, Response: MQTTCommand{}, Status: http.StatusAccepted, Handle: ui.v1SendMQTTCommand},
+		{Method: http.MethodGet, Path: "/audit", Perm: PermUsersManage, Summary: "Recent audit entries", Response: []AuditEntry{}, Legacy: "/api/audit", Handle: ui.v1Audit},
+
+		{Method: http.MethodGet, Path: "/openapi.json", Public: true, Summary: "This OpenAPI document", Handle: ui.v1OpenAPI},
+	}
+}
+
+// registerAPIV1 注册 /api/v1 路由
+// 同一路径的不同方法由 apiDispatch 分发，不支持的方法与未知路径同样返回错误信封
+func (ui *WebUI) registerAPIV1(mux *http.ServeMux) {
+	byPath := make(map[string][]apiRoute)
+	var paths []string
+	for _, route := range ui.apiV1Routes() {
+		if _, ok := byPath[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+		byPath[route.Path] = append(byPath[route.Path], route)
+	}
+	for _, path := range paths {
+		mux.HandleFunc(strings.TrimSuffix(apiV1Prefix, "/")+path, ui.apiDispatch(byPath[path]))
+	}
+	mux.HandleFunc(apiV1Prefix, func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, r, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "No such endpoint: %s %s", r.Method, r.URL.Path))
+	})
+}
+
+// apiDispatch 按方法分发同一路径上的操作
+func (ui *WebUI) apiDispatch(routes []apiRoute) http.HandlerFunc {
+	handlers := make(map[string]http.HandlerFunc, len(routes))
+	var methods []string
+	for _, route := range routes {
+		h := ui.serveAPI(route)
+		if !route.Public {
+			h = ui.authMiddleware(allow(route.Perm), h)
+		}
+		handlers[route.Method] = h
+		methods = append(methods, route.Method)
+	}
+	allowed := strings.Join(methods, ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		h, ok := handlers[method]
+		if !ok {
+			w.Header().Set("Allow", allowed)
+			writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method %s not allowed, use %s", r.Method, allowed))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// serveAPI 调用处理函数并按路由约定写入响应
+func (ui *WebUI) serveAPI(route apiRoute) http.HandlerFunc {
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, err := route.Handle(w, r)
+		if err == errResponseWritten {
+			return
+		}
+		if err != nil {
+			writeAPIError(w, r, err)
+			return
+		}
+		if resp == nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// legacyAliases 旧接口保持原有请求与响应格式，响应头指向对应的 /api/v1 接口
+// 按请求匹配到的路由模式查找，带 {key} 等通配段的旧接口同样适用
+func (ui *WebUI) legacyAliases(mux *http.ServeMux) http.Handler {
+	successors := make(map[string]string)
+	for _, route := range ui.apiV1Routes() {
+		if _, ok := successors[route.Legacy]; route.Legacy != "" && !ok {
+			successors[route.Legacy] = strings.TrimSuffix(apiV1Prefix, "/") + route.Path
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			if successor, ok := successors[pattern]; ok {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", "<"+expandSuccessor(pattern, r.URL.EscapedPath(), successor)+`>; rel="successor-version"`)
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// expandSuccessor 用请求路径中通配段的值填充新接口路径，如 /api/peers/{key}/diagnose -> /api/v1/peers/<key>/diagnose
+func expandSuccessor(pattern, path, successor string) string {
+	segments := strings.Split(path, "/")
+	for i, part := range strings.Split(pattern, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") && i < len(segments) {
+			successor = strings.ReplaceAll(successor, part, segments[i])
+		}
+	}
+	return successor
+}
+
+// ========== 状态与 Peer ==========
+
+func (ui *WebUI) v1Status(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.visibleDeviceInfo(currentPrincipal(r)), nil
+}
+
+func (ui *WebUI) v1ListPeers(w http.ResponseWriter, r *http.Request) (any, error) {
+	peers := ui.visibleDeviceInfo(currentPrincipal(r)).Peers
+	if peers == nil {
+		peers = []PeerInfo{}
+	}
+	return peers, nil
+}
+
+func (ui *WebUI) v1CreatePeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req PeerAddRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	publicKey, err := parsePeerKey(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ui.findPeer(currentPrincipal(r), publicKey); err == nil {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer already exists")
+	}
+	if _, err := ui.addPeer(currentPrincipal(r), req); err != nil {
+		return nil, err
+	}
+	w.Header().Set("Location", peerLocation(publicKey))
+	return ui.findPeer(currentPrincipal(r), publicKey)
+}
+
+func (ui *WebUI) v1GetPeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	publicKey, err := parsePeerKey(r.PathValue("key"))
+	if err != nil {
+		return nil, err
+	}
+	return ui.findPeer(currentPrincipal(r), publicKey)
+}
+
+func (ui *WebUI) v1PutPeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req PeerAddRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	publicKey, err := parsePeerKey(r.PathValue("key"))
+	if err != nil {
+		return nil, err
+	}
+	if req.PublicKey != "" {
+		if body, err := parsePeerKey(req.PublicKey); err != nil || body != publicKey {
+			return nil, apiErrorf(http.StatusBadRequest, ErrCodeInvalidKey, "public_key does not match the URL")
+		}
+	}
+	req.PublicKey = publicKey
+	if ui.config.HasPeer(publicKey) {
+		existing, err := ui.findPeer(currentPrincipal(r), publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing.Disabled {
+			return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer is disabled, enable it first")
+		}
+	}
+	if _, err := ui.replacePeer(currentPrincipal(r), req); err != nil {
+		return nil, err
+	}
+	return ui.findPeer(currentPrincipal(r), publicKey)
+}
+
+func (ui *WebUI) v1DeletePeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	publicKey, err := parsePeerKey(r.PathValue("key"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ui.findPeer(currentPrincipal(r), publicKey); err != nil {
+		return nil, err
+	}
+	return nil, ui.removePeer(currentPrincipal(r), publicKey)
+}
+
+func (ui *WebUI) v1PeerHistory(w http.ResponseWriter, r *http.Request) (any, error) {
+	q, err := parseHistoryQuery(r)
+	if err != nil {
+		return nil, err
+	}
+	hist, err := ui.peerHistory(currentPrincipal(r), r.PathValue("key"), q)
+	if err != nil {
+		return nil, err
+	}
+	if q.csv {
+		writeHistoryCSV(w, hist)
+		return nil, errResponseWritten
+	}
+	return hist, nil
+}
+
+func (ui *WebUI) v1SetPeerTags(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req TagsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	publicKey, err := parsePeerKey(r.PathValue("key"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ui.findPeer(currentPrincipal(r), publicKey); err != nil {
+		return nil, err
+	}
+	if err := ui.setPeerTags(currentPrincipal(r), publicKey, req.Tags); err != nil {
+		return nil, err
+	}
+	return ui.findPeer(currentPrincipal(r), publicKey)
+}
+
+func (ui *WebUI) v1DisablePeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.v1SetPeerDisabled(r, true)
+}
+
+func (ui *WebUI) v1EnablePeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.v1SetPeerDisabled(r, false)
+}
+
+func (ui *WebUI) v1SetPeerDisabled(r *http.Request, disabled bool) (any, error) {
+	publicKey, err := parsePeerKey(r.PathValue("key"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ui.findPeer(currentPrincipal(r), publicKey); err != nil {
+		return nil, err
+	}
+	if err := ui.setPeerDisabled(currentPrincipal(r), publicKey, disabled); err != nil {
+		return nil, err
+	}
+	return ui.findPeer(currentPrincipal(r), publicKey)
+}
+
+// peerLocation Peer 资源地址，公钥使用 URL 安全 Base64
+func peerLocation(publicKey string) string {
+	return apiV1Prefix + "peers/" + strings.NewReplacer("+", "-", "/", "_").Replace(publicKey)
+}
+
+// ========== 邀请码 ==========
+
+func (ui *WebUI) v1ListInvites(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.visibleInvites(currentPrincipal(r)), nil
+}
+
+func (ui *WebUI) v1CreateInvite(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req InviteGenerateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	inv, err := ui.createInvite(currentPrincipal(r), req)
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set("Location", apiV1Prefix+"invites/"+url.PathEscape(inv.Token))
+	return InviteCreateResponse{Invite: inv, URL: ui.joinURL(r, inv.Token)}, nil
+}
+
+func (ui *WebUI) v1GetInvite(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.findInvite(currentPrincipal(r), r.PathValue("token"))
+}
+
+func (ui *WebUI) v1DeleteInvite(w http.ResponseWriter, r *http.Request) (any, error) {
+	token := r.PathValue("token")
+	if _, err := ui.findInvite(currentPrincipal(r), token); err != nil {
+		return nil, err
+	}
+	return nil, ui.removeInvite(currentPrincipal(r), token)
+}
+
+// ========== 系统 ==========
+
+func (ui *WebUI) v1GetSystem(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.systemConfig(), nil
+}
+
+func (ui *WebUI) v1PutSystem(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req SystemConfig
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	if err := ui.updateSystem(req); err != nil {
+		return nil, err
+	}
+	return ui.systemConfig(), nil
+}
+
+func (ui *WebUI) v1ApplyConfig(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req ConfigRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	if err := ui.applyConfig(req.Config); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (ui *WebUI) v1Events(w http.ResponseWriter, r *http.Request) (any, error) {
+	ui.handleEvents(w, r)
+	return nil, errResponseWritten
+}
+
+func (ui *WebUI) v1Enroll(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req EnrollRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	resp, status, err := ui.remoteEnrollToServer(req.Server, req.Token, req.Endpoint, req.Fingerprint)
+	if err != nil {
+		code := ErrCodeInternal
+		switch status {
+		case http.StatusBadRequest:
+			code = ErrCodeBadRequest
+		case http.StatusBadGateway:
+			code = ErrCodeUpstream
+		}
+		return nil, &APIError{Status: status, Code: code, Message: err.Error()}
+	}
+	return resp, nil
+}
+
+func (ui *WebUI) v1TLS(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.tlsInfo(), nil
+}
+
+// ========== 账号、角色与令牌 ==========
+
+func (ui *WebUI) v1Me(w http.ResponseWriter, r *http.Request) (any, error) {
+	p := currentPrincipal(r)
+	user, _ := ui.config.FindUser(p.Username)
+	return MeResponse{
+		Username:    p.Username,
+		Role:        p.Role.Name,
+		Permissions: p.Permissions,
+		PeerTags:    p.Role.PeerTags,
+		Locale:      user.Locale,
+	}, nil
+}
+
+func (ui *WebUI) v1ListUsers(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.config.ListUsers(), nil
+}
+
+func (ui *WebUI) v1CreateUser(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req UserRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if _, ok := ui.config.FindUser(req.Username); ok {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "user %q already exists", req.Username)
+	}
+	if err := ui.createUser(r, req.Username, req.Password, req.Role); err != nil {
+		return nil, err
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditUserChange, "create "+req.Username)
+	w.Header().Set("Location", apiV1Prefix+"users/"+url.PathEscape(req.Username))
+	user, _ := ui.config.FindUser(req.Username)
+	return user.Info(), nil
+}
+
+func (ui *WebUI) v1GetUser(w http.ResponseWriter, r *http.Request) (any, error) {
+	user, ok := ui.config.FindUser(r.PathValue("username"))
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "user %q not found", r.PathValue("username"))
+	}
+	return user.Info(), nil
+}
+
+func (ui *WebUI) v1UpdateUser(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req UserUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	username := r.PathValue("username")
+	if err := ui.updateUser(r, username, req.Password, req.Role); err != nil {
+		return nil, err
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditUserChange, "update "+username+" role="+strconv.Quote(req.Role)+" password_reset="+strconv.FormatBool(req.Password != ""))
+	user, _ := ui.config.FindUser(username)
+	return user.Info(), nil
+}
+
+func (ui *WebUI) v1DeleteUser(w http.ResponseWriter, r *http.Request) (any, error) {
+	username := r.PathValue("username")
+	if err := ui.removeUser(r, username); err != nil {
+		return nil, err
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditUserChange, "delete "+username)
+	return nil, nil
+}
+
+func (ui *WebUI) v1ListRoles(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.config.ListRoles(), nil
+}
+
+func (ui *WebUI) v1PutRole(w http.ResponseWriter, r *http.Request) (any, error) {
+	var role Role
+	if err := decodeJSON(r, &role); err != nil {
+		return nil, err
+	}
+	role.Name = r.PathValue("name")
+	if err := ui.checkRole(r, role); err != nil {
+		return nil, err
+	}
+	if err := ui.config.SaveRole(role); err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditRoleChange, "PUT "+role.Name)
+	role, _ = ui.config.FindRole(role.Name)
+	return role, nil
+}
+
+func (ui *WebUI) v1DeleteRole(w http.ResponseWriter, r *http.Request) (any, error) {
+	name := r.PathValue("name")
+	if _, ok := ui.config.FindRole(name); !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "role %q not found", name)
+	}
+	if err := ui.config.RemoveRole(name); err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditRoleChange, "DELETE "+name)
+	return nil, nil
+}
+
+// tokenOwner 普通账号只能管理自己的令牌，具备 users.manage 权限的账号可管理全部令牌
+func tokenOwner(r *http.Request) string {
+	p := currentPrincipal(r)
+	if p.can(PermUsersManage) {
+		return ""
+	}
+	return p.Username
+}
+
+func (ui *WebUI) v1ListTokens(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.config.ListAPITokens(tokenOwner(r)), nil
+}
+
+func (ui *WebUI) v1CreateToken(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req TokenCreateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "expires_in_days must not be negative")
+	}
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	plain, info, err := ui.config.CreateAPIToken(currentUser(r), req.Name, req.Scopes, req.AllowedIPs, ttl)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		ui.config.RevokeAPIToken(info.ID, "")
+		return nil, err
+	}
+	ui.auditRequest(r, AuditTokenChange, "create "+info.ID)
+	w.Header().Set("Location", apiV1Prefix+"tokens/"+url.PathEscape(info.ID))
+	return TokenCreateResponse{Token: plain, Info: info}, nil
+}
+
+func (ui *WebUI) v1DeleteToken(w http.ResponseWriter, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if !ui.config.RevokeAPIToken(id, tokenOwner(r)) {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Token not found")
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditTokenChange, "revoke "+id)
+	return nil, nil
+}
+
+func (ui *WebUI) v1Audit(w http.ResponseWriter, r *http.Request) (any, error) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	return ui.audit.Recent(limit), nil
+}
+
+// ========== Webhook ==========
+
+func (ui *WebUI) v1ListWebhooks(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.config.ListWebhooks(), nil
+}
+
+func (ui *WebUI) v1CreateWebhook(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req WebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	secret, info, err := ui.config.CreateWebhook(req)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		ui.config.RemoveWebhook(info.ID)
+		return nil, err
+	}
+	ui.auditRequest(r, AuditWebhookChange, "create "+info.ID+" "+info.URL)
+	w.Header().Set("Location", apiV1Prefix+"webhooks/"+url.PathEscape(info.ID))
+	return WebhookCreateResponse{Secret: secret, Webhook: info}, nil
+}
+
+func (ui *WebUI) v1GetWebhook(w http.ResponseWriter, r *http.Request) (any, error) {
+	hook, ok := ui.config.FindWebhook(r.PathValue("id"))
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+	}
+	return hook.Info(), nil
+}
+
+func (ui *WebUI) v1UpdateWebhook(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req WebhookUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+	id := r.PathValue("id")
+	info, err := ui.config.UpdateWebhook(id, req)
+	if err == errWebhookNotFound {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+	}
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditWebhookChange, "update "+id+" enabled="+strconv.FormatBool(info.Enabled)+" secret_changed="+strconv.FormatBool(req.Secret != nil))
+	return info, nil
+}
+
+func (ui *WebUI) v1DeleteWebhook(w http.ResponseWriter, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if !ui.config.RemoveWebhook(id) {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditWebhookChange, "delete "+id)
+	return nil, nil
+}
+
+func (ui *WebUI) v1ListDeliveries(w http.ResponseWriter, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if _, ok := ui.config.FindWebhook(id); !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	return ui.webhookLog.list(id, limit), nil
+}
+
+func (ui *WebUI) v1ReplayDelivery(w http.ResponseWriter, r *http.Request) (any, error) {
+	id := r.PathValue("id")
+	if _, ok := ui.config.FindWebhook(id); !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+	}
+	orig, ok := ui.webhookLog.find(id, r.PathValue("delivery"))
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Delivery not found")
+	}
+	d, err := ui.startDelivery(id, orig.Event, orig.ID)
+	if err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditWebhookChange, "replay "+orig.ID+" as "+d.ID)
+	return d, nil
+}
+
+// ========== OpenAPI ==========
+
+// ========== MQTT ==========
+
+func (ui *WebUI) v1MQTT(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.mqttInfo(), nil
+}
+
+// mqttServer 返回服务端模式的信令桥
+func (ui *WebUI) mqttServer() (*mqttBridge, error) {
+	if ui.mqtt == nil {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "%v", errMQTTDisabled)
+	}
+	if ui.mqtt.mode != MQTTModeServer {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "MQTT bridge is in %s mode", ui.mqtt.mode)
+	}
+	return ui.mqtt, nil
+}
+
+func (ui *WebUI) v1ListMQTTDevices(w http.ResponseWriter, r *http.Request) (any, error) {
+	b, err := ui.mqttServer()
+	if err != nil {
+		return nil, err
+	}
+	return b.listDevices(), nil
+}
+
+func (ui *WebUI) v1GetMQTTDevice(w http.ResponseWriter, r *http.Request) (any, error) {
+	b, err := ui.mqttServer()
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	d, ok := b.devices[r.PathValue("id")]
+	b.mu.Unlock()
+	if !ok {
+		return nil, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Device not found")
+	}
+	return d, nil
+}
+
+func (ui *WebUI) v1SendMQTTCommand(w http.ResponseWriter, r *http.Request) (any, error) {
+	if _, err := ui.mqttServer(); err != nil {
+		return nil, err
+	}
+	var cmd MQTTCommand
+	if err := decodeJSON(r, &cmd); err != nil {
+		return nil, err
+	}
+	id := r.PathValue("id")
+	if !validTopicLevel(id) {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid device ID %q", id)
+	}
+	cmd, err := ui.sendMQTTCommand(id, cmd)
+	if err != nil {
+		return nil, err
+	}
+	ui.auditRequest(r, AuditMQTTCommand, "send "+cmd.Action+" to "+id+" ("+cmd.ID+")")
+	return cmd, nil
+}
+
+func (ui *WebUI) v1OpenAPI(w http.ResponseWriter, r *http.Request) (any, error) {
+	return buildOpenAPI(ui.apiV1Routes()), nil
+}
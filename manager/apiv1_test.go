@@ -0,0 +1,171 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var regexpRefs = regexp.MustCompile(`"#/components/(?:schemas|responses)/([A-Za-z0-9_]+)"`)
+
+func TestOperationID(t *testing.T) {
+	tests := []struct{ method, path, want string }{
+		{http.MethodGet, "/peers", "getPeers"},
+		{http.MethodGet, "/peers/{key}", "getPeersByKey"},
+		{http.MethodPost, "/webhooks/{id}/deliveries/{delivery}/replay", "postWebhooksByIdDeliveriesByDeliveryReplay"},
+		{http.MethodGet, "/openapi.json", "getOpenapi"},
+	}
+	for _, tt := range tests {
+		if got := operationID(tt.method, tt.path); got != tt.want {
+			t.Errorf("operationID(%s, %s) = %s, want %s", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	tu := newTestUI(t)
+	resp, body := tu.do(nil, http.MethodGet, "/api/v1/openapi.json", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("openapi.json: %d %s", resp.StatusCode, body)
+	}
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required []string `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != openAPIVersion {
+		t.Errorf("openapi version %q", doc.OpenAPI)
+	}
+	seen := make(map[string]bool)
+	for _, route := range tu.apiV1Routes() {
+		op := doc.Paths[route.Path][strings.ToLower(route.Method)]
+		if op == nil {
+			t.Errorf("%s %s missing from the document", route.Method, route.Path)
+			continue
+		}
+		id := op["operationId"].(string)
+		if seen[id] {
+			t.Errorf("duplicate operationId %s", id)
+		}
+		seen[id] = true
+		if perm, _ := op["x-permission"].(string); !route.Public && route.Perm != permAuthenticated && perm != string(route.Perm) {
+			t.Errorf("%s %s: x-permission %q, want %q", route.Method, route.Path, perm, route.Perm)
+		}
+	}
+
+	// 所有 $ref 都能在 components 中找到
+	for _, ref := range regexpRefs.FindAllStringSubmatch(body, -1) {
+		if _, ok := doc.Components.Schemas[ref[1]]; !ok && ref[0] != `"#/components/responses/Error"` {
+			t.Errorf("dangling reference %s", ref[0])
+		}
+	}
+	if req := doc.Components.Schemas["PeerAddRequest"].Required; strings.Join(req, ",") != "public_key,allowed_ips" {
+		t.Errorf("PeerAddRequest required fields %q", req)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	tu := newTestUI(t)
+	token := tu.token("root", RoleAdmin, ScopePeers)
+	tests := []struct {
+		name         string
+		token        string
+		method, path string
+		body         string
+		status       int
+		code         string
+	}{
+		{"unknown endpoint", token, http.MethodGet, "/api/v1/nope", "", http.StatusNotFound, ErrCodeNotFound},
+		{"method not allowed", token, http.MethodPatch, "/api/v1/peers", "", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+		{"invalid json", token, http.MethodPost, "/api/v1/peers", "{", http.StatusBadRequest, ErrCodeInvalidJSON},
+		{"invalid key", token, http.MethodGet, "/api/v1/peers/abc", "", http.StatusBadRequest, ErrCodeInvalidKey},
+		{"missing peer", token, http.MethodGet, "/api/v1/peers/" + url.PathEscape(testKey(9)), "", http.StatusNotFound, ErrCodeNotFound},
+		{"unauthenticated", "", http.MethodGet, "/api/v1/status", "", http.StatusUnauthorized, ErrCodeUnauthorized},
+	}
+	for _, tt := range tests {
+		var header []string
+		if tt.token != "" {
+			header = []string{"Authorization", "Bearer " + tt.token}
+		}
+		resp, body := tu.do(nil, tt.method, tt.path, tt.body, header...)
+		var env ErrorEnvelope
+		if err := json.Unmarshal([]byte(body), &env); err != nil || resp.StatusCode != tt.status || env.Error.Code != tt.code || env.Error.Status != tt.status || env.Error.Message == "" {
+			t.Errorf("%s: %d %s, want %d %q", tt.name, resp.StatusCode, body, tt.status, tt.code)
+		}
+		if tt.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != "GET, POST" {
+			t.Errorf("%s: Allow %q", tt.name, resp.Header.Get("Allow"))
+		}
+	}
+
+	// 旧接口保持原有的 {"error": "..."} 格式
+	resp, body := tu.do(nil, http.MethodGet, "/api/status", "")
+	var legacy map[string]string
+	if err := json.Unmarshal([]byte(body), &legacy); err != nil || resp.StatusCode != http.StatusUnauthorized || legacy["error"] == "" {
+		t.Errorf("legacy error: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestLegacyAliases(t *testing.T) {
+	tu := newTestUI(t)
+	token := tu.token("root", RoleAdmin, ScopeStatusRead, ScopePeers)
+	key := url.PathEscape(testKey(9))
+	tests := []struct {
+		method, path string
+		successor    string
+	}{
+		{http.MethodGet, "/api/status", "/api/v1/status"},
+		{http.MethodGet, "/api/invites/list", "/api/v1/invites"},
+		{http.MethodGet, "/api/peers/" + key + "/diagnose", "/api/v1/peers/" + key + "/diagnose"},
+		{http.MethodPost, "/api/peers/" + key + "/speedtest", "/api/v1/peers/" + key + "/speedtest"},
+		{http.MethodGet, "/api/peers/" + key + "/history", ""},
+		{http.MethodGet, "/api/v1/status", ""},
+		{http.MethodGet, "/api/v1/peers/" + key + "/diagnose", ""},
+	}
+	for _, tt := range tests {
+		resp, _ := tu.bearer(token, tt.method, tt.path, "")
+		deprecated := resp.Header.Get("Deprecation") == "true"
+		link := resp.Header.Get("Link")
+		if deprecated != (tt.successor != "") || (deprecated && link != "<"+tt.successor+`>; rel="successor-version"`) {
+			t.Errorf("%s %s: Deprecation %v, Link %q; want successor %q", tt.method, tt.path, deprecated, link, tt.successor)
+		}
+	}
+}
+
+func TestInviteRemoveMethod(t *testing.T) {
+	tu := newTestUI(t)
+	token := tu.token("root", RoleAdmin, ScopeInvites)
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		resp, _ := tu.bearer(token, method, "/api/invites/remove", `{"token": "abc"}`)
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+			t.Errorf("%s: %d, Allow %q", method, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+	}
+}
+
+func TestExpandSuccessor(t *testing.T) {
+	tests := []struct{ pattern, path, successor, want string }{
+		{"/api/status", "/api/status", "/api/v1/status", "/api/v1/status"},
+		{"/api/peers/{key}/diagnose", "/api/peers/ab%2Fcd/diagnose", "/api/v1/peers/{key}/diagnose", "/api/v1/peers/ab%2Fcd/diagnose"},
+		{"GET /api/x/{a}/{b}", "/api/x/1/2", "/api/v1/x/{b}/{a}", "/api/v1/x/2/1"},
+	}
+	for _, tt := range tests {
+		if got := expandSuccessor(tt.pattern, tt.path, tt.successor); got != tt.want {
+			t.Errorf("expandSuccessor(%q, %q) = %q, want %q", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// audit.go - 安全审计日志
+// 每条记录一行 JSON，追加写入 wg_data/audit.log，同时在内存保留最近的记录供接口查询
+
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	auditRecentSize    = 500         // 内存中保留的最近记录条数
+	auditFlushInterval = time.Second // 缓冲写入的最长落盘延迟
+)
+
+// 审计事件类型
+const (
+	AuditLoginSuccess   = "login.success"
+	AuditLoginFailure   = "login.failure"
+	AuditLockout        = "lockout"
+	AuditRateLimited    = "rate_limited"
+	AuditLogout         = "logout"
+	AuditPasswordChange = "password.change"
+	AuditCSRFRejected   = "csrf.rejected"
+	AuditInviteInvalid  = "invite.invalid"
+	AuditRegister       = "register"
+	AuditUserChange     = "user.change"
+	AuditRoleChange     = "role.change"
+	AuditTokenChange    = "token.change"
+	AuditWebhookChange  = "webhook.change"
+	AuditMQTTCommand    = "mqtt.command" // 收到或下发 MQTT 指令
+	AuditMQTTRotate     = "mqtt.rotate"  // 设备 rotate 后替换 Peer 公钥
+	AuditSpeedtest      = "speedtest"    // 发起隧道内吞吐测试
+	AuditAdminDenied    = "admin.denied"
+)
+
+// AuditEntry 单条审计记录
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Actor      string    `json:"actor,omitempty"`       // 操作者或尝试登录的用户名
+	RemoteAddr string    `json:"remote_addr,omitempty"` // 来源 IP
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// AuditLog 审计日志写入器
+type AuditLog struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	buf    *bufio.Writer
+	timer  *time.Timer
+	recent []AuditEntry
+}
+
+// auditLogPath 审计日志与配置文件放在同一目录
+func auditLogPath() string {
+	return filepath.Join(filepath.Dir(dataPath), "audit.log")
+}
+
+// NewAuditLog 创建审计日志，文件在首次写入时打开
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Record 追加一条审计记录，写入失败时仍保留在内存中
+func (a *AuditLog) Record(e AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.recent = append(a.recent, e)
+	if len(a.recent) > auditRecentSize {
+		a.recent = append([]AuditEntry(nil), a.recent[len(a.recent)-auditRecentSize:]...)
+	}
+
+	if a.buf == nil {
+		if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+			return
+		}
+		f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return
+		}
+		a.file = f
+		a.buf = bufio.NewWriter(f)
+	}
+	line, _ := json.Marshal(e)
+	a.buf.Write(append(line, '\n'))
+	if a.timer == nil {
+		a.timer = time.AfterFunc(auditFlushInterval, func() { a.Flush() })
+	}
+}
+
+// Recent 返回最近的审计记录 (新记录在前)，limit <= 0 返回全部
+func (a *AuditLog) Recent(limit int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := len(a.recent)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]AuditEntry, 0, limit)
+	for i := n - 1; i >= n-limit; i-- {
+		out = append(out, a.recent[i])
+	}
+	return out
+}
+
+// Flush 将缓冲区写入磁盘
+func (a *AuditLog) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked()
+}
+
+func (a *AuditLog) flushLocked() error {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	if a.buf == nil {
+		return nil
+	}
+	return a.buf.Flush()
+}
+
+// Close 落盘并关闭文件
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.flushLocked()
+	if a.file != nil {
+		if cerr := a.file.Close(); err == nil {
+			err = cerr
+		}
+		a.file = nil
+		a.buf = nil
+	}
+	return err
+}
+
+// auditRequest 以当前请求的认证主体与来源 IP 记录审计事件
+func (ui *WebUI) auditRequest(r *http.Request, event, detail string) {
+	ui.audit.Record(AuditEntry{
+		Event:      event,
+		Actor:      currentUser(r),
+		RemoteAddr: remoteAddr(r).String(),
+		Detail:     detail,
+	})
+}
+
+// handleAudit 查询最近的审计记录
+// GET /api/audit?limit=100
+func (ui *WebUI) handleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	json.NewEncoder(w).Encode(ui.audit.Recent(limit))
+}
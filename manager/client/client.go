@@ -0,0 +1,368 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// Package client 管理端 HTTP API 的 Go 客户端。
+//
+// 覆盖状态、Peer、邀请码、注册入驻、系统设置与事件流，请求与响应使用带类型的结构体，
+// 服务端错误以 *APIError 返回 (可用 errors.Is 按 ErrNotFound 等分类判断)。
+// 认证使用 API 令牌 (WithToken) 或账号密码登录得到的会话 Cookie (Login)，
+// 会话方式下写请求自动附带 CSRF 令牌。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+const (
+	apiPrefix      = "/api/v1"
+	csrfCookieName = "wg_ui_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	errorBodyLimit = 64 << 10
+)
+
+// Client 管理端 API 客户端，可并发使用
+type Client struct {
+	base  *url.URL
+	http  *http.Client
+	token string
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithToken 使用 API 令牌认证 (Authorization: Bearer)
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient 使用自定义的 http.Client (如固定证书指纹、代理、超时)
+// 事件流是长连接，需要订阅事件时不要设置 Timeout，改用 context 控制
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New 创建客户端，baseURL 为 WebUI 地址 (如 https://vpn.example.com:8080)
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q, use http:// or https://", baseURL)
+	}
+	c := &Client{base: base, http: &http.Client{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Login 以账号密码登录，之后的请求使用会话 Cookie
+// 账号需要先修改初始密码时返回 Code 为 CodePasswordChangeRequired 的 *APIError
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	hc := *c.http
+	if hc.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+		hc.Jar = jar
+	}
+	c.http = &hc
+
+	form := url.Values{"username": {username}, "password": {password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/login", nil), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	noRedirect := hc
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, errorBodyLimit))
+
+	// 登录结果通过跳转地址表达：失败回到 /login?error=...
+	loc, _ := resp.Location()
+	switch {
+	case resp.StatusCode != http.StatusFound || loc == nil:
+		return &APIError{StatusCode: resp.StatusCode, Code: CodeInternal, Message: "unexpected login response"}
+	case loc.Path == "/login":
+		switch loc.Query().Get("error") {
+		case "rate", "locked":
+			return &APIError{StatusCode: http.StatusTooManyRequests, Code: CodeRateLimited, Message: "too many login attempts"}
+		}
+		return &APIError{StatusCode: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "invalid username or password"}
+	case loc.Path == "/account/password":
+		return &APIError{StatusCode: http.StatusForbidden, Code: CodePasswordChangeRequired, Message: "password change required, sign in to the WebUI first"}
+	}
+	return nil
+}
+
+// url 拼接请求地址
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.base
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// csrfToken 返回会话 Cookie 对应的 CSRF 令牌
+func (c *Client) csrfToken() string {
+	if c.http.Jar == nil {
+		return ""
+	}
+	for _, ck := range c.http.Jar.Cookies(c.base) {
+		if ck.Name == csrfCookieName {
+			return ck.Value
+		}
+	}
+	return ""
+}
+
+// newRequest 创建带认证信息的请求
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, in any) (*http.Request, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if method != http.MethodGet && method != http.MethodHead {
+		if token := c.csrfToken(); token != "" {
+			req.Header.Set(csrfHeaderName, token)
+		}
+	}
+	return req, nil
+}
+
+// do 发送请求，2xx 时把响应体解析到 out (可为 nil)，否则返回 *APIError
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	req, err := c.newRequest(ctx, method, path, nil, in)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
+		return parseError(resp.StatusCode, body)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// pathKey 把 Base64 公钥转为可放进路径的 URL 安全 Base64
+func pathKey(key string) string {
+	return strings.NewReplacer("+", "-", "/", "_").Replace(strings.TrimRight(key, "="))
+}
+
+// ========== 状态与 Peer ==========
+
+// Status 返回设备与 Peer 状态
+func (c *Client) Status(ctx context.Context) (DeviceInfo, error) {
+	var info DeviceInfo
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/status", nil, &info)
+	return info, err
+}
+
+// Peers 返回 Peer 列表
+func (c *Client) Peers(ctx context.Context) ([]PeerInfo, error) {
+	var peers []PeerInfo
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/peers", nil, &peers)
+	return peers, err
+}
+
+// Peer 按公钥 (Base64 或 Hex) 查询 Peer
+func (c *Client) Peer(ctx context.Context, publicKey string) (PeerInfo, error) {
+	var peer PeerInfo
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/peers/"+pathKey(publicKey), nil, &peer)
+	return peer, err
+}
+
+// AddPeer 添加 Peer，已存在时返回 ErrConflict
+func (c *Client) AddPeer(ctx context.Context, req PeerAddRequest) (PeerInfo, error) {
+	var peer PeerInfo
+	err := c.do(ctx, http.MethodPost, apiPrefix+"/peers", req, &peer)
+	return peer, err
+}
+
+// PutPeer 创建或整体替换 Peer (AllowedIPs、保活与标签以请求为准)
+func (c *Client) PutPeer(ctx context.Context, req PeerAddRequest) (PeerInfo, error) {
+	var peer PeerInfo
+	err := c.do(ctx, http.MethodPut, apiPrefix+"/peers/"+pathKey(req.PublicKey), req, &peer)
+	return peer, err
+}
+
+// RemovePeer 删除 Peer
+func (c *Client) RemovePeer(ctx context.Context, publicKey string) error {
+	return c.do(ctx, http.MethodDelete, apiPrefix+"/peers/"+pathKey(publicKey), nil, nil)
+}
+
+// DisablePeer 停用 Peer：从设备上移除，保留配置记录与标签
+func (c *Client) DisablePeer(ctx context.Context, publicKey string) (PeerInfo, error) {
+	var peer PeerInfo
+	err := c.do(ctx, http.MethodPost, apiPrefix+"/peers/"+pathKey(publicKey)+"/disable", nil, &peer)
+	return peer, err
+}
+
+// EnablePeer 重新启用已停用的 Peer
+func (c *Client) EnablePeer(ctx context.Context, publicKey string) (PeerInfo, error) {
+	var peer PeerInfo
+	err := c.do(ctx, http.MethodPost, apiPrefix+"/peers/"+pathKey(publicKey)+"/enable", nil, &peer)
+	return peer, err
+}
+
+// SetPeerTags 替换 Peer 的标签
+func (c *Client) SetPeerTags(ctx context.Context, publicKey string, tags []string) (PeerInfo, error) {
+	var peer PeerInfo
+	req := struct {
+		Tags []string `json:"tags"`
+	}{tags}
+	err := c.do(ctx, http.MethodPut, apiPrefix+"/peers/"+pathKey(publicKey)+"/tags", req, &peer)
+	return peer, err
+}
+
+// ========== 邀请码与注册 ==========
+
+// Invites 返回未过期的邀请码
+func (c *Client) Invites(ctx context.Context) ([]Invite, error) {
+	var invites []Invite
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/invites", nil, &invites)
+	return invites, err
+}
+
+// Invite 查询邀请码
+func (c *Client) Invite(ctx context.Context, token string) (Invite, error) {
+	var inv Invite
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/invites/"+url.PathEscape(token), nil, &inv)
+	return inv, err
+}
+
+// CreateInvite 生成邀请码，返回记录与入驻链接
+func (c *Client) CreateInvite(ctx context.Context, req InviteGenerateRequest) (InviteCreateResponse, error) {
+	var resp InviteCreateResponse
+	err := c.do(ctx, http.MethodPost, apiPrefix+"/invites", req, &resp)
+	return resp, err
+}
+
+// RevokeInvite 撤回邀请码
+func (c *Client) RevokeInvite(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodDelete, apiPrefix+"/invites/"+url.PathEscape(token), nil, nil)
+}
+
+// Register 使用邀请码注册本机，无需认证
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (RegisterResponse, error) {
+	var resp RegisterResponse
+	err := c.do(ctx, http.MethodPost, "/api/register", req, &resp)
+	return resp, err
+}
+
+// Enroll 让服务端所在节点 (客户端模式) 向远端服务端入驻
+func (c *Client) Enroll(ctx context.Context, req EnrollRequest) (RegisterResponse, error) {
+	var resp RegisterResponse
+	err := c.do(ctx, http.MethodPost, apiPrefix+"/enroll", req, &resp)
+	return resp, err
+}
+
+// ========== 系统设置 ==========
+
+// System 返回系统设置
+func (c *Client) System(ctx context.Context) (SystemConfig, error) {
+	var sys SystemConfig
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/system", nil, &sys)
+	return sys, err
+}
+
+// UpdateSystem 修改可在线修改的系统设置，返回修改后的设置
+func (c *Client) UpdateSystem(ctx context.Context, sys SystemConfig) (SystemConfig, error) {
+	var out SystemConfig
+	err := c.do(ctx, http.MethodPut, apiPrefix+"/system", sys, &out)
+	return out, err
+}
+
+// STUN 返回 STUN 应答端与最近一次探测的结果
+func (c *Client) STUN(ctx context.Context) (STUNStatus, error) {
+	var st STUNStatus
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/stun", nil, &st)
+	return st, err
+}
+
+// ProbeSTUN 让守护进程立即从 WireGuard 端口探测一次
+func (c *Client) ProbeSTUN(ctx context.Context) (STUNStatus, error) {
+	var st STUNStatus
+	err := c.do(ctx, http.MethodPost, apiPrefix+"/stun/probe", nil, &st)
+	return st, err
+}
+
+// PortMap 返回路由器端口映射状态
+func (c *Client) PortMap(ctx context.Context) (PortMapStatus, error) {
+	var st PortMapStatus
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/portmap", nil, &st)
+	return st, err
+}
+
+// Health 查询 /healthz，ready 为 true 时查询 /readyz；无需认证
+// 检查未通过时服务端返回 503，同样解析出结果，返回的 bool 表示该端点是否通过
+func (c *Client) Health(ctx context.Context, ready bool) (HealthReport, bool, error) {
+	path := "/healthz"
+	if ready {
+		path = "/readyz"
+	}
+	var report HealthReport
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return report, false, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return report, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
+		return report, false, parseError(resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return report, false, fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return report, resp.StatusCode == http.StatusOK, nil
+}
+
+// ApplyConfig 下发原始 UAPI 配置
+func (c *Client) ApplyConfig(ctx context.Context, uapi string) error {
+	req := struct {
+		Config string `json:"config"`
+	}{uapi}
+	return c.do(ctx, http.MethodPost, apiPrefix+"/config", req, nil)
+}
@@ -0,0 +1,146 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		code   string
+		msg    string
+	}{
+		{404, `{"error":{"status":404,"code":"not_found","message":"Peer not found"}}`, CodeNotFound, "Peer not found"},
+		{403, `{"error":{"status":403,"code":"out_of_scope","message":"no"}}`, CodeOutOfScope, "no"},
+		{400, `{"error":"Invalid or expired token"}`, CodeBadRequest, "Invalid or expired token"},
+		{429, "Too many requests\n", CodeRateLimited, "Too many requests"},
+		{500, "", CodeInternal, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		e := parseError(tt.status, []byte(tt.body))
+		if e.StatusCode != tt.status || e.Code != tt.code || e.Message != tt.msg {
+			t.Errorf("parseError(%d, %q) = %+v, want code %q message %q", tt.status, tt.body, e, tt.code, tt.msg)
+		}
+	}
+	if err := error(parseError(404, nil)); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) {
+		t.Errorf("errors.Is mismatch for %v", err)
+	}
+}
+
+func TestTokenAuthAndPathKey(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer wgt_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":{"status":401,"code":"invalid_token","message":"bad token"}}`)
+			return
+		}
+		if r.URL.Path != "/api/v1/peers/ab-_cd" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"status":404,"code":"not_found","message":"Peer not found"}}`)
+			return
+		}
+		io.WriteString(w, `{"public_key":"ab+/cd==","tags":["iot"]}`)
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, WithToken("wgt_test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := c.Peer(context.Background(), "ab+/cd==")
+	if err != nil || peer.PublicKey != "ab+/cd==" || len(peer.Tags) != 1 {
+		t.Fatalf("Peer = %+v, %v", peer, err)
+	}
+
+	anon, _ := New(ts.URL)
+	_, err = anon.Peers(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidToken || !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("unauthenticated Peers error = %v", err)
+	}
+}
+
+func TestLoginSendsCSRF(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("password") != "secret" {
+			http.Redirect(w, r, "/login?error=1", http.StatusFound)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "wg_ui_session", Value: "s1", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: csrfCookieName, Value: "c1", Path: "/"})
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/api/v1/invites/", func(w http.ResponseWriter, r *http.Request) {
+		if ck, err := r.Cookie("wg_ui_session"); err != nil || ck.Value != "s1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(csrfHeaderName) != "c1" {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"error":{"status":403,"code":"csrf_failed","message":"CSRF token missing"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c, _ := New(ts.URL)
+	if err := c.Login(context.Background(), "admin", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Login with wrong password = %v", err)
+	}
+	if err := c.Login(context.Background(), "admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RevokeInvite(context.Background(), "tok"); err != nil {
+		t.Fatalf("RevokeInvite = %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("types") != "peer.online,peer.offline" || r.Header.Get("Last-Event-ID") != "6" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "retry: 3000\n\n: keepalive\n\n")
+		for id := 7; id <= 8; id++ {
+			fmt.Fprintf(w, "id: %d\r\nevent: peer.online\r\ndata: {\"id\":%d,\"type\":\"peer.online\",\"peer\":\"k%d\"}\r\n\r\n", id, id, id)
+		}
+		io.WriteString(w, "id: 9\ndata: {\"id\":9") // 未结束的消息
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL)
+	stream, err := c.Events(context.Background(), EventOptions{Types: []string{"peer.online", "peer.offline"}, LastEventID: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for id := uint64(7); id <= 8; id++ {
+		e, err := stream.Next()
+		if err != nil || e.ID != id || e.Type != "peer.online" || e.Peer != fmt.Sprintf("k%d", id) {
+			t.Fatalf("Next = %+v, %v", e, err)
+		}
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Fatalf("Next at end = %v, want io.EOF", err)
+	}
+	if stream.LastEventID() != 8 {
+		t.Fatalf("LastEventID = %d, want 8", stream.LastEventID())
+	}
+}
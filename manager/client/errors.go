@@ -0,0 +1,113 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 错误码，与服务端 /api/v1 错误信封中的 code 一致
+const (
+	CodeBadRequest             = "bad_request"
+	CodeInvalidJSON            = "invalid_json"
+	CodeInvalidKey             = "invalid_key"
+	CodeUnauthorized           = "unauthorized"
+	CodeInvalidToken           = "invalid_token"
+	CodeForbidden              = "forbidden"
+	CodeInsufficientScope      = "insufficient_scope"
+	CodeOutOfScope             = "out_of_scope"
+	CodeCSRF                   = "csrf_failed"
+	CodePasswordChangeRequired = "password_change_required"
+	CodeNotFound               = "not_found"
+	CodeMethodNotAllowed       = "method_not_allowed"
+	CodeConflict               = "conflict"
+	CodeRateLimited            = "rate_limited"
+	CodeUpstream               = "upstream_error"
+	CodeInternal               = "internal_error"
+)
+
+// 按 HTTP 状态分类的错误，可用 errors.Is 判断
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// APIError 服务端返回的错误
+// /api/v1 接口带错误码；旧接口 (如 /api/register) 只有消息，Code 按状态码推断
+type APIError struct {
+	StatusCode int    `json:"status"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d, %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// Is 将状态码映射到分类错误
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// statusCodes 旧接口没有错误码时按状态码推断
+var statusCodes = map[int]string{
+	http.StatusBadRequest:       CodeBadRequest,
+	http.StatusUnauthorized:     CodeUnauthorized,
+	http.StatusForbidden:        CodeForbidden,
+	http.StatusNotFound:         CodeNotFound,
+	http.StatusMethodNotAllowed: CodeMethodNotAllowed,
+	http.StatusConflict:         CodeConflict,
+	http.StatusTooManyRequests:  CodeRateLimited,
+	http.StatusBadGateway:       CodeUpstream,
+}
+
+// parseError 解析错误响应体：错误信封 {"error": {...}}、旧格式 {"error": "..."} 或纯文本
+func parseError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status}
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && len(envelope.Error) > 0 {
+		if json.Unmarshal(envelope.Error, e) != nil {
+			json.Unmarshal(envelope.Error, &e.Message)
+		}
+		e.StatusCode = status
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.Code == "" {
+		e.Code = statusCodes[status]
+		if e.Code == "" {
+			e.Code = CodeInternal
+		}
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(status)
+	}
+	return e
+}
@@ -0,0 +1,101 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// EventOptions 订阅选项
+type EventOptions struct {
+	Types       []string // 只接收这些类型，为空时接收全部
+	LastEventID uint64   // 断线重连时补发 ID 大于该值的事件
+}
+
+// EventStream 事件流 (text/event-stream)
+type EventStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	lastID uint64
+}
+
+// Events 订阅实时事件，流在 ctx 取消或 Close 后结束
+func (c *Client) Events(ctx context.Context, opts EventOptions) (*EventStream, error) {
+	query := url.Values{}
+	if len(opts.Types) > 0 {
+		query.Set("types", strings.Join(opts.Types, ","))
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, apiPrefix+"/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if opts.LastEventID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(opts.LastEventID, 10))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
+		return nil, parseError(resp.StatusCode, body)
+	}
+	return &EventStream{body: resp.Body, reader: bufio.NewReader(resp.Body), lastID: opts.LastEventID}, nil
+}
+
+// Next 阻塞读取下一个事件，流结束时返回 io.EOF
+func (s *EventStream) Next() (Event, error) {
+	var data strings.Builder
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			// 未以空行结束的消息不完整，按规范丢弃
+			return Event{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// 空行结束一条消息；只有 retry 或注释的消息没有 data
+			if data.Len() == 0 {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return Event{}, fmt.Errorf("decode event: %w", err)
+			}
+			s.lastID = e.ID
+			return e, nil
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		// id 与 event 已包含在 data 的 JSON 中；retry 与注释 (keepalive) 忽略
+		if field == "data" {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+}
+
+// LastEventID 返回最近收到的事件 ID，重连时传给 EventOptions.LastEventID
+func (s *EventStream) LastEventID() uint64 {
+	return s.lastID
+}
+
+// Close 关闭事件流
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
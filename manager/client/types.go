@@ -0,0 +1,219 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PeerInfo 对等体状态
+type PeerInfo struct {
+	Remark            string        `json:"remark"`
+	PublicKey         string        `json:"public_key"` // Base64
+	Endpoint          string        `json:"endpoint"`
+	AllowedIPs        []string      `json:"allowed_ips"`
+	LastHandshake     string        `json:"last_handshake"` // 本地时间 "2006-01-02 15:04:05"，从未握手时为空
+	TxBytes           uint64        `json:"tx_bytes"`
+	RxBytes           uint64        `json:"rx_bytes"`
+	TotalBytes        uint64        `json:"total_bytes"`
+	LifetimeTxBytes   uint64        `json:"lifetime_tx_bytes"` // 跨重启累计
+	LifetimeRxBytes   uint64        `json:"lifetime_rx_bytes"`
+	IsRunning         bool          `json:"is_running"`
+	IsOnline          bool          `json:"is_online"` // 基于握手时间
+	KeepaliveInterval uint32        `json:"keepalive_interval"`
+	Tags              []string      `json:"tags,omitempty"`
+	Disabled          bool          `json:"disabled,omitempty"` // 已停用，只保留配置记录
+	Counters          *PeerCounters `json:"counters,omitempty"` // 旧版服务端或已停用的 Peer 为 nil
+}
+
+// PeerCounters 报文、丢包与握手计数，从 Peer 添加到设备时开始累计
+type PeerCounters struct {
+	TxPackets          uint64    `json:"tx_packets"`
+	RxPackets          uint64    `json:"rx_packets"`
+	Drops              PeerDrops `json:"drops"`
+	HandshakesSent     uint64    `json:"handshakes_sent"`
+	HandshakesReceived uint64    `json:"handshakes_received"`
+	HandshakesFailed   uint64    `json:"handshakes_failed"`
+	Rekeys             uint64    `json:"rekeys"`
+}
+
+// PeerDrops 按原因统计的丢包数
+type PeerDrops struct {
+	AllowedIPs     uint64 `json:"allowed_ips"`     // 内层源地址不在 AllowedIPs 中
+	Replay         uint64 `json:"replay"`          // 重放
+	Decrypt        uint64 `json:"decrypt"`         // 解密失败
+	StagedOverflow uint64 `json:"staged_overflow"` // 暂存队列已满
+	NoKeypair      uint64 `json:"no_keypair"`      // 没有可用的会话密钥
+	Oversize       uint64 `json:"oversize"`        // 内层包过大
+}
+
+// DeviceInfo 设备状态
+type DeviceInfo struct {
+	PublicKey  string     `json:"public_key"`
+	ListenPort uint16     `json:"listen_port"`
+	Peers      []PeerInfo `json:"peers"`
+	PeerCount  int        `json:"peer_count"`
+}
+
+// PeerAddRequest 添加或更新 Peer
+type PeerAddRequest struct {
+	PublicKey  string   `json:"public_key"`
+	AllowedIPs []string `json:"allowed_ips"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	Keepalive  int      `json:"persistent_keepalive,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// Invite 邀请码
+type Invite struct {
+	Token     string    `json:"token"`
+	Remark    string    `json:"remark"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// InviteGenerateRequest 生成邀请码
+type InviteGenerateRequest struct {
+	Remark   string   `json:"remark"`
+	Duration int      `json:"duration_hours"` // 有效期 (小时)
+	Tags     []string `json:"tags,omitempty"` // 注册后 Peer 自动带上的标签
+}
+
+// InviteCreateResponse 新建的邀请码与入驻链接
+type InviteCreateResponse struct {
+	Invite
+	URL string `json:"url"`
+}
+
+// RegisterRequest 使用邀请码注册 (公开接口，无需登录)
+type RegisterRequest struct {
+	Token     string `json:"token"`
+	PublicKey string `json:"public_key,omitempty"` // 留空时由服务端代生密钥对
+	Endpoint  string `json:"endpoint,omitempty"`   // 覆盖返回的服务端地址
+}
+
+// RegisterConfig 注册后分配的隧道配置
+type RegisterConfig struct {
+	PrivateKey string   `json:"private_key,omitempty"` // 服务端代生密钥时返回
+	Address    string   `json:"address"`               // 分配的隧道地址
+	PublicKey  string   `json:"public_key"`            // 服务端公钥
+	Endpoint   string   `json:"endpoint"`              // 服务端地址
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// RegisterResponse 注册与入驻的结果
+type RegisterResponse struct {
+	Status string         `json:"status"`
+	Config RegisterConfig `json:"config"`
+}
+
+// EnrollRequest 让目标节点 (客户端模式) 向远端服务端入驻
+type EnrollRequest struct {
+	Token       string `json:"token"`
+	Server      string `json:"server"`
+	Endpoint    string `json:"endpoint,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // 远端自签名证书的 SHA-256 指纹
+}
+
+// SystemConfig 系统设置
+// PUT 只修改可在线修改的字段；需重启生效的分组原样保留为 JSON，由调用方按需解析
+type SystemConfig struct {
+	PublicHost       string `json:"public_host"`
+	PublicPort       uint16 `json:"public_port"`
+	WebHost          string `json:"web_host"`
+	WebPort          uint16 `json:"web_port"`
+	InternalSubnet   string `json:"internal_subnet"`
+	ListenPort       uint16 `json:"listen_port"`
+	IsClient         bool   `json:"is_client"`
+	DefaultKeepalive int    `json:"default_keepalive"`
+
+	SessionIdleTimeout int      `json:"session_idle_timeout,omitempty"` // 分钟
+	SessionMaxAge      int      `json:"session_max_age,omitempty"`      // 小时
+	CORSOrigins        []string `json:"cors_origins,omitempty"`
+	LoginIPv6Prefix    int      `json:"login_ipv6_prefix,omitempty"`
+
+	TLS        json.RawMessage `json:"tls,omitempty"`
+	Management json.RawMessage `json:"management,omitempty"`
+	GRPC       json.RawMessage `json:"grpc,omitempty"`
+	Metrics    json.RawMessage `json:"metrics,omitempty"`
+	History    json.RawMessage `json:"history,omitempty"`
+	MQTT       json.RawMessage `json:"mqtt,omitempty"`
+	Speedtest  json.RawMessage `json:"speedtest,omitempty"`
+	STUN       json.RawMessage `json:"stun,omitempty"`
+	PortMap    json.RawMessage `json:"portmap,omitempty"`
+	Health     json.RawMessage `json:"health,omitempty"`
+	Shutdown   json.RawMessage `json:"shutdown,omitempty"`
+	UI         json.RawMessage `json:"ui,omitempty"`
+}
+
+// STUNServerResult 单个 STUN 服务器的探测结果
+type STUNServerResult struct {
+	Server string  `json:"server"`
+	Addr   string  `json:"addr,omitempty"`
+	Mapped string  `json:"mapped,omitempty"` // 服务器看到的本机地址
+	RTT    float64 `json:"rtt,omitempty"`    // 毫秒
+	Error  string  `json:"error,omitempty"`
+}
+
+// STUNResult 一次 STUN 探测的结果
+type STUNResult struct {
+	LocalPort     uint16             `json:"local_port"`
+	Mapped        string             `json:"mapped,omitempty"`
+	NATType       string             `json:"nat_type"` // none / endpoint-independent / endpoint-dependent / unknown / blocked
+	PortPreserved bool               `json:"port_preserved"`
+	Servers       []STUNServerResult `json:"servers"`
+}
+
+// STUNStatus STUN 应答端、公网地址与 NAT 类型
+type STUNStatus struct {
+	Mode           string      `json:"mode"` // client / server
+	Responder      []string    `json:"responder,omitempty"`
+	PublicEndpoint string      `json:"public_endpoint,omitempty"`
+	Discovered     bool        `json:"discovered,omitempty"`
+	Checked        *time.Time  `json:"checked,omitempty"`
+	Result         *STUNResult `json:"result,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// PortMapStatus 路由器端口映射状态
+type PortMapStatus struct {
+	Enabled      bool       `json:"enabled"`
+	Protocol     string     `json:"protocol,omitempty"` // pcp / nat-pmp / upnp
+	Gateway      string     `json:"gateway,omitempty"`
+	InternalPort uint16     `json:"internal_port,omitempty"`
+	External     string     `json:"external,omitempty"`
+	ExternalPort uint16     `json:"external_port,omitempty"`
+	Lifetime     int        `json:"lifetime,omitempty"` // 秒，0 为永久
+	Expires      *time.Time `json:"expires,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// HealthCheck 单项健康检查结果
+type HealthCheck struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"` // ok / fail / skip
+	Liveness bool    `json:"liveness,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// HealthReport /healthz 与 /readyz 的响应
+type HealthReport struct {
+	Status string        `json:"status"`           // ok / degraded / fail
+	Checks []HealthCheck `json:"checks,omitempty"` // 未带 status.read 权限的令牌时为空
+	Time   time.Time     `json:"time"`
+}
+
+// Event 管理事件
+type Event struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Peer   string    `json:"peer,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
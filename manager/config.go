@@ -1,13 +1,14 @@
 package manager
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"net/netip"
 	"net/url"
 	"os"
@@ -19,14 +20,19 @@ import (
 	"time"
 
 	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/manager/client"
 )
 
 // Config 核心配置结构
 type Config struct {
-	System   SystemConfig   `json:"system"`
-	Identity IdentityConfig `json:"identity"`
-	Peers    []PeerRecord   `json:"peers"`
-	Invites  []Invite       `json:"invites"`
+	System    SystemConfig   `json:"system"`
+	Identity  IdentityConfig `json:"identity"`
+	Peers     []PeerRecord   `json:"peers"`
+	Invites   []Invite       `json:"invites"`
+	Users     []User         `json:"users"`
+	APITokens []APIToken     `json:"api_tokens"`
+	Roles     []Role         `json:"roles,omitempty"`    // 自定义角色 (内置 viewer/operator/admin 不落盘)
+	Webhooks  []Webhook      `json:"webhooks,omitempty"` // 出站 Webhook 订阅
 }
 
 // SystemConfig 系统级网络设置
@@ -39,6 +45,42 @@ type SystemConfig struct {
 	ListenPort       uint16 `json:"listen_port"`       // UDP 本地监听端口
 	IsClient         bool   `json:"is_client"`         // 标记是否为客户端
 	DefaultKeepalive int    `json:"default_keepalive"` // 新 Peer 默认的 PersistentKeepalive (秒)
+
+	SessionIdleTimeout int `json:"session_idle_timeout,omitempty"` // WebUI 会话空闲超时 (分钟)，0 为默认 30 分钟
+	SessionMaxAge      int `json:"session_max_age,omitempty"`      // WebUI 会话绝对有效期 (小时)，0 为默认 12 小时
+
+	CORSOrigins []string `json:"cors_origins,omitempty"` // 允许跨域调用 API 的来源 (如 https://ops.example.com)，空为禁止跨域
+
+	LoginIPv6Prefix int `json:"login_ipv6_prefix,omitempty"` // IPv6 来源按该长度的前缀合并限流与锁定，0 为默认 64，修改后需重启
+
+	TLS        TLSConfig        `json:"tls"`        // WebUI HTTPS 设置，修改后需重启
+	Management ManagementConfig `json:"management"` // 公开入口与管理面分离，修改后需重启
+	GRPC       GRPCConfig       `json:"grpc"`       // gRPC 控制接口，修改后需重启
+	Metrics    MetricsConfig    `json:"metrics"`    // Prometheus 指标
+	History    HistoryConfig    `json:"history"`    // Peer 流量与在线历史
+	MQTT       MQTTConfig       `json:"mqtt"`       // MQTT 信令桥，修改后需重启
+	Speedtest  SpeedtestConfig  `json:"speedtest"`  // 隧道内吞吐测试
+	STUN       STUNConfig       `json:"stun"`       // STUN 应答端与公网地址探测
+	PortMap    PortMapConfig    `json:"portmap"`    // 路由器端口映射 (PCP / NAT-PMP / UPnP-IGD)，修改后需重启
+	Health     HealthConfig     `json:"health"`     // /healthz 与 /readyz 的检查设置
+	Shutdown   ShutdownConfig   `json:"shutdown"`   // 退出时的等待时间与最后的 keepalive
+	UI         UIConfig         `json:"ui"`         // WebUI 品牌与页面定制，修改后需重启
+}
+
+// sessionIdleTimeout 返回生效的会话空闲超时
+func (s *SystemConfig) sessionIdleTimeout() time.Duration {
+	if s.SessionIdleTimeout > 0 {
+		return time.Duration(s.SessionIdleTimeout) * time.Minute
+	}
+	return defaultSessionIdleTimeout
+}
+
+// sessionMaxAge 返回生效的会话绝对有效期
+func (s *SystemConfig) sessionMaxAge() time.Duration {
+	if s.SessionMaxAge > 0 {
+		return time.Duration(s.SessionMaxAge) * time.Hour
+	}
+	return defaultSessionMaxAge
 }
 
 // IdentityConfig 服务端身份
@@ -53,14 +95,17 @@ type PeerRecord struct {
 	AllowedIPs          []string `json:"allowed_ips"`          // 分配的内网 IP
 	Endpoint            string   `json:"endpoint"`             // 如果是连接上游，需要带端口
 	PersistentKeepalive int      `json:"persistent_keepalive"` // 持久保活间隔 (秒)，0 为关闭
+	Tags                []string `json:"tags,omitempty"`       // 标签，用于角色授权范围等
+	Disabled            bool     `json:"disabled,omitempty"`   // 已停用：保留记录但不下发到设备
 }
 
 // Invite 邀请码记录
 type Invite struct {
-	Token     string    `json:"token"`      // 随机令牌
-	Remark    string    `json:"remark"`     // 预设备注
-	ExpiresAt time.Time `json:"expires_at"` // 过期时间
-	CreatedAt time.Time `json:"created_at"` // 创建时间
+	Token     string    `json:"token"`          // 随机令牌
+	Remark    string    `json:"remark"`         // 预设备注
+	ExpiresAt time.Time `json:"expires_at"`     // 过期时间
+	CreatedAt time.Time `json:"created_at"`     // 创建时间
+	Tags      []string  `json:"tags,omitempty"` // 通过该邀请注册的 Peer 自动带上的标签
 }
 
 // EnsureIdentity 确保服务端身份存在，如果不存在则生成并保存
@@ -79,6 +124,9 @@ var (
 	dataPath   = "wg_data/config.json"
 )
 
+// inviteTokenBytes 邀请码随机字节数 (128 位)
+const inviteTokenBytes = 16
+
 // LoadConfig 从磁盘加载配置，如果文件不存在则创建一个空的初始化配置
 func LoadConfig() (*Config, error) {
 	configLock.RLock()
@@ -133,6 +181,16 @@ func SaveConfig(conf *Config) error {
 	return os.Rename(tmpPath, dataPath)
 }
 
+// hexToB64 将 UAPI 的 Hex 密钥转换为 Base64，已是 Base64 时原样返回
+func hexToB64(key string) string {
+	if len(key) == 64 {
+		if data, err := hex.DecodeString(key); err == nil {
+			return base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return key
+}
+
 // b64ToHex 将 Base64 编码的密钥转换为 UAPI 要求的 Hex 编码
 func b64ToHex(b64Str string) string {
 	data, err := base64.StdEncoding.DecodeString(b64Str)
@@ -156,16 +214,10 @@ func (c *Config) ApplyToDevice(dev *device.Device) error {
 
 	// 2. 处理 Peers
 	for _, peer := range c.Peers {
-		uapi.WriteString(fmt.Sprintf("public_key=%s\n", b64ToHex(peer.PublicKey)))
-		for _, ip := range peer.AllowedIPs {
-			uapi.WriteString(fmt.Sprintf("allowed_ip=%s\n", ip))
-		}
-		if peer.Endpoint != "" {
-			uapi.WriteString(fmt.Sprintf("endpoint=%s\n", peer.Endpoint))
-		}
-		if peer.PersistentKeepalive > 0 {
-			uapi.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", peer.PersistentKeepalive))
+		if peer.Disabled {
+			continue
 		}
+		uapi.WriteString(peerUAPI(peer))
 	}
 
 	// 3. 执行注入
@@ -175,6 +227,22 @@ func (c *Config) ApplyToDevice(dev *device.Device) error {
 	return nil
 }
 
+// peerUAPI 生成单个 Peer 的 UAPI 配置段
+func peerUAPI(peer PeerRecord) string {
+	var uapi strings.Builder
+	uapi.WriteString(fmt.Sprintf("public_key=%s\n", b64ToHex(peer.PublicKey)))
+	for _, ip := range peer.AllowedIPs {
+		uapi.WriteString(fmt.Sprintf("allowed_ip=%s\n", ip))
+	}
+	if peer.Endpoint != "" {
+		uapi.WriteString(fmt.Sprintf("endpoint=%s\n", peer.Endpoint))
+	}
+	if peer.PersistentKeepalive > 0 {
+		uapi.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", peer.PersistentKeepalive))
+	}
+	return uapi.String()
+}
+
 // ConfigureInterface 自动化配置系统网卡 (针对 macOS/Linux)
 func (c *Config) ConfigureInterface(interfaceName string) error {
 	ip := c.System.InternalSubnet
@@ -259,19 +327,119 @@ func (c *Config) SyncFromDevice(dev *device.Device) {
 	c.System.ListenPort = dev.GetListenPort()
 
 	// 2. 同步 Peers
+	// 标签等元数据只存在于 Config 中，设备上没有，需要按公钥从旧记录中继承
+	previous := make(map[string]PeerRecord, len(c.Peers))
+	for _, p := range c.Peers {
+		previous[p.PublicKey] = p
+	}
 	var newPeers []PeerRecord
 	dev.ForEachPeer(func(p *device.Peer) {
-		newPeers = append(newPeers, PeerRecord{
+		record := PeerRecord{
 			PublicKey:           p.GetPublicKey(),
 			Remark:              p.Remark,
 			AllowedIPs:          p.GetAllowedIPList(),
 			Endpoint:            p.GetEndpoint(),
 			PersistentKeepalive: int(p.GetKeepaliveInterval()),
-		})
+		}
+		if old, ok := previous[record.PublicKey]; ok {
+			record.Tags = old.Tags
+			if record.Remark == "" {
+				record.Remark = old.Remark
+			}
+		}
+		newPeers = append(newPeers, record)
+		delete(previous, record.PublicKey)
 	})
+	// 停用的 Peer 不在设备上，原样保留
+	for _, p := range c.Peers {
+		if _, ok := previous[p.PublicKey]; ok && p.Disabled {
+			newPeers = append(newPeers, p)
+		}
+	}
 	c.Peers = newPeers
 }
 
+// DisabledPeers 返回已停用的 Peer 记录
+func (c *Config) DisabledPeers() []PeerRecord {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	var peers []PeerRecord
+	for _, p := range c.Peers {
+		if p.Disabled {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// SetPeerDisabled 设置 Peer 的停用状态，返回修改前的记录；Peer 不存在时返回 false
+func (c *Config) SetPeerDisabled(publicKey string, disabled bool) (PeerRecord, bool) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i, p := range c.Peers {
+		if p.PublicKey == publicKey {
+			c.Peers[i].Disabled = disabled
+			return p, true
+		}
+	}
+	return PeerRecord{}, false
+}
+
+// DeletePeer 从配置中删除 Peer 记录 (包括已停用的)
+func (c *Config) DeletePeer(publicKey string) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i, p := range c.Peers {
+		if p.PublicKey == publicKey {
+			c.Peers = append(c.Peers[:i], c.Peers[i+1:]...)
+			return
+		}
+	}
+}
+
+// HasPeer 判断 Peer 是否已在配置中
+func (c *Config) HasPeer(publicKey string) bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, p := range c.Peers {
+		if p.PublicKey == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerTags 返回 Peer 的标签
+func (c *Config) PeerTags(publicKey string) []string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, p := range c.Peers {
+		if p.PublicKey == publicKey {
+			return p.Tags
+		}
+	}
+	return nil
+}
+
+// SetPeerTags 设置 Peer 的标签
+func (c *Config) SetPeerTags(publicKey string, tags []string) bool {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i := range c.Peers {
+		if c.Peers[i].PublicKey == publicKey {
+			c.Peers[i].Tags = normalizeTags(tags)
+			return true
+		}
+	}
+	return false
+}
+
 // GetNextAvailableIP 查找下一个可用的内网 IP (Phase 3)
 func (c *Config) GetNextAvailableIP() (string, error) {
 	configLock.RLock()
@@ -304,6 +472,10 @@ func (c *Config) GetNextAvailableIP() (string, error) {
 		if addr.As4()[3] == 1 {
 			continue
 		}
+		// 跳过 netstack 管理地址
+		if c.System.reservedAddr(addr) {
+			continue
+		}
 		if !usedIPs[addr.String()] {
 			return addr.String() + "/32", nil
 		}
@@ -313,12 +485,12 @@ func (c *Config) GetNextAvailableIP() (string, error) {
 }
 
 // GenerateInvite 生成一个新的邀请码 (Phase 3)
-func (c *Config) GenerateInvite(remark string, duration time.Duration) (string, error) {
+func (c *Config) GenerateInvite(remark string, duration time.Duration, tags []string) (string, error) {
 	configLock.Lock()
 	defer configLock.Unlock()
 
-	// 生成 12 位随机 Token
-	b := make([]byte, 9)
+	// 生成 128 位随机 Token (32 位十六进制)
+	b := make([]byte, inviteTokenBytes)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
@@ -329,6 +501,7 @@ func (c *Config) GenerateInvite(remark string, duration time.Duration) (string,
 		Remark:    remark,
 		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(duration),
+		Tags:      normalizeTags(tags),
 	}
 
 	c.Invites = append(c.Invites, invite)
@@ -342,7 +515,7 @@ func (c *Config) ValidateInvite(token string) (*Invite, bool) {
 
 	cleanToken := strings.ToUpper(strings.TrimSpace(token))
 	for _, inv := range c.Invites {
-		if strings.ToUpper(inv.Token) == cleanToken {
+		if subtle.ConstantTimeCompare([]byte(strings.ToUpper(inv.Token)), []byte(cleanToken)) == 1 {
 			// 终极修复：给足 24 小时的额外宽限，彻底解决时钟漂移和 0 秒过期问题
 			if time.Now().Before(inv.ExpiresAt.Add(24 * time.Hour)) {
 				return &inv, true
@@ -352,6 +525,26 @@ func (c *Config) ValidateInvite(token string) (*Invite, bool) {
 	return nil, false
 }
 
+// ListInvites 返回邀请码列表副本
+func (c *Config) ListInvites() []Invite {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return append([]Invite{}, c.Invites...)
+}
+
+// FindInvite 按 Token 查找邀请码 (不校验有效期)
+func (c *Config) FindInvite(token string) (Invite, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, inv := range c.Invites {
+		if inv.Token == token {
+			return inv, true
+		}
+	}
+	return Invite{}, false
+}
+
 // RemoveInvite 消耗/删除邀请码
 func (c *Config) RemoveInvite(token string) {
 	configLock.Lock()
@@ -367,7 +560,7 @@ func (c *Config) RemoveInvite(token string) {
 
 // RemoteEnroll 通过邀请链接或 Token 远程注册入网
 func (c *Config) RemoteEnroll(joinURL string) error {
-	var token, apiBase, endpointOverride string
+	var token, apiBase, endpointOverride, fingerprint string
 
 	if strings.Contains(joinURL, "/join/") {
 		parsed, err := url.Parse(joinURL)
@@ -380,6 +573,7 @@ func (c *Config) RemoteEnroll(joinURL string) error {
 		}
 		token = parts[1]
 		endpointOverride = parsed.Query().Get("endpoint")
+		fingerprint = parsed.Query().Get(fingerprintQueryKey)
 		apiBase = fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
 	} else {
 		return fmt.Errorf("please provide a full join URL (e.g., http://server:8080/join/TOKEN)")
@@ -387,37 +581,25 @@ func (c *Config) RemoteEnroll(joinURL string) error {
 
 	fmt.Printf("🚀 正在尝试加入网络: %s\n", apiBase)
 
-	// 准备注册请求
-	payload := map[string]string{
-		"token": token,
+	// 邀请链接带有证书指纹时 (服务端使用自签名证书)，按指纹校验服务端身份
+	if !strings.HasPrefix(apiBase, "https://") {
+		fingerprint = ""
 	}
-	if strings.TrimSpace(endpointOverride) != "" {
-		payload["endpoint"] = endpointOverride
+	api, err := client.New(apiBase, client.WithHTTPClient(enrollHTTPClient(fingerprint)))
+	if err != nil {
+		return err
 	}
-	reqBody, _ := json.Marshal(payload)
-
-	resp, err := http.Post(apiBase+"/api/register", "application/json", bytes.NewBuffer(reqBody))
+	reg, err := api.Register(context.Background(), client.RegisterRequest{
+		Token:    token,
+		Endpoint: strings.TrimSpace(endpointOverride),
+	})
 	if err != nil {
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) {
+			return fmt.Errorf("server returned error (status %d): %s", apiErr.StatusCode, apiErr.Message)
+		}
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned error (status %d)", resp.StatusCode)
-	}
-
-	var reg struct {
-		Config struct {
-			PrivateKey string   `json:"private_key"`
-			Address    string   `json:"address"`
-			PublicKey  string   `json:"public_key"`
-			Endpoint   string   `json:"endpoint"`
-			AllowedIPs []string `json:"allowed_ips"`
-		} `json:"config"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&reg); err != nil {
-		return fmt.Errorf("failed to decode server response: %w", err)
-	}
 
 	// 将获取到的配置写入本地 Config
 	c.Identity.PrivateKey = reg.Config.PrivateKey
@@ -0,0 +1,571 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// diagnose.go - Peer 连通性诊断 GET /api/peers/{key}/diagnose
+// 从网关向 Peer 的隧道地址发送 ICMP Echo，统计 RTT 与丢包，同时给出握手、Endpoint、
+// 最后收包时间与 AllowedIPs 覆盖情况。请求 text/event-stream 时逐个探测推送结果。
+
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+const (
+	defaultDiagnoseCount    = 4
+	maxDiagnoseCount        = 20
+	defaultDiagnoseInterval = time.Second
+	minDiagnoseInterval     = 200 * time.Millisecond
+	maxDiagnoseInterval     = 5 * time.Second
+	defaultDiagnoseTimeout  = 2 * time.Second // 单个探测等待回复的时间
+	maxDiagnoseTimeout      = 10 * time.Second
+	defaultDiagnoseSize     = 56 // 与 ping 默认负载一致
+	maxDiagnoseSize         = 1400
+	maxDiagnoseDuration     = time.Minute // 单次诊断的总时长上限
+	diagnoseConcurrency     = 4           // 同时进行的诊断数
+	diagnoseTokenSize       = 8           // 负载开头的随机标识，用于区分其他 ping 进程的回复
+	hiddenPeer              = "hidden"    // 超出角色标签范围的 Peer 不显示公钥
+)
+
+// PeerDiagnosis Peer 诊断结果
+type PeerDiagnosis struct {
+	PublicKey         string             `json:"public_key"`
+	Remark            string             `json:"remark,omitempty"`
+	Target            string             `json:"target"`           // ICMP 目标地址
+	Source            string             `json:"source,omitempty"` // 探测源地址，空为由主机路由决定
+	Method            string             `json:"method,omitempty"` // netstack / icmp / icmp-raw
+	Endpoint          string             `json:"endpoint"`
+	Online            bool               `json:"online"`                   // 基于握手时间
+	LastHandshake     *time.Time         `json:"last_handshake,omitempty"` // 从未握手时省略
+	HandshakeAge      float64            `json:"handshake_age,omitempty"`  // 距最后握手的秒数
+	LastReceive       *time.Time         `json:"last_receive,omitempty"`   // 最后收到该 Peer 数据包 (含保活) 的时间
+	ReceiveAge        float64            `json:"receive_age,omitempty"`    // 距最后收包的秒数
+	HandshakeAttempts uint32             `json:"handshake_attempts"`       // 当前握手的重试次数
+	Coverage          AllowedIPsCoverage `json:"coverage"`                 // AllowedIPs 覆盖情况
+	Ping              PingStats          `json:"ping"`                     // ICMP 统计
+	Probes            []PingProbe        `json:"probes"`                   // 逐个探测结果
+	PingError         string             `json:"ping_error,omitempty"`     // 无法发送 ICMP 时的原因
+	Started           time.Time          `json:"started"`                  // 诊断开始时间
+	Duration          float64            `json:"duration"`                 // 诊断耗时 (秒)
+	Canceled          bool               `json:"canceled,omitempty"`       // 客户端断开或超过总时长，探测未全部完成
+
+	peer *device.Peer
+}
+
+// AllowedIPsCoverage 目标地址与 AllowedIPs 的关系
+type AllowedIPsCoverage struct {
+	AllowedIPs []string            `json:"allowed_ips"`         // 设备上该 Peer 的 AllowedIPs
+	InSubnet   bool                `json:"in_subnet"`           // 目标位于 internal_subnet 内
+	Routed     bool                `json:"routed"`              // 设备把发往目标的数据包交给该 Peer
+	RoutedTo   string              `json:"routed_to,omitempty"` // 目标被路由到其他 Peer 时为其公钥，超出角色范围时为 hidden
+	Conflicts  []AllowedIPConflict `json:"conflicts,omitempty"` // 被其他 Peer 更具体的前缀截走的部分
+}
+
+// AllowedIPConflict 该 Peer 前缀中的部分地址被路由到其他 Peer
+type AllowedIPConflict struct {
+	Prefix  string `json:"prefix"`  // 该 Peer 的前缀
+	Peer    string `json:"peer"`    // 截走部分地址的 Peer
+	Covered string `json:"covered"` // 该 Peer 上更具体的前缀
+}
+
+// PingStats ICMP Echo 统计，RTT 单位为毫秒
+type PingStats struct {
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss"` // 丢包率 (0~1)
+	MinRTT   float64 `json:"min_rtt"`
+	AvgRTT   float64 `json:"avg_rtt"`
+	MaxRTT   float64 `json:"max_rtt"`
+	MdevRTT  float64 `json:"mdev_rtt"` // RTT 标准差
+}
+
+// PingProbe 单个探测结果
+type PingProbe struct {
+	Seq     int     `json:"seq"`
+	RTT     float64 `json:"rtt,omitempty"` // 毫秒，超时或出错时省略
+	Timeout bool    `json:"timeout,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// diagnoseQuery 诊断参数
+type diagnoseQuery struct {
+	count    int
+	interval time.Duration
+	timeout  time.Duration
+	size     int
+	target   netip.Addr // 零值为自动选择
+	stream   bool
+}
+
+// parseDiagnoseQuery 读取 count、interval、timeout (如 500ms、2s)、size、target 与 stream 参数
+func parseDiagnoseQuery(r *http.Request) (diagnoseQuery, error) {
+	query := r.URL.Query()
+	q := diagnoseQuery{
+		count:    defaultDiagnoseCount,
+		interval: defaultDiagnoseInterval,
+		timeout:  defaultDiagnoseTimeout,
+		size:     defaultDiagnoseSize,
+		stream:   strings.Contains(r.Header.Get("Accept"), "text/event-stream"),
+	}
+	if v := query.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDiagnoseCount {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "count must be between 1 and %d", maxDiagnoseCount)
+		}
+		q.count = n
+	}
+	if v := query.Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minDiagnoseInterval || d > maxDiagnoseInterval {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "interval must be between %v and %v", minDiagnoseInterval, maxDiagnoseInterval)
+		}
+		q.interval = d
+	}
+	if v := query.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxDiagnoseTimeout {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "timeout must be positive and at most %v", maxDiagnoseTimeout)
+		}
+		q.timeout = d
+	}
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < diagnoseTokenSize || n > maxDiagnoseSize {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "size must be between %d and %d", diagnoseTokenSize, maxDiagnoseSize)
+		}
+		q.size = n
+	}
+	if v := query.Get("target"); v != "" {
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid target %q", v)
+		}
+		q.target = addr.Unmap()
+	}
+	switch v := query.Get("stream"); v {
+	case "":
+	case "1", "true":
+		q.stream = true
+	case "0", "false":
+		q.stream = false
+	default:
+		return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid stream %q, use 1 or 0", v)
+	}
+	return q, nil
+}
+
+// prepareDiagnosis 查找 Peer 并填充诊断的静态部分 (握手、Endpoint、AllowedIPs 覆盖)，选定探测目标
+func (ui *WebUI) prepareDiagnosis(p principal, key string, q diagnoseQuery) (PeerDiagnosis, error) {
+	publicKey, err := parsePeerKey(key)
+	if err != nil {
+		return PeerDiagnosis{}, err
+	}
+	info, err := ui.findPeer(p, publicKey)
+	if err != nil {
+		return PeerDiagnosis{}, err
+	}
+	diag := PeerDiagnosis{
+		PublicKey: publicKey,
+		Remark:    info.Remark,
+		Endpoint:  info.Endpoint,
+		Online:    info.IsOnline,
+		Probes:    []PingProbe{},
+	}
+	if info.Disabled {
+		return diag, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer is disabled")
+	}
+	// 全路由 (0.0.0.0/0) 的 Peer 允许探测任意地址，指定目标等于从网关 ping 任意主机，需要写权限
+	if q.target.IsValid() && !p.can(PermPeersWrite) {
+		return diag, apiErrorf(http.StatusForbidden, ErrCodeForbidden, "Permission %q required to choose a target", PermPeersWrite)
+	}
+
+	// 冲突检查只涉及角色可见的 Peer，避免泄露标签范围之外的公钥与网段
+	var others []*device.Peer
+	ui.device.ForEachPeer(func(dp *device.Peer) {
+		if dp.GetPublicKey() == publicKey {
+			diag.peer = dp
+		} else if p.canSeePeer(ui.config.PeerTags(dp.GetPublicKey())) {
+			others = append(others, dp)
+		}
+	})
+	if diag.peer == nil {
+		return diag, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Peer not found on device")
+	}
+	diag.refreshPeerState()
+
+	diag.Coverage.AllowedIPs = append([]string{}, diag.peer.GetAllowedIPList()...)
+	var prefixes []netip.Prefix
+	for _, s := range diag.Coverage.AllowedIPs {
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	configLock.RLock()
+	subnet, _ := netip.ParsePrefix(ui.config.System.InternalSubnet)
+	configLock.RUnlock()
+
+	target := q.target
+	if !target.IsValid() {
+		target = diagnoseTarget(prefixes, subnet)
+	}
+	if !target.IsValid() {
+		return diag, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer has no AllowedIPs to probe")
+	}
+	diag.Target = target.String()
+	if q.target.IsValid() && !prefixesContain(prefixes, target) {
+		return diag, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Target %s is not within the peer's AllowedIPs", target)
+	}
+
+	diag.Coverage.InSubnet = subnet.IsValid() && subnet.Contains(target)
+	if owner := ui.device.GetAllowedIPs().Lookup(target.AsSlice()); owner != nil {
+		if owner == diag.peer {
+			diag.Coverage.Routed = true
+		} else if key := owner.GetPublicKey(); p.canSeePeer(ui.config.PeerTags(key)) {
+			diag.Coverage.RoutedTo = key
+		} else {
+			diag.Coverage.RoutedTo = hiddenPeer
+		}
+	}
+	// 按最长前缀匹配，其他 Peer 更具体的前缀会截走该 Peer 前缀中的一部分地址
+	for _, other := range others {
+		for _, s := range other.GetAllowedIPList() {
+			theirs, err := netip.ParsePrefix(s)
+			if err != nil {
+				continue
+			}
+			for _, ours := range prefixes {
+				if theirs.Bits() > ours.Bits() && ours.Overlaps(theirs) {
+					diag.Coverage.Conflicts = append(diag.Coverage.Conflicts, AllowedIPConflict{Prefix: ours.String(), Peer: other.GetPublicKey(), Covered: theirs.String()})
+				}
+			}
+		}
+	}
+	return diag, nil
+}
+
+// refreshPeerState 读取握手、收包时间与 Endpoint，ping 结束后再次读取以反映探测期间的握手
+func (d *PeerDiagnosis) refreshPeerState() {
+	now := time.Now()
+	if nano := d.peer.GetLastHandshakeNano(); nano != 0 {
+		t := time.Unix(0, nano)
+		d.LastHandshake = &t
+		d.HandshakeAge = now.Sub(t).Seconds()
+		d.Online = peerOnline(nano)
+	}
+	if nano := d.peer.GetLastReceiveNano(); nano != 0 {
+		t := time.Unix(0, nano)
+		d.LastReceive = &t
+		d.ReceiveAge = now.Sub(t).Seconds()
+	}
+	d.HandshakeAttempts = d.peer.GetHandshakeAttempts()
+	d.Endpoint = d.peer.GetEndpoint()
+}
+
+// diagnoseTarget 选择探测目标：优先 internal_subnet 内的单地址前缀 (/32、/128)，其次前缀中的第一个主机地址
+func diagnoseTarget(prefixes []netip.Prefix, subnet netip.Prefix) netip.Addr {
+	for _, prefix := range prefixes {
+		if prefix.IsSingleIP() && subnet.IsValid() && subnet.Contains(prefix.Addr()) {
+			return prefix.Addr()
+		}
+	}
+	for _, prefix := range prefixes {
+		if prefix.IsSingleIP() {
+			return prefix.Addr()
+		}
+	}
+	for _, prefix := range prefixes {
+		if prefix.Bits() > 0 {
+			return prefix.Masked().Addr().Next()
+		}
+	}
+	return netip.Addr{}
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// runDiagnosis 依次发送 ICMP Echo，每个探测完成后调用 onProbe
+func (ui *WebUI) runDiagnosis(ctx context.Context, diag *PeerDiagnosis, q diagnoseQuery, onProbe func(PingProbe)) {
+	diag.Started = time.Now()
+	defer func() {
+		diag.Duration = time.Since(diag.Started).Seconds()
+		diag.refreshPeerState()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, maxDiagnoseDuration)
+	defer cancel()
+
+	target := netip.MustParseAddr(diag.Target)
+	pg, err := ui.openPinger(target)
+	if err != nil {
+		diag.PingError = err.Error()
+		return
+	}
+	defer pg.Close()
+	diag.Method, diag.Source = pg.method, pg.source
+	stop := context.AfterFunc(ctx, pg.Close) // 中断阻塞中的读取
+	defer stop()
+
+	payload := make([]byte, q.size)
+	rand.Read(payload[:diagnoseTokenSize])
+	for i := diagnoseTokenSize; i < len(payload); i++ {
+		payload[i] = byte(i)
+	}
+
+	var rtts []float64
+	for seq := 1; seq <= q.count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.interval):
+			}
+		}
+		if ctx.Err() != nil {
+			diag.Canceled = true
+			break
+		}
+		probe := PingProbe{Seq: seq}
+		rtt, err := pg.ping(seq, payload, q.timeout)
+		switch {
+		case ctx.Err() != nil:
+			diag.Canceled = true
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			probe.Timeout = true
+		case err != nil:
+			probe.Error = err.Error()
+		default:
+			probe.RTT = float64(rtt.Microseconds()) / 1000
+			rtts = append(rtts, probe.RTT)
+		}
+		if diag.Canceled {
+			break
+		}
+		diag.Probes = append(diag.Probes, probe)
+		if onProbe != nil {
+			onProbe(probe)
+		}
+	}
+	diag.Ping = pingStats(len(diag.Probes), rtts)
+}
+
+// pingStats 计算丢包率与 RTT 统计 (与 ping 的 min/avg/max/mdev 相同)
+func pingStats(sent int, rtts []float64) PingStats {
+	stats := PingStats{Sent: sent, Received: len(rtts)}
+	if sent > 0 {
+		stats.Loss = float64(sent-len(rtts)) / float64(sent)
+	}
+	if len(rtts) == 0 {
+		return stats
+	}
+	var sum, sq float64
+	stats.MinRTT = rtts[0]
+	for _, v := range rtts {
+		sum += v
+		sq += v * v
+		stats.MinRTT = min(stats.MinRTT, v)
+		stats.MaxRTT = max(stats.MaxRTT, v)
+	}
+	n := float64(len(rtts))
+	avg := sum / n
+	stats.AvgRTT = roundMillis(avg)
+	stats.MdevRTT = roundMillis(math.Sqrt(max(sq/n-avg*avg, 0)))
+	return stats
+}
+
+// roundMillis 毫秒保留到微秒
+func roundMillis(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
+
+// ========== ICMP 探测 ==========
+
+// pinger 发送 ICMP Echo 并等待对应回复，一次只有一个探测在途
+type pinger struct {
+	conn   net.PacketConn
+	dst    net.Addr
+	target netip.Addr
+	proto  int // ICMP 协议号：1 (IPv4) 或 58 (IPv6)
+	method string
+	source string
+	buf    []byte
+
+	closeOnce sync.Once
+}
+
+// openPinger 打开 ICMP 连接
+// 有 netstack 管理地址时从隧道内部发出 (无需主机权限)，否则使用主机的 ICMP 套接字：
+// 先尝试非特权的 ping 套接字 (net.ipv4.ping_group_range)，再尝试原始套接字 (CAP_NET_RAW)
+func (ui *WebUI) openPinger(target netip.Addr) (*pinger, error) {
+	pg := &pinger{target: target, proto: 1, buf: make([]byte, maxDiagnoseSize+128)}
+	network, raw, laddr := "udp4", "ip4:icmp", "0.0.0.0"
+	if target.Is6() {
+		pg.proto = 58
+		network, raw, laddr = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	if a := ui.adminNet; a != nil && a.addr.Is4() == target.Is4() {
+		conn, err := a.net.DialPingAddr(a.addr, target)
+		if err == nil {
+			pg.conn, pg.dst, pg.method, pg.source = conn, &net.IPAddr{IP: target.AsSlice()}, "netstack", a.addr.String()
+			return pg, nil
+		}
+		ui.device.GetLogger().Verbosef("Failed to open netstack ping socket, falling back to host ICMP: %v", err)
+	}
+	if conn, err := icmp.ListenPacket(network, laddr); err == nil {
+		pg.conn, pg.dst, pg.method = conn, &net.UDPAddr{IP: target.AsSlice()}, "icmp"
+		return pg, nil
+	}
+	conn, err := icmp.ListenPacket(raw, laddr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open ICMP socket (needs net.ipv4.ping_group_range or CAP_NET_RAW): %w", err)
+	}
+	pg.conn, pg.dst, pg.method = conn, &net.IPAddr{IP: target.AsSlice()}, "icmp-raw"
+	return pg, nil
+}
+
+// Close 可重复调用：诊断被取消时由 context 关闭，结束时再次关闭
+func (pg *pinger) Close() {
+	pg.closeOnce.Do(func() { pg.conn.Close() })
+}
+
+// ping 发送一个 Echo 请求，返回 RTT；超时返回 os.ErrDeadlineExceeded
+// ping 套接字会改写 Echo ID，因此按来源、序号与负载匹配回复，不比较 ID
+func (pg *pinger) ping(seq int, payload []byte, timeout time.Duration) (time.Duration, error) {
+	var reqType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if pg.proto == 58 {
+		reqType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	msg := icmp.Message{Type: reqType, Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: seq, Data: payload}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if err := pg.conn.SetReadDeadline(start.Add(timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := pg.conn.WriteTo(b, pg.dst); err != nil {
+		return 0, err
+	}
+	for {
+		n, from, err := pg.conn.ReadFrom(pg.buf)
+		if err != nil {
+			if time.Since(start) >= timeout {
+				return 0, os.ErrDeadlineExceeded
+			}
+			return 0, err
+		}
+		if addrOf(from) != pg.target {
+			continue
+		}
+		reply, err := icmp.ParseMessage(pg.proto, pg.buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq && string(echo.Data) == string(payload) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// addrOf 取各类 net.Addr 中的 IP 地址
+func addrOf(a net.Addr) netip.Addr {
+	var addr netip.Addr
+	switch v := a.(type) {
+	case *net.UDPAddr:
+		addr, _ = netip.AddrFromSlice(v.IP)
+	case *net.IPAddr:
+		addr, _ = netip.AddrFromSlice(v.IP)
+	case *netstack.PingAddr:
+		addr = v.Addr()
+	}
+	return addr.Unmap()
+}
+
+// ========== HTTP 接口 ==========
+
+// v1DiagnosePeer 执行诊断；stream 为 true 时以 text/event-stream 推送 probe 事件与最终的 result 事件
+func (ui *WebUI) v1DiagnosePeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	q, err := parseDiagnoseQuery(r)
+	if err != nil {
+		return nil, err
+	}
+	diag, err := ui.prepareDiagnosis(currentPrincipal(r), r.PathValue("key"), q)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case ui.diagnoseSlots <- struct{}{}:
+		defer func() { <-ui.diagnoseSlots }()
+	default:
+		return nil, apiErrorf(http.StatusTooManyRequests, ErrCodeRateLimited, "Too many diagnoses in progress, try again later")
+	}
+
+	if !q.stream {
+		ui.runDiagnosis(r.Context(), &diag, q, nil)
+		return diag, nil
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		rc.Flush()
+	}
+	send("start", diag)
+	ui.runDiagnosis(r.Context(), &diag, q, func(probe PingProbe) { send("probe", probe) })
+	send("result", diag)
+	return nil, errResponseWritten
+}
+
+// handlePeerDiagnose 处理 GET /api/peers/{key}/diagnose
+func (ui *WebUI) handlePeerDiagnose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed, use GET"))
+		return
+	}
+	resp, err := ui.v1DiagnosePeer(w, r)
+	if errors.Is(err, errResponseWritten) {
+		return
+	}
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,165 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDiagnoseQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		accept string
+		want   diagnoseQuery
+		ok     bool
+	}{
+		{"", "", diagnoseQuery{count: defaultDiagnoseCount, interval: defaultDiagnoseInterval, timeout: defaultDiagnoseTimeout, size: defaultDiagnoseSize}, true},
+		{"count=20&interval=200ms&timeout=10s&size=8", "", diagnoseQuery{count: 20, interval: 200 * time.Millisecond, timeout: 10 * time.Second, size: 8}, true},
+		{"target=::ffff:10.0.0.2", "", diagnoseQuery{count: defaultDiagnoseCount, interval: defaultDiagnoseInterval, timeout: defaultDiagnoseTimeout, size: defaultDiagnoseSize, target: netip.MustParseAddr("10.0.0.2")}, true},
+		{"", "text/event-stream", diagnoseQuery{count: defaultDiagnoseCount, interval: defaultDiagnoseInterval, timeout: defaultDiagnoseTimeout, size: defaultDiagnoseSize, stream: true}, true},
+		{"stream=0", "text/event-stream", diagnoseQuery{count: defaultDiagnoseCount, interval: defaultDiagnoseInterval, timeout: defaultDiagnoseTimeout, size: defaultDiagnoseSize}, true},
+		{"count=0", "", diagnoseQuery{}, false},
+		{"count=21", "", diagnoseQuery{}, false},
+		{"interval=100ms", "", diagnoseQuery{}, false},
+		{"interval=6s", "", diagnoseQuery{}, false},
+		{"timeout=0s", "", diagnoseQuery{}, false},
+		{"timeout=11s", "", diagnoseQuery{}, false},
+		{"size=7", "", diagnoseQuery{}, false},
+		{"size=1401", "", diagnoseQuery{}, false},
+		{"target=10.0.0.0/24", "", diagnoseQuery{}, false},
+		{"stream=yes", "", diagnoseQuery{}, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/peers/x/diagnose?"+tt.query, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		got, err := parseDiagnoseQuery(r)
+		if (err == nil) != tt.ok || tt.ok && got != tt.want {
+			t.Errorf("parseDiagnoseQuery(%q) = %+v, %v; want %+v, ok %v", tt.query, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDiagnoseTarget(t *testing.T) {
+	subnet := netip.MustParsePrefix("10.0.0.1/24")
+	tests := []struct {
+		prefixes []string
+		want     string
+	}{
+		{[]string{"192.168.1.7/32", "10.0.0.5/32"}, "10.0.0.5"},
+		{[]string{"192.168.1.0/24", "192.168.2.7/32"}, "192.168.2.7"},
+		{[]string{"fd00::/64"}, "fd00::1"},
+		{[]string{"192.168.1.0/24"}, "192.168.1.1"},
+		{[]string{"0.0.0.0/0"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		var prefixes []netip.Prefix
+		for _, s := range tt.prefixes {
+			prefixes = append(prefixes, netip.MustParsePrefix(s))
+		}
+		got := diagnoseTarget(prefixes, subnet)
+		if want, _ := netip.ParseAddr(tt.want); got != want {
+			t.Errorf("diagnoseTarget(%s) = %v, want %v", tt.prefixes, got, want)
+		}
+	}
+}
+
+func TestPingStats(t *testing.T) {
+	tests := []struct {
+		sent int
+		rtts []float64
+		want PingStats
+	}{
+		{0, nil, PingStats{}},
+		{4, nil, PingStats{Sent: 4, Loss: 1}},
+		{4, []float64{1, 3}, PingStats{Sent: 4, Received: 2, Loss: 0.5, MinRTT: 1, AvgRTT: 2, MaxRTT: 3, MdevRTT: 1}},
+		{3, []float64{0.1234, 0.1234, 0.1234}, PingStats{Sent: 3, Received: 3, MinRTT: 0.1234, AvgRTT: 0.123, MaxRTT: 0.1234}},
+	}
+	for _, tt := range tests {
+		if got := pingStats(tt.sent, tt.rtts); got != tt.want {
+			t.Errorf("pingStats(%d, %v) = %+v, want %+v", tt.sent, tt.rtts, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareDiagnosis(t *testing.T) {
+	iotKey, camKey, offKey := testKey(1), testKey(2), testKey(3)
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{
+			{Name: "iot-ops", Permissions: []Permission{PermStatusRead, PermPeersWrite}, PeerTags: []string{"iot"}},
+			{Name: "iot-viewer", Permissions: []Permission{PermStatusRead}, PeerTags: []string{"iot"}},
+		}
+		c.Peers = []PeerRecord{
+			{PublicKey: iotKey, AllowedIPs: []string{"10.0.0.2/32", "192.168.10.0/24"}, Tags: []string{"iot"}},
+			{PublicKey: camKey, AllowedIPs: []string{"192.168.10.7/32"}, Tags: []string{"cam"}},
+			{PublicKey: offKey, AllowedIPs: []string{"10.0.0.3/32"}, Tags: []string{"iot"}, Disabled: true},
+		}
+	})
+	admin := principal{Role: Role{Name: RoleAdmin}, Permissions: []Permission{PermStatusRead, PermPeersWrite}}
+	iot := principal{Role: tu.config.Roles[0], Permissions: tu.config.Roles[0].Permissions}
+	camTarget := diagnoseQuery{target: netip.MustParseAddr("192.168.10.7")}
+
+	// 管理员能看到截走地址的 Peer，受限角色只看到 hidden 且不列出冲突
+	tests := []struct {
+		name      string
+		p         principal
+		q         diagnoseQuery
+		target    string
+		inSubnet  bool
+		routed    bool
+		routedTo  string
+		conflicts []AllowedIPConflict
+	}{
+		{"auto target", admin, diagnoseQuery{}, "10.0.0.2", true, true, "", []AllowedIPConflict{{Prefix: "192.168.10.0/24", Peer: camKey, Covered: "192.168.10.7/32"}}},
+		{"admin, routed elsewhere", admin, camTarget, "192.168.10.7", false, false, camKey, []AllowedIPConflict{{Prefix: "192.168.10.0/24", Peer: camKey, Covered: "192.168.10.7/32"}}},
+		{"scoped, routed elsewhere", iot, camTarget, "192.168.10.7", false, false, hiddenPeer, nil},
+		{"scoped, own address", iot, diagnoseQuery{target: netip.MustParseAddr("192.168.10.8")}, "192.168.10.8", false, true, "", nil},
+	}
+	for _, tt := range tests {
+		diag, err := tu.prepareDiagnosis(tt.p, iotKey, tt.q)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		c := diag.Coverage
+		if diag.Target != tt.target || c.InSubnet != tt.inSubnet || c.Routed != tt.routed || c.RoutedTo != tt.routedTo || !reflect.DeepEqual(c.Conflicts, tt.conflicts) {
+			t.Errorf("%s: target %s, coverage %+v", tt.name, diag.Target, c)
+		}
+	}
+
+	adminToken := tu.token("root", RoleAdmin, ScopeStatusRead, ScopePeers)
+	viewerToken := tu.token("bob", "iot-viewer", ScopeStatusRead)
+	path := func(key, query string) string {
+		return "/api/v1/peers/" + url.PathEscape(key) + "/diagnose?" + query
+	}
+	for _, tt := range []struct {
+		name   string
+		token  string
+		path   string
+		status int
+		code   string
+	}{
+		{"hidden peer", viewerToken, path(camKey, "count=1"), http.StatusNotFound, ErrCodeNotFound},
+		{"target without peers.write", viewerToken, path(iotKey, "target=10.0.0.2"), http.StatusForbidden, ErrCodeForbidden},
+		{"target outside AllowedIPs", adminToken, path(iotKey, "target=10.0.0.9"), http.StatusBadRequest, ErrCodeBadRequest},
+		{"disabled peer", adminToken, path(offKey, ""), http.StatusConflict, ErrCodeConflict},
+		{"bad count", adminToken, path(iotKey, "count=99"), http.StatusBadRequest, ErrCodeBadRequest},
+		{"invalid key", adminToken, path("nope", ""), http.StatusBadRequest, ErrCodeInvalidKey},
+	} {
+		resp, body := tu.bearer(tt.token, http.MethodGet, tt.path, "")
+		if resp.StatusCode != tt.status || errorCode(body) != tt.code {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+}
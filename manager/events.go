@@ -0,0 +1,232 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// events.go - 管理事件总线
+// Peer、邀请码与配置的变更由各操作发布，握手、端点与设备启停来自设备事件订阅，在线状态由 watchDevice 轮询得到；
+// 订阅方 (SSE/WebSocket、gRPC WatchEvents) 按需过滤，最近的事件保存在环形缓冲中供断线续传
+
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// 事件类型
+const (
+	EventPeerAdded      = "peer.added"
+	EventPeerRemoved    = "peer.removed"
+	EventPeerUpdated    = "peer.updated"
+	EventPeerHandshake  = "peer.handshake" // 完成握手
+	EventPeerEndpoint   = "peer.endpoint"  // 端点变化 (漫游)
+	EventPeerOnline     = "peer.online"
+	EventPeerOffline    = "peer.offline"
+	EventPeerRegistered = "peer.registered" // 通过邀请码注册
+	EventInviteCreated  = "invite.created"
+	EventInviteRemoved  = "invite.removed"
+	EventInviteConsumed = "invite.consumed"
+	EventInviteExpired  = "invite.expired"
+	EventConfigApplied  = "config.applied"
+	EventSystemUpdated  = "system.updated"
+	EventDeviceUp       = "device.up"
+	EventDeviceDown     = "device.down"
+	EventPublicEndpoint = "system.endpoint" // STUN 探测到的公网地址或 NAT 类型变化
+	EventPortMapping    = "system.portmap"  // 路由器端口映射建立、外部地址变化或失败
+)
+
+// eventTypes 所有事件类型，用于校验订阅过滤
+var eventTypes = []string{
+	EventPeerAdded, EventPeerRemoved, EventPeerUpdated, EventPeerHandshake, EventPeerEndpoint,
+	EventPeerOnline, EventPeerOffline, EventPeerRegistered,
+	EventInviteCreated, EventInviteRemoved, EventInviteConsumed, EventInviteExpired,
+	EventConfigApplied, EventSystemUpdated, EventDeviceUp, EventDeviceDown, EventPublicEndpoint, EventPortMapping,
+}
+
+func knownEventType(typ string) bool {
+	for _, t := range eventTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	deviceWatchInterval = time.Second // 设备状态轮询间隔
+	eventHistorySize    = 1024        // 环形缓冲保存的事件数
+)
+
+// Event 管理事件
+type Event struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Peer   string    `json:"peer,omitempty"`   // 相关 Peer 公钥 (Base64)
+	Detail string    `json:"detail,omitempty"` // 备注、端点等补充信息
+}
+
+// EventBus 事件发布/订阅，订阅方处理过慢时丢弃事件而不阻塞发布方
+type EventBus struct {
+	mu      sync.Mutex
+	nextID  uint64
+	subs    map[chan Event]struct{}
+	history []Event           // 环形缓冲
+	head    int               // 下一个写入位置
+	counts  map[string]uint64 // 按类型累计的事件数
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs:    make(map[chan Event]struct{}),
+		history: make([]Event, 0, eventHistorySize),
+		counts:  make(map[string]uint64),
+	}
+}
+
+// Publish 发布事件，自动填充 ID 与时间
+func (b *EventBus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e.ID = b.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.counts[e.Type]++
+	if len(b.history) < eventHistorySize {
+		b.history = append(b.history, e)
+	} else {
+		b.history[b.head] = e
+		b.head = (b.head + 1) % eventHistorySize
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Counts 返回按类型累计的事件数
+func (b *EventBus) Counts() map[string]uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[string]uint64, len(b.counts))
+	for typ, n := range b.counts {
+		counts[typ] = n
+	}
+	return counts
+}
+
+// Subscribe 订阅事件，buf 为缓冲大小；调用返回的 cancel 取消订阅
+func (b *EventBus) Subscribe(buf int) (<-chan Event, func()) {
+	_, ch, cancel := b.SubscribeSince(0, buf)
+	return ch, cancel
+}
+
+// SubscribeSince 订阅事件，同时返回缓冲中 ID 大于 after 的事件 (after 为 0 时不返回)
+// 补发与订阅在同一把锁内完成，两者之间不会漏掉事件
+func (b *EventBus) SubscribeSince(after uint64, buf int) ([]Event, <-chan Event, func()) {
+	ch := make(chan Event, buf)
+	b.mu.Lock()
+	var backlog []Event
+	if after > 0 {
+		for i := range b.history {
+			e := b.history[(b.head+i)%len(b.history)]
+			if e.ID > after {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return backlog, ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// forwardDeviceEvents 把设备的握手完成、端点变化与启停事件转发到事件总线
+func (ui *WebUI) forwardDeviceEvents(sub *device.Subscription) {
+	defer sub.Close()
+	for {
+		var ev device.Event
+		select {
+		case <-ui.done:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			ev = e
+		}
+		switch ev.Type {
+		case device.EventHandshakeCompleted:
+			ui.events.Publish(Event{Type: EventPeerHandshake, Peer: ev.PublicKey, Time: ev.Time})
+		case device.EventEndpointChanged:
+			if ev.Endpoint != "" {
+				ui.events.Publish(Event{Type: EventPeerEndpoint, Peer: ev.PublicKey, Detail: ev.Endpoint})
+			}
+		case device.EventDeviceUp:
+			ui.events.Publish(Event{Type: EventDeviceUp})
+		case device.EventDeviceDown:
+			ui.events.Publish(Event{Type: EventDeviceDown})
+		}
+	}
+}
+
+// watchDevice 轮询 Peer 的在线状态，变化时发布上线、离线事件；
+// 同时发布在两次轮询之间到期的邀请码
+func (ui *WebUI) watchDevice() {
+	online := make(map[string]bool)
+	lastCheck := time.Now()
+	ticker := time.NewTicker(deviceWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ui.done:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		for _, inv := range ui.config.ListInvites() {
+			if inv.ExpiresAt.After(lastCheck) && !inv.ExpiresAt.After(now) {
+				ui.events.Publish(Event{Type: EventInviteExpired, Detail: inv.Remark, Time: inv.ExpiresAt})
+			}
+		}
+		lastCheck = now
+
+		seen := make(map[string]bool)
+		ui.device.ForEachPeer(func(p *device.Peer) {
+			key := p.GetPublicKey()
+			cur := peerOnline(p.GetLastHandshakeNano())
+			seen[key] = true
+			prev, known := online[key]
+			online[key] = cur
+			if known && cur != prev {
+				typ := EventPeerOffline
+				if cur {
+					typ = EventPeerOnline
+				}
+				ui.events.Publish(Event{Type: typ, Peer: key, Detail: p.Remark})
+			}
+		})
+		for key := range online {
+			if !seen[key] {
+				delete(online, key)
+			}
+		}
+	}
+}
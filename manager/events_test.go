@@ -0,0 +1,218 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBusSubscribeSince(t *testing.T) {
+	b := NewEventBus()
+	for i := 0; i < eventHistorySize+10; i++ {
+		b.Publish(Event{Type: EventPeerHandshake})
+	}
+	tests := []struct {
+		after      uint64
+		first, len int
+	}{
+		{0, 0, 0}, // 不补发
+		{5, 11, eventHistorySize},
+		{eventHistorySize, eventHistorySize + 1, 10},
+		{eventHistorySize + 10, 0, 0},
+	}
+	for _, tt := range tests {
+		backlog, _, cancel := b.SubscribeSince(tt.after, 1)
+		cancel()
+		if len(backlog) != tt.len || tt.len > 0 && backlog[0].ID != uint64(tt.first) {
+			t.Errorf("SubscribeSince(%d): %d events", tt.after, len(backlog))
+			continue
+		}
+		for i := 1; i < len(backlog); i++ {
+			if backlog[i].ID != backlog[i-1].ID+1 {
+				t.Errorf("SubscribeSince(%d): ID %d follows %d", tt.after, backlog[i].ID, backlog[i-1].ID)
+				break
+			}
+		}
+	}
+
+	// 订阅方读取过慢时丢弃事件，不阻塞发布
+	ch, cancel := b.Subscribe(1)
+	b.Publish(Event{Type: EventPeerOnline})
+	b.Publish(Event{Type: EventPeerOffline})
+	if e := <-ch; e.Type != EventPeerOnline || len(ch) != 0 {
+		t.Errorf("slow subscriber got %+v, %d queued", e, len(ch))
+	}
+	cancel()
+	cancel()
+	if counts := b.Counts(); counts[EventPeerHandshake] != eventHistorySize+10 || counts[EventPeerOffline] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+}
+
+func TestParseEventSubscription(t *testing.T) {
+	tests := []struct {
+		header, query string
+		after         uint64
+		types         []string
+		ok            bool
+	}{
+		{"", "", 0, nil, true},
+		{"42", "", 42, nil, true},
+		{"", "last_event_id=7&types=peer.online,+peer.offline,,", 7, []string{"peer.offline", "peer.online"}, true},
+		{"9", "last_event_id=7", 9, nil, true}, // 请求头优先
+		{"-1", "", 0, nil, false},
+		{"", "last_event_id=abc", 0, nil, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/events?"+tt.query, nil)
+		if tt.header != "" {
+			r.Header.Set("Last-Event-ID", tt.header)
+		}
+		sub, err := parseEventSubscription(r)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q %q: err %v, want ok %v", tt.header, tt.query, err, tt.ok)
+			continue
+		}
+		var types []string
+		for typ := range sub.types {
+			types = append(types, typ)
+		}
+		if len(types) > 1 && types[0] > types[1] {
+			types[0], types[1] = types[1], types[0]
+		}
+		if err == nil && (sub.after != tt.after || !reflect.DeepEqual(types, tt.types)) {
+			t.Errorf("%q %q: after %d, types %q", tt.header, tt.query, sub.after, types)
+		}
+	}
+}
+
+// readEvents 读取 SSE 响应中的 n 个事件
+func readEvents(t *testing.T, sc *bufio.Scanner, n int) []Event {
+	t.Helper()
+	var events []Event
+	for len(events) < n && sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if len(events) < n {
+		t.Fatalf("stream ended after %d of %d events: %v", len(events), n, sc.Err())
+	}
+	return events
+}
+
+func TestEventStream(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{{Name: "iot-ops", Permissions: []Permission{PermStatusRead}, PeerTags: []string{"iot"}}}
+	})
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	iot := tu.token("alice", "iot-ops", ScopeStatusRead)
+	keyIoT, keyCam := testKey(1), testKey(2)
+	for _, req := range []string{
+		fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.2/32"],"tags":["iot"]}`, keyIoT),
+		fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.3/32"],"tags":["cam"]}`, keyCam),
+	} {
+		if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers", req); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create peer: %d %s", resp.StatusCode, body)
+		}
+	}
+
+	tu.events.mu.Lock()
+	since := tu.events.nextID
+	tu.events.mu.Unlock()
+	tu.events.Publish(Event{Type: EventPeerHandshake, Peer: keyIoT})
+	tu.events.Publish(Event{Type: EventPeerHandshake, Peer: keyCam})
+	tu.events.Publish(Event{Type: EventConfigApplied})
+	tu.events.Publish(Event{Type: EventPeerOffline, Peer: keyIoT})
+
+	tests := []struct {
+		name   string
+		token  string
+		header string // Last-Event-ID
+		query  string
+		want   []uint64 // 相对 since 的事件 ID
+	}{
+		{"resume", admin, fmt.Sprint(since), "", []uint64{1, 2, 3, 4}},
+		{"resume by query", admin, "", fmt.Sprintf("?last_event_id=%d", since+2), []uint64{3, 4}},
+		{"type filter", admin, fmt.Sprint(since), "?types=peer.handshake", []uint64{1, 2}},
+		{"peer tag scope", iot, fmt.Sprint(since), "", []uint64{1, 3, 4}},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, tu.ts.URL+"/api/events"+tt.query, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		if tt.header != "" {
+			req.Header.Set("Last-Event-ID", tt.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("%s: Content-Type %q", tt.name, ct)
+		}
+		sc := bufio.NewScanner(resp.Body)
+		var got []uint64
+		for _, e := range readEvents(t, sc, len(tt.want)) {
+			got = append(got, e.ID-since)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events %v, want %v", tt.name, got, tt.want)
+		}
+
+		// 补发之后继续推送新事件
+		tu.events.Publish(Event{Type: EventPeerHandshake, Peer: keyIoT})
+		if e := readEvents(t, sc, 1)[0]; e.Type != EventPeerHandshake || e.Peer != keyIoT {
+			t.Errorf("%s: live event %+v", tt.name, e)
+		}
+		cancel()
+		resp.Body.Close()
+	}
+
+	resp, body := tu.do(nil, http.MethodGet, "/api/events", "", "Authorization", "Bearer "+admin, "Last-Event-ID", "x")
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "Last-Event-ID") {
+		t.Errorf("invalid Last-Event-ID: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.System.CORSOrigins = []string{"https://dash.example.com"}
+	})
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"http://wg.example.com:8080", true},
+		{"https://dash.example.com", true},
+		{"https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://wg.example.com:8080/api/events", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if err := tu.checkWebSocketOrigin(nil, r); (err == nil) != tt.ok {
+			t.Errorf("origin %q: %v, want ok %v", tt.origin, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// eventstream.go - 实时事件推送 GET /api/events
+// 默认以 Server-Sent Events 输出，带 Upgrade: websocket 时改为 WebSocket (每条消息一个 JSON 事件)。
+// 断线后通过 Last-Event-ID (或查询参数 last_event_id) 从环形缓冲补发错过的事件
+
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	eventStreamBuffer    = 64               // 单个订阅的缓冲，客户端读取过慢时丢弃事件
+	eventStreamKeepalive = 15 * time.Second // SSE 保活注释间隔，防止代理断开空闲连接
+	eventStreamRetry     = 3000             // 建议浏览器的重连间隔 (毫秒)
+)
+
+// errStreamClosed 服务停止，事件流结束
+var errStreamClosed = errors.New("event stream closed")
+
+// eventSubscription 单个事件流的订阅参数
+type eventSubscription struct {
+	after uint64          // 补发 ID 大于该值的事件
+	types map[string]bool // 为空时不过滤类型
+}
+
+// parseEventSubscription 读取 Last-Event-ID 与 types 参数 (逗号分隔)
+func parseEventSubscription(r *http.Request) (eventSubscription, error) {
+	var sub eventSubscription
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	if last != "" {
+		id, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			return sub, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid Last-Event-ID %q", last)
+		}
+		sub.after = id
+	}
+	sub.types = eventTypeSet(strings.Split(r.URL.Query().Get("types"), ","))
+	return sub, nil
+}
+
+func eventTypeSet(types []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, typ := range types {
+		if typ = strings.TrimSpace(typ); typ != "" {
+			set[typ] = true
+		}
+	}
+	return set
+}
+
+// streamEvents 推送事件直到 ctx 结束或服务停止，先补发缓冲中的事件
+// 受标签限制的角色只能收到可见 Peer 的事件；keepalive 非空时在空闲期间定期调用
+func (ui *WebUI) streamEvents(ctx context.Context, p principal, sub eventSubscription, send func(Event) error, keepalive func() error) error {
+	backlog, events, cancel := ui.events.SubscribeSince(sub.after, eventStreamBuffer)
+	defer cancel()
+
+	visible := func(e Event) bool {
+		if len(sub.types) > 0 && !sub.types[e.Type] {
+			return false
+		}
+		return e.Peer == "" || p.canSeePeer(ui.config.PeerTags(e.Peer))
+	}
+	for _, e := range backlog {
+		if !visible(e) {
+			continue
+		}
+		if err := send(e); err != nil {
+			return err
+		}
+	}
+
+	var tick <-chan time.Time
+	if keepalive != nil {
+		ticker := time.NewTicker(eventStreamKeepalive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ui.done:
+			return errStreamClosed
+		case <-tick:
+			if err := keepalive(); err != nil {
+				return err
+			}
+		case e := <-events:
+			if !visible(e) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleEvents 实时事件流
+// GET /api/events
+func (ui *WebUI) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed, use GET"))
+		return
+	}
+	sub, err := parseEventSubscription(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		ui.serveEventsWebSocket(w, r, sub)
+		return
+	}
+	ui.serveEventsSSE(w, r, sub)
+}
+
+// serveEventsSSE 以 text/event-stream 输出，事件类型写入 event 字段，便于前端按类型 addEventListener
+func (ui *WebUI) serveEventsSSE(w http.ResponseWriter, r *http.Request, sub eventSubscription) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	send := func(e Event) error {
+		data, _ := json.Marshal(e)
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	keepalive := func() error {
+		if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	ui.streamEvents(r.Context(), currentPrincipal(r), sub, send, keepalive)
+}
+
+// serveEventsWebSocket 每个事件作为一条 JSON 文本消息发送，客户端发来的消息被忽略
+func (ui *WebUI) serveEventsWebSocket(w http.ResponseWriter, r *http.Request, sub eventSubscription) {
+	p := currentPrincipal(r)
+	srv := websocket.Server{
+		Handshake: ui.checkWebSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			go func() {
+				// 读到错误即视为客户端断开
+				io.Copy(io.Discard, ws)
+				cancel()
+			}()
+			send := func(e Event) error {
+				return websocket.JSON.Send(ws, e)
+			}
+			ui.streamEvents(ctx, p, sub, send, nil)
+		},
+	}
+	srv.ServeHTTP(w, r)
+}
+
+// checkWebSocketOrigin 浏览器会为 WebSocket 自动携带 Cookie，只接受同源或 CORS 白名单中的来源
+func (ui *WebUI) checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil // 非浏览器客户端
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	if ui.corsAllowed(origin) {
+		return nil
+	}
+	return fmt.Errorf("origin %q not allowed", origin)
+}
@@ -0,0 +1,440 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// grpc.go - gRPC 控制接口 (可选)
+// 与 HTTP 接口共用 resources.go 中的操作与 API 令牌认证，可监听 TCP 地址和/或 UAPI 目录下的 Unix 套接字
+
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"golang.zx2c4.com/wireguard/manager/managerpb"
+)
+
+// GRPCConfig gRPC 控制接口设置，修改后需重启
+type GRPCConfig struct {
+	Listen string `json:"listen,omitempty"` // TCP 监听地址 (如 127.0.0.1:8082)，空为不监听
+	Socket bool   `json:"socket,omitempty"` // 在 UAPI 套接字旁监听 <接口名>.grpc.sock
+}
+
+// grpcMethodPerms 各 RPC 所需的权限，未列出的方法一律拒绝
+var grpcMethodPerms = map[string]Permission{
+	managerpb.Manager_GetStatus_FullMethodName:    PermStatusRead,
+	managerpb.Manager_ListPeers_FullMethodName:    PermStatusRead,
+	managerpb.Manager_GetPeer_FullMethodName:      PermStatusRead,
+	managerpb.Manager_WatchEvents_FullMethodName:  PermStatusRead,
+	managerpb.Manager_CreatePeer_FullMethodName:   PermPeersWrite,
+	managerpb.Manager_DeletePeer_FullMethodName:   PermPeersWrite,
+	managerpb.Manager_SetPeerTags_FullMethodName:  PermPeersWrite,
+	managerpb.Manager_ListInvites_FullMethodName:  PermInvitesRead,
+	managerpb.Manager_CreateInvite_FullMethodName: PermInvitesWrite,
+	managerpb.Manager_DeleteInvite_FullMethodName: PermInvitesWrite,
+	managerpb.Manager_ApplyConfig_FullMethodName:  PermConfigRaw,
+}
+
+// grpcServer TCP 与 Unix 套接字各用一个 grpc.Server，Unix 套接字不使用 TLS
+type grpcServer struct {
+	servers []*grpc.Server
+	socket  string
+}
+
+// SetGRPCSocket 设置 gRPC Unix 套接字路径，需在 Start 之前调用
+func (ui *WebUI) SetGRPCSocket(path string) {
+	if ui.grpc == nil {
+		ui.grpc = &grpcServer{}
+	}
+	ui.grpc.socket = path
+}
+
+// startGRPC 按配置启动 gRPC 监听，WebUI 启用 TLS 时 TCP 监听使用同一证书
+func (ui *WebUI) startGRPC(tlsConf *tls.Config) error {
+	configLock.RLock()
+	conf := ui.config.System.GRPC
+	configLock.RUnlock()
+	if ui.grpc == nil {
+		ui.grpc = &grpcServer{}
+	}
+	logger := ui.device.GetLogger()
+
+	if conf.Listen != "" {
+		ln, err := net.Listen("tcp", conf.Listen)
+		if err != nil {
+			return err
+		}
+		var opts []grpc.ServerOption
+		if tlsConf != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
+		} else if ap, err := netip.ParseAddrPort(ln.Addr().String()); err != nil || !ap.Addr().IsLoopback() {
+			logger.Errorf("gRPC listening on %s without TLS, API tokens are sent in cleartext", ln.Addr())
+		}
+		ui.serveGRPC(ln, opts...)
+		logger.Verbosef("gRPC control API listening on %s", ln.Addr())
+	}
+
+	if conf.Socket && ui.grpc.socket != "" {
+		os.Remove(ui.grpc.socket)
+		ln, err := net.Listen("unix", ui.grpc.socket)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(ui.grpc.socket, 0o600); err != nil {
+			ln.Close()
+			return err
+		}
+		ui.serveGRPC(ln)
+		logger.Verbosef("gRPC control API listening on %s", ui.grpc.socket)
+	}
+	return nil
+}
+
+func (ui *WebUI) serveGRPC(ln net.Listener, opts ...grpc.ServerOption) {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(ui.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(ui.grpcStreamAuth),
+	)
+	srv := grpc.NewServer(opts...)
+	managerpb.RegisterManagerServer(srv, &grpcService{ui: ui})
+	ui.grpc.servers = append(ui.grpc.servers, srv)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			ui.device.GetLogger().Errorf("gRPC server error: %v", err)
+		}
+	}()
+}
+
+// stopGRPC 停止 gRPC 监听并断开正在进行的 WatchEvents
+func (ui *WebUI) stopGRPC(ctx context.Context) error {
+	if ui.grpc == nil {
+		return nil
+	}
+	var err error
+	for _, srv := range ui.grpc.servers {
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			srv.Stop()
+			err = ctx.Err()
+		}
+	}
+	if len(ui.grpc.servers) > 0 && ui.grpc.socket != "" {
+		os.Remove(ui.grpc.socket)
+	}
+	ui.grpc.servers = nil
+	return err
+}
+
+// ========== 认证 ==========
+
+type ctxGRPCPrincipalKey struct{}
+
+func (ui *WebUI) grpcUnaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := ui.grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (ui *WebUI) grpcStreamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := ui.grpcAuthenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &grpcAuthStream{ServerStream: ss, ctx: ctx})
+}
+
+// grpcAuthStream 携带认证主体的 ServerStream
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcAuthStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcAuthenticate 校验 authorization 元数据中的 API 令牌与方法权限
+// gRPC 只接受 API 令牌，权限检查与 HTTP 接口相同
+func (ui *WebUI) grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	perm, ok := grpcMethodPerms[method]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "method %s is not allowed", method)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var plain string
+	if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+		plain = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+	}
+	if plain == "" {
+		return nil, status.Error(codes.Unauthenticated, "API token required")
+	}
+
+	addr := grpcRemoteAddr(ctx)
+	p, err := ui.tokenPrincipal(plain, addr)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := authorize(&p, perm, addr); err != nil {
+		return nil, grpcError(err)
+	}
+	return context.WithValue(ctx, ctxGRPCPrincipalKey{}, p), nil
+}
+
+// grpcRemoteAddr 解析调用方地址，Unix 套接字视为本机
+func grpcRemoteAddr(ctx context.Context) netip.Addr {
+	pr, ok := grpcpeer.FromContext(ctx)
+	if !ok {
+		return netip.Addr{}
+	}
+	if _, ok := pr.Addr.(*net.UnixAddr); ok {
+		return netip.IPv6Loopback()
+	}
+	ap, err := netip.ParseAddrPort(pr.Addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ap.Addr().Unmap()
+}
+
+func grpcPrincipal(ctx context.Context) principal {
+	p, _ := ctx.Value(ctxGRPCPrincipalKey{}).(principal)
+	return p
+}
+
+// grpcError 将 APIError 的 HTTP 状态码映射为 gRPC 状态码
+func grpcError(err error) error {
+	e := asAPIError(err)
+	code := codes.Internal
+	switch e.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusBadGateway:
+		code = codes.Unavailable
+	}
+	return status.Error(code, e.Message)
+}
+
+// ========== 服务实现 ==========
+
+type grpcService struct {
+	managerpb.UnimplementedManagerServer
+	ui *WebUI
+}
+
+func (s *grpcService) GetStatus(ctx context.Context, req *managerpb.GetStatusRequest) (*managerpb.Status, error) {
+	info := s.ui.visibleDeviceInfo(grpcPrincipal(ctx))
+	return &managerpb.Status{
+		PublicKey:  info.PublicKey,
+		ListenPort: uint32(info.ListenPort),
+		Peers:      pbPeers(info.Peers),
+	}, nil
+}
+
+func (s *grpcService) ListPeers(ctx context.Context, req *managerpb.ListPeersRequest) (*managerpb.ListPeersResponse, error) {
+	info := s.ui.visibleDeviceInfo(grpcPrincipal(ctx))
+	return &managerpb.ListPeersResponse{Peers: pbPeers(info.Peers)}, nil
+}
+
+func (s *grpcService) GetPeer(ctx context.Context, req *managerpb.GetPeerRequest) (*managerpb.Peer, error) {
+	key, err := parsePeerKey(req.GetPublicKey())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	peer, err := s.ui.findPeer(grpcPrincipal(ctx), key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return pbPeer(peer), nil
+}
+
+func (s *grpcService) CreatePeer(ctx context.Context, req *managerpb.CreatePeerRequest) (*managerpb.Peer, error) {
+	p := grpcPrincipal(ctx)
+	key, err := s.ui.addPeer(p, PeerAddRequest{
+		PublicKey:  req.GetPublicKey(),
+		AllowedIPs: req.GetAllowedIps(),
+		Endpoint:   req.GetEndpoint(),
+		Keepalive:  int(req.GetPersistentKeepalive()),
+		Tags:       req.GetTags(),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	peer, err := s.ui.findPeer(p, key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return pbPeer(peer), nil
+}
+
+func (s *grpcService) DeletePeer(ctx context.Context, req *managerpb.DeletePeerRequest) (*emptypb.Empty, error) {
+	if err := s.ui.removePeer(grpcPrincipal(ctx), req.GetPublicKey()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcService) SetPeerTags(ctx context.Context, req *managerpb.SetPeerTagsRequest) (*managerpb.Peer, error) {
+	p := grpcPrincipal(ctx)
+	if err := s.ui.setPeerTags(p, req.GetPublicKey(), req.GetTags()); err != nil {
+		return nil, grpcError(err)
+	}
+	key, _ := parsePeerKey(req.GetPublicKey())
+	peer, err := s.ui.findPeer(p, key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return pbPeer(peer), nil
+}
+
+func (s *grpcService) ListInvites(ctx context.Context, req *managerpb.ListInvitesRequest) (*managerpb.ListInvitesResponse, error) {
+	var invites []*managerpb.Invite
+	for _, inv := range s.ui.visibleInvites(grpcPrincipal(ctx)) {
+		invites = append(invites, s.pbInvite(inv))
+	}
+	return &managerpb.ListInvitesResponse{Invites: invites}, nil
+}
+
+func (s *grpcService) CreateInvite(ctx context.Context, req *managerpb.CreateInviteRequest) (*managerpb.Invite, error) {
+	inv, err := s.ui.createInvite(grpcPrincipal(ctx), InviteGenerateRequest{
+		Remark:   req.GetRemark(),
+		Duration: int(req.GetDurationHours()),
+		Tags:     req.GetTags(),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return s.pbInvite(inv), nil
+}
+
+func (s *grpcService) DeleteInvite(ctx context.Context, req *managerpb.DeleteInviteRequest) (*emptypb.Empty, error) {
+	p := grpcPrincipal(ctx)
+	if _, err := s.ui.findInvite(p, req.GetToken()); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := s.ui.removeInvite(p, req.GetToken()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcService) ApplyConfig(ctx context.Context, req *managerpb.ApplyConfigRequest) (*emptypb.Empty, error) {
+	if err := s.ui.applyConfig(req.GetConfig()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// WatchEvents 推送管理事件，与 /api/events 共用订阅逻辑
+func (s *grpcService) WatchEvents(req *managerpb.WatchEventsRequest, stream managerpb.Manager_WatchEventsServer) error {
+	ctx := stream.Context()
+	sub := eventSubscription{after: req.GetAfterId(), types: eventTypeSet(req.GetTypes())}
+	send := func(e Event) error {
+		return stream.Send(&managerpb.Event{
+			Id:     e.ID,
+			Time:   timestamppb.New(e.Time),
+			Type:   e.Type,
+			Peer:   e.Peer,
+			Detail: e.Detail,
+		})
+	}
+	err := s.ui.streamEvents(ctx, grpcPrincipal(ctx), sub, send, nil)
+	if err == errStreamClosed {
+		return status.Error(codes.Unavailable, "server shutting down")
+	}
+	return err
+}
+
+// ========== 类型转换 ==========
+
+func pbPeers(peers []PeerInfo) []*managerpb.Peer {
+	out := make([]*managerpb.Peer, 0, len(peers))
+	for _, peer := range peers {
+		out = append(out, pbPeer(peer))
+	}
+	return out
+}
+
+func pbPeer(peer PeerInfo) *managerpb.Peer {
+	pb := &managerpb.Peer{
+		PublicKey:           peer.PublicKey,
+		Remark:              peer.Remark,
+		Endpoint:            peer.Endpoint,
+		AllowedIps:          peer.AllowedIPs,
+		TxBytes:             peer.TxBytes,
+		RxBytes:             peer.RxBytes,
+		Running:             peer.IsRunning,
+		Online:              peer.IsOnline,
+		PersistentKeepalive: peer.KeepaliveInterval,
+		Tags:                peer.Tags,
+	}
+	if !peer.handshake.IsZero() {
+		pb.LastHandshake = timestamppb.New(peer.handshake)
+	}
+	return pb
+}
+
+// pbInvite 转换邀请码，入驻链接取公开入口或 Web 门户地址，均未配置时为空
+func (s *grpcService) pbInvite(inv Invite) *managerpb.Invite {
+	pb := &managerpb.Invite{
+		Token:     inv.Token,
+		Remark:    inv.Remark,
+		ExpiresAt: timestamppb.New(inv.ExpiresAt),
+		CreatedAt: timestamppb.New(inv.CreatedAt),
+		Tags:      inv.Tags,
+	}
+	host := s.ui.publicJoinHost()
+	if host == "" {
+		configLock.RLock()
+		webHost, webPort := s.ui.config.System.WebHost, s.ui.config.System.WebPort
+		configLock.RUnlock()
+		host = webHost
+		if webHost != "" && webPort != 0 {
+			host = net.JoinHostPort(webHost, strconv.Itoa(int(webPort)))
+		}
+	}
+	if host != "" {
+		pb.Url = s.ui.inviteURL(s.ui.Scheme(), host, inv.Token)
+	}
+	return pb
+}
+
+// GRPCSocketName 返回接口对应的 gRPC 套接字文件名，与 UAPI 套接字放在同一目录
+func GRPCSocketName(iface string) string {
+	return fmt.Sprintf("%s.grpc.sock", iface)
+}
@@ -0,0 +1,165 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"golang.zx2c4.com/wireguard/manager/managerpb"
+)
+
+// grpcClient 在回环地址上启动 gRPC 服务并返回客户端
+func (tu *testUI) grpcClient() managerpb.ManagerClient {
+	tu.t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	tu.grpc = &grpcServer{}
+	tu.serveGRPC(ln)
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	tu.t.Cleanup(func() {
+		conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		tu.stopGRPC(ctx)
+	})
+	return managerpb.NewManagerClient(conn)
+}
+
+// grpcContext 带 API 令牌的调用上下文
+func grpcContext(t *testing.T, token string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	return ctx
+}
+
+func TestGRPCMethodPerms(t *testing.T) {
+	// 新增 RPC 必须同时声明所需权限，否则会被一律拒绝
+	desc := managerpb.Manager_ServiceDesc
+	methods := len(desc.Methods) + len(desc.Streams)
+	for _, m := range desc.Methods {
+		if _, ok := grpcMethodPerms["/"+desc.ServiceName+"/"+m.MethodName]; !ok {
+			t.Errorf("no permission for %s", m.MethodName)
+		}
+	}
+	for _, s := range desc.Streams {
+		if _, ok := grpcMethodPerms["/"+desc.ServiceName+"/"+s.StreamName]; !ok {
+			t.Errorf("no permission for %s", s.StreamName)
+		}
+	}
+	if len(grpcMethodPerms) != methods {
+		t.Errorf("%d permissions for %d methods", len(grpcMethodPerms), methods)
+	}
+
+	tu := newTestUI(t)
+	if _, err := tu.grpcAuthenticate(context.Background(), "/wireguard.manager.v1.Manager/Unknown"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("unknown method: %v", err)
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "bad"), codes.InvalidArgument},
+		{apiErrorf(http.StatusUnauthorized, ErrCodeInvalidToken, "token"), codes.Unauthenticated},
+		{apiErrorf(http.StatusForbidden, ErrCodeInsufficientScope, "scope"), codes.PermissionDenied},
+		{apiErrorf(http.StatusNotFound, ErrCodeNotFound, "missing"), codes.NotFound},
+		{apiErrorf(http.StatusConflict, ErrCodeConflict, "exists"), codes.AlreadyExists},
+		{apiErrorf(http.StatusTooManyRequests, ErrCodeRateLimited, "slow down"), codes.ResourceExhausted},
+		{apiErrorf(http.StatusBadGateway, ErrCodeUpstream, "upstream"), codes.Unavailable},
+		{errors.New("boom"), codes.Internal},
+	}
+	for _, tt := range tests {
+		st, _ := status.FromError(grpcError(tt.err))
+		if st.Code() != tt.want || st.Message() != tt.err.Error() {
+			t.Errorf("grpcError(%v) = %v %q, want %v", tt.err, st.Code(), st.Message(), tt.want)
+		}
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	tu := newTestUI(t)
+	statusToken := tu.token("watcher", RoleOperator, ScopeStatusRead)
+	peersToken := tu.token("ops", RoleOperator, ScopePeers)
+	viewerToken := tu.token("viewer", RoleViewer, ScopePeers)
+	client := tu.grpcClient()
+
+	create := func(ctx context.Context) error {
+		_, err := client.CreatePeer(ctx, &managerpb.CreatePeerRequest{
+			PublicKey:  testKey(1),
+			AllowedIps: []string{"10.0.0.9/32"},
+			Tags:       []string{"ci"},
+		})
+		return err
+	}
+	tests := []struct {
+		name  string
+		token string
+		call  func(context.Context) error
+		want  codes.Code
+	}{
+		{"no token", "", func(ctx context.Context) error {
+			_, err := client.GetStatus(ctx, &managerpb.GetStatusRequest{})
+			return err
+		}, codes.Unauthenticated},
+		{"unknown token", apiTokenPrefix + "00000000_x", func(ctx context.Context) error {
+			_, err := client.GetStatus(ctx, &managerpb.GetStatusRequest{})
+			return err
+		}, codes.Unauthenticated},
+		{"read with status scope", statusToken, func(ctx context.Context) error {
+			_, err := client.GetStatus(ctx, &managerpb.GetStatusRequest{})
+			return err
+		}, codes.OK},
+		{"write with status scope", statusToken, create, codes.PermissionDenied},
+		{"scope beyond owner role", viewerToken, create, codes.PermissionDenied},
+		{"write with peers scope", peersToken, create, codes.OK},
+		{"invalid allowed ip", peersToken, func(ctx context.Context) error {
+			_, err := client.CreatePeer(ctx, &managerpb.CreatePeerRequest{PublicKey: testKey(2), AllowedIps: []string{"10.0.0.1/33"}})
+			return err
+		}, codes.InvalidArgument},
+		{"unknown peer", statusToken, func(ctx context.Context) error {
+			_, err := client.GetPeer(ctx, &managerpb.GetPeerRequest{PublicKey: testKey(3)})
+			return err
+		}, codes.NotFound},
+		{"raw config needs system", peersToken, func(ctx context.Context) error {
+			_, err := client.ApplyConfig(ctx, &managerpb.ApplyConfigRequest{})
+			return err
+		}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		if err := tt.call(grpcContext(t, tt.token)); status.Code(err) != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	peer, err := client.GetPeer(grpcContext(t, statusToken), &managerpb.GetPeerRequest{PublicKey: testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peer.GetAllowedIps()) != 1 || peer.GetAllowedIps()[0] != "10.0.0.9/32" || len(peer.GetTags()) != 1 {
+		t.Errorf("created peer = %v", peer)
+	}
+}
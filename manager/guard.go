@@ -0,0 +1,166 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// guard.go - 公开入口的防爆破保护
+// 登录、邀请页、注册接口按来源 IP 限流；连续失败按用户名与来源 IP 渐进锁定
+// IPv6 来源按所在前缀 (默认 /64) 计数，否则客户端轮换自己网段内的地址即可绕过限流与锁定
+
+package manager
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/ratelimiter"
+)
+
+const (
+	loginInterval  = 6 * time.Second // 每个来源 IP 平均每 6 秒一次登录尝试
+	loginBurst     = 10
+	publicInterval = 2 * time.Second // 邀请页与注册接口
+	publicBurst    = 20
+
+	lockoutThreshold = 5                // 连续失败次数达到阈值后锁定
+	lockoutBase      = time.Minute      // 首次锁定时长，之后每次翻倍
+	lockoutMax       = 60 * time.Minute // 锁定时长上限
+	lockoutForget    = 24 * time.Hour   // 超过该时间没有失败则清除记录
+
+	defaultIPv6SourcePrefix = 64 // 通常分配给单个站点的最小 IPv6 网段
+)
+
+// lockoutEntry 单个键的连续失败记录
+type lockoutEntry struct {
+	failures    int
+	level       uint // 已锁定次数，决定下次锁定时长
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// loginGuard 公开入口的限流与锁定状态 (仅内存，重启后清空)
+type loginGuard struct {
+	login      *ratelimiter.Keyed[netip.Prefix]
+	public     *ratelimiter.Keyed[netip.Prefix]
+	ipv6Prefix int // IPv6 来源聚合的前缀长度
+
+	mu      sync.Mutex
+	timeNow func() time.Time
+	entries map[string]*lockoutEntry
+}
+
+// newLoginGuard ipv6Prefix 为 IPv6 来源聚合的前缀长度，超出 1-128 时使用默认的 64
+func newLoginGuard(ipv6Prefix int) *loginGuard {
+	if ipv6Prefix <= 0 || ipv6Prefix > 128 {
+		ipv6Prefix = defaultIPv6SourcePrefix
+	}
+	return &loginGuard{
+		login:      ratelimiter.NewKeyed[netip.Prefix](loginInterval, loginBurst),
+		public:     ratelimiter.NewKeyed[netip.Prefix](publicInterval, publicBurst),
+		ipv6Prefix: ipv6Prefix,
+		timeNow:    time.Now,
+		entries:    make(map[string]*lockoutEntry),
+	}
+}
+
+// source 返回计数用的来源：IPv4 为单个地址，IPv6 为所在的前缀
+func (g *loginGuard) source(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	bits := addr.BitLen()
+	if addr.Is6() {
+		bits = g.ipv6Prefix
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		// 无效地址 (如无法解析的 RemoteAddr) 共用一个计数
+		return netip.Prefix{}
+	}
+	return prefix
+}
+
+func userLockKey(username string) string { return "user:" + username }
+
+// addrLockKey 来源的登录失败计数键
+func (g *loginGuard) addrLockKey(addr netip.Addr) string {
+	return "ip:" + g.source(addr).String()
+}
+
+// inviteLockKey 邀请码猜测与登录失败分开计数
+func (g *loginGuard) inviteLockKey(addr netip.Addr) string {
+	return "invite:" + g.source(addr).String()
+}
+
+// AllowLogin 登录请求频率限制
+func (g *loginGuard) AllowLogin(addr netip.Addr) bool {
+	return g.login.Allow(g.source(addr))
+}
+
+// AllowPublic 邀请页与注册接口的频率限制
+func (g *loginGuard) AllowPublic(addr netip.Addr) bool {
+	return g.public.Allow(g.source(addr))
+}
+
+// Locked 返回键的剩余锁定时间，未锁定时返回 0
+func (g *loginGuard) Locked(keys ...string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.timeNow()
+	var remaining time.Duration
+	for _, key := range keys {
+		if e := g.entries[key]; e != nil && now.Before(e.lockedUntil) {
+			remaining = max(remaining, e.lockedUntil.Sub(now))
+		}
+	}
+	return remaining
+}
+
+// Fail 记录一次失败，返回因本次失败新触发锁定的时长 (未触发为 0)
+func (g *loginGuard) Fail(keys ...string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.timeNow()
+	g.cleanup(now)
+
+	var locked time.Duration
+	for _, key := range keys {
+		e := g.entries[key]
+		if e == nil {
+			e = &lockoutEntry{}
+			g.entries[key] = e
+		}
+		e.failures++
+		e.lastFailure = now
+		if e.failures < lockoutThreshold {
+			continue
+		}
+		d := min(lockoutBase<<e.level, lockoutMax)
+		e.lockedUntil = now.Add(d)
+		e.failures = 0
+		if d < lockoutMax {
+			e.level++
+		}
+		locked = max(locked, d)
+	}
+	return locked
+}
+
+// Succeed 认证成功后清除键的失败记录
+func (g *loginGuard) Succeed(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range keys {
+		delete(g.entries, key)
+	}
+}
+
+// cleanup 清除长时间没有失败的记录 (调用方持有锁)
+func (g *loginGuard) cleanup(now time.Time) {
+	for key, e := range g.entries {
+		if now.Sub(e.lastFailure) > lockoutForget && now.After(e.lockedUntil) {
+			delete(g.entries, key)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGuardSource(t *testing.T) {
+	tests := []struct {
+		prefix int
+		addr   string
+		want   string
+	}{
+		{0, "192.0.2.7", "192.0.2.7/32"},
+		{0, "::ffff:192.0.2.7", "192.0.2.7/32"},
+		{0, "2001:db8:1:2:aaaa::1", "2001:db8:1:2::/64"},
+		{48, "2001:db8:1:2:aaaa::1", "2001:db8:1::/48"},
+		{128, "2001:db8:1:2:aaaa::1", "2001:db8:1:2:aaaa::1/128"},
+		{200, "2001:db8:1:2:aaaa::1", "2001:db8:1:2::/64"},
+	}
+	for _, tt := range tests {
+		g := newLoginGuard(tt.prefix)
+		if got := g.source(netip.MustParseAddr(tt.addr)).String(); got != tt.want {
+			t.Errorf("prefix %d: source(%s) = %s, want %s", tt.prefix, tt.addr, got, tt.want)
+		}
+	}
+	g := newLoginGuard(0)
+	if g.addrLockKey(netip.MustParseAddr("2001:db8::1")) != g.addrLockKey(netip.MustParseAddr("2001:db8::ffff:2")) {
+		t.Error("addresses in one /64 use different lock keys")
+	}
+	if g.addrLockKey(netip.Addr{}) != g.addrLockKey(netip.Addr{}) {
+		t.Error("invalid addresses do not share a lock key")
+	}
+}
+
+func TestGuardRateLimitPerPrefix(t *testing.T) {
+	g := newLoginGuard(0)
+	for i := 0; i < publicBurst; i++ {
+		addr := netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: byte(i + 1)})
+		if !g.AllowPublic(addr) {
+			t.Fatalf("request %d from the /64 limited early", i)
+		}
+	}
+	if g.AllowPublic(netip.MustParseAddr("2001:db8::ffff")) {
+		t.Error("rotating addresses within the /64 bypassed the limit")
+	}
+	if !g.AllowPublic(netip.MustParseAddr("2001:db8:0:1::1")) {
+		t.Error("neighbouring /64 limited")
+	}
+	if !g.AllowLogin(netip.MustParseAddr("2001:db8::ffff")) {
+		t.Error("login and public limits share a bucket")
+	}
+}
+
+func TestGuardLockout(t *testing.T) {
+	g := newLoginGuard(0)
+	now := time.Unix(1700000000, 0)
+	g.timeNow = func() time.Time { return now }
+
+	failN := func(n int) time.Duration {
+		var d time.Duration
+		for i := 0; i < n; i++ {
+			d = g.Fail("user:alice", "ip:a")
+		}
+		return d
+	}
+	if d := failN(lockoutThreshold - 1); d != 0 || g.Locked("user:alice") != 0 {
+		t.Fatalf("locked before the threshold: %v", d)
+	}
+	if d := failN(1); d != lockoutBase {
+		t.Fatalf("first lockout = %v, want %v", d, lockoutBase)
+	}
+	if g.Locked("user:bob", "ip:a") != lockoutBase || g.Locked("user:bob", "ip:b") != 0 {
+		t.Error("Locked does not report the longest lock of the given keys")
+	}
+
+	// 每次锁定时长翻倍，直到上限
+	want := []time.Duration{2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 32 * time.Minute, lockoutMax, lockoutMax}
+	for i, w := range want {
+		now = now.Add(lockoutMax + time.Second)
+		if d := failN(lockoutThreshold); d != w {
+			t.Errorf("lockout %d = %v, want %v", i+2, d, w)
+		}
+	}
+
+	g.Succeed("user:alice", "ip:a")
+	if g.Locked("user:alice", "ip:a") != 0 {
+		t.Error("Succeed did not clear the lock")
+	}
+
+	// 长时间没有失败的记录被清除，锁定时长重新从头计算
+	g.Fail("user:carol")
+	now = now.Add(lockoutForget + time.Minute)
+	g.Fail("user:dave")
+	if _, ok := g.entries["user:carol"]; ok {
+		t.Error("stale entry not cleaned up")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	tu := newTestUI(t)
+	tu.addUser("alice", "longenough", RoleViewer)
+
+	attempt := func(password string) string {
+		resp, _ := tu.do(nil, http.MethodPost, "/login?"+url.Values{"username": {"alice"}, "password": {password}}.Encode(), "")
+		return resp.Header.Get("Location")
+	}
+	for i := 0; i < lockoutThreshold; i++ {
+		if loc := attempt("wrong-password"); loc != "/login?error=1" {
+			t.Fatalf("failure %d redirected to %q", i, loc)
+		}
+	}
+	// 锁定期间正确的密码同样被拒绝
+	if loc := attempt("longenough"); loc != "/login?error=locked" {
+		t.Fatalf("login while locked redirected to %q", loc)
+	}
+
+	var lockout, locked bool
+	for _, e := range tu.audit.Recent(20) {
+		switch {
+		case e.Event == AuditLockout && e.Actor == "alice":
+			lockout = true
+		case e.Event == AuditLoginFailure && e.Detail == "locked out":
+			locked = true
+		}
+	}
+	if !lockout || !locked {
+		t.Errorf("audit log missing lockout entries: %+v", tu.audit.Recent(20))
+	}
+
+	// 登录请求超出频率后返回 rate
+	var limited bool
+	for i := 0; i < loginBurst && !limited; i++ {
+		limited = attempt("longenough") == "/login?error=rate"
+	}
+	if !limited {
+		t.Error("login requests not rate limited")
+	}
+}
+
+func TestRegisterInviteLockout(t *testing.T) {
+	tu := newTestUI(t)
+	for i := 0; i < lockoutThreshold; i++ {
+		if resp, body := tu.do(nil, http.MethodPost, "/api/register", `{"token":"DEADBEEF"}`); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("invalid invite %d: %d %s", i, resp.StatusCode, body)
+		}
+	}
+	resp, _ := tu.do(nil, http.MethodPost, "/api/register", `{"token":"DEADBEEF"}`)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("after repeated invalid invites: %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	// 邀请码猜测与登录分开计数
+	if tu.guard.Locked(tu.guard.addrLockKey(netip.MustParseAddr("127.0.0.1"))) != 0 {
+		t.Error("invite failures locked the login")
+	}
+}
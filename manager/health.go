@@ -0,0 +1,380 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+const (
+	defaultMaxHandshakeAge = 180             // 上游最近一次握手的最长间隔 (秒)，与 WireGuard 的 Reject-After-Time 一致
+	healthCheckTimeout     = 2 * time.Second // 单项检查的最长时间
+	healthCacheTTL         = time.Second     // 检查结果的缓存时间，频繁探测不会反复触碰配置目录与设备锁
+	upstreamRemark         = "UPSTREAM_SERVER"
+	upstreamTag            = "upstream"
+)
+
+// 检查结果
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+	HealthSkip = "skip" // 不适用 (如服务端模式下的上游检查)
+
+	HealthDegraded = "degraded" // 总体状态：存活但未就绪
+)
+
+// HealthConfig 健康检查
+type HealthConfig struct {
+	Upstream        []string `json:"upstream,omitempty"`          // 客户端模式下检查握手的 Peer 公钥，默认为备注 UPSTREAM_SERVER 或带 upstream 标签的 Peer
+	MaxHandshakeAge int      `json:"max_handshake_age,omitempty"` // 上游最近一次握手的最长间隔 (秒)，默认 180
+}
+
+func (c *HealthConfig) maxHandshakeAge() time.Duration {
+	if c.MaxHandshakeAge <= 0 {
+		return defaultMaxHandshakeAge * time.Second
+	}
+	return time.Duration(c.MaxHandshakeAge) * time.Second
+}
+
+// HealthCheck 单项检查结果
+type HealthCheck struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`             // ok / fail / skip
+	Liveness bool    `json:"liveness,omitempty"` // 失败时 /healthz 也返回 503 (重启才能恢复)
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// HealthReport /healthz 与 /readyz 的响应
+// 未认证 (或没有 status.read 权限) 的调用方只能看到总体状态，不返回各项检查
+type HealthReport struct {
+	Status string        `json:"status"` // ok / degraded / fail
+	Checks []HealthCheck `json:"checks,omitempty"`
+	Time   time.Time     `json:"time"`
+}
+
+// healthCache 最近一次检查结果，并发的探测共用同一次检查
+type healthCache struct {
+	mu     sync.Mutex
+	report HealthReport
+	at     time.Time
+}
+
+// healthCheckFunc 返回说明与错误，错误为 errHealthSkip 时记为 skip
+type healthCheckFunc func(ctx context.Context) (string, error)
+
+var errHealthSkip = errors.New("skip")
+
+// readinessError 存活检查中只影响就绪的失败 (如设备被停用)，/healthz 仍然通过
+type readinessError struct{ error }
+
+type healthCheckDef struct {
+	name     string
+	liveness bool
+	check    healthCheckFunc
+}
+
+// healthChecks 按顺序执行的检查；liveness 为 true 的检查失败说明进程需要重启
+func (ui *WebUI) healthChecks() []healthCheckDef {
+	return []healthCheckDef{
+		{"device", true, ui.checkDevice},
+		{"tun", true, ui.checkTUN},
+		{"bind", false, ui.checkBind},
+		{"config", false, ui.checkConfigWritable},
+		{"uapi", false, ui.checkUAPI},
+		{"upstream", false, ui.checkUpstream},
+	}
+}
+
+// health 并发执行所有检查
+func (ui *WebUI) health(ctx context.Context) HealthReport {
+	defs := ui.healthChecks()
+	checks := make([]HealthCheck, len(defs))
+	var wg sync.WaitGroup
+	for i, def := range defs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			msg, err := def.check(ctx)
+			c := HealthCheck{Name: def.name, Status: HealthOK, Liveness: def.liveness, Message: msg}
+			switch {
+			case errors.Is(err, errHealthSkip):
+				c.Status = HealthSkip
+			case err != nil:
+				c.Status, c.Message = HealthFail, err.Error()
+				if errors.As(err, new(readinessError)) {
+					c.Liveness = false
+				}
+			}
+			c.Duration = roundMillis(float64(time.Since(start)) / float64(time.Millisecond))
+			checks[i] = c
+		}()
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthOK, Checks: checks, Time: time.Now()}
+	for _, c := range checks {
+		if c.Status != HealthFail {
+			continue
+		}
+		if c.Liveness {
+			report.Status = HealthFail
+			break
+		}
+		report.Status = HealthDegraded
+	}
+	return report
+}
+
+// cachedHealth 返回不超过 healthCacheTTL 的检查结果
+// 检查不随单个请求取消，避免某个探测断开后把失败结果缓存给其他调用方
+func (ui *WebUI) cachedHealth() HealthReport {
+	c := &ui.healthCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.at.IsZero() || time.Since(c.at) >= healthCacheTTL {
+		c.report = ui.health(context.Background())
+		c.at = time.Now()
+	}
+	return c.report
+}
+
+// ========== 检查项 ==========
+
+func (ui *WebUI) checkDevice(ctx context.Context) (string, error) {
+	switch state := ui.device.State(); state {
+	case "up":
+		return state, nil
+	case "closed":
+		return "", errors.New("device is closed")
+	default:
+		// 停用的设备重启也不会自动启用，只影响就绪
+		return "", readinessError{fmt.Errorf("device is %s", state)}
+	}
+}
+
+func (ui *WebUI) checkTUN(ctx context.Context) (string, error) {
+	if err := ui.device.TUNHealth(); err != nil {
+		return "", err
+	}
+	return "reader running", nil
+}
+
+func (ui *WebUI) checkBind(ctx context.Context) (string, error) {
+	port, err := ui.device.BindHealth()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("listening on UDP %d", port), nil
+}
+
+// checkConfigWritable 在配置目录中创建并删除一个临时文件
+func (ui *WebUI) checkConfigWritable(ctx context.Context) (string, error) {
+	configLock.RLock()
+	dir := filepath.Dir(dataPath)
+	configLock.RUnlock()
+	f, err := os.CreateTemp(dir, ".health-*")
+	if err != nil {
+		return "", fmt.Errorf("config directory is not writable: %w", err)
+	}
+	name := f.Name()
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(name)
+	if err != nil {
+		return "", fmt.Errorf("config directory is not writable: %w", err)
+	}
+	return dir, nil
+}
+
+// checkUAPI 连接 UAPI 套接字并读取一次配置，确认监听协程仍在接受连接
+func (ui *WebUI) checkUAPI(ctx context.Context) (string, error) {
+	if ui.uapiSocket == "" {
+		return "", errHealthSkip
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", ui.uapiSocket)
+	if err != nil {
+		return "", fmt.Errorf("UAPI socket: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write([]byte("get=1\n\n")); err != nil {
+		return "", fmt.Errorf("UAPI socket: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("UAPI socket: %w", err)
+		}
+		if errno, ok := strings.CutPrefix(strings.TrimSpace(line), "errno="); ok {
+			if errno != "0" {
+				return "", fmt.Errorf("UAPI get returned errno %s", errno)
+			}
+			return ui.uapiSocket, nil
+		}
+	}
+}
+
+// checkUpstream 客户端模式下检查上游 Peer 最近一次握手的时间
+func (ui *WebUI) checkUpstream(ctx context.Context) (string, error) {
+	configLock.RLock()
+	isClient := ui.config.System.IsClient
+	conf := ui.config.System.Health
+	keys := slices.Clone(conf.Upstream)
+	if len(keys) == 0 {
+		for _, p := range ui.config.Peers {
+			if !p.Disabled && (p.Remark == upstreamRemark || slices.Contains(p.Tags, upstreamTag)) {
+				keys = append(keys, p.PublicKey)
+			}
+		}
+	}
+	configLock.RUnlock()
+	if !isClient {
+		return "", errHealthSkip
+	}
+	if len(keys) == 0 {
+		return "", errors.New("no upstream peer configured")
+	}
+
+	handshakes := make(map[string]int64)
+	ui.device.ForEachPeer(func(p *device.Peer) {
+		handshakes[p.GetPublicKey()] = p.GetLastHandshakeNano()
+	})
+	maxAge := conf.maxHandshakeAge()
+	var ok, failed []string
+	for _, key := range keys {
+		short := shortKey(key)
+		ns, present := handshakes[key]
+		switch {
+		case !present:
+			failed = append(failed, short+": not on device")
+		case ns == 0:
+			failed = append(failed, short+": no handshake yet")
+		default:
+			age := time.Since(time.Unix(0, ns)).Round(time.Second)
+			if age > maxAge {
+				failed = append(failed, fmt.Sprintf("%s: last handshake %s ago", short, age))
+			} else {
+				ok = append(ok, fmt.Sprintf("%s: %s ago", short, age))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return "", fmt.Errorf("%s (max %s)", strings.Join(failed, "; "), maxAge)
+	}
+	return strings.Join(ok, "; "), nil
+}
+
+// shortKey 公钥前 8 个字符，用于日志与检查说明
+func shortKey(key string) string {
+	if len(key) > 8 {
+		return key[:8]
+	}
+	return key
+}
+
+// ========== HTTP 接口 ==========
+
+// SetUAPISocket 设置 UAPI 套接字路径，健康检查会连接它确认监听仍然正常
+func (ui *WebUI) SetUAPISocket(path string) {
+	ui.uapiSocket = path
+}
+
+// handleHealthz 存活检查：只有设备已关闭或 TUN 不可读时返回 503，其余失败的检查记为 degraded
+func (ui *WebUI) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !healthMethod(w, r) {
+		return
+	}
+	report := ui.cachedHealth()
+	ui.writeHealth(w, r, report, report.Status != HealthFail)
+}
+
+// handleReadyz 就绪检查：任一检查失败时返回 503
+func (ui *WebUI) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !healthMethod(w, r) {
+		return
+	}
+	report := ui.cachedHealth()
+	ui.writeHealth(w, r, report, report.Status == HealthOK)
+}
+
+// healthDetailAllowed 请求带有 status.read 权限的会话或令牌时才返回各项检查
+// 检查说明含配置目录、UAPI 套接字路径与上游握手时间，不对匿名调用方公开；认证失败不报错，只隐藏详情
+func (ui *WebUI) healthDetailAllowed(r *http.Request) bool {
+	addr := remoteAddr(r)
+	var p principal
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		var err error
+		if p, err = ui.tokenPrincipal(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), addr); err != nil {
+			return false
+		}
+	} else {
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			return false
+		}
+		username, ok := ui.sessions.Lookup(cookie.Value)
+		if !ok {
+			return false
+		}
+		user, ok := ui.config.FindUser(username)
+		if !ok {
+			return false
+		}
+		if p.Role, ok = ui.config.FindRole(user.Role); !ok {
+			return false
+		}
+		p.Username, p.Permissions = username, p.Role.Permissions
+	}
+	return authorize(&p, PermStatusRead, addr) == nil
+}
+
+func healthMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func (ui *WebUI) writeHealth(w http.ResponseWriter, r *http.Request, report HealthReport, healthy bool) {
+	if !ui.healthDetailAllowed(r) {
+		report = HealthReport{Status: report.Status, Time: report.Time}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,168 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkStatus 返回报告中某项检查的结果
+func checkStatus(report HealthReport, name string) HealthCheck {
+	for _, c := range report.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	return HealthCheck{}
+}
+
+// fakeUAPI 在 Unix 套接字上应答 get=1，返回给定的 errno
+func fakeUAPI(t *testing.T, errno string) string {
+	path := filepath.Join(t.TempDir(), "wg0.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for line, err := r.ReadString('\n'); err == nil && line != "\n"; line, err = r.ReadString('\n') {
+			}
+			conn.Write([]byte("listen_port=51820\nerrno=" + errno + "\n\n"))
+			conn.Close()
+		}
+	}()
+	return path
+}
+
+func TestHealthChecks(t *testing.T) {
+	upstream := testKey(1)
+	tests := []struct {
+		name   string
+		setup  func(*Config)
+		prep   func(*testUI)
+		status string
+		checks map[string]string
+	}{
+		{"server defaults", nil, nil, HealthOK, map[string]string{
+			"device": HealthOK, "tun": HealthOK, "bind": HealthOK, "config": HealthOK, "uapi": HealthSkip, "upstream": HealthSkip,
+		}},
+		{"uapi answers", nil, func(tu *testUI) { tu.SetUAPISocket(fakeUAPI(t, "0")) }, HealthOK, map[string]string{"uapi": HealthOK}},
+		{"uapi error", nil, func(tu *testUI) { tu.SetUAPISocket(fakeUAPI(t, "1")) }, HealthDegraded, map[string]string{"uapi": HealthFail}},
+		{"uapi gone", nil, func(tu *testUI) { tu.SetUAPISocket(filepath.Join(t.TempDir(), "missing.sock")) }, HealthDegraded, map[string]string{"uapi": HealthFail}},
+		{"config not writable", nil, func(tu *testUI) { dataPath = filepath.Join(t.TempDir(), "missing", "config.json") }, HealthDegraded, map[string]string{"config": HealthFail}},
+		{"device down", nil, func(tu *testUI) { tu.device.Down() }, HealthDegraded, map[string]string{"device": HealthFail, "bind": HealthFail}},
+		{"device closed", nil, func(tu *testUI) { tu.device.Close() }, HealthFail, map[string]string{"device": HealthFail}},
+		{"client without upstream", func(c *Config) { c.System.IsClient = true }, nil, HealthDegraded, map[string]string{"upstream": HealthFail}},
+		{"upstream never handshaked", func(c *Config) {
+			c.System.IsClient = true
+			c.Peers = []PeerRecord{{PublicKey: upstream, Remark: upstreamRemark, AllowedIPs: []string{"10.0.0.1/32"}}}
+		}, nil, HealthDegraded, map[string]string{"upstream": HealthFail}},
+		{"configured upstream missing", func(c *Config) {
+			c.System.IsClient = true
+			c.System.Health.Upstream = []string{testKey(2)}
+		}, nil, HealthDegraded, map[string]string{"upstream": HealthFail}},
+	}
+	for _, tt := range tests {
+		var setup []func(*Config)
+		if tt.setup != nil {
+			setup = append(setup, tt.setup)
+		}
+		tu := newTestUI(t, setup...)
+		if tt.prep != nil {
+			tt.prep(tu)
+		}
+		report := tu.health(context.Background())
+		if report.Status != tt.status {
+			t.Errorf("%s: status %s, checks %+v", tt.name, report.Status, report.Checks)
+		}
+		for name, want := range tt.checks {
+			if c := checkStatus(report, name); c.Status != want {
+				t.Errorf("%s: check %s = %+v, want %s", tt.name, name, c, want)
+			}
+		}
+	}
+
+	tu := newTestUI(t, func(c *Config) {
+		c.System.IsClient = true
+		c.Peers = []PeerRecord{{PublicKey: upstream, Tags: []string{upstreamTag}, AllowedIPs: []string{"10.0.0.1/32"}}}
+	})
+	if c := checkStatus(tu.health(context.Background()), "upstream"); !strings.Contains(c.Message, shortKey(upstream)+": no handshake yet") {
+		t.Errorf("upstream by tag: %+v", c)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{{Name: "auditor", Permissions: []Permission{PermInvitesRead}}}
+	})
+	reader := tu.token("viewer", RoleViewer, ScopeStatusRead)
+	other := tu.token("carol", "auditor", ScopeInvites)
+	tu.addUser("alice", "longenough", RoleViewer)
+	session := tu.login("alice", "longenough")
+
+	// 只有带 status.read 的会话或令牌能看到各项检查
+	tests := []struct {
+		name    string
+		path    string
+		client  *http.Client
+		token   string
+		details bool
+	}{
+		{"anonymous", "/healthz", nil, "", false},
+		{"invalid token", "/readyz", nil, "wgt_invalid", false},
+		{"token without status.read", "/healthz", nil, other, false},
+		{"token", "/readyz", nil, reader, true},
+		{"session", "/healthz", session, "", true},
+	}
+	for _, tt := range tests {
+		var header []string
+		if tt.token != "" {
+			header = []string{"Authorization", "Bearer " + tt.token}
+		}
+		resp, body := tu.do(tt.client, http.MethodGet, tt.path, "", header...)
+		var report HealthReport
+		json.Unmarshal([]byte(body), &report)
+		if resp.StatusCode != http.StatusOK || report.Status != HealthOK || (len(report.Checks) > 0) != tt.details || resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+	if resp, _ := tu.do(nil, http.MethodPost, "/healthz", ""); resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST /healthz: %d", resp.StatusCode)
+	}
+
+	// 结果缓存 1 秒：设备停用后缓存过期前仍返回旧结果
+	tu.device.Down()
+	if resp, _ := tu.do(nil, http.MethodGet, "/readyz", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("cached /readyz: %d", resp.StatusCode)
+	}
+	tu.healthCache.mu.Lock()
+	tu.healthCache.at = time.Now().Add(-healthCacheTTL)
+	tu.healthCache.mu.Unlock()
+	for path, status := range map[string]int{"/readyz": http.StatusServiceUnavailable, "/healthz": http.StatusOK} {
+		resp, body := tu.do(nil, http.MethodHead, path, "")
+		if resp.StatusCode != status || body != "" {
+			t.Errorf("HEAD %s with device down: %d %q", path, resp.StatusCode, body)
+		}
+	}
+	resp, body := tu.do(nil, http.MethodGet, "/readyz", "")
+	if !strings.Contains(body, `"status":"degraded"`) {
+		t.Errorf("GET /readyz with device down: %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,540 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// history.go - Peer 流量与在线状态历史
+// 按 system.history.interval 采样各 Peer 的流量增量与在线状态，追加写入 wg_data/history/ 下的 JSON Lines 文件；
+// 每过一个整点、一个自然日，把上一时段的记录汇总为小时、日粒度，各粒度按保留期删除旧文件。
+// 累计流量保存在 history/state.json，进程重启后继续累加
+
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// 历史数据粒度
+const (
+	historyRaw   = "raw"   // 原始采样
+	historyHour  = "hour"  // 小时汇总
+	historyDay   = "day"   // 日汇总 (本地时区)
+	historyMonth = "month" // 月汇总，查询时由日汇总合并，不单独存储
+)
+
+const (
+	defaultHistoryInterval        = 60  // 秒
+	defaultHistoryRawRetention    = 2   // 天
+	defaultHistoryHourlyRetention = 90  // 天
+	defaultHistoryDailyRetention  = 730 // 天
+
+	historyMaxLine = 64 << 20 // 单条记录的最大长度
+)
+
+// HistoryConfig Peer 历史采样设置
+type HistoryConfig struct {
+	Interval        int `json:"interval,omitempty"`         // 采样间隔 (秒)，0 为默认 60，-1 为关闭采样
+	RawRetention    int `json:"raw_retention,omitempty"`    // 原始采样保留天数，0 为默认 2
+	HourlyRetention int `json:"hourly_retention,omitempty"` // 小时汇总保留天数，0 为默认 90
+	DailyRetention  int `json:"daily_retention,omitempty"`  // 日汇总保留天数，0 为默认 730
+}
+
+// interval 返回生效的采样间隔，0 表示关闭
+func (h *HistoryConfig) interval() time.Duration {
+	switch {
+	case h.Interval < 0:
+		return 0
+	case h.Interval == 0:
+		return defaultHistoryInterval * time.Second
+	}
+	return time.Duration(h.Interval) * time.Second
+}
+
+// retention 返回指定粒度的保留期
+func (h *HistoryConfig) retention(res string) time.Duration {
+	days, def := h.DailyRetention, defaultHistoryDailyRetention
+	switch res {
+	case historyRaw:
+		days, def = h.RawRetention, defaultHistoryRawRetention
+	case historyHour:
+		days, def = h.HourlyRetention, defaultHistoryHourlyRetention
+	}
+	if days <= 0 {
+		days = def
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PeerTotals Peer 累计流量，跨进程重启累加
+type PeerTotals struct {
+	TxBytes uint64    `json:"tx_bytes"`
+	RxBytes uint64    `json:"rx_bytes"`
+	Since   time.Time `json:"since"` // 开始统计的时间
+}
+
+// historyRecord 文件中的一行：一个时段内各 Peer 的流量增量与在线时长
+type historyRecord struct {
+	Time     int64                   `json:"t"` // 时段起点 (Unix 秒)
+	Duration int64                   `json:"d"` // 实际采样时长 (秒)
+	Peers    map[string]historyUsage `json:"p"` // 无流量且不在线的 Peer 省略
+}
+
+// historyUsage 单个 Peer 在一个时段内的用量
+type historyUsage struct {
+	Tx     uint64 `json:"tx,omitempty"`
+	Rx     uint64 `json:"rx,omitempty"`
+	Online int64  `json:"on,omitempty"` // 在线秒数
+}
+
+func (u *historyUsage) add(o historyUsage) {
+	u.Tx += o.Tx
+	u.Rx += o.Rx
+	u.Online += o.Online
+}
+
+// historyState 持久化的汇总进度与累计流量
+type historyState struct {
+	NextHour int64                  `json:"next_hour"` // 下一个待汇总的小时起点 (Unix 秒)，之前的原始采样已汇总
+	NextDay  int64                  `json:"next_day"`  // 下一个待汇总的自然日起点
+	Totals   map[string]*PeerTotals `json:"totals"`
+}
+
+// peerReading 一次采样读到的 Peer 状态
+type peerReading struct {
+	tx, rx uint64
+	online bool
+}
+
+// historyStore Peer 历史存储
+type historyStore struct {
+	mu      sync.Mutex
+	dir     string
+	state   historyState
+	last    map[string]peerReading // 上次采样时设备计数器的读数
+	lastRun time.Time              // 上次采样时间，首次采样的时段从创建时开始
+}
+
+// historyDir 历史数据与配置文件放在同一目录
+func historyDir() string {
+	return filepath.Join(filepath.Dir(dataPath), "history")
+}
+
+// newHistoryStore 创建历史存储，读取上次保存的累计流量
+func newHistoryStore(dir string) (*historyStore, error) {
+	h := &historyStore{
+		dir:     dir,
+		last:    make(map[string]peerReading),
+		lastRun: time.Now(),
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "state.json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return h, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &h.state); err != nil {
+			return h, err
+		}
+	}
+	if h.state.Totals == nil {
+		h.state.Totals = make(map[string]*PeerTotals)
+	}
+	return h, nil
+}
+
+// counterDelta 计数器增量，计数器变小说明 Peer 被重建，从 0 重新计数
+func counterDelta(prev, cur uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	return cur
+}
+
+// record 写入一次采样，累加累计流量，并汇总已结束的小时与自然日
+func (h *historyStore) record(now time.Time, readings map[string]peerReading, conf HistoryConfig) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := h.lastRun
+	h.lastRun = now
+	// 采样中断过 (关闭后重新开启) 时，不把流量记到已汇总的小时里
+	if next := time.Unix(h.state.NextHour, 0); h.state.NextHour != 0 && start.Before(next) {
+		start = next
+	}
+	rec := historyRecord{
+		Time:     start.Unix(),
+		Duration: max(int64(now.Sub(start).Round(time.Second)/time.Second), 1),
+		Peers:    make(map[string]historyUsage),
+	}
+	for key, cur := range readings {
+		prev := h.last[key]
+		h.last[key] = cur
+		u := historyUsage{Tx: counterDelta(prev.tx, cur.tx), Rx: counterDelta(prev.rx, cur.rx)}
+		if cur.online {
+			u.Online = rec.Duration
+		}
+
+		total := h.state.Totals[key]
+		if total == nil {
+			total = &PeerTotals{Since: start}
+			h.state.Totals[key] = total
+		}
+		total.TxBytes += u.Tx
+		total.RxBytes += u.Rx
+
+		if u != (historyUsage{}) {
+			rec.Peers[key] = u
+		}
+	}
+	for key := range h.last {
+		if _, ok := readings[key]; !ok {
+			delete(h.last, key)
+		}
+	}
+
+	err := h.append(historyRaw, rec)
+	if rerr := h.rollup(now, conf); err == nil {
+		err = rerr
+	}
+	if serr := h.saveState(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// rollup 汇总已结束的小时与自然日，停机期间错过的时段在下次采样时补齐
+func (h *historyStore) rollup(now time.Time, conf HistoryConfig) error {
+	rolled := false
+
+	curHour := historyBucket(historyHour, now)
+	if h.state.NextHour == 0 {
+		h.state.NextHour = curHour.Unix()
+	}
+	// 超出原始采样保留期的小时已无数据可汇总
+	h.state.NextHour = max(h.state.NextHour, curHour.Add(-conf.retention(historyRaw)).Unix())
+	for h.state.NextHour < curHour.Unix() {
+		start := time.Unix(h.state.NextHour, 0)
+		end := start.Add(time.Hour)
+		if err := h.rollupInto(historyRaw, historyHour, start, end); err != nil {
+			return err
+		}
+		h.state.NextHour = end.Unix()
+		rolled = true
+	}
+
+	curDay := historyBucket(historyDay, now)
+	if h.state.NextDay == 0 {
+		h.state.NextDay = curDay.Unix()
+	}
+	h.state.NextDay = max(h.state.NextDay, historyBucket(historyDay, now.Add(-conf.retention(historyHour))).Unix())
+	for h.state.NextDay < curDay.Unix() {
+		start := time.Unix(h.state.NextDay, 0)
+		end := historyBucket(historyDay, start.Add(36*time.Hour)) // 跨夏令时的一天不是 24 小时
+		if err := h.rollupInto(historyHour, historyDay, start, end); err != nil {
+			return err
+		}
+		h.state.NextDay = end.Unix()
+		rolled = true
+	}
+
+	if rolled {
+		return h.prune(now, conf)
+	}
+	return nil
+}
+
+// rollupInto 把 src 粒度在 [start, end) 内的记录合并为一条 dst 粒度的记录
+func (h *historyStore) rollupInto(src, dst string, start, end time.Time) error {
+	records, err := h.read(src, start, end)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	merged := historyRecord{Time: start.Unix(), Peers: make(map[string]historyUsage)}
+	for _, rec := range records {
+		merged.Duration += rec.Duration
+		for key, u := range rec.Peers {
+			m := merged.Peers[key]
+			m.add(u)
+			merged.Peers[key] = m
+		}
+	}
+	return h.append(dst, merged)
+}
+
+// append 把记录追加到所属的文件
+func (h *historyStore) append(res string, rec historyRecord) error {
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	name := historyFileName(res, time.Unix(rec.Time, 0))
+	f, err := os.OpenFile(filepath.Join(h.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// read 读取 res 粒度中起点在 [from, to) 内的记录，按时间排序
+// 写入中途被读到的残行直接跳过
+func (h *historyStore) read(res string, from, to time.Time) ([]historyRecord, error) {
+	var records []historyRecord
+	for t := from; t.Before(to); {
+		start, end := historyFileSpan(res, t)
+		t = end
+		f, err := os.Open(filepath.Join(h.dir, historyFileName(res, start)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, historyMaxLine)
+		for scanner.Scan() {
+			var rec historyRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+				continue
+			}
+			if rec.Time >= from.Unix() && rec.Time < to.Unix() {
+				records = append(records, rec)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// series 返回 res 粒度在 [from, to) 内的记录
+// 尚未汇总的最近时段由更细的粒度临时合并，当前小时与今天的数据同样可见
+func (h *historyStore) series(res string, from, to time.Time) ([]historyRecord, error) {
+	h.mu.Lock()
+	nextHour, nextDay := time.Unix(h.state.NextHour, 0), time.Unix(h.state.NextDay, 0)
+	h.mu.Unlock()
+
+	type span struct {
+		res      string
+		from, to time.Time
+	}
+	var spans []span
+	switch res {
+	case historyRaw:
+		spans = []span{{historyRaw, from, to}}
+	case historyHour:
+		spans = []span{{historyHour, from, nextHour}, {historyRaw, nextHour, to}}
+	default:
+		spans = []span{{historyDay, from, nextDay}, {historyHour, nextDay, nextHour}, {historyRaw, nextHour, to}}
+	}
+
+	var records []historyRecord
+	for _, s := range spans {
+		lo, hi := s.from, s.to
+		if lo.Before(from) {
+			lo = from
+		}
+		if hi.After(to) {
+			hi = to
+		}
+		if !lo.Before(hi) {
+			continue
+		}
+		recs, err := h.read(s.res, lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recs...)
+	}
+	if res == historyRaw {
+		return records, nil
+	}
+
+	// 按粒度的时段合并，records 已按时间排序
+	var merged []historyRecord
+	for _, rec := range records {
+		bucket := historyBucket(res, time.Unix(rec.Time, 0)).Unix()
+		if n := len(merged); n == 0 || merged[n-1].Time != bucket {
+			merged = append(merged, historyRecord{Time: bucket, Peers: make(map[string]historyUsage)})
+		}
+		m := &merged[len(merged)-1]
+		m.Duration += rec.Duration
+		for key, u := range rec.Peers {
+			acc := m.Peers[key]
+			acc.add(u)
+			m.Peers[key] = acc
+		}
+	}
+	return merged, nil
+}
+
+// lifetime 返回 Peer 的累计流量，包含上次采样之后尚未计入的部分
+func (h *historyStore) lifetime(key string, tx, rx uint64) PeerTotals {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	totals := PeerTotals{Since: h.lastRun}
+	if t := h.state.Totals[key]; t != nil {
+		totals = *t
+	}
+	prev := h.last[key]
+	totals.TxBytes += counterDelta(prev.tx, tx)
+	totals.RxBytes += counterDelta(prev.rx, rx)
+	return totals
+}
+
+// forget 删除 Peer 的累计流量，历史记录按保留期自然过期
+func (h *historyStore) forget(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.state.Totals, key)
+	delete(h.last, key)
+}
+
+// saveState 原子写入 state.json
+func (h *historyStore) saveState() error {
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(&h.state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(h.dir, "state.json")
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// prune 删除整体超出保留期的文件
+func (h *historyStore) prune(now time.Time, conf HistoryConfig) error {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		res, t, ok := parseHistoryFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		if _, end := historyFileSpan(res, t); end.Before(now.Add(-conf.retention(res))) {
+			if err := os.Remove(filepath.Join(h.dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// historyLayouts 各粒度的文件名日期格式：原始采样按天、小时汇总按月、日汇总按年分文件
+var historyLayouts = map[string]string{
+	historyRaw:  "20060102",
+	historyHour: "200601",
+	historyDay:  "2006",
+}
+
+func historyFileName(res string, t time.Time) string {
+	return res + "-" + t.Format(historyLayouts[res]) + ".jsonl"
+}
+
+func parseHistoryFileName(name string) (string, time.Time, bool) {
+	res, date, ok := strings.Cut(strings.TrimSuffix(name, ".jsonl"), "-")
+	layout, known := historyLayouts[res]
+	if !ok || !known || !strings.HasSuffix(name, ".jsonl") {
+		return "", time.Time{}, false
+	}
+	t, err := time.ParseInLocation(layout, date, time.Local)
+	return res, t, err == nil
+}
+
+// historyFileSpan 返回 t 所在文件覆盖的时间范围 [start, end)
+func historyFileSpan(res string, t time.Time) (time.Time, time.Time) {
+	y, m, d := t.Date()
+	switch res {
+	case historyRaw:
+		start := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(0, 0, 1)
+	case historyHour:
+		start := time.Date(y, m, 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(y, 1, 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(1, 0, 0)
+	}
+}
+
+// historyBucket 返回 t 所在时段的起点
+func historyBucket(res string, t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch res {
+	case historyHour:
+		return t.Truncate(time.Hour)
+	case historyDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	case historyMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.Local)
+	}
+	return t
+}
+
+// sampleHistory 读取各 Peer 的计数器与在线状态并写入历史
+func (ui *WebUI) sampleHistory(now time.Time, conf HistoryConfig) {
+	readings := make(map[string]peerReading)
+	ui.device.ForEachPeer(func(p *device.Peer) {
+		tx, rx := p.GetTrafficStats()
+		readings[p.GetPublicKey()] = peerReading{tx: tx, rx: rx, online: peerOnline(p.GetLastHandshakeNano())}
+	})
+	if err := ui.history.record(now, readings, conf); err != nil {
+		ui.device.GetLogger().Errorf("Failed to record peer history: %v", err)
+	}
+}
+
+// historyConfig 返回当前的历史采样设置
+func (ui *WebUI) historyConfig() HistoryConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return ui.config.System.History
+}
+
+// runHistory 按设置的间隔采样，修改间隔后从下一次采样起生效
+func (ui *WebUI) runHistory() {
+	for {
+		conf := ui.historyConfig()
+		wait := conf.interval()
+		if wait == 0 {
+			wait = defaultHistoryInterval * time.Second // 关闭时定期检查设置是否重新开启
+		}
+		select {
+		case <-ui.done:
+			return
+		case now := <-time.After(wait):
+			if conf := ui.historyConfig(); conf.interval() > 0 {
+				ui.sampleHistory(now, conf)
+			}
+		}
+	}
+}
+
+// flushHistory 停止时补一次采样，使累计流量包含最后一个间隔
+func (ui *WebUI) flushHistory() {
+	if conf := ui.historyConfig(); conf.interval() > 0 {
+		ui.sampleHistory(time.Now(), conf)
+	}
+}
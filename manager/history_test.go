@@ -0,0 +1,194 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"6h", 6 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"30d", 30 * 24 * time.Hour, true},
+		{"0d", 0, false},
+		{"-1h", 0, false},
+		{"xd", 0, false},
+		{"week", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseHistoryRange(tt.in)
+		if (err == nil) != tt.ok || tt.ok && got != tt.want {
+			t.Errorf("parseHistoryRange(%q) = %v, %v; want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAutoHistoryResolution(t *testing.T) {
+	now := time.Date(2026, 6, 20, 12, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+	tests := []struct {
+		from, to time.Time
+		conf     HistoryConfig
+		want     string
+	}{
+		{now.Add(-6 * time.Hour), now, HistoryConfig{}, historyRaw},
+		{now.Add(-2 * day), now, HistoryConfig{}, historyRaw},
+		{now.Add(-3 * day), now, HistoryConfig{}, historyHour},
+		{now.Add(-2 * day), now, HistoryConfig{RawRetention: 1}, historyHour}, // 原始采样已过期
+		{now.Add(-60 * day), now, HistoryConfig{}, historyHour},
+		{now.Add(-60 * day), now, HistoryConfig{HourlyRetention: 30}, historyDay},
+		{now.Add(-365 * day), now, HistoryConfig{}, historyDay},
+	}
+	for _, tt := range tests {
+		if got := autoHistoryResolution(tt.from, tt.to, now, tt.conf); got != tt.want {
+			t.Errorf("span %v with %+v: %s, want %s", tt.to.Sub(tt.from), tt.conf, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryRollup(t *testing.T) {
+	dir := t.TempDir()
+	h, err := newHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每 30 分钟采样一次，共 30 小时：每次发送 100 字节，隔次在线
+	start := time.Date(2026, 6, 10, 0, 0, 0, 0, time.Local)
+	h.lastRun = start
+	const samples = 60
+	now := start
+	for i := 1; i <= samples; i++ {
+		now = start.Add(time.Duration(i) * 30 * time.Minute)
+		readings := map[string]peerReading{"a": {tx: uint64(i) * 100, rx: uint64(i) * 10, online: i%2 == 0}}
+		if err := h.record(now, readings, HistoryConfig{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 已结束的 30 个小时与第一天写入了汇总文件
+	if recs, _ := h.read(historyHour, start, now); len(recs) != 30 || recs[0].Peers["a"].Tx != 200 {
+		t.Errorf("hourly records: %d %+v", len(recs), recs)
+	}
+	if recs, _ := h.read(historyDay, start, now); len(recs) != 1 || recs[0].Peers["a"] != (historyUsage{Tx: 4800, Rx: 480, Online: 24 * 1800}) || recs[0].Duration != 86400 {
+		t.Errorf("daily records: %+v", recs)
+	}
+
+	tests := []struct {
+		res    string
+		points int
+		first  historyUsage
+		tx     uint64
+	}{
+		{historyRaw, samples, historyUsage{Tx: 100, Rx: 10}, samples * 100},
+		{historyHour, 30, historyUsage{Tx: 200, Rx: 20, Online: 1800}, samples * 100},
+		{historyDay, 2, historyUsage{Tx: 4800, Rx: 480, Online: 24 * 1800}, samples * 100},
+		{historyMonth, 1, historyUsage{Tx: 6000, Rx: 600, Online: 30 * 1800}, samples * 100},
+	}
+	for _, tt := range tests {
+		recs, err := h.series(tt.res, start, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tx uint64
+		for _, rec := range recs {
+			tx += rec.Peers["a"].Tx
+		}
+		if len(recs) != tt.points || recs[0].Peers["a"] != tt.first || tx != tt.tx {
+			t.Errorf("%s: %d points, first %+v, tx %d", tt.res, len(recs), recs[0].Peers["a"], tx)
+		}
+	}
+
+	// 计数器变小说明 Peer 被重建，累计流量继续累加
+	if err := h.record(now.Add(30*time.Minute), map[string]peerReading{"a": {tx: 50}}, HistoryConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.lifetime("a", 80, 0); got.TxBytes != samples*100+50+30 || !got.Since.Equal(start) {
+		t.Errorf("lifetime = %+v", got)
+	}
+	reopened, err := newHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.state.Totals["a"]; got == nil || got.TxBytes != samples*100+50 || reopened.state.NextHour != h.state.NextHour {
+		t.Errorf("state after restart: %+v", reopened.state)
+	}
+
+	if err := h.prune(start.AddDate(0, 0, 3), HistoryConfig{RawRetention: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		res  string
+		day  time.Time
+		kept bool
+	}{
+		{historyRaw, start, false},
+		{historyRaw, start.AddDate(0, 0, 1), true},
+		{historyHour, start, true},
+		{historyDay, start, true},
+	} {
+		_, err := os.Stat(filepath.Join(dir, historyFileName(tt.res, tt.day)))
+		if (err == nil) != tt.kept {
+			t.Errorf("%s: stat = %v, want kept %v", historyFileName(tt.res, tt.day), err, tt.kept)
+		}
+	}
+}
+
+func TestPeerHistoryAPI(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{{Name: "iot-ops", Permissions: []Permission{PermStatusRead}, PeerTags: []string{"iot"}}}
+	})
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	iot := tu.token("alice", "iot-ops", ScopeStatusRead)
+	key := testKey(1)
+	req := fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.2/32"],"tags":["cam"]}`, key)
+	if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers", req); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create peer: %d %s", resp.StatusCode, body)
+	}
+	tu.sampleHistory(time.Now(), HistoryConfig{})
+	path := "/api/v1/peers/" + url.PathEscape(key) + "/history"
+
+	tests := []struct {
+		name   string
+		token  string
+		query  string
+		status int
+		res    string
+	}{
+		{"default range", admin, "", http.StatusOK, historyRaw},
+		{"auto day", admin, "?range=90d", http.StatusOK, historyDay},
+		{"explicit month", admin, "?range=30d&resolution=month", http.StatusOK, historyMonth},
+		{"bad resolution", admin, "?resolution=week", http.StatusBadRequest, ""},
+		{"bad range", admin, "?range=soon", http.StatusBadRequest, ""},
+		{"from after to", admin, "?from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z", http.StatusBadRequest, ""},
+		{"hidden peer", iot, "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, body := tu.bearer(tt.token, http.MethodGet, path+tt.query, "")
+		var hist PeerHistory
+		json.Unmarshal([]byte(body), &hist)
+		if resp.StatusCode != tt.status || hist.Resolution != tt.res {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+
+	resp, body := tu.bearer(admin, http.MethodGet, path+"?format=csv", "")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") || !strings.HasPrefix(body, "time,duration_seconds,tx_bytes,") {
+		t.Errorf("csv: %q %q", resp.Header.Get("Content-Type"), body)
+	}
+}
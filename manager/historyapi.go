@@ -0,0 +1,238 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// historyapi.go - Peer 历史查询 GET /api/peers/{key}/history
+// 返回可直接绘图的时间序列，format=csv 时输出 CSV 供带宽报表与月度用量统计
+
+package manager
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistoryRange = 24 * time.Hour
+	historyAutoRaw      = 2 * 24 * time.Hour  // 自动粒度：不超过该跨度时使用原始采样
+	historyAutoHour     = 62 * 24 * time.Hour // 自动粒度：不超过该跨度时使用小时汇总
+)
+
+// PeerHistory Peer 历史数据
+type PeerHistory struct {
+	PublicKey    string         `json:"public_key"`
+	Resolution   string         `json:"resolution"` // raw / hour / day / month
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	TxBytes      uint64         `json:"tx_bytes"`     // 区间内发送字节数
+	RxBytes      uint64         `json:"rx_bytes"`     // 区间内接收字节数
+	Availability float64        `json:"availability"` // 区间内在线时长占采样时长的比例
+	Lifetime     PeerTotals     `json:"lifetime"`     // 累计流量 (跨重启)
+	Points       []HistoryPoint `json:"points"`
+}
+
+// HistoryPoint 单个时段的数据点
+type HistoryPoint struct {
+	Time         time.Time `json:"time"`         // 时段起点
+	Duration     int64     `json:"duration"`     // 采样时长 (秒)
+	TxBytes      uint64    `json:"tx_bytes"`     // 发送字节数
+	RxBytes      uint64    `json:"rx_bytes"`     // 接收字节数
+	TxRate       float64   `json:"tx_rate"`      // 平均发送速率 (字节/秒)
+	RxRate       float64   `json:"rx_rate"`      // 平均接收速率 (字节/秒)
+	Availability float64   `json:"availability"` // 在线时长占比 (0~1)
+}
+
+// historyQuery 历史查询参数
+type historyQuery struct {
+	from, to   time.Time
+	resolution string // 空为按跨度自动选择
+	csv        bool
+}
+
+// parseHistoryQuery 读取 from/to (RFC 3339 或 Unix 秒)、range (如 6h、30d)、resolution 与 format 参数
+// 只给 range 时查询截至现在的区间，都不给时为最近 24 小时
+func parseHistoryQuery(r *http.Request) (historyQuery, error) {
+	query := r.URL.Query()
+	q := historyQuery{to: time.Now()}
+	var err error
+	if v := query.Get("to"); v != "" {
+		if q.to, err = parseHistoryTime(v); err != nil {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid to %q", v)
+		}
+	}
+	span := defaultHistoryRange
+	if v := query.Get("range"); v != "" {
+		if span, err = parseHistoryRange(v); err != nil {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid range %q, use e.g. 6h or 30d", v)
+		}
+	}
+	q.from = q.to.Add(-span)
+	if v := query.Get("from"); v != "" {
+		if q.from, err = parseHistoryTime(v); err != nil {
+			return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid from %q", v)
+		}
+	}
+	if !q.from.Before(q.to) {
+		return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "from must be before to")
+	}
+
+	switch res := query.Get("resolution"); res {
+	case "", "auto":
+	case historyRaw, historyHour, historyDay, historyMonth:
+		q.resolution = res
+	default:
+		return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid resolution %q, use raw, hour, day, month or auto", res)
+	}
+
+	switch format := query.Get("format"); format {
+	case "":
+		q.csv = strings.Contains(r.Header.Get("Accept"), "text/csv")
+	case "csv":
+		q.csv = true
+	case "json":
+	default:
+		return q, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid format %q, use json or csv", format)
+	}
+	return q, nil
+}
+
+func parseHistoryTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseHistoryRange 在 time.ParseDuration 的基础上支持按天 (如 30d)
+func parseHistoryRange(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err == nil && d <= 0 {
+		err = strconv.ErrRange
+	}
+	return d, err
+}
+
+// autoHistoryResolution 按查询跨度与各粒度的保留期选择粒度
+func autoHistoryResolution(from, to, now time.Time, conf HistoryConfig) string {
+	span := to.Sub(from)
+	switch {
+	case span <= historyAutoRaw && !from.Before(now.Add(-conf.retention(historyRaw))):
+		return historyRaw
+	case span <= historyAutoHour && !from.Before(now.Add(-conf.retention(historyHour))):
+		return historyHour
+	}
+	return historyDay
+}
+
+// peerHistory 查询 Peer 的历史数据，受标签限制的角色只能查询可见 Peer
+func (ui *WebUI) peerHistory(p principal, key string, q historyQuery) (PeerHistory, error) {
+	publicKey, err := parsePeerKey(key)
+	if err != nil {
+		return PeerHistory{}, err
+	}
+	peer, err := ui.findPeer(p, publicKey)
+	if err != nil {
+		return PeerHistory{}, err
+	}
+
+	res := q.resolution
+	if res == "" {
+		res = autoHistoryResolution(q.from, q.to, time.Now(), ui.historyConfig())
+	}
+	from := historyBucket(res, q.from) // 汇总粒度从时段起点开始，首个时段完整
+	records, err := ui.history.series(res, from, q.to)
+	if err != nil {
+		return PeerHistory{}, apiErrorf(http.StatusInternalServerError, ErrCodeInternal, "Failed to read history: %v", err)
+	}
+
+	hist := PeerHistory{
+		PublicKey:  publicKey,
+		Resolution: res,
+		From:       from,
+		To:         q.to,
+		Lifetime:   ui.history.lifetime(publicKey, peer.TxBytes, peer.RxBytes),
+		Points:     make([]HistoryPoint, 0, len(records)),
+	}
+	var sampled, online int64
+	for _, rec := range records {
+		u := rec.Peers[publicKey]
+		point := HistoryPoint{
+			Time:     time.Unix(rec.Time, 0),
+			Duration: rec.Duration,
+			TxBytes:  u.Tx,
+			RxBytes:  u.Rx,
+		}
+		if rec.Duration > 0 {
+			point.TxRate = float64(u.Tx) / float64(rec.Duration)
+			point.RxRate = float64(u.Rx) / float64(rec.Duration)
+			point.Availability = float64(u.Online) / float64(rec.Duration)
+		}
+		hist.Points = append(hist.Points, point)
+		hist.TxBytes += u.Tx
+		hist.RxBytes += u.Rx
+		sampled += rec.Duration
+		online += u.Online
+	}
+	if sampled > 0 {
+		hist.Availability = float64(online) / float64(sampled)
+	}
+	return hist, nil
+}
+
+// writeHistoryCSV 输出 CSV，每个数据点一行
+func writeHistoryCSV(w http.ResponseWriter, hist PeerHistory) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="peer-history-`+hist.Resolution+`.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "duration_seconds", "tx_bytes", "rx_bytes", "tx_rate", "rx_rate", "availability"})
+	for _, p := range hist.Points {
+		cw.Write([]string{
+			p.Time.Format(time.RFC3339),
+			strconv.FormatInt(p.Duration, 10),
+			strconv.FormatUint(p.TxBytes, 10),
+			strconv.FormatUint(p.RxBytes, 10),
+			strconv.FormatFloat(p.TxRate, 'f', 2, 64),
+			strconv.FormatFloat(p.RxRate, 'f', 2, 64),
+			strconv.FormatFloat(p.Availability, 'f', 4, 64),
+		})
+	}
+	cw.Flush()
+}
+
+// handlePeerHistory Peer 流量与在线历史
+// GET /api/peers/{key}/history
+func (ui *WebUI) handlePeerHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed, use GET"))
+		return
+	}
+	q, err := parseHistoryQuery(r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	hist, err := ui.peerHistory(currentPrincipal(r), r.PathValue("key"), q)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if q.csv {
+		writeHistoryCSV(w, hist)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hist)
+}
@@ -0,0 +1,425 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// metrics.go - Prometheus 指标 GET /metrics
+// 手写文本格式 (text/plain; version=0.0.4)，不引入客户端库。
+// 逐 Peer 指标的数量受 system.metrics 限制，避免大规模部署时标签基数失控
+
+package manager
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+const (
+	metricsNamespace       = "wireguard"
+	defaultMetricsMaxPeers = 1000
+	metricsOtherPeer       = "_other" // 超出 max_peers 的 Peer 汇总到该标签值
+)
+
+// MetricsConfig /metrics 设置
+type MetricsConfig struct {
+	MaxPeers    int  `json:"max_peers,omitempty"`    // 逐 Peer 指标的最大数量，首次输出时按流量选出、之后固定；0 为默认 1000，-1 为不输出逐 Peer 指标
+	RemarkLabel bool `json:"remark_label,omitempty"` // 逐 Peer 指标附带 remark 标签
+}
+
+// maxPeers 返回生效的逐 Peer 指标上限，负数表示关闭
+func (m *MetricsConfig) maxPeers() int {
+	if m.MaxPeers == 0 {
+		return defaultMetricsMaxPeers
+	}
+	return m.MaxPeers
+}
+
+// counterVec 按单个标签值计数
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func (c *counterVec) Inc(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]uint64)
+	}
+	c.values[label]++
+}
+
+// snapshot 返回按标签值排序的计数副本
+func (c *counterVec) snapshot() (labels []string, values []uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for label := range c.values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		values = append(values, c.values[label])
+	}
+	return labels, values
+}
+
+// apiErrorsTotal 按错误码统计的 API 错误响应，由 writeAPIError 计数
+var apiErrorsTotal counterVec
+
+// 注册结果
+const (
+	registerSuccess       = "success"
+	registerInvalidInvite = "invalid_invite"
+	registerRateLimited   = "rate_limited"
+	registerFailed        = "failed"
+)
+
+// managerMetrics 管理层计数器
+type managerMetrics struct {
+	registrations counterVec    // 按结果统计的邀请码注册
+	peerSeries    peerSeriesSet // 单独输出指标的 Peer
+}
+
+// peerSeriesSet 超过 max_peers 时单独输出指标的 Peer 集合
+// Peer 一旦入选就保留到被删除为止，不随流量排名变化进出，否则逐 Peer 与 _other 的计数会在抓取之间回退，
+// rate() 把回退当作计数器重置，得到虚假的尖峰
+type peerSeriesSet struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// split 把样本分为单独输出与汇总到 _other 的两组
+// 集合有空位时按累计流量从高到低补入新 Peer；current 为所有现存 Peer 的公钥，用于清除已删除的 Peer
+func (s *peerSeriesSet) split(samples []peerSample, limit int, current map[string]bool) (kept, overflow []peerSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil || len(s.keys) > limit {
+		// 首次抓取或调小了 max_peers，重新选择
+		s.keys = make(map[string]struct{}, limit)
+	}
+	for key := range s.keys {
+		if !current[key] {
+			delete(s.keys, key)
+		}
+	}
+
+	var candidates []peerSample
+	for _, sample := range samples {
+		if _, ok := s.keys[sample.info.PublicKey]; ok {
+			kept = append(kept, sample)
+		} else {
+			candidates = append(candidates, sample)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].info.TotalBytes > candidates[j].info.TotalBytes
+	})
+	for _, sample := range candidates {
+		if len(s.keys) < limit {
+			s.keys[sample.info.PublicKey] = struct{}{}
+			kept = append(kept, sample)
+		} else {
+			overflow = append(overflow, sample)
+		}
+	}
+	return kept, overflow
+}
+
+// metricsWriter 输出 Prometheus 文本格式
+type metricsWriter struct {
+	w io.Writer
+}
+
+// header 输出指标的 HELP 与 TYPE 行
+func (m *metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", metricsNamespace, name, help, metricsNamespace, name, typ)
+}
+
+// sample 输出一个样本，labels 为交替的标签名与标签值
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(metricsNamespace + "_" + name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatMetricValue(value))
+	b.WriteByte('\n')
+	io.WriteString(m.w, b.String())
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatMetricValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// peerSample 单个 Peer 的指标
+type peerSample struct {
+	info     PeerInfo
+	attempts uint32
+}
+
+// handleMetrics Prometheus 指标
+// GET /metrics
+func (ui *WebUI) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := &metricsWriter{w: w}
+	dev := ui.device
+
+	configLock.RLock()
+	conf := ui.config.System.Metrics
+	configLock.RUnlock()
+
+	// ========== 设备 ==========
+	info := ui.visibleDeviceInfo(currentPrincipal(r))
+	online := 0
+	for _, peer := range info.Peers {
+		if peer.IsOnline {
+			online++
+		}
+	}
+	m.header("device_up", "gauge", "Whether the device is up.")
+	m.sample("device_up", boolValue(dev.IsUp()))
+	m.header("device_listen_port", "gauge", "UDP listen port of the device.")
+	m.sample("device_listen_port", float64(info.ListenPort))
+	m.header("device_peers", "gauge", "Number of configured peers.")
+	m.sample("device_peers", float64(info.PeerCount))
+	m.header("device_peers_online", "gauge", "Number of peers with a handshake in the last 135 seconds.")
+	m.sample("device_peers_online", float64(online))
+	m.header("device_under_load", "gauge", "Whether the device is under handshake load and requires cookies.")
+	m.sample("device_under_load", boolValue(dev.IsUnderLoad()))
+
+	queues := dev.GetQueueStats()
+	m.header("device_queue_length", "gauge", "Current length of the device work queues.")
+	for _, q := range queues {
+		m.sample("device_queue_length", float64(q.Len), "queue", q.Name)
+	}
+	m.header("device_queue_capacity", "gauge", "Capacity of the device work queues.")
+	for _, q := range queues {
+		m.sample("device_queue_capacity", float64(q.Cap), "queue", q.Name)
+	}
+	pools := dev.GetPoolStats()
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		m.header("device_pool_in_use", "gauge", "Objects currently borrowed from the bounded device pools.")
+		for _, name := range names {
+			m.sample("device_pool_in_use", float64(pools[name]), "pool", name)
+		}
+	}
+
+	// ========== Peer ==========
+	if limit := conf.maxPeers(); limit >= 0 {
+		ui.writePeerMetrics(m, info.Peers, limit, conf.RemarkLabel)
+	}
+
+	// ========== 管理 ==========
+	m.header("manager_registrations_total", "counter", "Invitation registrations by result.")
+	labels, values := ui.metrics.registrations.snapshot()
+	for i, label := range labels {
+		m.sample("manager_registrations_total", float64(values[i]), "result", label)
+	}
+
+	counts := ui.events.Counts()
+	m.header("manager_invites_total", "counter", "Invitation tokens by action.")
+	for _, action := range []string{"created", "consumed", "removed", "expired"} {
+		m.sample("manager_invites_total", float64(counts["invite."+action]), "action", action)
+	}
+	pending := 0
+	for _, inv := range ui.config.ListInvites() {
+		if time.Now().Before(inv.ExpiresAt) {
+			pending++
+		}
+	}
+	m.header("manager_invites_pending", "gauge", "Unused, unexpired invitation tokens.")
+	m.sample("manager_invites_pending", float64(pending))
+
+	m.header("manager_events_total", "counter", "Published management events by type.")
+	types := make([]string, 0, len(counts))
+	for typ := range counts {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		m.sample("manager_events_total", float64(counts[typ]), "type", typ)
+	}
+
+	m.header("manager_api_errors_total", "counter", "API error responses by error code.")
+	labels, values = apiErrorsTotal.snapshot()
+	for i, label := range labels {
+		m.sample("manager_api_errors_total", float64(values[i]), "code", label)
+	}
+}
+
+// writePeerMetrics 输出逐 Peer 指标
+// 超过 limit 时只单独输出 peerSeriesSet 选出的 Peer，其余 Peer 的流量汇总到 public_key="_other"
+func (ui *WebUI) writePeerMetrics(m *metricsWriter, peers []PeerInfo, limit int, remarkLabel bool) {
+	attempts := make(map[string]uint32, len(peers))
+	ui.device.ForEachPeer(func(p *device.Peer) {
+		attempts[p.GetPublicKey()] = p.GetHandshakeAttempts()
+	})
+	samples := make([]peerSample, 0, len(peers))
+	for _, peer := range peers {
+		samples = append(samples, peerSample{info: peer, attempts: attempts[peer.PublicKey]})
+	}
+
+	// 受标签限制的角色只看到部分 Peer，清除集合中的 Peer 要以配置中的全部 Peer 为准
+	current := make(map[string]bool)
+	configLock.RLock()
+	for _, p := range ui.config.Peers {
+		current[p.PublicKey] = true
+	}
+	configLock.RUnlock()
+	for key := range attempts {
+		current[key] = true
+	}
+
+	var other *peerSample
+	if len(samples) > limit {
+		var overflow []peerSample
+		samples, overflow = ui.metrics.peerSeries.split(samples, limit, current)
+		other = &peerSample{info: PeerInfo{PublicKey: metricsOtherPeer, Counters: new(PeerCounters)}}
+		for _, s := range overflow {
+			other.info.TxBytes += s.info.TxBytes
+			other.info.RxBytes += s.info.RxBytes
+			if c := s.info.Counters; c != nil {
+				o := other.info.Counters
+				o.TxPackets += c.TxPackets
+				o.RxPackets += c.RxPackets
+				o.Drops.AllowedIPs += c.Drops.AllowedIPs
+				o.Drops.Replay += c.Drops.Replay
+				o.Drops.Decrypt += c.Drops.Decrypt
+				o.Drops.StagedOverflow += c.Drops.StagedOverflow
+				o.Drops.NoKeypair += c.Drops.NoKeypair
+				o.Drops.Oversize += c.Drops.Oversize
+			}
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].info.PublicKey < samples[j].info.PublicKey
+	})
+
+	labels := func(peer PeerInfo) []string {
+		l := []string{"public_key", peer.PublicKey}
+		if remarkLabel {
+			l = append(l, "remark", peer.Remark)
+		}
+		return l
+	}
+
+	m.header("peer_transmit_bytes_total", "counter", "Bytes sent to the peer.")
+	for _, s := range samples {
+		m.sample("peer_transmit_bytes_total", float64(s.info.TxBytes), labels(s.info)...)
+	}
+	if other != nil {
+		m.sample("peer_transmit_bytes_total", float64(other.info.TxBytes), labels(other.info)...)
+	}
+	m.header("peer_receive_bytes_total", "counter", "Bytes received from the peer.")
+	for _, s := range samples {
+		m.sample("peer_receive_bytes_total", float64(s.info.RxBytes), labels(s.info)...)
+	}
+	if other != nil {
+		m.sample("peer_receive_bytes_total", float64(other.info.RxBytes), labels(other.info)...)
+	}
+	// 已停用的 Peer 没有计数，不输出
+	forEachCounted := func(fn func(PeerInfo, *PeerCounters)) {
+		for _, s := range samples {
+			if s.info.Counters != nil {
+				fn(s.info, s.info.Counters)
+			}
+		}
+		if other != nil {
+			fn(other.info, other.info.Counters)
+		}
+	}
+	m.header("peer_transmit_packets_total", "counter", "UDP packets sent to the peer, including handshakes.")
+	forEachCounted(func(peer PeerInfo, c *PeerCounters) {
+		m.sample("peer_transmit_packets_total", float64(c.TxPackets), labels(peer)...)
+	})
+	m.header("peer_receive_packets_total", "counter", "Authenticated packets received from the peer, including handshakes.")
+	forEachCounted(func(peer PeerInfo, c *PeerCounters) {
+		m.sample("peer_receive_packets_total", float64(c.RxPackets), labels(peer)...)
+	})
+	m.header("peer_dropped_packets_total", "counter", "Packets to or from the peer that were dropped, by reason.")
+	forEachCounted(func(peer PeerInfo, c *PeerCounters) {
+		for _, d := range []struct {
+			reason string
+			value  uint64
+		}{
+			{"allowed_ips", c.Drops.AllowedIPs},
+			{"replay", c.Drops.Replay},
+			{"decrypt", c.Drops.Decrypt},
+			{"staged_overflow", c.Drops.StagedOverflow},
+			{"no_keypair", c.Drops.NoKeypair},
+			{"oversize", c.Drops.Oversize},
+		} {
+			m.sample("peer_dropped_packets_total", float64(d.value), append(labels(peer), "reason", d.reason)...)
+		}
+	})
+	m.header("peer_handshakes_total", "counter", "Handshake initiations sent, valid initiations received and handshakes given up, by kind.")
+	for _, s := range samples {
+		if c := s.info.Counters; c != nil {
+			m.sample("peer_handshakes_total", float64(c.HandshakesSent), append(labels(s.info), "kind", "sent")...)
+			m.sample("peer_handshakes_total", float64(c.HandshakesReceived), append(labels(s.info), "kind", "received")...)
+			m.sample("peer_handshakes_total", float64(c.HandshakesFailed), append(labels(s.info), "kind", "failed")...)
+		}
+	}
+	m.header("peer_rekeys_total", "counter", "Times a new session key replaced one still in use.")
+	for _, s := range samples {
+		if c := s.info.Counters; c != nil {
+			m.sample("peer_rekeys_total", float64(c.Rekeys), labels(s.info)...)
+		}
+	}
+	m.header("peer_last_handshake_seconds", "gauge", "Unix time of the last completed handshake, 0 if never.")
+	for _, s := range samples {
+		var ts float64
+		if !s.info.handshake.IsZero() {
+			ts = float64(s.info.handshake.UnixNano()) / 1e9
+		}
+		m.sample("peer_last_handshake_seconds", ts, labels(s.info)...)
+	}
+	m.header("peer_persistent_keepalive_seconds", "gauge", "Persistent keepalive interval, 0 if disabled.")
+	for _, s := range samples {
+		m.sample("peer_persistent_keepalive_seconds", float64(s.info.KeepaliveInterval), labels(s.info)...)
+	}
+	m.header("peer_handshake_attempts", "gauge", "Retries of the handshake currently in progress.")
+	for _, s := range samples {
+		m.sample("peer_handshake_attempts", float64(s.attempts), labels(s.info)...)
+	}
+	m.header("peer_online", "gauge", "Whether the peer had a handshake in the last 135 seconds.")
+	for _, s := range samples {
+		m.sample("peer_online", boolValue(s.info.IsOnline), labels(s.info)...)
+	}
+}
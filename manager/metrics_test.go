@@ -0,0 +1,250 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+func TestPeerSeriesSet(t *testing.T) {
+	sample := func(key string, total uint64) peerSample {
+		return peerSample{info: PeerInfo{PublicKey: key, TotalBytes: total}}
+	}
+	keys := func(samples []peerSample) []string {
+		var out []string
+		for _, s := range samples {
+			out = append(out, s.info.PublicKey)
+		}
+		sort.Strings(out)
+		return out
+	}
+	all := map[string]bool{"a": true, "b": true, "c": true}
+
+	// 每一步依次调用 split，集合状态在步骤之间保留
+	var s peerSeriesSet
+	steps := []struct {
+		name     string
+		samples  []peerSample
+		limit    int
+		current  map[string]bool
+		kept     []string
+		overflow []string
+	}{
+		{"first scrape picks top traffic", []peerSample{sample("a", 100), sample("b", 50), sample("c", 10)}, 2, all, []string{"a", "b"}, []string{"c"}},
+		{"ranking change keeps members", []peerSample{sample("a", 100), sample("b", 50), sample("c", 1000)}, 2, all, []string{"a", "b"}, []string{"c"}},
+		{"removed peer frees a slot", []peerSample{sample("b", 50), sample("c", 1000)}, 2, map[string]bool{"b": true, "c": true}, []string{"b", "c"}, nil},
+		{"lower limit reselects", []peerSample{sample("a", 100), sample("b", 50), sample("c", 1000)}, 1, all, []string{"c"}, []string{"a", "b"}},
+	}
+	for _, tt := range steps {
+		kept, overflow := s.split(tt.samples, tt.limit, tt.current)
+		if got := keys(kept); !reflect.DeepEqual(got, tt.kept) {
+			t.Errorf("%s: kept %q, want %q", tt.name, got, tt.kept)
+		}
+		if got := keys(overflow); !reflect.DeepEqual(got, tt.overflow) {
+			t.Errorf("%s: overflow %q, want %q", tt.name, got, tt.overflow)
+		}
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	tests := []struct {
+		value  float64
+		labels []string
+		want   string
+	}{
+		{3, nil, "wireguard_x 3\n"},
+		{0.25, []string{"a", "b"}, `wireguard_x{a="b"} 0.25` + "\n"},
+		{1e16, nil, "wireguard_x 1e+16\n"},
+		{1, []string{"remark", "say \"hi\"\n\\"}, `wireguard_x{remark="say \"hi\"\n\\"} 1` + "\n"},
+		{1, []string{"a", "1", "b", "2"}, `wireguard_x{a="1",b="2"} 1` + "\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		(&metricsWriter{w: &b}).sample("x", tt.value, tt.labels...)
+		if b.String() != tt.want {
+			t.Errorf("sample(%v, %q) = %q, want %q", tt.value, tt.labels, b.String(), tt.want)
+		}
+	}
+}
+
+// sendHandshake 经测试用的 Bind 向 Peer 发出一次握手请求，累加其报文与握手计数
+func sendHandshake(t *testing.T, tu *testUI, key string) {
+	t.Helper()
+	if err := tu.device.IpcSet("public_key=" + b64ToHex(key) + "\nendpoint=127.0.0.1:1\n"); err != nil {
+		t.Fatal(err)
+	}
+	var pk device.NoisePublicKey
+	raw, _ := base64.StdEncoding.DecodeString(key)
+	copy(pk[:], raw)
+	if err := tu.device.LookupPeer(pk).SendHandshakeInitiation(false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// metricLines 返回以 prefix 开头的样本行
+func metricLines(body, prefix string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{{Name: "iot-ops", Permissions: []Permission{PermStatusRead}, PeerTags: []string{"iot"}}}
+	})
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	iot := tu.token("alice", "iot-ops", ScopeStatusRead)
+	for i, tag := range []string{"iot", "cam", "cam"} {
+		req := fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.%d/32"],"tags":[%q]}`, testKey(byte(i+1)), i+2, tag)
+		if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers", req); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create peer: %d %s", resp.StatusCode, body)
+		}
+	}
+	tu.bearer(admin, http.MethodGet, "/api/v1/peers/"+strings.Repeat("A", 43)+"=", "") // 计入 not_found
+	sendHandshake(t, tu, testKey(2))
+
+	setMetrics := func(m MetricsConfig) {
+		configLock.Lock()
+		tu.config.System.Metrics = m
+		configLock.Unlock()
+	}
+	tests := []struct {
+		name    string
+		token   string
+		metrics MetricsConfig
+		want    []string // 必须出现的样本行
+		series  int      // 逐 Peer 发送字节数的样本行数
+	}{
+		{"all peers", admin, MetricsConfig{}, []string{
+			"wireguard_device_peers 3",
+			"wireguard_device_peers_online 0",
+			`wireguard_manager_events_total{type="peer.added"} 3`,
+			`wireguard_manager_api_errors_total{code="not_found"} `,
+			`wireguard_peer_transmit_packets_total{public_key="` + testKey(1) + `"} 0`,
+			`wireguard_peer_transmit_packets_total{public_key="` + testKey(2) + `"} 1`,
+			`wireguard_peer_receive_packets_total{public_key="` + testKey(2) + `"} 0`,
+			`wireguard_peer_dropped_packets_total{public_key="` + testKey(2) + `",reason="allowed_ips"} 0`,
+			`wireguard_peer_dropped_packets_total{public_key="` + testKey(2) + `",reason="oversize"} 0`,
+			`wireguard_peer_handshakes_total{public_key="` + testKey(2) + `",kind="sent"} 1`,
+			`wireguard_peer_handshakes_total{public_key="` + testKey(2) + `",kind="failed"} 0`,
+			`wireguard_peer_rekeys_total{public_key="` + testKey(2) + `"} 0`,
+		}, 3},
+		{"remark label", admin, MetricsConfig{RemarkLabel: true}, []string{
+			`wireguard_peer_transmit_bytes_total{public_key="` + testKey(1) + `",remark="未命名"} 0`,
+		}, 3},
+		{"over max_peers", admin, MetricsConfig{MaxPeers: 1}, []string{
+			`wireguard_peer_transmit_bytes_total{public_key="_other"} 0`,
+			`wireguard_peer_transmit_packets_total{public_key="` + testKey(2) + `"} 1`,
+			`wireguard_peer_transmit_packets_total{public_key="_other"} 0`,
+			`wireguard_peer_dropped_packets_total{public_key="_other",reason="replay"} 0`,
+		}, 2},
+		{"per-peer disabled", admin, MetricsConfig{MaxPeers: -1}, []string{"wireguard_device_peers 3"}, 0},
+		{"peer tag scope", iot, MetricsConfig{}, []string{
+			"wireguard_device_peers 1",
+			`wireguard_peer_transmit_bytes_total{public_key="` + testKey(1) + `"} 0`,
+		}, 1},
+	}
+	for _, tt := range tests {
+		setMetrics(tt.metrics)
+		resp, body := tu.bearer(tt.token, http.MethodGet, "/metrics", "")
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+			t.Fatalf("%s: %d %q", tt.name, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: missing %q", tt.name, want)
+			}
+		}
+		if n := len(metricLines(body, "wireguard_peer_transmit_bytes_total{")); n != tt.series {
+			t.Errorf("%s: %d transmit series, want %d", tt.name, n, tt.series)
+		}
+	}
+
+	resp, _ := tu.do(nil, http.MethodGet, "/metrics", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous /metrics: %d", resp.StatusCode)
+	}
+
+	// 已停用的 Peer 不在设备上，没有计数
+	if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers/"+b64ToHex(testKey(3))+"/disable", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("disable peer: %d %s", resp.StatusCode, body)
+	}
+	_, body := tu.bearer(admin, http.MethodGet, "/metrics", "")
+	if lines := metricLines(body, `wireguard_peer_transmit_packets_total{public_key="`+testKey(3)+`"}`); len(lines) != 0 {
+		t.Errorf("disabled peer counted: %q", lines)
+	}
+}
+
+func TestPeerCountersAPI(t *testing.T) {
+	tu := newTestUI(t)
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	active, disabled := testKey(1), testKey(2)
+	for i, key := range []string{active, disabled} {
+		req := fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.%d/32"]}`, key, i+2)
+		if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers", req); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create peer: %d %s", resp.StatusCode, body)
+		}
+	}
+	sendHandshake(t, tu, active)
+	if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers/"+b64ToHex(disabled)+"/disable", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("disable peer: %d %s", resp.StatusCode, body)
+	}
+
+	want := &PeerCounters{TxPackets: 1, HandshakesSent: 1}
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"legacy list", "/api/peers"},
+		{"v1 list", "/api/v1/peers"},
+		{"v1 get", "/api/v1/peers/" + b64ToHex(active)},
+	}
+	for _, tt := range tests {
+		resp, body := tu.bearer(admin, http.MethodGet, tt.path, "")
+		var peers []PeerInfo
+		if strings.HasPrefix(body, "{") {
+			peers = make([]PeerInfo, 1)
+			json.Unmarshal([]byte(body), &peers[0])
+		} else {
+			json.Unmarshal([]byte(body), &peers)
+		}
+		if resp.StatusCode != http.StatusOK || len(peers) == 0 {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+			continue
+		}
+		for _, p := range peers {
+			switch p.PublicKey {
+			case active:
+				if !reflect.DeepEqual(p.Counters, want) {
+					t.Errorf("%s: counters %+v, want %+v", tt.name, p.Counters, want)
+				}
+			case disabled:
+				if p.Counters != nil {
+					t.Errorf("%s: disabled peer has counters %+v", tt.name, p.Counters)
+				}
+			}
+		}
+	}
+	_, body := tu.bearer(admin, http.MethodGet, "/api/v1/peers/"+b64ToHex(active), "")
+	for _, field := range []string{`"drops":{"allowed_ips":0,`, `"handshakes_sent":1`, `"rekeys":0`} {
+		if !strings.Contains(body, field) {
+			t.Errorf("GET peer: missing %s in %s", field, body)
+		}
+	}
+}
@@ -0,0 +1,791 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// mqtt.go - MQTT 信令桥
+// 设备订阅 {prefix}/{device_id}/cmd 接收 vpn_up / vpn_down / rotate / config 指令，
+// 并把隧道状态、隧道 IP 与握手情况以保留消息发布到 {prefix}/{device_id}/status；
+// 服务端模式另外订阅 {prefix}/+/status 跟踪各设备的状态，通过 API 向设备下发指令，
+// 并为完成 rotate 的设备换上新公钥
+
+package manager
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/mqtt"
+)
+
+const (
+	defaultMQTTPrefix         = "iot"
+	defaultMQTTStatusInterval = 60              // 周期上报间隔 (秒)
+	mqttEventBuffer           = 64              // 事件订阅缓冲
+	mqttStopTimeout           = 3 * time.Second // 退出时发布离线状态的等待时间
+)
+
+// 桥接模式
+const (
+	MQTTModeClient = "client" // 设备端：执行指令、上报状态
+	MQTTModeServer = "server" // 网关：同上，另外跟踪设备状态并下发指令
+)
+
+// 指令
+const (
+	MQTTActionUp     = "vpn_up"
+	MQTTActionDown   = "vpn_down"
+	MQTTActionRotate = "rotate" // 更换本机密钥对
+	MQTTActionConfig = "config" // 修改 Peer 端点与保活
+)
+
+// 隧道状态
+const (
+	MQTTVPNDown       = "down"
+	MQTTVPNConnecting = "connecting" // 设备已启动，尚无在线 Peer
+	MQTTVPNConnected  = "connected"
+)
+
+// mqttRotateLabel 参与 rotate 证明计算的固定前缀
+const mqttRotateLabel = "wireguard-go mqtt rotate v1"
+
+// mqttCommandLabel 参与指令签名计算的固定前缀
+const mqttCommandLabel = "wireguard-go mqtt cmd v1"
+
+// mqttCommandMaxAge 指令签名时间与本机时间的最大偏差，超出视为重放
+const mqttCommandMaxAge = 5 * time.Minute
+
+var errMQTTDisabled = errors.New("MQTT bridge is not enabled")
+
+// MQTTConfig MQTT 信令桥设置，修改后需重启
+type MQTTConfig struct {
+	Broker         string `json:"broker,omitempty"`          // 代理地址 tcp://host:1883 或 tls://host:8883，空为关闭
+	DeviceID       string `json:"device_id,omitempty"`       // 本机设备 ID，空为主机名
+	Mode           string `json:"mode,omitempty"`            // client 或 server，空时按 is_client 推断
+	TopicPrefix    string `json:"topic_prefix,omitempty"`    // 主题前缀，空为 iot
+	Username       string `json:"username,omitempty"`        // 可选
+	Password       string `json:"password,omitempty"`        // 可选，读取系统设置时不返回
+	StatusInterval int    `json:"status_interval,omitempty"` // 周期上报间隔 (秒)，0 为默认 60
+}
+
+// mode 返回生效的模式
+func (m *MQTTConfig) mode(isClient bool) string {
+	if m.Mode != "" {
+		return m.Mode
+	}
+	if isClient {
+		return MQTTModeClient
+	}
+	return MQTTModeServer
+}
+
+// validTopicLevel 主题层级不能为空，也不能含通配符或分隔符
+func validTopicLevel(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "+#/\x00")
+}
+
+// MQTTCommand 下发给设备的指令 (发布到 {prefix}/{device_id}/cmd)
+type MQTTCommand struct {
+	ID        string `json:"id,omitempty"`        // 关联 ID，执行结果原样带回
+	Action    string `json:"action"`              // vpn_up / vpn_down / rotate / config
+	Peer      string `json:"peer,omitempty"`      // config：目标 Peer 公钥，只有一个 Peer 时可省略
+	Endpoint  string `json:"endpoint,omitempty"`  // vpn_up、config：Peer 的新端点 (ip:port)
+	Keepalive *int   `json:"keepalive,omitempty"` // config：PersistentKeepalive (秒)，0 为关闭
+	Time      int64  `json:"time,omitempty"`      // 签名时间 (Unix 秒)
+	Sig       string `json:"sig,omitempty"`       // 网关签名，见 mqttCommandMessage
+}
+
+// mqttCommandMessage 返回指令的签名内容
+// 签名为 HMAC-SHA256(DH(网关私钥, 设备公钥), label || 各字段)；
+// 设备用自己的私钥与各 Peer 公钥算出同一值，只执行由自己的 Peer 签发的指令
+func (cmd MQTTCommand) mqttCommandMessage() string {
+	keepalive := ""
+	if cmd.Keepalive != nil {
+		keepalive = strconv.Itoa(*cmd.Keepalive)
+	}
+	return strings.Join([]string{mqttCommandLabel, cmd.ID, cmd.Action, cmd.Peer, cmd.Endpoint, keepalive, strconv.FormatInt(cmd.Time, 10)}, "\n")
+}
+
+// MQTTCommandResult 最近一条指令的执行结果
+type MQTTCommandResult struct {
+	ID     string    `json:"id,omitempty"`
+	Action string    `json:"action"`
+	OK     bool      `json:"ok"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// MQTTRotation rotate 后上报的旧公钥与证明
+// 证明为 HMAC-SHA256(DH(旧私钥, Peer 公钥), label || 旧公钥 || 新公钥)，按 Peer 公钥索引；
+// Peer 用自己的私钥与旧公钥算出同一值，确认新公钥确实来自旧密钥的持有者
+type MQTTRotation struct {
+	From   string            `json:"from"`
+	Proofs map[string]string `json:"proofs"`
+}
+
+// MQTTStatus 发布到 {prefix}/{device_id}/status 的状态 (保留消息)
+type MQTTStatus struct {
+	DeviceID      string             `json:"device_id"`
+	Online        bool               `json:"online"`                   // 遗嘱消息与正常退出时为 false
+	VPN           string             `json:"vpn,omitempty"`            // down / connecting / connected
+	IP            string             `json:"ip,omitempty"`             // 隧道 IP
+	PublicKey     string             `json:"public_key,omitempty"`     // 本机公钥
+	Endpoint      string             `json:"endpoint,omitempty"`       // 自动发现的 WireGuard 公网地址 (端口映射或 STUN)
+	Peers         int                `json:"peers"`                    // Peer 数量
+	PeersOnline   int                `json:"peers_online"`             // 握手未过期的 Peer 数量
+	LastHandshake *time.Time         `json:"last_handshake,omitempty"` // 最近一次握手
+	Rotation      *MQTTRotation      `json:"rotation,omitempty"`       // 本次运行中最近一次 rotate
+	Command       *MQTTCommandResult `json:"command,omitempty"`        // 最近一条指令的结果
+	Time          *time.Time         `json:"time,omitempty"`
+}
+
+// MQTTDevice 服务端模式下跟踪到的设备
+type MQTTDevice struct {
+	DeviceID  string     `json:"device_id"`
+	Status    MQTTStatus `json:"status"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// MQTTBridgeInfo 信令桥运行状态
+type MQTTBridgeInfo struct {
+	Enabled   bool   `json:"enabled"`
+	Connected bool   `json:"connected"`
+	Broker    string `json:"broker,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	DeviceID  string `json:"device_id,omitempty"`
+	Topic     string `json:"topic,omitempty"` // 指令主题
+}
+
+// mqttBridge 信令桥运行时状态
+type mqttBridge struct {
+	client   *mqtt.Client
+	broker   string
+	mode     string
+	deviceID string
+	prefix   string
+	interval time.Duration
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+
+	cmdMu sync.Mutex           // 指令与 rotate 逐条执行
+	seen  map[string]time.Time // 已执行指令的 ID 与签名时间，防重放，受 cmdMu 保护
+
+	mu       sync.Mutex
+	last     *MQTTCommandResult
+	rotation *MQTTRotation
+	devices  map[string]MQTTDevice // 服务端模式
+}
+
+func (b *mqttBridge) topic(deviceID, kind string) string {
+	return b.prefix + "/" + deviceID + "/" + kind
+}
+
+// startMQTT 按配置连接代理，未配置代理时不启用
+func (ui *WebUI) startMQTT() error {
+	configLock.RLock()
+	conf := ui.config.System.MQTT
+	isClient := ui.config.System.IsClient
+	configLock.RUnlock()
+	if conf.Broker == "" {
+		return nil
+	}
+
+	b := &mqttBridge{
+		broker:   conf.Broker,
+		mode:     conf.mode(isClient),
+		deviceID: conf.DeviceID,
+		prefix:   strings.TrimSuffix(conf.TopicPrefix, "/"),
+		interval: time.Duration(conf.StatusInterval) * time.Second,
+		stopped:  make(chan struct{}),
+		devices:  make(map[string]MQTTDevice),
+	}
+	if b.mode != MQTTModeClient && b.mode != MQTTModeServer {
+		return fmt.Errorf("invalid mode %q, use %q or %q", b.mode, MQTTModeClient, MQTTModeServer)
+	}
+	if b.deviceID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("device_id not set and hostname unavailable: %w", err)
+		}
+		b.deviceID = host
+	}
+	if !validTopicLevel(b.deviceID) {
+		return fmt.Errorf("invalid device_id %q", b.deviceID)
+	}
+	if b.prefix == "" {
+		b.prefix = defaultMQTTPrefix
+	}
+	if strings.ContainsAny(b.prefix, "+#\x00") {
+		return fmt.Errorf("invalid topic_prefix %q", b.prefix)
+	}
+	if b.interval <= 0 {
+		b.interval = defaultMQTTStatusInterval * time.Second
+	}
+
+	will, _ := json.Marshal(MQTTStatus{DeviceID: b.deviceID})
+	logger := ui.device.GetLogger()
+	b.client = mqtt.NewClient(mqtt.Options{
+		Broker:    conf.Broker,
+		ClientID:  "wg-" + b.deviceID,
+		Username:  conf.Username,
+		Password:  conf.Password,
+		Will:      &mqtt.Message{Topic: b.topic(b.deviceID, "status"), Payload: will, QoS: 1, Retain: true},
+		OnConnect: func(*mqtt.Client) { ui.publishMQTTStatus() },
+		Logf:      logger.Verbosef,
+	})
+	b.client.Subscribe(b.topic(b.deviceID, "cmd"), 1, ui.handleMQTTCommand)
+	if b.mode == MQTTModeServer {
+		b.client.Subscribe(b.topic("+", "status"), 1, ui.handleMQTTDeviceStatus)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	ui.mqtt = b
+	go func() {
+		defer close(b.stopped)
+		b.client.Run(ctx)
+	}()
+	go ui.runMQTTStatus()
+	logger.Verbosef("MQTT bridge (%s mode) connecting to %s as %s", b.mode, b.broker, b.deviceID)
+	return nil
+}
+
+// stopMQTT 发布离线状态后断开，代理不会再发布遗嘱
+func (ui *WebUI) stopMQTT() {
+	b := ui.mqtt
+	if b == nil {
+		return
+	}
+	if b.client.Connected() {
+		payload, _ := json.Marshal(MQTTStatus{DeviceID: b.deviceID, VPN: MQTTVPNDown})
+		if err := b.client.Publish(mqtt.Message{Topic: b.topic(b.deviceID, "status"), Payload: payload, QoS: 1, Retain: true}); err != nil {
+			ui.device.GetLogger().Errorf("Failed to publish MQTT offline status: %v", err)
+		}
+	}
+	b.cancel()
+	select {
+	case <-b.stopped:
+	case <-time.After(mqttStopTimeout):
+	}
+}
+
+// mqttStatusEvent 判断事件是否需要重新上报状态；服务端 Peer 众多，只在设备启停与公网地址变化时上报
+func (b *mqttBridge) mqttStatusEvent(typ string) bool {
+	switch typ {
+	case EventDeviceUp, EventDeviceDown, EventPublicEndpoint, EventPortMapping:
+		return true
+	case EventPeerOnline, EventPeerOffline, EventPeerHandshake, EventPeerEndpoint:
+		return b.mode == MQTTModeClient
+	}
+	return false
+}
+
+// runMQTTStatus 状态变化时及按周期发布状态
+func (ui *WebUI) runMQTTStatus() {
+	b := ui.mqtt
+	events, cancel := ui.events.Subscribe(mqttEventBuffer)
+	defer cancel()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ui.done:
+			return
+		case e := <-events:
+			if !b.mqttStatusEvent(e.Type) {
+				continue
+			}
+		case <-ticker.C:
+		}
+		ui.publishMQTTStatus()
+	}
+}
+
+// mqttStatus 汇总本机当前状态
+func (ui *WebUI) mqttStatus() MQTTStatus {
+	b := ui.mqtt
+	now := time.Now()
+	st := MQTTStatus{
+		DeviceID:  b.deviceID,
+		Online:    true,
+		VPN:       MQTTVPNDown,
+		PublicKey: ui.device.GetPublicKey(),
+		Time:      &now,
+	}
+	configLock.RLock()
+	st.IP, _, _ = strings.Cut(ui.config.System.InternalSubnet, "/")
+	configLock.RUnlock()
+	if ap, ok := ui.discoveredEndpoint(); ok {
+		st.Endpoint = ap.String()
+	}
+
+	var latest int64
+	ui.device.ForEachPeer(func(p *device.Peer) {
+		st.Peers++
+		handshake := p.GetLastHandshakeNano()
+		if peerOnline(handshake) {
+			st.PeersOnline++
+		}
+		latest = max(latest, handshake)
+	})
+	if latest > 0 {
+		t := time.Unix(0, latest)
+		st.LastHandshake = &t
+	}
+	if ui.device.IsUp() {
+		st.VPN = MQTTVPNConnecting
+		if st.PeersOnline > 0 {
+			st.VPN = MQTTVPNConnected
+		}
+	}
+
+	b.mu.Lock()
+	st.Rotation = b.rotation
+	st.Command = b.last
+	b.mu.Unlock()
+	return st
+}
+
+// publishMQTTStatus 发布状态，未连接时跳过 (连上后会重新发布)
+func (ui *WebUI) publishMQTTStatus() {
+	b := ui.mqtt
+	payload, err := json.Marshal(ui.mqttStatus())
+	if err != nil {
+		return
+	}
+	err = b.client.Publish(mqtt.Message{Topic: b.topic(b.deviceID, "status"), Payload: payload, QoS: 1, Retain: true})
+	if err != nil && err != mqtt.ErrNotConnected {
+		ui.device.GetLogger().Verbosef("MQTT status publish failed: %v", err)
+	}
+}
+
+// ========== 指令 ==========
+
+// handleMQTTCommand 执行指令并在状态中带回结果
+// 保留消息不执行：否则每次重连都会重放一条过期的指令
+func (ui *WebUI) handleMQTTCommand(msg mqtt.Message) {
+	if msg.Retain || len(msg.Payload) == 0 {
+		return
+	}
+	b := ui.mqtt
+	var cmd MQTTCommand
+	err := json.Unmarshal(msg.Payload, &cmd)
+	if err != nil {
+		err = fmt.Errorf("invalid command: %w", err)
+	} else {
+		b.cmdMu.Lock()
+		if err = ui.verifyMQTTCommand(cmd, time.Now()); err == nil {
+			err = ui.runMQTTCommand(cmd)
+		}
+		b.cmdMu.Unlock()
+	}
+
+	result := &MQTTCommandResult{ID: cmd.ID, Action: cmd.Action, OK: err == nil, Time: time.Now()}
+	detail := cmd.Action
+	if err != nil {
+		result.Error = err.Error()
+		detail += " failed: " + result.Error
+		ui.device.GetLogger().Errorf("MQTT command %q failed: %v", cmd.Action, err)
+	}
+	ui.audit.Record(AuditEntry{Event: AuditMQTTCommand, Actor: "mqtt", Detail: detail})
+	b.mu.Lock()
+	b.last = result
+	b.mu.Unlock()
+	ui.publishMQTTStatus()
+}
+
+// verifyMQTTCommand 校验指令签名、时间与 ID，调用方需持有 cmdMu
+// 任何能向指令主题发布的人都能伪造未签名的指令，因此不依赖代理的 ACL
+func (ui *WebUI) verifyMQTTCommand(cmd MQTTCommand, now time.Time) error {
+	b := ui.mqtt
+	if cmd.Sig == "" || cmd.ID == "" {
+		return errors.New("unsigned command")
+	}
+	at := time.Unix(cmd.Time, 0)
+	if at.Before(now.Add(-mqttCommandMaxAge)) || at.After(now.Add(mqttCommandMaxAge)) {
+		return fmt.Errorf("command time %s is out of range", at.UTC().Format(time.RFC3339))
+	}
+	for id, t := range b.seen {
+		if t.Before(now.Add(-mqttCommandMaxAge)) {
+			delete(b.seen, id)
+		}
+	}
+	if _, ok := b.seen[cmd.ID]; ok {
+		return fmt.Errorf("command %s already executed", cmd.ID)
+	}
+
+	configLock.RLock()
+	private := ui.config.Identity.PrivateKey
+	peers := make([]string, 0, len(ui.config.Peers))
+	for _, p := range ui.config.Peers {
+		peers = append(peers, p.PublicKey)
+	}
+	configLock.RUnlock()
+	message := cmd.mqttCommandMessage()
+	for _, peer := range peers {
+		want, err := mqttMAC(private, peer, message)
+		if err == nil && hmac.Equal([]byte(cmd.Sig), []byte(want)) {
+			if b.seen == nil {
+				b.seen = make(map[string]time.Time)
+			}
+			b.seen[cmd.ID] = at
+			return nil
+		}
+	}
+	return errors.New("invalid command signature")
+}
+
+// runMQTTCommand 执行单条指令
+func (ui *WebUI) runMQTTCommand(cmd MQTTCommand) error {
+	switch cmd.Action {
+	case MQTTActionUp:
+		if cmd.Endpoint != "" {
+			if err := ui.configureMQTTPeer(MQTTCommand{Peer: cmd.Peer, Endpoint: cmd.Endpoint}); err != nil {
+				return err
+			}
+		}
+		return ui.device.Up()
+	case MQTTActionDown:
+		return ui.device.Down()
+	case MQTTActionRotate:
+		return ui.rotateIdentity()
+	case MQTTActionConfig:
+		return ui.configureMQTTPeer(cmd)
+	}
+	return fmt.Errorf("unknown action %q", cmd.Action)
+}
+
+// configureMQTTPeer 修改 Peer 的端点与保活间隔并持久化
+func (ui *WebUI) configureMQTTPeer(cmd MQTTCommand) error {
+	if cmd.Endpoint == "" && cmd.Keepalive == nil {
+		return errors.New("nothing to change, set endpoint and/or keepalive")
+	}
+	publicKey, err := ui.mqttTargetPeer(cmd.Peer)
+	if err != nil {
+		return err
+	}
+
+	var config strings.Builder
+	config.WriteString("public_key=" + b64ToHex(publicKey) + "\nupdate_only=true\n")
+	if cmd.Endpoint != "" {
+		// 指令来自 Broker，端点必须先解析再拼入 UAPI
+		endpoint, err := parseEndpoint(cmd.Endpoint)
+		if err != nil {
+			return err
+		}
+		config.WriteString("endpoint=" + endpoint + "\n")
+	}
+	if cmd.Keepalive != nil {
+		if *cmd.Keepalive < 0 || *cmd.Keepalive > 65535 {
+			return fmt.Errorf("invalid keepalive %d", *cmd.Keepalive)
+		}
+		config.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", *cmd.Keepalive))
+	}
+	if err := ui.device.IpcSet(config.String()); err != nil {
+		return err
+	}
+	ui.config.SyncFromDevice(ui.device)
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to save config after MQTT config command: %v", err)
+	}
+	ui.events.Publish(Event{Type: EventPeerUpdated, Peer: publicKey, Detail: "mqtt"})
+	return nil
+}
+
+// mqttTargetPeer 解析指令的目标 Peer；未指定时要求只配置了一个 Peer (客户端的上游)
+func (ui *WebUI) mqttTargetPeer(key string) (string, error) {
+	if key != "" {
+		publicKey, err := parsePeerKey(key)
+		if err != nil {
+			return "", err
+		}
+		if !ui.config.HasPeer(publicKey) {
+			return "", fmt.Errorf("peer %s not found", publicKey)
+		}
+		return publicKey, nil
+	}
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if len(ui.config.Peers) != 1 {
+		return "", fmt.Errorf("peer is required when %d peers are configured", len(ui.config.Peers))
+	}
+	return ui.config.Peers[0].PublicKey, nil
+}
+
+// mqttRotateProof 计算 rotate 证明，见 MQTTRotation
+func mqttRotateProof(privateKey, peerPublicKey, from, to string) (string, error) {
+	return mqttMAC(privateKey, peerPublicKey, mqttRotateLabel+from+to)
+}
+
+// mqttMAC 以本机私钥与对端公钥的 DH 共享密钥计算 HMAC-SHA256，返回 Hex
+func mqttMAC(privateKey, peerPublicKey, message string) (string, error) {
+	priv, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+	pub, err := base64.StdEncoding.DecodeString(peerPublicKey)
+	if err != nil {
+		return "", err
+	}
+	shared, err := curve25519.X25519(priv, pub)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, shared)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// rotateIdentity 生成新的密钥对并立即生效，同时为每个 Peer 计算 rotate 证明
+// 新公钥随下一条状态上报，服务端验证证明后替换 Peer 公钥，隧道随后重新握手
+func (ui *WebUI) rotateIdentity() error {
+	configLock.RLock()
+	oldPrivate := ui.config.Identity.PrivateKey
+	peers := make([]string, 0, len(ui.config.Peers))
+	for _, p := range ui.config.Peers {
+		peers = append(peers, p.PublicKey)
+	}
+	configLock.RUnlock()
+	if oldPrivate == "" {
+		return errors.New("no identity to rotate")
+	}
+	from, err := device.GetPublicKeyFromPrivateKey(oldPrivate)
+	if err != nil {
+		return err
+	}
+	newPrivate := device.GeneratePrivateKey()
+	to, err := device.GetPublicKeyFromPrivateKey(newPrivate)
+	if err != nil {
+		return err
+	}
+	rotation := &MQTTRotation{From: from, Proofs: make(map[string]string, len(peers))}
+	for _, peer := range peers {
+		proof, err := mqttRotateProof(oldPrivate, peer, from, to)
+		if err != nil {
+			return fmt.Errorf("proof for peer %s: %w", peer, err)
+		}
+		rotation.Proofs[peer] = proof
+	}
+
+	if err := ui.device.IpcSet("private_key=" + b64ToHex(newPrivate) + "\n"); err != nil {
+		return err
+	}
+	configLock.Lock()
+	ui.config.Identity.PrivateKey = newPrivate
+	configLock.Unlock()
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to save rotated identity: %v", err)
+	}
+	ui.mqtt.mu.Lock()
+	ui.mqtt.rotation = rotation
+	ui.mqtt.mu.Unlock()
+	ui.device.GetLogger().Verbosef("Identity rotated, new public key %s", to)
+	return nil
+}
+
+// ========== 服务端 ==========
+
+// handleMQTTDeviceStatus 记录设备状态，设备完成 rotate 时替换对应 Peer 的公钥
+func (ui *WebUI) handleMQTTDeviceStatus(msg mqtt.Message) {
+	b := ui.mqtt
+	id, ok := strings.CutPrefix(msg.Topic, b.prefix+"/")
+	if ok {
+		id, ok = strings.CutSuffix(id, "/status")
+	}
+	if !ok || !validTopicLevel(id) || id == b.deviceID {
+		return
+	}
+	if len(msg.Payload) == 0 {
+		// 清除保留消息表示设备已退役
+		b.mu.Lock()
+		delete(b.devices, id)
+		b.mu.Unlock()
+		return
+	}
+	var st MQTTStatus
+	if err := json.Unmarshal(msg.Payload, &st); err != nil {
+		ui.device.GetLogger().Verbosef("Ignoring malformed MQTT status from %s: %v", id, err)
+		return
+	}
+	st.DeviceID = id
+	b.mu.Lock()
+	b.devices[id] = MQTTDevice{DeviceID: id, Status: st, UpdatedAt: time.Now()}
+	b.mu.Unlock()
+
+	if st.Rotation != nil && st.PublicKey != "" {
+		b.cmdMu.Lock()
+		err := ui.applyMQTTRotation(st.Rotation, st.PublicKey)
+		b.cmdMu.Unlock()
+		if err != nil {
+			ui.device.GetLogger().Errorf("MQTT key rotation from %s rejected: %v", id, err)
+			ui.audit.Record(AuditEntry{Event: AuditMQTTRotate, Actor: "mqtt:" + id, Detail: "rejected: " + err.Error()})
+		}
+	}
+}
+
+// applyMQTTRotation 验证证明后用新公钥替换 Peer，保留 AllowedIPs、端点、备注与标签
+// 保留消息会在每次重连时重放，新公钥已存在时视为已完成
+func (ui *WebUI) applyMQTTRotation(rot *MQTTRotation, to string) error {
+	from, err := parsePeerKey(rot.From)
+	if err != nil {
+		return err
+	}
+	if to, err = parsePeerKey(to); err != nil {
+		return err
+	}
+	if from == to || ui.config.HasPeer(to) {
+		return nil
+	}
+
+	configLock.RLock()
+	var record PeerRecord
+	found := false
+	for _, p := range ui.config.Peers {
+		if p.PublicKey == from {
+			record, found = p, true
+			break
+		}
+	}
+	private := ui.config.Identity.PrivateKey
+	configLock.RUnlock()
+	if !found {
+		return nil // 不是本网关的 Peer
+	}
+
+	own, err := device.GetPublicKeyFromPrivateKey(private)
+	if err != nil {
+		return err
+	}
+	want, err := mqttRotateProof(private, from, from, to)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(rot.Proofs[own]), []byte(want)) {
+		return fmt.Errorf("invalid proof for %s", from)
+	}
+
+	var config strings.Builder
+	config.WriteString("public_key=" + b64ToHex(from) + "\nremove=true\n")
+	config.WriteString("public_key=" + b64ToHex(to) + "\n")
+	if record.Endpoint != "" {
+		config.WriteString("endpoint=" + record.Endpoint + "\n")
+	}
+	if record.PersistentKeepalive > 0 {
+		config.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", record.PersistentKeepalive))
+	}
+	for _, ip := range record.AllowedIPs {
+		config.WriteString("allowed_ip=" + ip + "\n")
+	}
+	if err := ui.device.IpcSet(config.String()); err != nil {
+		return err
+	}
+	ui.device.ForEachPeer(func(p *device.Peer) {
+		if p.GetPublicKey() == to {
+			p.Remark = record.Remark
+		}
+	})
+	ui.config.SyncFromDevice(ui.device)
+	if len(record.Tags) > 0 {
+		ui.config.SetPeerTags(to, record.Tags)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to save config after key rotation: %v", err)
+	}
+	ui.history.forget(from)
+	ui.audit.Record(AuditEntry{Event: AuditMQTTRotate, Actor: "mqtt", Detail: from + " -> " + to + " (" + record.Remark + ")"})
+	ui.events.Publish(Event{Type: EventPeerRemoved, Peer: from, Detail: "rotated"})
+	ui.events.Publish(Event{Type: EventPeerAdded, Peer: to, Detail: record.Remark})
+	return nil
+}
+
+// listDevices 返回跟踪到的设备，按 ID 排序
+func (b *mqttBridge) listDevices() []MQTTDevice {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	devices := make([]MQTTDevice, 0, len(b.devices))
+	for _, d := range b.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+	return devices
+}
+
+// sendMQTTCommand 向设备发布指令，未指定 ID 时自动生成
+// 指令用本机私钥与设备上报的公钥签名，设备尚未上报公钥时无法下发
+func (ui *WebUI) sendMQTTCommand(deviceID string, cmd MQTTCommand) (MQTTCommand, error) {
+	b := ui.mqtt
+	switch cmd.Action {
+	case MQTTActionUp, MQTTActionDown, MQTTActionRotate, MQTTActionConfig:
+	default:
+		return cmd, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Unknown action %q", cmd.Action)
+	}
+	if cmd.Endpoint != "" {
+		if _, err := parseEndpoint(cmd.Endpoint); err != nil {
+			return cmd, err
+		}
+	}
+	if cmd.ID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		cmd.ID = hex.EncodeToString(id)
+	}
+	b.mu.Lock()
+	devicePublic := b.devices[deviceID].Status.PublicKey
+	b.mu.Unlock()
+	if devicePublic == "" {
+		return cmd, apiErrorf(http.StatusConflict, ErrCodeConflict, "Device %s has not reported its public key", deviceID)
+	}
+	configLock.RLock()
+	private := ui.config.Identity.PrivateKey
+	configLock.RUnlock()
+	cmd.Time = time.Now().Unix()
+	sig, err := mqttMAC(private, devicePublic, cmd.mqttCommandMessage())
+	if err != nil {
+		return cmd, apiErrorf(http.StatusConflict, ErrCodeConflict, "Cannot sign command for %s: %v", deviceID, err)
+	}
+	cmd.Sig = sig
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return cmd, err
+	}
+	err = b.client.Publish(mqtt.Message{Topic: b.topic(deviceID, "cmd"), Payload: payload, QoS: 1})
+	if err == mqtt.ErrNotConnected {
+		return cmd, apiErrorf(http.StatusServiceUnavailable, ErrCodeUpstream, "Not connected to MQTT broker")
+	}
+	if err != nil {
+		return cmd, apiErrorf(http.StatusBadGateway, ErrCodeUpstream, "Publish failed: %v", err)
+	}
+	return cmd, nil
+}
+
+// mqttInfo 返回信令桥运行状态
+func (ui *WebUI) mqttInfo() MQTTBridgeInfo {
+	b := ui.mqtt
+	if b == nil {
+		return MQTTBridgeInfo{}
+	}
+	return MQTTBridgeInfo{
+		Enabled:   true,
+		Connected: b.client.Connected(),
+		Broker:    b.broker,
+		Mode:      b.mode,
+		DeviceID:  b.deviceID,
+		Topic:     b.topic(b.deviceID, "cmd"),
+	}
+}
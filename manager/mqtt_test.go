@@ -0,0 +1,216 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+func TestValidTopicLevel(t *testing.T) {
+	for level, want := range map[string]bool{
+		"gw-01":    true,
+		"sensor.7": true,
+		"":         false,
+		"a/b":      false,
+		"+":        false,
+		"dev#":     false,
+		"x\x00":    false,
+	} {
+		if got := validTopicLevel(level); got != want {
+			t.Errorf("validTopicLevel(%q) = %v, want %v", level, got, want)
+		}
+	}
+
+	tests := []struct {
+		mode     string
+		isClient bool
+		want     string
+	}{
+		{"", true, MQTTModeClient},
+		{"", false, MQTTModeServer},
+		{MQTTModeServer, true, MQTTModeServer},
+	}
+	for _, tt := range tests {
+		m := MQTTConfig{Mode: tt.mode}
+		if got := m.mode(tt.isClient); got != tt.want {
+			t.Errorf("mode(%q, %v) = %s, want %s", tt.mode, tt.isClient, got, tt.want)
+		}
+	}
+}
+
+// peerRecord 读取配置中的 Peer 记录
+func (tu *testUI) peerRecord(publicKey string) (PeerRecord, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	for _, p := range tu.config.Peers {
+		if p.PublicKey == publicKey {
+			return p, true
+		}
+	}
+	return PeerRecord{}, false
+}
+
+func TestMQTTCommand(t *testing.T) {
+	keyA, keyB := testKey(1), testKey(2)
+	tu := newTestUI(t, func(c *Config) {
+		c.Peers = []PeerRecord{{PublicKey: keyA, AllowedIPs: []string{"10.0.0.2/32"}}}
+	})
+	tu.mqtt = &mqttBridge{}
+	keepalive := func(n int) *int { return &n }
+
+	tests := []struct {
+		name      string
+		cmd       MQTTCommand
+		ok        bool
+		keepalive int // 执行后 Peer 的保活间隔
+	}{
+		{"keepalive for the only peer", MQTTCommand{Action: MQTTActionConfig, Keepalive: keepalive(25)}, true, 25},
+		{"explicit peer", MQTTCommand{Action: MQTTActionConfig, Peer: keyA, Keepalive: keepalive(0)}, true, 0},
+		{"nothing to change", MQTTCommand{Action: MQTTActionConfig, Peer: keyA}, false, 0},
+		{"keepalive out of range", MQTTCommand{Action: MQTTActionConfig, Keepalive: keepalive(65536)}, false, 0},
+		{"unknown peer", MQTTCommand{Action: MQTTActionConfig, Peer: keyB, Keepalive: keepalive(5)}, false, 0},
+		{"endpoint injection", MQTTCommand{Action: MQTTActionConfig, Endpoint: "192.0.2.1:51820\nallowed_ip=0.0.0.0/0", Keepalive: keepalive(5)}, false, 0},
+		{"up with bad endpoint", MQTTCommand{Action: MQTTActionUp, Endpoint: "vpn.example.com:51820"}, false, 0},
+		{"unknown action", MQTTCommand{Action: "reboot"}, false, 0},
+	}
+	for _, tt := range tests {
+		err := tu.runMQTTCommand(tt.cmd)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if p, _ := tu.peerRecord(keyA); p.PersistentKeepalive != tt.keepalive || !reflect.DeepEqual(p.AllowedIPs, []string{"10.0.0.2/32"}) {
+			t.Errorf("%s: peer %+v", tt.name, p)
+		}
+	}
+
+	// 有多个 Peer 时必须指定目标
+	if err := tu.device.IpcSet("public_key=" + b64ToHex(keyB) + "\nallowed_ip=10.0.0.3/32\n"); err != nil {
+		t.Fatal(err)
+	}
+	tu.config.SyncFromDevice(tu.device)
+	if err := tu.runMQTTCommand(MQTTCommand{Action: MQTTActionConfig, Keepalive: keepalive(5)}); err == nil {
+		t.Error("config without peer accepted with two peers")
+	}
+
+	// 网关在发布前同样校验指令
+	for _, cmd := range []MQTTCommand{
+		{Action: "reboot"},
+		{Action: MQTTActionConfig, Endpoint: "192.0.2.1:51820\nremove=true"},
+	} {
+		if _, err := tu.sendMQTTCommand("gw-01", cmd); err == nil {
+			t.Errorf("sendMQTTCommand(%+v) accepted", cmd)
+		}
+	}
+}
+
+func TestMQTTRotation(t *testing.T) {
+	gwPrivate := device.GeneratePrivateKey()
+	gwPublic, _ := device.GetPublicKeyFromPrivateKey(gwPrivate)
+
+	// 设备端更换密钥对并为每个 Peer 生成证明
+	client := newTestUI(t, func(c *Config) {
+		c.Peers = []PeerRecord{{PublicKey: gwPublic, AllowedIPs: []string{"10.0.0.1/32"}}}
+	})
+	client.mqtt = &mqttBridge{}
+	oldPublic, _ := device.GetPublicKeyFromPrivateKey(client.config.Identity.PrivateKey)
+	if err := client.runMQTTCommand(MQTTCommand{Action: MQTTActionRotate}); err != nil {
+		t.Fatal(err)
+	}
+	newPublic, _ := device.GetPublicKeyFromPrivateKey(client.config.Identity.PrivateKey)
+	rotation := client.mqtt.rotation
+	if newPublic == oldPublic || rotation == nil || rotation.From != oldPublic || len(rotation.Proofs) != 1 {
+		t.Fatalf("rotation %+v, public key %s -> %s", rotation, oldPublic, newPublic)
+	}
+	if got := client.device.GetPublicKey(); got != newPublic {
+		t.Errorf("device public key %s, want %s", got, newPublic)
+	}
+
+	// 网关验证证明后替换 Peer 公钥，保留地址、备注与标签
+	gateway := newTestUI(t, func(c *Config) {
+		c.Identity.PrivateKey = gwPrivate
+		c.Peers = []PeerRecord{{PublicKey: oldPublic, Remark: "cam", AllowedIPs: []string{"10.0.0.2/32"}, Tags: []string{"iot"}}}
+	})
+	proof := []byte(rotation.Proofs[gwPublic])
+	proof[len(proof)-1] ^= 1 // 篡改最后一位
+	forged := &MQTTRotation{From: oldPublic, Proofs: map[string]string{gwPublic: string(proof)}}
+	tests := []struct {
+		name     string
+		rotation *MQTTRotation
+		to       string
+		ok       bool
+		peer     string // 执行后配置中的 Peer 公钥
+	}{
+		{"forged proof", forged, newPublic, false, oldPublic},
+		{"other peer's proof", &MQTTRotation{From: oldPublic, Proofs: map[string]string{testKey(9): rotation.Proofs[gwPublic]}}, newPublic, false, oldPublic},
+		{"unknown old key", &MQTTRotation{From: testKey(3), Proofs: rotation.Proofs}, newPublic, true, oldPublic},
+		{"valid", rotation, newPublic, true, newPublic},
+		{"replayed status", rotation, newPublic, true, newPublic},
+	}
+	for _, tt := range tests {
+		err := gateway.applyMQTTRotation(tt.rotation, tt.to)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if len(gateway.config.Peers) != 1 || gateway.config.Peers[0].PublicKey != tt.peer {
+			t.Errorf("%s: peers %+v", tt.name, gateway.config.Peers)
+		}
+	}
+	p, _ := gateway.peerRecord(newPublic)
+	if p.Remark != "cam" || !reflect.DeepEqual(p.AllowedIPs, []string{"10.0.0.2/32"}) || !reflect.DeepEqual(p.Tags, []string{"iot"}) {
+		t.Errorf("rotated peer %+v", p)
+	}
+}
+
+func TestMQTTCommandAuth(t *testing.T) {
+	gwPrivate := device.GeneratePrivateKey()
+	gwPublic, _ := device.GetPublicKeyFromPrivateKey(gwPrivate)
+	client := newTestUI(t, func(c *Config) {
+		c.Peers = []PeerRecord{{PublicKey: gwPublic, AllowedIPs: []string{"10.0.0.1/32"}}}
+	})
+	client.mqtt = &mqttBridge{}
+	clientPublic, _ := device.GetPublicKeyFromPrivateKey(client.config.Identity.PrivateKey)
+
+	now := time.Now()
+	sign := func(cmd MQTTCommand, private string) MQTTCommand {
+		cmd.Time = now.Unix()
+		cmd.Sig, _ = mqttMAC(private, clientPublic, cmd.mqttCommandMessage())
+		return cmd
+	}
+	valid := sign(MQTTCommand{ID: "1", Action: MQTTActionDown}, gwPrivate)
+	tampered := valid
+	tampered.Action = MQTTActionRotate
+	stale := MQTTCommand{ID: "3", Action: MQTTActionDown, Time: now.Add(-time.Hour).Unix()}
+	stale.Sig, _ = mqttMAC(gwPrivate, clientPublic, stale.mqttCommandMessage())
+
+	tests := []struct {
+		name string
+		cmd  MQTTCommand
+		ok   bool
+	}{
+		{"unsigned", MQTTCommand{ID: "0", Action: MQTTActionDown, Time: now.Unix()}, false},
+		{"valid", valid, true},
+		{"replayed", valid, false},
+		{"tampered", tampered, false},
+		{"signed by non-peer", sign(MQTTCommand{ID: "2", Action: MQTTActionDown}, device.GeneratePrivateKey()), false},
+		{"stale", stale, false},
+	}
+	for _, tt := range tests {
+		if err := client.verifyMQTTCommand(tt.cmd, now); (err == nil) != tt.ok {
+			t.Errorf("%s: %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	// 网关只向已上报公钥的设备下发指令
+	gateway := newTestUI(t, func(c *Config) { c.Identity.PrivateKey = gwPrivate })
+	gateway.mqtt = &mqttBridge{devices: map[string]MQTTDevice{}}
+	if _, err := gateway.sendMQTTCommand("kiosk-0421", MQTTCommand{Action: MQTTActionDown}); err == nil {
+		t.Error("command sent to a device without public key")
+	}
+}
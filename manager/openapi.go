@@ -0,0 +1,245 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// openapi.go - 由路由表与 Go 类型生成 OpenAPI 3.0 文档
+// 请求体与响应体的 schema 通过反射 json 标签得到，接口变更时文档自动保持一致
+
+package manager
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const openAPIVersion = "3.0.3"
+
+var pathParamPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// schemaGen 生成 schema，具名结构体放入 components/schemas 并以 $ref 引用
+type schemaGen struct {
+	schemas map[string]any
+}
+
+func (g *schemaGen) ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// schema 返回类型 t 的 schema
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = nil // 占位，防止递归类型无限展开
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return g.ref(t.Name())
+	}
+	return map[string]any{}
+}
+
+// object 按 json 标签展开结构体字段，匿名嵌入的结构体字段提升到外层
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// operationID 由方法与路径生成，如 GET /peers/{key} -> getPeersByKey
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "" {
+			continue
+		}
+		if m := pathParamPattern.FindStringSubmatch(seg); m != nil {
+			b.WriteString("By")
+			seg = m[1]
+		}
+		seg = strings.TrimSuffix(seg, ".json")
+		r := []rune(seg)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+// buildOpenAPI 生成 /api/v1 的 OpenAPI 文档
+func buildOpenAPI(routes []apiRoute) map[string]any {
+	g := &schemaGen{schemas: make(map[string]any)}
+	errorResponse := map[string]any{"$ref": "#/components/responses/Error"}
+
+	paths := make(map[string]any)
+	for _, route := range routes {
+		op := map[string]any{
+			"operationId": operationID(route.Method, route.Path),
+			"summary":     route.Summary,
+		}
+
+		var params []any
+		for _, m := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]any{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if route.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		if route.Response != nil {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(route.Response))},
+			}
+		}
+		op["responses"] = map[string]any{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		switch {
+		case route.Public:
+			op["security"] = []any{}
+		case route.Perm == permAuthenticated:
+			// 仅限浏览器会话，API 令牌不可访问
+			op["security"] = []any{map[string]any{"session": []any{}}}
+		default:
+			op["x-permission"] = string(route.Perm)
+		}
+		if route.Legacy != "" {
+			op["x-legacy-route"] = route.Legacy
+		}
+
+		item, _ := paths[route.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	g.schema(reflect.TypeOf(ErrorEnvelope{}))
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "WireGuard Controller API",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": strings.TrimSuffix(apiV1Prefix, "/")}},
+		"paths":   paths,
+		"security": []any{
+			map[string]any{"session": []any{}},
+			map[string]any{"bearer": []any{}},
+		},
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"responses": map[string]any{
+				"Error": map[string]any{
+					"description": "Error envelope with a machine-readable code",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": g.ref("ErrorEnvelope")},
+					},
+				},
+			},
+			"securitySchemes": map[string]any{
+				"session": map[string]any{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        sessionCookieName,
+					"description": "Browser session; write requests also need the " + csrfHeaderName + " header",
+				},
+				"bearer": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "API token (wgt_...)",
+				},
+			},
+		},
+	}
+}
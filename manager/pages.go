@@ -0,0 +1,349 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// pages.go - WebUI 页面：内嵌的 html/template 模板、多语言文案与品牌定制
+
+package manager
+
+import (
+	"bytes"
+	"cmp"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates/*.html locales/*.json
+var pageFS embed.FS
+
+const (
+	defaultLocale     = "zh-CN"                // 内置文案最完整的语言，其他语言缺失的条目回退到这里
+	defaultBrandTitle = "WireGuard Controller" // 页面标题与页眉中的产品名
+	defaultAccent     = "#38bdf8"
+
+	langCookieName = "wg_ui_lang" // 记住未登录访客 (登录页、入网页) 选择的语言
+	langQueryParam = "lang"       // ?lang=en 切换语言，登录用户同时保存为账号偏好
+)
+
+// pageNames 所有页面模板，每个页面与 layout.html 中的公共片段一起解析
+var pageNames = []string{"index", "docs", "join", "portal", "error", "login", "password"}
+
+// UIConfig WebUI 品牌与页面定制，修改后需重启
+type UIConfig struct {
+	Dir           string `json:"dir,omitempty"`            // 定制目录：templates/ 覆盖同名模板，locales/ 覆盖或新增文案，static/ 以 /ui/static/ 公开
+	Title         string `json:"title,omitempty"`          // 产品名，默认 WireGuard Controller
+	LogoURL       string `json:"logo_url,omitempty"`       // 页眉 Logo 地址，如 /ui/static/logo.svg
+	AccentColor   string `json:"accent_color,omitempty"`   // 主题色 (CSS 颜色值，如 #10b981)
+	DefaultLocale string `json:"default_locale,omitempty"` // 无法从请求判断语言时使用，默认 zh-CN
+}
+
+// branding 模板中使用的品牌信息
+type branding struct {
+	Title     string
+	LogoURL   string
+	Accent    string
+	CustomCSS bool // 定制目录中存在 static/custom.css
+}
+
+// localeOption 语言切换菜单中的一项
+type localeOption struct {
+	Code string
+	Name string
+}
+
+// pageSet 启动时加载的页面模板与文案，之后只读
+type pageSet struct {
+	templates map[string]*template.Template
+	catalogs  map[string]map[string]string // 语言 -> 文案键 -> 文本
+	locales   []localeOption
+	static    string // 定制静态资源目录，空为未配置
+	customCSS bool
+}
+
+// loadPages 加载内嵌模板与文案，dir 非空时其中的同名文件优先
+func loadPages(dir string) (*pageSet, error) {
+	read := func(name string) ([]byte, error) {
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err == nil {
+				return data, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+		return pageFS.ReadFile(name)
+	}
+
+	ps := &pageSet{
+		templates: make(map[string]*template.Template, len(pageNames)),
+		catalogs:  make(map[string]map[string]string),
+	}
+	layout, err := read("templates/layout.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pageNames {
+		page, err := read("templates/" + name + ".html")
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.New(name).Parse(string(layout))
+		if err == nil {
+			_, err = t.Parse(string(page))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		ps.templates[name] = t
+	}
+
+	// 内嵌文案在前，定制目录中的同名语言按条目覆盖
+	mergeLocales := func(fsys fs.FS) error {
+		entries, err := fs.ReadDir(fsys, "locales")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			code, ok := strings.CutSuffix(e.Name(), ".json")
+			if !ok || e.IsDir() {
+				continue
+			}
+			data, err := fs.ReadFile(fsys, path.Join("locales", e.Name()))
+			if err != nil {
+				return err
+			}
+			var messages map[string]string
+			if err := json.Unmarshal(data, &messages); err != nil {
+				return fmt.Errorf("locale %s: %w", e.Name(), err)
+			}
+			if ps.catalogs[code] == nil {
+				ps.catalogs[code] = make(map[string]string, len(messages))
+			}
+			for k, v := range messages {
+				ps.catalogs[code][k] = v
+			}
+		}
+		return nil
+	}
+	if err := mergeLocales(pageFS); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := mergeLocales(os.DirFS(dir)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	for code, messages := range ps.catalogs {
+		name := messages["locale.name"]
+		if name == "" {
+			name = code
+		}
+		ps.locales = append(ps.locales, localeOption{Code: code, Name: name})
+	}
+	slices.SortFunc(ps.locales, func(a, b localeOption) int { return strings.Compare(a.Code, b.Code) })
+
+	if dir != "" {
+		ps.static = filepath.Join(dir, "static")
+		if _, err := os.Stat(filepath.Join(ps.static, "custom.css")); err == nil {
+			ps.customCSS = true
+		}
+	}
+	return ps, nil
+}
+
+// hasLocale 判断是否有该语言的文案，返回规范的语言代码
+func (ps *pageSet) hasLocale(code string) (string, bool) {
+	for _, l := range ps.locales {
+		if strings.EqualFold(l.Code, code) {
+			return l.Code, true
+		}
+	}
+	return "", false
+}
+
+// matchLocale 按 Accept-Language 的权重选择可用语言
+// 先精确匹配 (en-US)，再按主语言匹配 (en-US 匹配 en，zh-TW 匹配 zh-CN)
+func (ps *pageSet) matchLocale(header string) (string, bool) {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var tags []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "*" && q > 0 {
+			tags = append(tags, candidate{tag, q})
+		}
+	}
+	slices.SortStableFunc(tags, func(a, b candidate) int { return cmp.Compare(b.q, a.q) })
+	for _, c := range tags {
+		if code, ok := ps.hasLocale(c.tag); ok {
+			return code, true
+		}
+		primary, _, _ := strings.Cut(c.tag, "-")
+		for _, l := range ps.locales {
+			if p, _, _ := strings.Cut(l.Code, "-"); strings.EqualFold(p, primary) {
+				return l.Code, true
+			}
+		}
+	}
+	return "", false
+}
+
+// pageData 模板的数据：公共的语言、品牌信息，以及页面自己的 Data
+type pageData struct {
+	Lang    string
+	Brand   branding
+	Locales []localeOption
+	Data    any
+
+	messages, fallback map[string]string
+}
+
+// T 取当前语言的文案，{0}、{1} 依次替换为参数；缺失时回退到默认语言，再回退到键本身
+func (p pageData) T(key string, args ...any) string {
+	s, ok := p.messages[key]
+	if !ok {
+		if s, ok = p.fallback[key]; !ok {
+			s = key
+		}
+	}
+	for i, arg := range args {
+		s = strings.ReplaceAll(s, "{"+strconv.Itoa(i)+"}", fmt.Sprint(arg))
+	}
+	return s
+}
+
+// JSMessages 页面脚本使用的文案 (js. 前缀)，模板中以 JSON 输出
+func (p pageData) JSMessages() map[string]string {
+	out := make(map[string]string)
+	for _, m := range []map[string]string{p.fallback, p.messages} {
+		for k, v := range m {
+			if strings.HasPrefix(k, "js.") {
+				out[k] = v
+			}
+		}
+	}
+	return out
+}
+
+// pageLocale 选择页面语言：?lang= > 账号偏好 > Cookie > Accept-Language > 配置的默认语言
+func (ui *WebUI) pageLocale(w http.ResponseWriter, r *http.Request) string {
+	username := currentUser(r)
+	if code, ok := ui.pages.hasLocale(r.URL.Query().Get(langQueryParam)); ok {
+		http.SetCookie(w, &http.Cookie{
+			Name:     langCookieName,
+			Value:    code,
+			Path:     "/",
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   365 * 24 * 3600,
+		})
+		if username != "" {
+			if changed, err := ui.config.SetUserLocale(username, code); err == nil && changed {
+				if err := SaveConfig(ui.config); err != nil {
+					ui.device.GetLogger().Errorf("Failed to save locale preference: %v", err)
+				}
+			}
+		}
+		return code
+	}
+	if username != "" {
+		if user, ok := ui.config.FindUser(username); ok {
+			if code, ok := ui.pages.hasLocale(user.Locale); ok {
+				return code
+			}
+		}
+	}
+	if cookie, err := r.Cookie(langCookieName); err == nil {
+		if code, ok := ui.pages.hasLocale(cookie.Value); ok {
+			return code
+		}
+	}
+	if code, ok := ui.pages.matchLocale(r.Header.Get("Accept-Language")); ok {
+		return code
+	}
+	configLock.RLock()
+	def := ui.config.System.UI.DefaultLocale
+	configLock.RUnlock()
+	if code, ok := ui.pages.hasLocale(def); ok {
+		return code
+	}
+	return defaultLocale
+}
+
+// newPageData 准备模板公共数据
+func (ui *WebUI) newPageData(w http.ResponseWriter, r *http.Request, data any) pageData {
+	lang := ui.pageLocale(w, r)
+
+	configLock.RLock()
+	conf := ui.config.System.UI
+	configLock.RUnlock()
+	brand := branding{Title: conf.Title, LogoURL: conf.LogoURL, Accent: conf.AccentColor, CustomCSS: ui.pages.customCSS}
+	if brand.Title == "" {
+		brand.Title = defaultBrandTitle
+	}
+	if brand.Accent == "" {
+		brand.Accent = defaultAccent
+	}
+
+	return pageData{
+		Lang:     lang,
+		Brand:    brand,
+		Locales:  ui.pages.locales,
+		Data:     data,
+		messages: ui.pages.catalogs[lang],
+		fallback: ui.pages.catalogs[defaultLocale],
+	}
+}
+
+// renderPage 渲染页面模板，先写入缓冲区，模板出错时返回 500 而不是半个页面
+func (ui *WebUI) renderPage(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	pd := ui.newPageData(w, r, data)
+	var buf bytes.Buffer
+	if err := ui.pages.templates[name].Execute(&buf, pd); err != nil {
+		ui.device.GetLogger().Errorf("Failed to render page %s: %v", name, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", pd.Lang)
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// renderErrorPage 渲染美化的错误页，title 与 msg 为文案键
+func (ui *WebUI) renderErrorPage(w http.ResponseWriter, r *http.Request, status int, title, msg string) {
+	ui.renderPage(w, r, status, "error", struct{ Title, Message string }{title, msg})
+}
+
+// handleStatic 提供定制目录 static/ 下的文件 (Logo、custom.css 等)，不列目录
+// GET /ui/static/{file}
+func (ui *WebUI) handleStatic(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/ui/static/")
+	if ui.pages.static == "" || name == "" || strings.HasSuffix(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, os.DirFS(ui.pages.static), name)
+}
@@ -0,0 +1,173 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLocaleCatalogs(t *testing.T) {
+	ps, err := loadPages("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模板中引用的文案键必须在默认语言中存在，其他语言缺失时才能回退
+	keyRef := regexp.MustCompile(`\bT "([^"]+)"`)
+	for _, name := range append(pageNames, "layout") {
+		data, err := pageFS.ReadFile("templates/" + name + ".html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range keyRef.FindAllStringSubmatch(string(data), -1) {
+			if _, ok := ps.catalogs[defaultLocale][m[1]]; !ok {
+				t.Errorf("%s.html: key %q missing from %s", name, m[1], defaultLocale)
+			}
+		}
+	}
+	for code, messages := range ps.catalogs {
+		for key := range ps.catalogs[defaultLocale] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("%s: key %q not translated", code, key)
+			}
+		}
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	ps, err := loadPages("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"en", "en", true},
+		{"EN-us,en;q=0.9", "en", true},
+		{"zh-TW", "zh-CN", true},
+		{"fr;q=1, zh-CN;q=0.5, en;q=0.8", "en", true},
+		{"en;q=0, zh", "zh-CN", true},
+		{"de, *", "", false},
+		{"en;q=abc", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ps.matchLocale(tt.header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("matchLocale(%q) = %q, %v; want %q, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPageDataT(t *testing.T) {
+	p := pageData{
+		messages: map[string]string{"greet": "Hello {0}, you have {1} peers", "js.ok": "OK"},
+		fallback: map[string]string{"greet": "你好 {0}", "only.default": "默认", "js.cancel": "取消", "js.ok": "确定"},
+	}
+	tests := []struct {
+		key  string
+		args []any
+		want string
+	}{
+		{"greet", []any{"alice", 3}, "Hello alice, you have 3 peers"},
+		{"only.default", nil, "默认"},
+		{"missing.key", nil, "missing.key"},
+	}
+	for _, tt := range tests {
+		if got := p.T(tt.key, tt.args...); got != tt.want {
+			t.Errorf("T(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if js := p.JSMessages(); len(js) != 2 || js["js.ok"] != "OK" || js["js.cancel"] != "取消" {
+		t.Errorf("JSMessages = %v", js)
+	}
+}
+
+func TestLoadPagesOverride(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("templates/error.html", `{{define "content"}}custom error{{end}}`)
+	write("locales/fr.json", `{"locale.name":"Français","login.title":"Connexion"}`)
+	write("locales/en.json", `{"login.title":"Sign in to VPN"}`)
+	write("static/custom.css", "body{}")
+
+	ps, err := loadPages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, ok := ps.hasLocale("FR"); !ok || code != "fr" {
+		t.Errorf("hasLocale(FR) = %q, %v", code, ok)
+	}
+	if ps.catalogs["en"]["login.title"] != "Sign in to VPN" || ps.catalogs["en"]["locale.name"] == "" {
+		t.Errorf("en catalog not merged: %q", ps.catalogs["en"]["login.title"])
+	}
+	if !ps.customCSS || ps.static != filepath.Join(dir, "static") {
+		t.Errorf("static %q, custom CSS %v", ps.static, ps.customCSS)
+	}
+
+	write("templates/login.html", `{{define "content"}}{{.Broken}`)
+	if _, err := loadPages(dir); err == nil || !strings.Contains(err.Error(), "login") {
+		t.Errorf("broken template: %v", err)
+	}
+}
+
+func TestRenderedPages(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "static"), 0700)
+	os.WriteFile(filepath.Join(dir, "static", "custom.css"), []byte("body{color:red}"), 0600)
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("do-not-serve"), 0600)
+	tu := newTestUI(t, func(c *Config) {
+		c.System.UI = UIConfig{Dir: dir, Title: `<script>alert(1)</script>`, AccentColor: `red;}</style><script>x()</script>`}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		header []string
+		status int
+		lang   string
+	}{
+		{"default locale", "/login", nil, http.StatusOK, defaultLocale},
+		{"accept-language", "/login", []string{"Accept-Language", "en-GB,en;q=0.8"}, http.StatusOK, "en"},
+		{"query overrides header", "/login?lang=zh-CN", []string{"Accept-Language", "en"}, http.StatusOK, "zh-CN"},
+		{"cookie", "/login", []string{"Cookie", langCookieName + "=en"}, http.StatusOK, "en"},
+	}
+	for _, tt := range tests {
+		resp, body := tu.do(nil, http.MethodGet, tt.path, "", tt.header...)
+		if resp.StatusCode != tt.status || resp.Header.Get("Content-Language") != tt.lang {
+			t.Errorf("%s: %d %q", tt.name, resp.StatusCode, resp.Header.Get("Content-Language"))
+		}
+		// 品牌设置来自配置，同样按 HTML 转义输出
+		if strings.Contains(body, "<script>alert(1)") || strings.Contains(body, "<script>x()") {
+			t.Errorf("%s: unescaped branding in page", tt.name)
+		}
+	}
+
+	resp, _ := tu.do(nil, http.MethodGet, "/login?lang=en", "")
+	if c := resp.Cookies(); len(c) == 0 || c[0].Name != langCookieName || c[0].Value != "en" {
+		t.Errorf("language cookie %v", c)
+	}
+	if resp, body := tu.do(nil, http.MethodGet, "/ui/static/custom.css", ""); resp.StatusCode != http.StatusOK || body != "body{color:red}" {
+		t.Errorf("custom.css: %d %q", resp.StatusCode, body)
+	}
+	for _, path := range []string{"/ui/static/", "/ui/static/../secret.txt", "/ui/static/%2e%2e/secret.txt"} {
+		if resp, body := tu.do(nil, http.MethodGet, path, ""); resp.StatusCode == http.StatusOK || strings.Contains(body, "do-not-serve") {
+			t.Errorf("%s: %d %q", path, resp.StatusCode, body)
+		}
+	}
+}
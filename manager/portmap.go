@@ -0,0 +1,171 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"golang.zx2c4.com/wireguard/portmap"
+)
+
+const (
+	defaultPortMapLifetime = 120             // 申请的租期 (分钟)
+	portMapStopTimeout     = 6 * time.Second // 停止时等待删除映射的最长时间
+)
+
+// PortMapConfig 在家用路由器上为 WireGuard 监听端口申请 UDP 映射 (PCP / NAT-PMP / UPnP-IGD)，修改后需重启
+type PortMapConfig struct {
+	Enabled   bool     `json:"enabled,omitempty"`
+	Gateway   string   `json:"gateway,omitempty"`   // 网关地址，默认取默认路由的网关
+	Protocols []string `json:"protocols,omitempty"` // 尝试顺序，默认 ["pcp", "nat-pmp", "upnp"]
+	Lifetime  int      `json:"lifetime,omitempty"`  // 申请的租期 (分钟)，默认 120，到期前自动续期
+}
+
+func (c *PortMapConfig) lifetime() time.Duration {
+	if c.Lifetime <= 0 {
+		return defaultPortMapLifetime * time.Minute
+	}
+	return time.Duration(c.Lifetime) * time.Minute
+}
+
+// PortMapStatus 端口映射状态
+type PortMapStatus struct {
+	Enabled      bool       `json:"enabled"`
+	Protocol     string     `json:"protocol,omitempty"` // pcp / nat-pmp / upnp
+	Gateway      string     `json:"gateway,omitempty"`
+	InternalPort uint16     `json:"internal_port,omitempty"`
+	External     string     `json:"external,omitempty"`      // 外部地址与端口，网关未告知外部 IP 时为空
+	ExternalPort uint16     `json:"external_port,omitempty"` // 外部端口
+	Lifetime     int        `json:"lifetime,omitempty"`      // 网关给出的租期 (秒)，0 为永久
+	Expires      *time.Time `json:"expires,omitempty"`
+	Error        string     `json:"error,omitempty"` // 最近一次失败的原因，失败后按退避间隔重试
+}
+
+// portMapState 运行中的端口映射
+type portMapState struct {
+	mapper  *portmap.Mapper
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// startPortMap 启动端口映射；映射失败不影响启动，按退避间隔重试
+func (ui *WebUI) startPortMap() error {
+	configLock.RLock()
+	conf := ui.config.System.PortMap
+	configLock.RUnlock()
+	if !conf.Enabled {
+		return nil
+	}
+
+	cfg := portmap.Config{
+		Protocols: conf.Protocols,
+		Lifetime:  conf.lifetime(),
+		Logf:      ui.device.GetLogger().Verbosef,
+	}
+	if conf.Gateway != "" {
+		gw, err := netip.ParseAddr(conf.Gateway)
+		if err != nil {
+			return fmt.Errorf("invalid gateway %q: %w", conf.Gateway, err)
+		}
+		cfg.Gateway = gw.Unmap()
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &portMapState{
+		mapper:  portmap.NewMapper(cfg, ui.device.GetListenPort),
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	ui.portmap = s
+	go func() {
+		defer close(s.stopped)
+		s.mapper.Run(ctx, ui.portMapChanged)
+	}()
+	return nil
+}
+
+// stopPortMap 删除映射，网关无应答时最多等待 portMapStopTimeout
+func (ui *WebUI) stopPortMap() {
+	s := ui.portmap
+	if s == nil {
+		return
+	}
+	s.cancel()
+	select {
+	case <-s.stopped:
+	case <-time.After(portMapStopTimeout):
+		ui.device.GetLogger().Errorf("Port mapping removal timed out")
+	}
+}
+
+// portMapChanged 映射建立、外部地址变化或失败时记录日志并发布事件
+func (ui *WebUI) portMapChanged(m *portmap.Mapping, err error) {
+	if err != nil {
+		ui.device.GetLogger().Errorf("Port mapping failed: %v", err)
+		ui.events.Publish(Event{Type: EventPortMapping, Detail: "failed: " + err.Error()})
+		return
+	}
+	external := mappingExternal(m)
+	ui.device.GetLogger().Verbosef("Port mapping: UDP %d mapped via %s (%s), external %s", m.InternalPort, m.Gateway, m.Protocol, orNone(external))
+	ui.events.Publish(Event{Type: EventPortMapping, Detail: fmt.Sprintf("%s %s", m.Protocol, orNone(external))})
+}
+
+// mappingExternal 外部地址与端口，外部 IP 未知时为空
+func mappingExternal(m *portmap.Mapping) string {
+	if !m.External.Addr().IsValid() {
+		return ""
+	}
+	return m.External.String()
+}
+
+// mappedEndpoint 端口映射得到的外部地址
+func (ui *WebUI) mappedEndpoint() (netip.AddrPort, bool) {
+	if ui.portmap == nil {
+		return netip.AddrPort{}, false
+	}
+	m, _ := ui.portmap.mapper.Mapping()
+	if m == nil || !m.External.Addr().IsValid() {
+		return netip.AddrPort{}, false
+	}
+	return m.External, true
+}
+
+// portMapStatus 返回当前映射状态
+func (ui *WebUI) portMapStatus() PortMapStatus {
+	if ui.portmap == nil {
+		return PortMapStatus{}
+	}
+	st := PortMapStatus{Enabled: true}
+	m, err := ui.portmap.mapper.Mapping()
+	if err != nil {
+		st.Error = err.Error()
+	}
+	if m != nil {
+		st.Protocol = m.Protocol
+		st.Gateway = m.Gateway.String()
+		st.InternalPort = m.InternalPort
+		st.External = mappingExternal(m)
+		st.ExternalPort = m.External.Port()
+		st.Lifetime = int(m.Lifetime / time.Second)
+		if !m.Expires.IsZero() {
+			st.Expires = &m.Expires
+		}
+	}
+	return st
+}
+
+// ========== HTTP 接口 ==========
+
+func (ui *WebUI) v1PortMap(w http.ResponseWriter, r *http.Request) (any, error) {
+	return ui.portMapStatus(), nil
+}
@@ -0,0 +1,162 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/portmap"
+)
+
+func TestStartPortMapConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf PortMapConfig
+		ok   bool
+	}{
+		{"disabled", PortMapConfig{Gateway: "bogus", Protocols: []string{"smtp"}}, true},
+		{"invalid gateway", PortMapConfig{Enabled: true, Gateway: "router.lan"}, false},
+		{"unknown protocol", PortMapConfig{Enabled: true, Gateway: "192.168.1.1", Protocols: []string{"nat-pmp", "smtp"}}, false},
+	}
+	for _, tt := range tests {
+		tu := newTestUI(t, func(c *Config) { c.System.PortMap = tt.conf })
+		if err := tu.startPortMap(); (err == nil) != tt.ok || tu.portmap != nil {
+			t.Errorf("%s: %v, state %v", tt.name, err, tu.portmap)
+		}
+		if st := tu.portMapStatus(); st.Enabled {
+			t.Errorf("%s: status %+v", tt.name, st)
+		}
+		tu.stopPortMap()
+	}
+	if d := (&PortMapConfig{}).lifetime(); d != defaultPortMapLifetime*time.Minute {
+		t.Errorf("default lifetime %v", d)
+	}
+}
+
+// pmpGateway 只支持 NAT-PMP 的模拟网关，记录每个内部端口最近一次申请的租期
+type pmpGateway struct {
+	conn     *net.UDPConn
+	mu       sync.Mutex
+	lifetime map[uint16]uint32
+}
+
+func newPMPGateway(t *testing.T) *pmpGateway {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	g := &pmpGateway{conn: conn, lifetime: make(map[uint16]uint32)}
+	go g.serve()
+	return g
+}
+
+func (g *pmpGateway) serve() {
+	buf := make([]byte, 1100)
+	for {
+		n, from, err := g.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		switch {
+		case n >= 2 && buf[0] == 0 && buf[1] == 0: // 查询外部地址
+			g.conn.WriteToUDPAddrPort([]byte{0, 0x80, 0, 0, 0, 0, 0, 1, 203, 0, 113, 7}, from)
+		case n >= 12 && buf[0] == 0 && buf[1] == 1: // 映射 UDP 端口，外部端口为内部端口 + 1000
+			port, lifetime := binary.BigEndian.Uint16(buf[4:]), binary.BigEndian.Uint32(buf[8:])
+			g.mu.Lock()
+			g.lifetime[port] = lifetime
+			g.mu.Unlock()
+			resp := make([]byte, 16)
+			resp[1] = 0x81
+			binary.BigEndian.PutUint16(resp[8:], port)
+			if lifetime > 0 {
+				binary.BigEndian.PutUint16(resp[10:], port+1000)
+			}
+			binary.BigEndian.PutUint32(resp[12:], lifetime)
+			g.conn.WriteToUDPAddrPort(resp, from)
+		default: // PCP 等其他版本：不支持的版本
+			g.conn.WriteToUDPAddrPort([]byte{0, 0x80 | buf[1], 0, 1}, from)
+		}
+	}
+}
+
+func (g *pmpGateway) requested(port uint16) (uint32, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	lifetime, ok := g.lifetime[port]
+	return lifetime, ok
+}
+
+func TestPortMapStatus(t *testing.T) {
+	g := newPMPGateway(t)
+	tu := newTestUI(t)
+	events, cancelEvents := tu.events.Subscribe(4)
+	defer cancelEvents()
+
+	// 与 startPortMap 相同，但网关端口指向模拟网关
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &portMapState{
+		mapper: portmap.NewMapper(portmap.Config{
+			Gateway:  netip.MustParseAddr("127.0.0.1"),
+			PMPPort:  uint16(g.conn.LocalAddr().(*net.UDPAddr).Port),
+			Lifetime: 2 * time.Hour,
+		}, tu.device.GetListenPort),
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	tu.portmap = s
+	go func() {
+		defer close(s.stopped)
+		s.mapper.Run(ctx, tu.portMapChanged)
+	}()
+
+	select {
+	case e := <-events:
+		if e.Type != EventPortMapping || e.Detail == "" {
+			t.Errorf("event %+v", e)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no port mapping event")
+	}
+
+	port := tu.device.GetListenPort()
+	external := netip.AddrPortFrom(netip.MustParseAddr("203.0.113.7"), port+1000)
+	st := tu.portMapStatus()
+	if !st.Enabled || st.Protocol != portmap.ProtocolNATPMP || st.Gateway != "127.0.0.1" || st.InternalPort != port ||
+		st.External != external.String() || st.ExternalPort != external.Port() || st.Lifetime != 7200 || st.Expires == nil || st.Error != "" {
+		t.Errorf("status %+v", st)
+	}
+	admin := tu.token("root", RoleAdmin, ScopeSystem)
+	resp, body := tu.bearer(admin, http.MethodGet, "/api/v1/portmap", "")
+	var got PortMapStatus
+	if json.Unmarshal([]byte(body), &got); resp.StatusCode != http.StatusOK || got.External != st.External {
+		t.Errorf("GET /api/v1/portmap: %d %s", resp.StatusCode, body)
+	}
+
+	// 端口映射的外部地址优先于 STUN 映射地址
+	tu.stun.mu.Lock()
+	tu.stun.result = &STUNResult{Mapped: "198.51.100.9:40000"}
+	tu.stun.mu.Unlock()
+	r := httptest.NewRequest(http.MethodGet, "http://vpn.example.com/", nil)
+	if endpoint, discovered := tu.publicEndpoint(r); endpoint != external.String() || !discovered {
+		t.Errorf("publicEndpoint = %s, %v", endpoint, discovered)
+	}
+
+	// 停止时删除映射
+	tu.stopPortMap()
+	if lifetime, ok := g.requested(port); !ok || lifetime != 0 {
+		t.Errorf("mapping not removed: lifetime %d, %v", lifetime, ok)
+	}
+}
@@ -0,0 +1,323 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// rbac.go - 管理接口的基于角色的访问控制
+// 账号绑定一个角色，角色包含权限集合，并可选地限制来源网段与可管理的 Peer 标签
+
+package manager
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Permission 单项操作权限
+type Permission string
+
+const (
+	PermStatusRead     Permission = "status.read"     // 查看设备与 Peer 状态
+	PermPeersWrite     Permission = "peers.write"     // 添加、移除、修改 Peer
+	PermInvitesRead    Permission = "invites.read"    // 查看邀请码
+	PermInvitesWrite   Permission = "invites.write"   // 生成、撤回邀请码
+	PermConfigRaw      Permission = "config.raw"      // 下发原始 UAPI 配置
+	PermSystemRead     Permission = "system.read"     // 查看系统配置
+	PermSystemWrite    Permission = "system.write"    // 修改系统配置、客户端入驻
+	PermUsersManage    Permission = "users.manage"    // 管理账号、角色与他人的令牌
+	PermWebhooksManage Permission = "webhooks.manage" // 管理 Webhook 订阅与投递记录
+
+	// permAuthenticated 任意已登录会话即可访问 (页面、个人信息等)，API 令牌不可访问
+	permAuthenticated Permission = ""
+)
+
+// AllPermissions 所有可分配给角色的权限
+var AllPermissions = []Permission{
+	PermStatusRead, PermPeersWrite, PermInvitesRead, PermInvitesWrite,
+	PermConfigRaw, PermSystemRead, PermSystemWrite, PermUsersManage, PermWebhooksManage,
+}
+
+// 内置角色名
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Role 角色定义
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Permissions []Permission `json:"permissions"`
+	Networks    []string     `json:"networks,omitempty"`  // 允许的来源网段，空为不限制
+	PeerTags    []string     `json:"peer_tags,omitempty"` // 仅可查看/管理带这些标签的 Peer，空为不限制
+	BuiltIn     bool         `json:"built_in,omitempty"`
+}
+
+// builtinRoles 内置角色，不可修改或删除
+var builtinRoles = []Role{
+	{
+		Name:        RoleViewer,
+		Description: "只读查看状态",
+		Permissions: []Permission{PermStatusRead},
+		BuiltIn:     true,
+	},
+	{
+		Name:        RoleOperator,
+		Description: "查看状态、管理 Peer 与邀请码",
+		Permissions: []Permission{PermStatusRead, PermPeersWrite, PermInvitesRead, PermInvitesWrite},
+		BuiltIn:     true,
+	},
+	{
+		Name:        RoleAdmin,
+		Description: "全部权限",
+		Permissions: AllPermissions,
+		BuiltIn:     true,
+	},
+}
+
+// scopePermissions API 令牌范围对应的权限集合
+// 令牌的最终权限为其范围权限与创建者角色权限的交集
+var scopePermissions = map[Scope][]Permission{
+	ScopeStatusRead: {PermStatusRead},
+	ScopePeers:      {PermStatusRead, PermPeersWrite},
+	ScopeInvites:    {PermInvitesRead, PermInvitesWrite},
+	ScopeSystem:     {PermConfigRaw, PermSystemRead, PermSystemWrite, PermWebhooksManage},
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9._-]{1,32}$`)
+
+func validPermission(p Permission) bool {
+	for _, perm := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Has 判断角色是否具备某项权限
+func (r *Role) Has(p Permission) bool {
+	for _, perm := range r.Permissions {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsAddr 判断来源地址是否在角色允许的网段内
+func (r *Role) allowsAddr(addr netip.Addr) bool {
+	if len(r.Networks) == 0 {
+		return true
+	}
+	for _, cidr := range r.Networks {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsPeer 判断角色能否查看/管理带指定标签的 Peer
+func (r *Role) allowsPeer(tags []string) bool {
+	if len(r.PeerTags) == 0 {
+		return true
+	}
+	for _, want := range r.PeerTags {
+		for _, tag := range tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeTags 去重、去空白并排序标签
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// FindRole 按名称查找角色 (内置或自定义)，空名称视为 admin 以兼容旧配置
+func (c *Config) FindRole(name string) (Role, bool) {
+	if name == "" {
+		name = RoleAdmin
+	}
+	for _, r := range builtinRoles {
+		if r.Name == name {
+			return r, true
+		}
+	}
+
+	configLock.RLock()
+	defer configLock.RUnlock()
+	for _, r := range c.Roles {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Role{}, false
+}
+
+// ListRoles 返回内置与自定义角色
+func (c *Config) ListRoles() []Role {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	roles := append([]Role{}, builtinRoles...)
+	return append(roles, c.Roles...)
+}
+
+// SaveRole 新增或更新自定义角色
+func (c *Config) SaveRole(role Role) error {
+	role.Name = strings.TrimSpace(role.Name)
+	if !roleNamePattern.MatchString(role.Name) {
+		return fmt.Errorf("invalid role name")
+	}
+	for _, r := range builtinRoles {
+		if r.Name == role.Name {
+			return fmt.Errorf("built-in role %q cannot be modified", role.Name)
+		}
+	}
+	for _, p := range role.Permissions {
+		if !validPermission(p) {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+	}
+	networks, err := parseAllowedNetworks(role.Networks)
+	if err != nil {
+		return err
+	}
+	role.Networks = networks
+	role.PeerTags = normalizeTags(role.PeerTags)
+	role.BuiltIn = false
+
+	configLock.Lock()
+	defer configLock.Unlock()
+	for i := range c.Roles {
+		if c.Roles[i].Name == role.Name {
+			c.Roles[i] = role
+			return nil
+		}
+	}
+	c.Roles = append(c.Roles, role)
+	return nil
+}
+
+// RemoveRole 删除自定义角色，仍被账号引用时拒绝删除
+func (c *Config) RemoveRole(name string) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for _, u := range c.Users {
+		if u.Role == name {
+			return fmt.Errorf("role %q is still assigned to user %q", name, u.Username)
+		}
+	}
+	for i, r := range c.Roles {
+		if r.Name == name {
+			c.Roles = append(c.Roles[:i], c.Roles[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("role %q not found", name)
+}
+
+// ========== 请求授权 ==========
+
+// access 接口的权限要求：读请求 (GET/HEAD) 与写请求可分别要求不同权限
+type access struct {
+	read, write Permission
+}
+
+// allow 读写均要求同一权限
+func allow(p Permission) access {
+	return access{read: p, write: p}
+}
+
+// allowRW 读写分别要求不同权限
+func allowRW(read, write Permission) access {
+	return access{read: read, write: write}
+}
+
+// required 返回本次请求所需的权限
+func (a access) required(method string) Permission {
+	if method == "GET" || method == "HEAD" {
+		return a.read
+	}
+	return a.write
+}
+
+// tokenPermissions 计算令牌在创建者角色约束下的有效权限
+func tokenPermissions(token *APIToken, role *Role) []Permission {
+	var perms []Permission
+	for _, scope := range token.Scopes {
+		for _, p := range scopePermissions[scope] {
+			if role.Has(p) {
+				perms = append(perms, p)
+			}
+		}
+	}
+	return perms
+}
+
+// can 判断当前认证主体是否具备某项权限
+func (p *principal) can(perm Permission) bool {
+	if perm == permAuthenticated {
+		return true
+	}
+	for _, have := range p.Permissions {
+		if have == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// covers 判断角色的权限是否都在当前认证主体的权限之内
+func (p *principal) covers(role Role) bool {
+	for _, perm := range role.Permissions {
+		if !p.can(perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// canSeePeer 判断当前认证主体能否查看/管理带指定标签的 Peer
+func (p *principal) canSeePeer(tags []string) bool {
+	return p.Role.allowsPeer(tags)
+}
+
+// scopedTags 校验新建 Peer/邀请码的标签是否落在角色范围内
+// 受限角色未指定标签时自动使用角色的标签，保证新对象仍对自己可见
+func (p *principal) scopedTags(tags []string) ([]string, bool) {
+	tags = normalizeTags(tags)
+	if len(p.Role.PeerTags) == 0 {
+		return tags, true
+	}
+	if len(tags) == 0 {
+		return p.Role.PeerTags, true
+	}
+	for _, tag := range tags {
+		if !p.Role.allowsPeer([]string{tag}) {
+			return nil, false
+		}
+	}
+	return tags, true
+}
@@ -0,0 +1,228 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveRole(t *testing.T) {
+	conf := &Config{}
+	tests := []struct {
+		role Role
+		ok   bool
+	}{
+		{Role{Name: "iot-ops", Permissions: []Permission{PermStatusRead, PermPeersWrite}, PeerTags: []string{" IoT ", "iot"}}, true},
+		{Role{Name: "lan", Networks: []string{"192.0.2.1"}}, true},
+		{Role{Name: RoleAdmin}, false},
+		{Role{Name: "Bad Name"}, false},
+		{Role{Name: "x", Permissions: []Permission{"root"}}, false},
+		{Role{Name: "y", Networks: []string{"lan"}}, false},
+	}
+	for _, tt := range tests {
+		if err := conf.SaveRole(tt.role); (err == nil) != tt.ok {
+			t.Errorf("SaveRole(%+v) = %v, want ok %v", tt.role, err, tt.ok)
+		}
+	}
+	if r, _ := conf.FindRole("iot-ops"); !reflect.DeepEqual(r.PeerTags, []string{"iot"}) {
+		t.Errorf("peer tags not normalised: %q", r.PeerTags)
+	}
+	if r, _ := conf.FindRole("lan"); !reflect.DeepEqual(r.Networks, []string{"192.0.2.1/32"}) {
+		t.Errorf("networks not normalised: %q", r.Networks)
+	}
+	if r, ok := conf.FindRole(""); !ok || r.Name != RoleAdmin {
+		t.Errorf("empty role name resolves to %q", r.Name)
+	}
+
+	conf.Users = []User{{Username: "alice", Role: "iot-ops"}}
+	if err := conf.RemoveRole("iot-ops"); err == nil {
+		t.Error("removed a role still assigned to a user")
+	}
+	if err := conf.RemoveRole("lan"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoleEscalation(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{{Name: "user-admin", Permissions: []Permission{PermStatusRead, PermUsersManage}}}
+	})
+	tu.addUser("root", "longenough", RoleAdmin)
+	tu.addUser("alice", "longenough", "user-admin")
+	tu.addUser("bob", "longenough", RoleViewer)
+	c := tu.login("alice", "longenough")
+
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		status       int
+	}{
+		{"grant admin", http.MethodPatch, "/api/v1/users/bob", `{"role":"admin"}`, http.StatusForbidden},
+		{"grant admin to self", http.MethodPatch, "/api/v1/users/alice", `{"role":"admin"}`, http.StatusForbidden},
+		{"grant admin via legacy", http.MethodPut, "/api/users", `{"username":"bob","role":"admin"}`, http.StatusForbidden},
+		{"create admin", http.MethodPost, "/api/v1/users", `{"username":"mallory","password":"longenough","role":"admin"}`, http.StatusForbidden},
+		{"reset admin password", http.MethodPatch, "/api/v1/users/root", `{"password":"longenough2"}`, http.StatusForbidden},
+		{"remove admin", http.MethodDelete, "/api/v1/users/root", "", http.StatusForbidden},
+		{"widen own role", http.MethodPut, "/api/v1/roles/user-admin", `{"permissions":["status.read","users.manage","system.write"]}`, http.StatusForbidden},
+		{"grant covered role", http.MethodPatch, "/api/v1/users/bob", `{"role":"user-admin"}`, http.StatusOK},
+		{"create viewer", http.MethodPost, "/api/v1/users", `{"username":"carol","password":"longenough"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		resp, body := tu.write(c, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+	}
+	for username, want := range map[string]string{"root": RoleAdmin, "alice": "user-admin", "bob": "user-admin"} {
+		if u, _ := tu.config.FindUser(username); u.Role != want {
+			t.Errorf("%s has role %q, want %q", username, u.Role, want)
+		}
+	}
+	if _, ok := tu.config.FindUser("mallory"); ok {
+		t.Error("created an admin account")
+	}
+	if r, _ := tu.config.FindRole("user-admin"); r.Has(PermSystemWrite) {
+		t.Error("widened own role")
+	}
+}
+
+func TestScopedTags(t *testing.T) {
+	scoped := principal{Role: Role{PeerTags: []string{"cam", "iot"}}}
+	open := principal{Role: Role{}}
+	tests := []struct {
+		p    principal
+		tags []string
+		want []string
+		ok   bool
+	}{
+		{open, []string{"B", "a", "a "}, []string{"a", "b"}, true},
+		{open, nil, nil, true},
+		{scoped, nil, []string{"cam", "iot"}, true},
+		{scoped, []string{"IoT"}, []string{"iot"}, true},
+		{scoped, []string{"iot", "lab"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.p.scopedTags(tt.tags)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scopedTags(%q) with role tags %q = %q, %v; want %q, %v", tt.tags, tt.p.Role.PeerTags, got, ok, tt.want, tt.ok)
+		}
+	}
+	if !scoped.canSeePeer([]string{"lab", "iot"}) || scoped.canSeePeer([]string{"lab"}) || scoped.canSeePeer(nil) {
+		t.Error("canSeePeer does not follow role tags")
+	}
+}
+
+func TestPeerTagScope(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.Roles = []Role{
+			{Name: "iot-ops", Permissions: []Permission{PermStatusRead, PermPeersWrite}, PeerTags: []string{"iot"}},
+			{Name: "remote", Permissions: []Permission{PermStatusRead}, Networks: []string{"192.0.2.0/24"}},
+		}
+	})
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	iot := tu.token("alice", "iot-ops", ScopePeers)
+	remote := tu.token("bob", "remote", ScopeStatusRead)
+
+	keyIoT, keyCam, keyNew := testKey(1), testKey(2), testKey(3)
+	for _, req := range []string{
+		fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.2/32"],"tags":["iot"]}`, keyIoT),
+		fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.3/32"],"tags":["cam"]}`, keyCam),
+	} {
+		if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers", req); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("admin create: %d %s", resp.StatusCode, body)
+		}
+	}
+
+	resp, body := tu.bearer(iot, http.MethodGet, "/api/v1/peers", "")
+	var peers []PeerInfo
+	json.Unmarshal([]byte(body), &peers)
+	if resp.StatusCode != http.StatusOK || len(peers) != 1 || peers[0].PublicKey != keyIoT {
+		t.Fatalf("scoped list: %d %s", resp.StatusCode, body)
+	}
+
+	camPath := "/api/v1/peers/" + url.PathEscape(keyCam)
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		status       int
+		code         string
+	}{
+		{"get hidden peer", http.MethodGet, camPath, "", http.StatusNotFound, ErrCodeNotFound},
+		{"replace hidden peer", http.MethodPut, camPath, `{"allowed_ips":["10.0.0.3/32"],"tags":["iot"]}`, http.StatusNotFound, ErrCodeNotFound},
+		{"update hidden peer via create", http.MethodPost, "/api/v1/peers", fmt.Sprintf(`{"public_key":%q,"allowed_ips":["0.0.0.0/0"]}`, keyCam), http.StatusForbidden, ErrCodeOutOfScope},
+		{"update hidden peer via legacy add", http.MethodPost, "/api/peer/add", fmt.Sprintf(`{"public_key":%q,"allowed_ips":["0.0.0.0/0"],"tags":["iot"]}`, keyCam), http.StatusForbidden, ""},
+		{"retag hidden peer", http.MethodPut, camPath + "/tags", `{"tags":["iot"]}`, http.StatusNotFound, ErrCodeNotFound},
+		{"remove hidden peer", http.MethodDelete, camPath, "", http.StatusNotFound, ErrCodeNotFound},
+		{"create outside scope", http.MethodPost, "/api/v1/peers", fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.4/32"],"tags":["cam"]}`, keyNew), http.StatusForbidden, ErrCodeOutOfScope},
+		{"create inside scope", http.MethodPost, "/api/v1/peers", fmt.Sprintf(`{"public_key":%q,"allowed_ips":["10.0.0.4/32"]}`, keyNew), http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		resp, body := tu.bearer(iot, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status || errorCode(body) != tt.code {
+			t.Errorf("%s: %d %s, want %d %q", tt.name, resp.StatusCode, body, tt.status, tt.code)
+		}
+	}
+	if tags := tu.config.PeerTags(keyCam); !reflect.DeepEqual(tags, []string{"cam"}) {
+		t.Errorf("hidden peer tags changed to %q", tags)
+	}
+	if peer, err := tu.findPeer(principal{}, keyCam); err != nil || !reflect.DeepEqual(peer.AllowedIPs, []string{"10.0.0.3/32"}) {
+		t.Errorf("hidden peer changed: %+v, %v", peer, err)
+	}
+	if tags := tu.config.PeerTags(keyNew); !reflect.DeepEqual(tags, []string{"iot"}) {
+		t.Errorf("peer created by scoped role has tags %q", tags)
+	}
+
+	if resp, body := tu.bearer(remote, http.MethodGet, "/api/v1/status", ""); resp.StatusCode != http.StatusForbidden || errorCode(body) != ErrCodeForbidden {
+		t.Errorf("role network restriction: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestPeerInputValidation(t *testing.T) {
+	tu := newTestUI(t)
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	key := testKey(1)
+	path := "/api/v1/peers/" + url.PathEscape(key)
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"valid", `{"allowed_ips":["10.0.0.2/32","fd00::2/128"],"endpoint":"[2001:db8::1]:51820"}`, true},
+		{"hostname endpoint", `{"endpoint":"vpn.example.com:51820"}`, false},
+		{"endpoint without port", `{"endpoint":"192.0.2.1"}`, false},
+		{"endpoint injection", `{"endpoint":"192.0.2.1:51820\nallowed_ip=0.0.0.0/0"}`, false},
+		{"allowed IP injection", fmt.Sprintf(`{"allowed_ips":["10.0.0.2/32\npublic_key=%s"]}`, strings.Repeat("00", 32)), false},
+		{"bare address", `{"allowed_ips":["10.0.0.2"]}`, false},
+	}
+	for _, tt := range tests {
+		resp, body := tu.bearer(admin, http.MethodPut, path, tt.body)
+		if ok := resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated; ok != tt.ok || (!ok && resp.StatusCode != http.StatusBadRequest) {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+	if resp, body := tu.bearer(admin, http.MethodPost, "/api/v1/peers", `{"public_key":"abc","allowed_ips":["10.0.0.2/32"]}`); resp.StatusCode != http.StatusBadRequest || errorCode(body) != ErrCodeInvalidKey {
+		t.Errorf("bad key: %d %s", resp.StatusCode, body)
+	}
+
+	peer, err := tu.findPeer(principal{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(peer.AllowedIPs, []string{"10.0.0.2/32", "fd00::2/128"}) {
+		t.Errorf("peer after rejected updates: %+v", peer)
+	}
+	if n := len(tu.getDeviceInfo().Peers); n != 1 {
+		t.Errorf("device has %d peers, want 1", n)
+	}
+}
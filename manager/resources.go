@@ -0,0 +1,431 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// resources.go - Peer、邀请码、系统设置与账号的增删改
+// 旧接口与 /api/v1 共用这些操作，只是请求与响应的形式不同
+
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// parsePeerKey 解析 Hex、标准 Base64 或 URL 安全 Base64 编码的公钥，返回标准 Base64
+// URL 路径中的公钥通常使用 Hex 或 URL 安全 Base64，避免 "/" 与 "+"
+func parsePeerKey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	var key []byte
+	var err error
+	switch {
+	case len(s) == device.NoisePublicKeySize*2:
+		key, err = hex.DecodeString(s)
+	case strings.ContainsAny(s, "-_") || !strings.HasSuffix(s, "="):
+		key, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	default:
+		key, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(key) != device.NoisePublicKeySize {
+		return "", apiErrorf(http.StatusBadRequest, ErrCodeInvalidKey, "Invalid public key %q", s)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// uapiError 将 IpcSet 的错误转换为 APIError，配置内容有误时返回 400
+func uapiError(err error) error {
+	var ipcErr *device.IPCError
+	if errors.As(err, &ipcErr) && ipcErr.ErrorCode() == ipc.IpcErrorInvalid {
+		return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	return err
+}
+
+// parseEndpoint 校验 Peer 端点 (IP:端口)
+// 端点会拼入 UAPI 文本，必须先解析，避免带换行的值注入其他配置行
+func parseEndpoint(s string) (string, error) {
+	addrPort, err := netip.ParseAddrPort(strings.TrimSpace(s))
+	if err != nil {
+		return "", apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid endpoint %q, expected ip:port", s)
+	}
+	return addrPort.String(), nil
+}
+
+// parseAllowedIPs 校验 AllowedIPs 中的每个网段，理由同 parseEndpoint
+func parseAllowedIPs(ips []string) ([]string, error) {
+	prefixes := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(ip))
+		if err != nil {
+			return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid allowed IP %q, expected a CIDR prefix", ip)
+		}
+		prefixes = append(prefixes, prefix.String())
+	}
+	return prefixes, nil
+}
+
+// ========== Peer ==========
+
+// findPeer 查找当前角色可见的 Peer，超出标签范围时同样返回 404
+func (ui *WebUI) findPeer(p principal, publicKey string) (PeerInfo, error) {
+	for _, peer := range ui.visibleDeviceInfo(p).Peers {
+		if peer.PublicKey == publicKey {
+			return peer, nil
+		}
+	}
+	return PeerInfo{}, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Peer not found")
+}
+
+// addPeer 添加或更新 Peer，返回标准 Base64 公钥
+// 更新已有 Peer 时 AllowedIPs 与原有的合并
+func (ui *WebUI) addPeer(p principal, req PeerAddRequest) (string, error) {
+	return ui.writePeer(p, req, false)
+}
+
+// replacePeer 创建或整体替换 Peer：AllowedIPs、保活与标签都以请求为准
+func (ui *WebUI) replacePeer(p principal, req PeerAddRequest) (string, error) {
+	return ui.writePeer(p, req, true)
+}
+
+func (ui *WebUI) writePeer(p principal, req PeerAddRequest, replace bool) (string, error) {
+	publicKey, err := parsePeerKey(req.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	tags, ok := p.scopedTags(req.Tags)
+	if !ok {
+		return "", apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Peer tags outside of your role")
+	}
+	// 已有 Peer 超出标签范围时不能借添加接口修改或改标签收归己有
+	existed := ui.config.HasPeer(publicKey)
+	if existed && !p.canSeePeer(ui.config.PeerTags(publicKey)) {
+		return "", apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Peer outside of your role")
+	}
+	allowedIPs, err := parseAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		return "", err
+	}
+
+	// 构建 UAPI 配置字符串
+	var config strings.Builder
+	config.WriteString("public_key=" + b64ToHex(publicKey) + "\n")
+	if replace {
+		config.WriteString("replace_allowed_ips=true\n")
+	}
+	if req.Endpoint != "" {
+		endpoint, err := parseEndpoint(req.Endpoint)
+		if err != nil {
+			return "", err
+		}
+		config.WriteString("endpoint=" + endpoint + "\n")
+	}
+	if req.Keepalive > 0 || replace {
+		config.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", req.Keepalive))
+	}
+	for _, ip := range allowedIPs {
+		config.WriteString("allowed_ip=" + ip + "\n")
+	}
+	if err := ui.device.IpcSet(config.String()); err != nil {
+		return "", uapiError(err)
+	}
+
+	// 持久化改动 (Phase 2)
+	ui.config.SyncFromDevice(ui.device)
+	if len(tags) > 0 || replace {
+		ui.config.SetPeerTags(publicKey, tags)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to save config after adding peer: %v", err)
+	}
+	if existed {
+		ui.events.Publish(Event{Type: EventPeerUpdated, Peer: publicKey})
+	} else {
+		ui.events.Publish(Event{Type: EventPeerAdded, Peer: publicKey})
+	}
+	return publicKey, nil
+}
+
+// removePeer 删除 Peer
+func (ui *WebUI) removePeer(p principal, key string) error {
+	publicKey, err := parsePeerKey(key)
+	if err != nil {
+		return err
+	}
+	if !p.canSeePeer(ui.config.PeerTags(publicKey)) {
+		return apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Peer outside of your role")
+	}
+	if err := ui.device.IpcSet(fmt.Sprintf("public_key=%s\nremove=true\n", b64ToHex(publicKey))); err != nil {
+		return uapiError(err)
+	}
+
+	// 持久化改动 (Phase 2)
+	ui.config.SyncFromDevice(ui.device)
+	ui.config.DeletePeer(publicKey) // 已停用的 Peer 不在设备上，需单独删除记录
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to save config after removing peer: %v", err)
+	}
+	ui.history.forget(publicKey)
+	ui.events.Publish(Event{Type: EventPeerRemoved, Peer: publicKey})
+	return nil
+}
+
+// setPeerTags 设置 Peer 标签
+// 受标签限制的角色：只能修改自己范围内的 Peer，且新标签也必须在范围内
+func (ui *WebUI) setPeerTags(p principal, key string, tags []string) error {
+	publicKey, err := parsePeerKey(key)
+	if err != nil {
+		return err
+	}
+	tags, ok := p.scopedTags(tags)
+	if !ok || !p.canSeePeer(ui.config.PeerTags(publicKey)) {
+		return apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Peer tags outside of your role")
+	}
+	if !ui.config.SetPeerTags(publicKey, tags) {
+		return apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Peer not found")
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return err
+	}
+	ui.events.Publish(Event{Type: EventPeerUpdated, Peer: publicKey, Detail: "tags"})
+	return nil
+}
+
+// setPeerDisabled 停用或启用 Peer
+// 停用时从设备上移除 Peer、断开其会话，但保留配置记录与标签；启用时按记录重新下发
+func (ui *WebUI) setPeerDisabled(p principal, key string, disabled bool) error {
+	publicKey, err := parsePeerKey(key)
+	if err != nil {
+		return err
+	}
+	if !p.canSeePeer(ui.config.PeerTags(publicKey)) {
+		return apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Peer outside of your role")
+	}
+	ui.config.SyncFromDevice(ui.device) // 先记下设备上的最新端点等状态
+	record, ok := ui.config.SetPeerDisabled(publicKey, disabled)
+	if !ok {
+		return apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Peer not found")
+	}
+	if record.Disabled == disabled {
+		return nil
+	}
+	uapi := peerUAPI(record)
+	if disabled {
+		uapi = fmt.Sprintf("public_key=%s\nremove=true\n", b64ToHex(publicKey))
+	}
+	if err := ui.device.IpcSet(uapi); err != nil {
+		ui.config.SetPeerDisabled(publicKey, record.Disabled)
+		return uapiError(err)
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		return err
+	}
+	detail := "enabled"
+	if disabled {
+		detail = "disabled"
+	}
+	ui.events.Publish(Event{Type: EventPeerUpdated, Peer: publicKey, Detail: detail})
+	return nil
+}
+
+// ========== 邀请码 ==========
+
+// InviteCreateResponse 新建邀请码返回的记录与入驻链接
+type InviteCreateResponse struct {
+	Invite
+	URL string `json:"url"` // 入驻链接
+}
+
+// createInvite 生成邀请码
+func (ui *WebUI) createInvite(p principal, req InviteGenerateRequest) (Invite, error) {
+	// 彻底修正：确保 Duration 至少为 24 小时，且优先解析 JSON 字段
+	if req.Duration <= 0 {
+		req.Duration = 24
+	}
+	tags, ok := p.scopedTags(req.Tags)
+	if !ok {
+		return Invite{}, apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Invite tags outside of your role")
+	}
+
+	token, err := ui.config.GenerateInvite(req.Remark, time.Duration(req.Duration)*time.Hour, tags)
+	if err != nil {
+		return Invite{}, err
+	}
+	// 立即保存
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to save config after generating invite: %v", err)
+	}
+	inv, _ := ui.config.FindInvite(token)
+	ui.events.Publish(Event{Type: EventInviteCreated, Detail: inv.Remark})
+	return inv, nil
+}
+
+// visibleInvites 当前角色可见的邀请码
+func (ui *WebUI) visibleInvites(p principal) []Invite {
+	invites := []Invite{}
+	for _, inv := range ui.config.ListInvites() {
+		if p.canSeePeer(inv.Tags) {
+			invites = append(invites, inv)
+		}
+	}
+	return invites
+}
+
+// findInvite 查找当前角色可见的邀请码
+func (ui *WebUI) findInvite(p principal, token string) (Invite, error) {
+	inv, ok := ui.config.FindInvite(token)
+	if !ok || !p.canSeePeer(inv.Tags) {
+		return Invite{}, apiErrorf(http.StatusNotFound, ErrCodeNotFound, "Invite not found")
+	}
+	return inv, nil
+}
+
+// removeInvite 撤回邀请码
+func (ui *WebUI) removeInvite(p principal, token string) error {
+	inv, ok := ui.config.FindInvite(token)
+	if ok && !p.canSeePeer(inv.Tags) {
+		return apiErrorf(http.StatusForbidden, ErrCodeOutOfScope, "Invite outside of your role")
+	}
+	ui.config.RemoveInvite(token)
+	if err := SaveConfig(ui.config); err != nil {
+		return err
+	}
+	if ok {
+		ui.events.Publish(Event{Type: EventInviteRemoved, Detail: inv.Remark})
+	}
+	return nil
+}
+
+// ========== 系统设置 ==========
+
+// updateSystem 更新可在线修改的系统设置，TLS 与管理面等需重启的设置不在此修改
+func (ui *WebUI) updateSystem(newSys SystemConfig) error {
+	configLock.Lock()
+	ui.config.System.PublicHost = newSys.PublicHost
+	ui.config.System.PublicPort = newSys.PublicPort
+	ui.config.System.WebHost = newSys.WebHost
+	ui.config.System.WebPort = newSys.WebPort
+	ui.config.System.DefaultKeepalive = newSys.DefaultKeepalive
+	if newSys.CORSOrigins != nil {
+		// 字段缺省时保留原值，避免只提交部分设置的页面清空白名单
+		ui.config.System.CORSOrigins = newSys.CORSOrigins
+	}
+	configLock.Unlock()
+	if err := SaveConfig(ui.config); err != nil {
+		return err
+	}
+	ui.events.Publish(Event{Type: EventSystemUpdated})
+	return nil
+}
+
+// applyConfig 直接应用 UAPI 格式配置
+func (ui *WebUI) applyConfig(config string) error {
+	if err := ui.device.IpcSet(config); err != nil {
+		return uapiError(err)
+	}
+	ui.events.Publish(Event{Type: EventConfigApplied})
+	return nil
+}
+
+// systemConfig 返回系统设置的副本，不含 MQTT 密码
+func (ui *WebUI) systemConfig() SystemConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	sys := ui.config.System
+	sys.MQTT.Password = ""
+	return sys
+}
+
+// ========== 账号 ==========
+
+// checkRole 只能授予或管理权限不超过自己的角色，防止持有 users.manage 的角色借此提升权限
+func (ui *WebUI) checkRole(r *http.Request, role Role) error {
+	p := currentPrincipal(r)
+	if !p.covers(role) {
+		return apiErrorf(http.StatusForbidden, ErrCodeForbidden, "role %q has permissions beyond your own", role.Name)
+	}
+	return nil
+}
+
+// checkRoleName 按名称校验角色，见 checkRole
+func (ui *WebUI) checkRoleName(r *http.Request, name string) error {
+	role, ok := ui.config.FindRole(name)
+	if !ok {
+		return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "role %q not found", name)
+	}
+	return ui.checkRole(r, role)
+}
+
+// createUser 新增账号，未指定角色时为 viewer
+func (ui *WebUI) createUser(r *http.Request, username, password, role string) error {
+	if role == "" {
+		role = RoleViewer
+	}
+	if err := ui.checkRoleName(r, role); err != nil {
+		return err
+	}
+	if err := ui.config.AddUser(username, password, role); err != nil {
+		return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	return nil
+}
+
+// updateUser 重置密码和/或修改角色 (重置他人密码后对方需重新修改)
+func (ui *WebUI) updateUser(r *http.Request, username, password, role string) error {
+	user, ok := ui.config.FindUser(username)
+	if !ok {
+		return apiErrorf(http.StatusNotFound, ErrCodeNotFound, "user %q not found", username)
+	}
+	if err := ui.checkRoleName(r, user.roleName()); err != nil {
+		return err
+	}
+	if role != "" {
+		if err := ui.checkRoleName(r, role); err != nil {
+			return err
+		}
+		if err := ui.config.SetUserRole(username, role); err != nil {
+			return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+		}
+	}
+	if password == "" {
+		return nil
+	}
+	self := currentUser(r)
+	if err := ui.config.SetUserPassword(username, password, username != self); err != nil {
+		return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	keep := ""
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && username == self {
+		keep = cookie.Value
+	}
+	ui.sessions.RevokeUser(username, keep)
+	return nil
+}
+
+// removeUser 删除账号并注销其会话，不能删除当前登录的账号
+func (ui *WebUI) removeUser(r *http.Request, username string) error {
+	if username == currentUser(r) {
+		return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "cannot remove the current user")
+	}
+	user, ok := ui.config.FindUser(username)
+	if !ok {
+		return apiErrorf(http.StatusNotFound, ErrCodeNotFound, "user %q not found", username)
+	}
+	if err := ui.checkRoleName(r, user.roleName()); err != nil {
+		return err
+	}
+	if err := ui.config.RemoveUser(username); err != nil {
+		return apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	ui.sessions.RevokeUser(username, "")
+	return nil
+}
@@ -0,0 +1,128 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/manager/client"
+)
+
+func TestSDKErrorCodes(t *testing.T) {
+	// 客户端单独维护错误码常量，与服务端保持一致
+	for sdk, server := range map[string]string{
+		client.CodeBadRequest:             ErrCodeBadRequest,
+		client.CodeInvalidJSON:            ErrCodeInvalidJSON,
+		client.CodeInvalidKey:             ErrCodeInvalidKey,
+		client.CodeUnauthorized:           ErrCodeUnauthorized,
+		client.CodeInvalidToken:           ErrCodeInvalidToken,
+		client.CodeForbidden:              ErrCodeForbidden,
+		client.CodeInsufficientScope:      ErrCodeInsufficientScope,
+		client.CodeOutOfScope:             ErrCodeOutOfScope,
+		client.CodeCSRF:                   ErrCodeCSRF,
+		client.CodePasswordChangeRequired: ErrCodePasswordChangeRequired,
+		client.CodeNotFound:               ErrCodeNotFound,
+		client.CodeMethodNotAllowed:       ErrCodeMethodNotAllowed,
+		client.CodeConflict:               ErrCodeConflict,
+		client.CodeRateLimited:            ErrCodeRateLimited,
+		client.CodeUpstream:               ErrCodeUpstream,
+		client.CodeInternal:               ErrCodeInternal,
+	} {
+		if sdk != server {
+			t.Errorf("client code %q, server code %q", sdk, server)
+		}
+	}
+}
+
+func TestSDKAgainstServer(t *testing.T) {
+	tu := newTestUI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	newClient := func(opts ...client.Option) *client.Client {
+		c, err := client.New(tu.ts.URL, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	ops := newClient(client.WithToken(tu.token("ops", RoleOperator, ScopeStatusRead, ScopePeers)))
+	key := testKey(1)
+
+	peer, err := ops.AddPeer(ctx, client.PeerAddRequest{PublicKey: key, AllowedIPs: []string{"10.0.0.9/32"}, Tags: []string{"iot"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.PublicKey != key || !reflect.DeepEqual(peer.AllowedIPs, []string{"10.0.0.9/32"}) {
+		t.Errorf("AddPeer = %+v", peer)
+	}
+	if peer, err = ops.SetPeerTags(ctx, key, []string{"cam", "iot"}); err != nil || !reflect.DeepEqual(peer.Tags, []string{"cam", "iot"}) {
+		t.Errorf("SetPeerTags = %+v, %v", peer, err)
+	}
+	if peer, err = ops.DisablePeer(ctx, key); err != nil || !peer.Disabled {
+		t.Errorf("DisablePeer = %+v, %v", peer, err)
+	}
+	if peer, err = ops.EnablePeer(ctx, key); err != nil || peer.Disabled {
+		t.Errorf("EnablePeer = %+v, %v", peer, err)
+	}
+	if info, err := ops.Status(ctx); err != nil || info.PeerCount != 1 {
+		t.Errorf("Status = %+v, %v", info, err)
+	}
+	if err := ops.RemovePeer(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		c    *client.Client
+		call func(*client.Client) error
+		want error
+		code string
+	}{
+		{"removed peer", ops, func(c *client.Client) error {
+			_, err := c.Peer(ctx, key)
+			return err
+		}, client.ErrNotFound, client.CodeNotFound},
+		{"invalid allowed ip", ops, func(c *client.Client) error {
+			_, err := c.AddPeer(ctx, client.PeerAddRequest{PublicKey: key, AllowedIPs: []string{"10.0.0.9"}})
+			return err
+		}, client.ErrBadRequest, client.CodeBadRequest},
+		{"insufficient scope", ops, func(c *client.Client) error {
+			_, err := c.System(ctx)
+			return err
+		}, client.ErrForbidden, client.CodeInsufficientScope},
+		{"no credentials", newClient(), func(c *client.Client) error {
+			_, err := c.Peers(ctx)
+			return err
+		}, client.ErrUnauthorized, client.CodeUnauthorized},
+		{"bootstrap password", newClient(), func(c *client.Client) error {
+			return c.Login(ctx, "admin", "admin")
+		}, client.ErrForbidden, client.CodePasswordChangeRequired},
+	}
+	for _, tt := range tests {
+		err := tt.call(tt.c)
+		var apiErr *client.APIError
+		if !errors.Is(err, tt.want) || !errors.As(err, &apiErr) || apiErr.Code != tt.code {
+			t.Errorf("%s: %v, want %v (%s)", tt.name, err, tt.want, tt.code)
+		}
+	}
+
+	// 会话登录后写请求自动带上 CSRF 令牌
+	tu.addUser("alice", "longenough", RoleOperator)
+	alice := newClient()
+	if err := alice.Login(ctx, "alice", "longenough"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.AddPeer(ctx, client.PeerAddRequest{PublicKey: key, AllowedIPs: []string{"10.0.0.9/32"}}); err != nil {
+		t.Errorf("AddPeer with session: %v", err)
+	}
+	if peers, err := alice.Peers(ctx); err != nil || len(peers) != 1 {
+		t.Errorf("Peers = %+v, %v", peers, err)
+	}
+}
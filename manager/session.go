@@ -0,0 +1,192 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// session.go - WebUI 登录会话管理
+// 每次登录生成独立的随机会话令牌，支持空闲超时、绝对超时与主动注销
+
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionIdleTimeout = 30 * time.Minute
+	defaultSessionMaxAge      = 12 * time.Hour
+)
+
+// session 单个登录会话
+type session struct {
+	username  string
+	createdAt time.Time
+	lastSeen  time.Time
+}
+
+// sessionStore 内存中的会话表
+// 会话令牌仅以 SHA-256 摘要作为键保存，进程重启后所有会话失效
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	idle     func() time.Duration
+	maxAge   func() time.Duration
+}
+
+func newSessionStore(idle, maxAge func() time.Duration) *sessionStore {
+	return &sessionStore{
+		sessions: make(map[string]*session),
+		idle:     idle,
+		maxAge:   maxAge,
+	}
+}
+
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionLimits 会话的空闲超时与绝对有效期，在取 s.mu 之前读取，不在会话锁内再取配置锁
+type sessionLimits struct {
+	idle, maxAge time.Duration
+}
+
+func (s *sessionStore) limits() sessionLimits {
+	return sessionLimits{idle: s.idle(), maxAge: s.maxAge()}
+}
+
+// expired 判断会话是否已过期
+func (l sessionLimits) expired(sess *session, now time.Time) bool {
+	return now.Sub(sess.lastSeen) > l.idle || now.Sub(sess.createdAt) > l.maxAge
+}
+
+// Create 为用户创建新会话，返回明文令牌
+func (s *sessionStore) Create(username string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	limits := s.limits()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 顺手清理过期会话，避免表无限增长
+	for key, sess := range s.sessions {
+		if limits.expired(sess, now) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[sessionKey(token)] = &session{
+		username:  username,
+		createdAt: now,
+		lastSeen:  now,
+	}
+	return token, nil
+}
+
+// Lookup 校验令牌并刷新空闲计时，返回会话所属用户名
+func (s *sessionStore) Lookup(token string) (string, bool) {
+	key := sessionKey(token)
+	now := time.Now()
+	limits := s.limits()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[key]
+	if !ok {
+		return "", false
+	}
+	if limits.expired(sess, now) {
+		delete(s.sessions, key)
+		return "", false
+	}
+	sess.lastSeen = now
+	return sess.username, true
+}
+
+// Revoke 注销单个会话
+func (s *sessionStore) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionKey(token))
+}
+
+// RevokeUser 注销某用户的全部会话 (可保留当前会话)
+func (s *sessionStore) RevokeUser(username, keepToken string) {
+	keep := ""
+	if keepToken != "" {
+		keep = sessionKey(keepToken)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, sess := range s.sessions {
+		if sess.username == username && key != keep {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// sessionIdleTimeout 返回当前的会话空闲超时
+func (ui *WebUI) sessionIdleTimeout() time.Duration {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return ui.config.System.sessionIdleTimeout()
+}
+
+// sessionMaxAge 返回当前的会话绝对有效期
+func (ui *WebUI) sessionMaxAge() time.Duration {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return ui.config.System.sessionMaxAge()
+}
+
+// ========== 请求上下文 ==========
+
+type contextKey int
+
+const ctxPrincipalKey contextKey = iota
+
+// principal 当前请求的认证主体
+type principal struct {
+	Username    string       // 会话用户，或 API 令牌的创建者
+	TokenID     string       // 通过 API 令牌认证时非空
+	Role        Role         // 账号角色
+	Permissions []Permission // 有效权限 (令牌为范围与角色的交集)
+	CSRFToken   string       // 会话对应的 CSRF 令牌，令牌认证时为空
+}
+
+// withPrincipal 将认证主体写入请求上下文
+func withPrincipal(r *http.Request, p principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxPrincipalKey, p))
+}
+
+func currentPrincipal(r *http.Request) principal {
+	p, _ := r.Context().Value(ctxPrincipalKey).(principal)
+	return p
+}
+
+// currentUser 读取当前请求的认证用户名
+func currentUser(r *http.Request) string {
+	return currentPrincipal(r).Username
+}
+
+// remoteAddr 解析请求来源 IP
+func remoteAddr(r *http.Request) netip.Addr {
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return ap.Addr().Unmap()
+	}
+	addr, _ := netip.ParseAddr(r.RemoteAddr)
+	return addr.Unmap()
+}
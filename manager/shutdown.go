@@ -0,0 +1,189 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+const (
+	defaultShutdownTimeout = 8                      // 秒，留在 docker stop 默认 10 秒的 SIGKILL 之前
+	finalKeepaliveWait     = 500 * time.Millisecond // 等待最后一个 keepalive 发出的最长时间
+)
+
+// ShutdownConfig 退出时的行为
+type ShutdownConfig struct {
+	Timeout        int  `json:"timeout,omitempty"`         // 等待进行中的请求与后台任务结束的最长时间 (秒)，默认 8
+	FinalKeepalive bool `json:"final_keepalive,omitempty"` // 退出前向在线的 Peer 各发送一个 keepalive
+}
+
+// ShutdownTimeout 返回生效的退出等待时间
+func (ui *WebUI) ShutdownTimeout() time.Duration {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if t := ui.config.System.Shutdown.Timeout; t > 0 {
+		return time.Duration(t) * time.Second
+	}
+	return defaultShutdownTimeout * time.Second
+}
+
+// Shutdown 按顺序停止 Web UI：
+// 不再接受新连接并在 ctx 截止前等待进行中的请求 (同时发布 MQTT 离线状态、删除端口映射)，
+// 可选地发送最后的 keepalive，再把设备上的运行时状态 (漫游得到的端点、经 UAPI 添加的 Peer) 写回配置，
+// 最后刷新流量历史与审计日志。ctx 截止后强制断开剩余连接，持久化步骤仍会执行。
+// 重复调用 (如信号处理与 Stop 先后触发) 只执行一次，返回第一次的结果。
+func (ui *WebUI) Shutdown(ctx context.Context) error {
+	ui.shutdownOnce.Do(func() {
+		ui.shutdownErr = ui.shutdown(ctx)
+	})
+	return ui.shutdownErr
+}
+
+func (ui *WebUI) shutdown(ctx context.Context) error {
+	log := ui.device.GetLogger()
+	// 先关闭 done：事件流等长连接随之结束，否则 http.Server.Shutdown 会一直等待它们
+	ui.device.SetStrayPacketHandler(nil)
+	close(ui.done)
+
+	httpDone := make(chan error, 1)
+	go func() { httpDone <- ui.shutdownHTTP(ctx) }()
+	others := make(chan struct{})
+	go func() {
+		defer close(others)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ui.stopMQTT()
+		}()
+		go func() {
+			defer wg.Done()
+			ui.stopPortMap()
+		}()
+		wg.Wait()
+	}()
+	httpErr := <-httpDone // ctx 截止后剩余连接被强制断开，一定会返回
+	select {
+	case <-others:
+	case <-ctx.Done():
+		// MQTT 与端口映射有各自的超时，不再等待
+		log.Errorf("Shutdown deadline exceeded, not waiting for MQTT and port mapping")
+	}
+	if httpErr != nil && !errors.Is(httpErr, context.DeadlineExceeded) && !errors.Is(httpErr, context.Canceled) {
+		log.Errorf("WebUI shutdown: %v", httpErr)
+	}
+
+	if ui.shutdownConfig().FinalKeepalive {
+		ui.sendFinalKeepalives()
+	}
+	err := ui.persistDeviceState()
+	ui.flushHistory()
+	if aerr := ui.audit.Close(); err == nil {
+		err = aerr
+	}
+	return err
+}
+
+func (ui *WebUI) shutdownConfig() ShutdownConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return ui.config.System.Shutdown
+}
+
+// shutdownHTTP 停止所有 HTTP 与 gRPC 监听，ctx 截止后强制断开
+func (ui *WebUI) shutdownHTTP(ctx context.Context) error {
+	servers := []*http.Server{ui.server, ui.admin, ui.redirect}
+	errs := make([]error, len(servers)+1)
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		if srv == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				srv.Close()
+				errs[i] = err
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs[len(servers)] = ui.stopGRPC(ctx)
+	}()
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sendFinalKeepalives 向最近握手过的 Peer 各发送一个 keepalive，最多等待 finalKeepaliveWait
+// 没有有效会话的 Peer 跳过，否则会触发一次无用的握手
+func (ui *WebUI) sendFinalKeepalives() {
+	if !ui.device.IsUp() {
+		return
+	}
+	sent := make(map[*device.Peer]uint64)
+	ui.device.ForEachPeer(func(p *device.Peer) {
+		if peerOnline(p.GetLastHandshakeNano()) && p.GetEndpoint() != "" {
+			sent[p], _ = p.GetTrafficStats()
+			p.SendKeepalive()
+		}
+	})
+	deadline := time.Now().Add(finalKeepaliveWait)
+	for len(sent) > 0 && time.Now().Before(deadline) {
+		for p, tx := range sent {
+			if now, _ := p.GetTrafficStats(); now > tx {
+				delete(sent, p)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(sent) > 0 {
+		ui.device.GetLogger().Verbosef("Final keepalive not confirmed for %d peer(s)", len(sent))
+	}
+}
+
+// persistDeviceState 把设备上的最新状态写回配置文件
+// 设备已关闭时 (如网卡被删除) Peer 已被移除，此时同步会清空配置，因此跳过
+func (ui *WebUI) persistDeviceState() error {
+	if ui.device.State() == "closed" {
+		ui.device.GetLogger().Errorf("Device already closed, runtime state not persisted")
+		return nil
+	}
+	configLock.RLock()
+	before := slices.Clone(ui.config.Peers)
+	port := ui.config.System.ListenPort
+	configLock.RUnlock()
+
+	ui.config.SyncFromDevice(ui.device)
+
+	configLock.RLock()
+	changed := port != ui.config.System.ListenPort || !slices.EqualFunc(before, ui.config.Peers, peerRecordEqual)
+	configLock.RUnlock()
+	if !changed {
+		return nil
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		ui.device.GetLogger().Errorf("Failed to persist device state on shutdown: %v", err)
+		return err
+	}
+	ui.device.GetLogger().Verbosef("Device state persisted on shutdown")
+	return nil
+}
+
+func peerRecordEqual(a, b PeerRecord) bool {
+	return a.PublicKey == b.PublicKey && a.Remark == b.Remark && a.Endpoint == b.Endpoint &&
+		a.PersistentKeepalive == b.PersistentKeepalive && a.Disabled == b.Disabled &&
+		slices.Equal(a.AllowedIPs, b.AllowedIPs) && slices.Equal(a.Tags, b.Tags)
+}
@@ -0,0 +1,241 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	for timeout, want := range map[int]time.Duration{
+		0:  defaultShutdownTimeout * time.Second,
+		-1: defaultShutdownTimeout * time.Second,
+		30: 30 * time.Second,
+	} {
+		tu := newTestUI(t, func(c *Config) { c.System.Shutdown.Timeout = timeout })
+		if got := tu.ShutdownTimeout(); got != want {
+			t.Errorf("timeout %d: %v, want %v", timeout, got, want)
+		}
+	}
+}
+
+// savedPeer 读取配置文件中的 Peer
+func savedPeer(t *testing.T, publicKey string) (PeerRecord, bool) {
+	t.Helper()
+	conf, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range conf.Peers {
+		if p.PublicKey == publicKey {
+			return p, true
+		}
+	}
+	return PeerRecord{}, false
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		release bool // 截止前放行进行中的请求
+	}{
+		{"drain", 5 * time.Second, true},
+		{"deadline", 200 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		tu := newTestUI(t)
+		token := tu.token("root", RoleAdmin, ScopeStatusRead)
+		started, release := make(chan struct{}), make(chan struct{})
+		defer close(release)
+		handler := tu.server.Handler
+		tu.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/slow" {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			close(started)
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			io.WriteString(w, "done")
+		})
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go tu.server.Serve(ln)
+		base := "http://" + ln.Addr().String()
+
+		// 事件流是长连接，关闭 done 后应立即结束，不拖住 HTTP 的排空
+		req, _ := http.NewRequest(http.MethodGet, base+"/api/events", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		stream, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamClosed := make(chan struct{})
+		go func() {
+			defer close(streamClosed)
+			sc := bufio.NewScanner(stream.Body)
+			for sc.Scan() {
+			}
+		}()
+
+		type result struct {
+			body string
+			err  error
+		}
+		slow := make(chan result, 1)
+		go func() {
+			resp, err := http.Get(base + "/slow")
+			if err != nil {
+				slow <- result{err: err}
+				return
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			slow <- result{string(body), err}
+		}()
+		<-started
+
+		// 经原始 UAPI 添加、尚未写入配置的 Peer
+		key := testKey(7)
+		if err := tu.device.IpcSet("public_key=" + b64ToHex(key) + "\nallowed_ip=10.0.0.7/32\n"); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+		defer cancel()
+		begin := time.Now()
+		done := make(chan error, 1)
+		go func() { done <- tu.Shutdown(ctx) }()
+
+		select {
+		case <-streamClosed:
+		case <-time.After(2 * time.Second):
+			t.Errorf("%s: event stream still open", tt.name)
+		}
+		if tt.release {
+			select {
+			case err := <-done:
+				t.Errorf("%s: Shutdown returned before the request finished: %v", tt.name, err)
+			case <-time.After(100 * time.Millisecond):
+			}
+			release <- struct{}{}
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%s: Shutdown = %v", tt.name, err)
+			}
+		case <-time.After(tt.timeout + 2*time.Second):
+			t.Fatalf("%s: Shutdown did not return", tt.name)
+		}
+		if !tt.release && time.Since(begin) > tt.timeout+time.Second {
+			t.Errorf("%s: Shutdown took %v", tt.name, time.Since(begin))
+		}
+
+		r := <-slow
+		if tt.release && (r.err != nil || r.body != "done") || !tt.release && r.err == nil {
+			t.Errorf("%s: in-flight request %q, %v", tt.name, r.body, r.err)
+		}
+		if _, err := http.Get(base + "/healthz"); err == nil {
+			t.Errorf("%s: listener still accepts requests", tt.name)
+		}
+		// 截止后强制断开连接，持久化仍然执行
+		if p, ok := savedPeer(t, key); !ok || !reflect.DeepEqual(p.AllowedIPs, []string{"10.0.0.7/32"}) {
+			t.Errorf("%s: runtime peer not persisted: %+v", tt.name, p)
+		}
+	}
+}
+
+func TestShutdownOnce(t *testing.T) {
+	tu := newTestUI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	first := tu.Shutdown(ctx)
+	// 信号处理之后 Stop 再次触发退出，不应关闭已关闭的 done 而 panic
+	if err := tu.Stop(); err != first {
+		t.Errorf("Stop after Shutdown = %v, want %v", err, first)
+	}
+	if err := tu.Shutdown(ctx); err != first {
+		t.Errorf("second Shutdown = %v, want %v", err, first)
+	}
+}
+
+func TestPersistDeviceState(t *testing.T) {
+	tu := newTestUI(t)
+	configLock.Lock()
+	tu.config.System.ListenPort = tu.device.GetListenPort() // 测试用的 Bind 不使用配置的端口
+	configLock.Unlock()
+
+	// 设备状态与配置一致时不写文件
+	os.Remove(dataPath)
+	if err := tu.persistDeviceState(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+		t.Errorf("config written without changes: %v", err)
+	}
+
+	key := testKey(3)
+	if err := tu.device.IpcSet("public_key=" + b64ToHex(key) + "\nallowed_ip=10.0.0.3/32\nendpoint=192.0.2.10:51820\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tu.persistDeviceState(); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := savedPeer(t, key); !ok || p.Endpoint == "" {
+		t.Errorf("saved peer %+v, %v", p, ok)
+	}
+
+	// 设备关闭后 Peer 已被移除，不能用它覆盖配置
+	tu.device.Close()
+	if err := tu.persistDeviceState(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tu.peerRecord(key); !ok {
+		t.Error("closed device cleared the configured peers")
+	}
+	if _, ok := savedPeer(t, key); !ok {
+		t.Error("closed device cleared the saved peers")
+	}
+}
+
+func TestPeerRecordEqual(t *testing.T) {
+	base := PeerRecord{PublicKey: "k", Remark: "r", AllowedIPs: []string{"10.0.0.2/32"}, Tags: []string{"iot"}}
+	tests := []struct {
+		name   string
+		modify func(*PeerRecord)
+		equal  bool
+	}{
+		{"same", func(*PeerRecord) {}, true},
+		{"endpoint", func(p *PeerRecord) { p.Endpoint = "192.0.2.1:51820" }, false},
+		{"keepalive", func(p *PeerRecord) { p.PersistentKeepalive = 25 }, false},
+		{"allowed ips", func(p *PeerRecord) { p.AllowedIPs = append(p.AllowedIPs, "10.0.0.3/32") }, false},
+		{"tags", func(p *PeerRecord) { p.Tags = nil }, false},
+		{"disabled", func(p *PeerRecord) { p.Disabled = true }, false},
+	}
+	for _, tt := range tests {
+		p := base
+		p.AllowedIPs, p.Tags = append([]string(nil), base.AllowedIPs...), append([]string(nil), base.Tags...)
+		tt.modify(&p)
+		if got := peerRecordEqual(base, p); got != tt.equal {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.equal)
+		}
+	}
+}
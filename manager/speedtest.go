@@ -0,0 +1,664 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// speedtest.go - 隧道内吞吐测试 POST /api/peers/{key}/speedtest
+// 客户端模式的守护进程在隧道地址上运行一个小型应答端 (TCP 传输数据，UDP 回显探测包)，
+// 网关连接它分别测下行 (网关 → 设备) 与上行 (设备 → 网关) 速率，测试期间用 UDP 探测测量延迟与抖动，
+// 发送方的 TCP 重传数由各自的内核给出。用于区分设备自身链路 (如 4G) 与网关的瓶颈。
+
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSpeedtestPort        = 8092
+	defaultSpeedtestDuration    = 5 * time.Second  // 每个方向的默认时长
+	defaultSpeedtestMaxDuration = 10 * time.Second // 每个方向的时长上限
+	defaultSpeedtestMaxBytes    = 100 << 20        // 每个方向的字节数上限
+	speedtestChunk              = 64 << 10         // 数据帧负载大小
+	speedtestGrace              = 10 * time.Second // 连接整体超时 = 时长 + 余量 (握手、排空队列)
+	speedtestProbeInterval      = 100 * time.Millisecond
+	speedtestProbeWait          = 500 * time.Millisecond // 停止探测后等待迟到回复的时间
+	speedtestVersion            = 1
+
+	SpeedtestDownload = "download" // 网关 → 设备
+	SpeedtestUpload   = "upload"   // 设备 → 网关
+	SpeedtestBoth     = "both"
+)
+
+// speedtestMagic UDP 探测包前缀，应答端只回显带该前缀的 16 字节包
+var speedtestMagic = [4]byte{'W', 'G', 'S', 'T'}
+
+// SpeedtestConfig 隧道内吞吐测试
+// 网关与客户端使用同一组设置：网关据此限制请求，应答端据此限制接受的测试
+type SpeedtestConfig struct {
+	Disabled    bool   `json:"disabled,omitempty"`     // 客户端模式下不启动应答端，修改后需重启
+	Port        uint16 `json:"port,omitempty"`         // 应答端口 (TCP 与 UDP，只监听隧道地址)，默认 8092，修改后需重启
+	MaxDuration int    `json:"max_duration,omitempty"` // 每个方向的最长时长 (秒)，默认 10
+	MaxBytes    int64  `json:"max_bytes,omitempty"`    // 每个方向的最大字节数，默认 100 MiB
+}
+
+func (c *SpeedtestConfig) port() uint16 {
+	if c.Port == 0 {
+		return defaultSpeedtestPort
+	}
+	return c.Port
+}
+
+func (c *SpeedtestConfig) maxDuration() time.Duration {
+	if c.MaxDuration <= 0 {
+		return defaultSpeedtestMaxDuration
+	}
+	return time.Duration(c.MaxDuration) * time.Second
+}
+
+func (c *SpeedtestConfig) maxBytes() int64 {
+	if c.MaxBytes <= 0 {
+		return defaultSpeedtestMaxBytes
+	}
+	return c.MaxBytes
+}
+
+// speedtestConfig 返回当前的吞吐测试设置
+func (ui *WebUI) speedtestConfig() SpeedtestConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return ui.config.System.Speedtest
+}
+
+// SpeedtestRequest 吞吐测试参数，字段留空使用默认值
+type SpeedtestRequest struct {
+	Direction string `json:"direction,omitempty"` // both (默认) / download / upload
+	Duration  int    `json:"duration,omitempty"`  // 每个方向的时长 (秒)，默认 5，不超过 speedtest.max_duration
+	MaxBytes  int64  `json:"max_bytes,omitempty"` // 每个方向的最大字节数，不超过 speedtest.max_bytes
+}
+
+// SpeedtestResult 吞吐测试结果
+type SpeedtestResult struct {
+	PublicKey string              `json:"public_key"`
+	Target    string              `json:"target"` // 应答端地址 (隧道地址:端口)
+	Started   time.Time           `json:"started"`
+	Download  *SpeedtestDirection `json:"download,omitempty"` // 网关 → 设备
+	Upload    *SpeedtestDirection `json:"upload,omitempty"`   // 设备 → 网关
+}
+
+// SpeedtestDirection 单个方向的结果，速率由接收方从首个到最后一个数据帧计时
+type SpeedtestDirection struct {
+	Bytes         int64   `json:"bytes"`
+	Duration      float64 `json:"duration"` // 秒
+	BitsPerSecond float64 `json:"bits_per_second"`
+	Retransmits   *uint32 `json:"retransmits,omitempty"` // 发送方的 TCP 重传段数，平台或协议栈不支持时省略
+	Probes        int     `json:"probes"`                // 测试期间发送的 UDP 探测数
+	Latency       float64 `json:"latency"`               // 探测的平均 RTT (毫秒)，反映满载时的排队延迟
+	Jitter        float64 `json:"jitter"`                // 相邻探测 RTT 差的平均值 (毫秒)
+	ProbeLoss     float64 `json:"probe_loss"`            // 探测丢失率 (0~1)
+	Limited       bool    `json:"limited,omitempty"`     // 达到字节上限提前结束
+	Error         string  `json:"error,omitempty"`
+}
+
+// ========== 协议 ==========
+//
+// 每个方向一条 TCP 连接：
+//  1. 网关发送一行 JSON speedtestHello，应答端回复一行 speedtestHello (生效的上限或错误)
+//  2. 发送方写入数据帧 (4 字节大端长度 + 负载)，长度 0 表示结束
+//  3. 接收方回复一行 speedtestReport (字节数与计时)，发送方再回复一行 speedtestReport (重传数)
+
+// speedtestHello 测试请求与应答
+type speedtestHello struct {
+	Version   int    `json:"version"`
+	Direction string `json:"direction"`
+	Duration  int64  `json:"duration_ms"`
+	MaxBytes  int64  `json:"max_bytes"`
+	Error     string `json:"error,omitempty"`
+}
+
+// speedtestReport 数据传输结束后的统计
+type speedtestReport struct {
+	Bytes       int64   `json:"bytes,omitempty"`
+	Duration    int64   `json:"duration_us,omitempty"`
+	Retransmits *uint32 `json:"retransmits,omitempty"`
+}
+
+func writeJSONLine(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// readJSONLine 读取一行 JSON，行长受 bufio.Reader 缓冲区限制
+func readJSONLine(r *bufio.Reader, v any) error {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(line, v)
+}
+
+// writeFrames 持续写入数据帧，直到 deadline 或达到 maxBytes，最后写入结束帧
+func writeFrames(w io.Writer, deadline time.Time, maxBytes int64) (int64, error) {
+	buf := make([]byte, 4+speedtestChunk)
+	for i := 4; i < len(buf); i++ {
+		buf[i] = byte(i)
+	}
+	var sent int64
+	for sent < maxBytes && time.Now().Before(deadline) {
+		n := int(min(int64(speedtestChunk), maxBytes-sent))
+		binary.BigEndian.PutUint32(buf, uint32(n))
+		if _, err := w.Write(buf[:4+n]); err != nil {
+			return sent, err
+		}
+		sent += int64(n)
+	}
+	binary.BigEndian.PutUint32(buf, 0)
+	_, err := w.Write(buf[:4])
+	return sent, err
+}
+
+// readFrames 读取数据帧直到结束帧，返回字节数与从首个数据帧到结束帧的时长
+func readFrames(r io.Reader, maxBytes int64) (int64, time.Duration, error) {
+	var hdr [4]byte
+	var received int64
+	var start time.Time
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return received, 0, err
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[:]))
+		if n == 0 {
+			if start.IsZero() {
+				return 0, 0, nil
+			}
+			return received, time.Since(start), nil
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+		if n > speedtestChunk || received+n > maxBytes {
+			return received, 0, errors.New("frame exceeds limits")
+		}
+		if _, err := io.CopyN(io.Discard, r, n); err != nil {
+			return received, 0, err
+		}
+		received += n
+	}
+}
+
+// ========== 应答端 (客户端模式) ==========
+
+// runSpeedtestResponder 客户端模式下在隧道地址上运行应答端
+// 隧道地址可能尚未配置到网卡上 (例如刚入驻)，监听失败时定期重试
+func (ui *WebUI) runSpeedtestResponder() {
+	logged := false
+	for {
+		configLock.RLock()
+		sys := ui.config.System
+		configLock.RUnlock()
+		if sys.IsClient && !sys.Speedtest.Disabled {
+			err := ui.serveSpeedtest(&sys)
+			if err == nil {
+				return
+			}
+			if !logged {
+				ui.device.GetLogger().Errorf("Speedtest responder listen failed, retrying: %v", err)
+				logged = true
+			}
+		}
+		select {
+		case <-ui.done:
+			return
+		case <-time.After(adminListenRetry):
+		}
+	}
+}
+
+// serveSpeedtest 监听隧道地址并处理测试，直到 WebUI 停止
+func (ui *WebUI) serveSpeedtest(sys *SystemConfig) error {
+	addr, err := sys.tunnelAddr()
+	if err != nil {
+		return err
+	}
+	ap := netip.AddrPortFrom(addr, sys.Speedtest.port()).String()
+	ln, err := net.Listen("tcp", ap)
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", ap)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	ui.device.GetLogger().Verbosef("Speedtest responder listening on %s", ap)
+	go func() {
+		<-ui.done
+		ln.Close()
+		pc.Close()
+	}()
+	ui.acceptSpeedtest(ln, pc)
+	return nil
+}
+
+// acceptSpeedtest 处理测试连接与探测包，直到监听关闭
+func (ui *WebUI) acceptSpeedtest(ln net.Listener, pc net.PacketConn) {
+	go ui.echoSpeedtestProbes(pc)
+
+	var busy atomic.Bool // 同一时间只进行一个测试
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		if !ui.fromTunnel(conn.RemoteAddr()) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			if !busy.CompareAndSwap(false, true) {
+				writeJSONLine(conn, speedtestHello{Version: speedtestVersion, Error: "busy"})
+				return
+			}
+			defer busy.Store(false)
+			if err := ui.respondSpeedtest(conn); err != nil {
+				ui.device.GetLogger().Verbosef("Speedtest with %s failed: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// fromTunnel 来源地址属于某个 Peer 的 AllowedIPs，即经由隧道到达
+func (ui *WebUI) fromTunnel(a net.Addr) bool {
+	var addr netip.Addr
+	switch v := a.(type) {
+	case *net.TCPAddr:
+		addr = v.AddrPort().Addr()
+	case *net.UDPAddr:
+		addr = v.AddrPort().Addr()
+	}
+	addr = addr.Unmap()
+	return addr.IsValid() && ui.device.GetAllowedIPs().Lookup(addr.AsSlice()) != nil
+}
+
+// respondSpeedtest 处理一个方向的测试，时长与字节数按本机设置截断
+func (ui *WebUI) respondSpeedtest(conn net.Conn) error {
+	conf := ui.speedtestConfig()
+	conn.SetDeadline(time.Now().Add(conf.maxDuration() + speedtestGrace))
+	br := bufio.NewReaderSize(conn, 4096)
+
+	var req speedtestHello
+	if err := readJSONLine(br, &req); err != nil {
+		return err
+	}
+	resp := speedtestHello{
+		Version:   speedtestVersion,
+		Direction: req.Direction,
+		Duration:  min(req.Duration, conf.maxDuration().Milliseconds()),
+		MaxBytes:  min(req.MaxBytes, conf.maxBytes()),
+	}
+	switch {
+	case req.Version != speedtestVersion:
+		resp.Error = fmt.Sprintf("unsupported version %d", req.Version)
+	case req.Direction != SpeedtestDownload && req.Direction != SpeedtestUpload:
+		resp.Error = fmt.Sprintf("invalid direction %q", req.Direction)
+	case resp.Duration <= 0 || resp.MaxBytes <= 0:
+		resp.Error = "invalid limits"
+	}
+	if err := writeJSONLine(conn, resp); err != nil || resp.Error != "" {
+		return err
+	}
+
+	if resp.Direction == SpeedtestDownload {
+		n, d, err := readFrames(br, resp.MaxBytes)
+		if err != nil {
+			return err
+		}
+		return writeJSONLine(conn, speedtestReport{Bytes: n, Duration: d.Microseconds()})
+	}
+	deadline := time.Now().Add(time.Duration(resp.Duration) * time.Millisecond)
+	if _, err := writeFrames(conn, deadline, resp.MaxBytes); err != nil {
+		return err
+	}
+	// 接收方的统计到达时数据已全部确认，此时的重传数是完整的
+	var report speedtestReport
+	if err := readJSONLine(br, &report); err != nil {
+		return err
+	}
+	retrans, ok := tcpRetransmits(conn)
+	if !ok {
+		return writeJSONLine(conn, speedtestReport{})
+	}
+	return writeJSONLine(conn, speedtestReport{Retransmits: &retrans})
+}
+
+// echoSpeedtestProbes 原样回显经由隧道到达的 UDP 探测包
+func (ui *WebUI) echoSpeedtestProbes(pc net.PacketConn) {
+	buf := make([]byte, 64)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n == 16 && [4]byte(buf[:4]) == speedtestMagic && ui.fromTunnel(from) {
+			pc.WriteTo(buf[:n], from)
+		}
+	}
+}
+
+// ========== 网关 ==========
+
+// speedtestDial 连接设备上的应答端：有 netstack 管理地址时从隧道内部发出，否则使用主机网络
+func (ui *WebUI) speedtestDial(ctx context.Context, network string, target netip.AddrPort) (net.Conn, error) {
+	if a := ui.adminNet; a != nil && a.addr.Is4() == target.Addr().Is4() {
+		if network == "tcp" {
+			conn, err := a.net.DialContextTCPAddrPort(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			return conn, nil
+		}
+		conn, err := a.net.DialUDPAddrPort(netip.AddrPortFrom(a.addr, 0), target)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, target.String())
+}
+
+// runSpeedtest 依次测试请求的方向
+func (ui *WebUI) runSpeedtest(ctx context.Context, target netip.AddrPort, direction string, duration time.Duration, maxBytes int64) SpeedtestResult {
+	res := SpeedtestResult{Target: target.String(), Started: time.Now()}
+	if direction == SpeedtestBoth || direction == SpeedtestDownload {
+		d := ui.speedtestDirection(ctx, target, SpeedtestDownload, duration, maxBytes)
+		res.Download = &d
+	}
+	if direction == SpeedtestBoth || direction == SpeedtestUpload {
+		d := ui.speedtestDirection(ctx, target, SpeedtestUpload, duration, maxBytes)
+		res.Upload = &d
+	}
+	return res
+}
+
+// speedtestDirection 测试一个方向，测试期间同时发送 UDP 探测
+func (ui *WebUI) speedtestDirection(ctx context.Context, target netip.AddrPort, direction string, duration time.Duration, maxBytes int64) SpeedtestDirection {
+	var res SpeedtestDirection
+	fail := func(format string, args ...any) SpeedtestDirection {
+		res.Error = fmt.Sprintf(format, args...)
+		return res
+	}
+
+	conn, err := ui.speedtestDial(ctx, "tcp", target)
+	if err != nil {
+		return fail("connect to responder: %v", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(duration + speedtestGrace))
+	br := bufio.NewReaderSize(conn, 4096)
+
+	if err := writeJSONLine(conn, speedtestHello{Version: speedtestVersion, Direction: direction, Duration: duration.Milliseconds(), MaxBytes: maxBytes}); err != nil {
+		return fail("send request: %v", err)
+	}
+	var hello speedtestHello
+	if err := readJSONLine(br, &hello); err != nil {
+		return fail("read responder reply: %v", err)
+	}
+	if hello.Error != "" {
+		return fail("responder: %s", hello.Error)
+	}
+	// 应答端可能按自己的设置缩小上限
+	duration = min(duration, time.Duration(hello.Duration)*time.Millisecond)
+	maxBytes = min(maxBytes, hello.MaxBytes)
+
+	var probes *speedtestProbes
+	if pc, err := ui.speedtestDial(ctx, "udp", target); err == nil {
+		probes = startSpeedtestProbes(pc)
+	}
+
+	var elapsed time.Duration
+	if direction == SpeedtestDownload {
+		if _, err := writeFrames(conn, time.Now().Add(duration), maxBytes); err != nil {
+			probes.stop()
+			return fail("send data: %v", err)
+		}
+		var report speedtestReport
+		if err := readJSONLine(br, &report); err != nil {
+			probes.stop()
+			return fail("read responder report: %v", err)
+		}
+		res.Bytes, elapsed = report.Bytes, time.Duration(report.Duration)*time.Microsecond
+		if retrans, ok := tcpRetransmits(conn); ok {
+			res.Retransmits = &retrans
+		}
+	} else {
+		n, d, err := readFrames(br, maxBytes)
+		if err != nil {
+			probes.stop()
+			return fail("receive data: %v", err)
+		}
+		res.Bytes, elapsed = n, d
+		var report speedtestReport
+		if err := writeJSONLine(conn, speedtestReport{Bytes: n, Duration: d.Microseconds()}); err == nil {
+			if err := readJSONLine(br, &report); err == nil {
+				res.Retransmits = report.Retransmits
+			}
+		}
+	}
+	probes.stop().fill(&res)
+
+	res.Duration = elapsed.Seconds()
+	if elapsed > 0 {
+		res.BitsPerSecond = float64(res.Bytes*8) / elapsed.Seconds()
+	}
+	res.Limited = res.Bytes >= maxBytes
+	return res
+}
+
+// speedtestProbes 测试期间每 100ms 发送一个 UDP 探测 (魔数 + 序号 + 发送时间)，由应答端回显
+type speedtestProbes struct {
+	conn    net.Conn
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	sent    int
+	rtts    map[uint32]time.Duration
+	stopped bool
+}
+
+func startSpeedtestProbes(conn net.Conn) *speedtestProbes {
+	p := &speedtestProbes{conn: conn, done: make(chan struct{}), rtts: make(map[uint32]time.Duration)}
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(speedtestProbeInterval)
+		defer ticker.Stop()
+		var pkt [16]byte
+		copy(pkt[:4], speedtestMagic[:])
+		for seq := uint32(0); ; seq++ {
+			binary.BigEndian.PutUint32(pkt[4:], seq)
+			binary.BigEndian.PutUint64(pkt[8:], uint64(time.Now().UnixNano()))
+			if _, err := conn.Write(pkt[:]); err == nil {
+				p.mu.Lock()
+				p.sent++
+				p.mu.Unlock()
+			}
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		var buf [64]byte
+		for {
+			n, err := conn.Read(buf[:])
+			if err != nil {
+				return
+			}
+			if n != 16 || [4]byte(buf[:4]) != speedtestMagic {
+				continue
+			}
+			sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:])))
+			p.mu.Lock()
+			p.rtts[binary.BigEndian.Uint32(buf[4:])] = time.Since(sentAt)
+			p.mu.Unlock()
+		}
+	}()
+	return p
+}
+
+// stop 停止发送，等待迟到的回复后关闭连接；p 为 nil 时 (UDP 不可用) 什么也不做
+func (p *speedtestProbes) stop() *speedtestProbes {
+	if p == nil || p.stopped {
+		return p
+	}
+	p.stopped = true
+	close(p.done)
+	time.Sleep(speedtestProbeWait)
+	p.conn.Close()
+	p.wg.Wait()
+	return p
+}
+
+// fill 按序号计算平均 RTT、抖动 (相邻 RTT 差的平均值) 与丢失率
+func (p *speedtestProbes) fill(res *SpeedtestDirection) {
+	if p == nil || p.sent == 0 {
+		return
+	}
+	seqs := make([]uint32, 0, len(p.rtts))
+	for seq := range p.rtts {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	var sum, diff float64
+	for i, seq := range seqs {
+		rtt := float64(p.rtts[seq].Microseconds()) / 1000
+		sum += rtt
+		if i > 0 {
+			prev := float64(p.rtts[seqs[i-1]].Microseconds()) / 1000
+			diff += max(rtt-prev, prev-rtt)
+		}
+	}
+	res.Probes = p.sent
+	res.ProbeLoss = float64(p.sent-min(len(seqs), p.sent)) / float64(p.sent)
+	if len(seqs) > 0 {
+		res.Latency = roundMillis(sum / float64(len(seqs)))
+	}
+	if len(seqs) > 1 {
+		res.Jitter = roundMillis(diff / float64(len(seqs)-1))
+	}
+}
+
+// ========== HTTP 接口 ==========
+
+// v1SpeedtestPeer 对在线 Peer 发起吞吐测试，同一时间只进行一个测试
+func (ui *WebUI) v1SpeedtestPeer(w http.ResponseWriter, r *http.Request) (any, error) {
+	var req SpeedtestRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			return nil, err
+		}
+	}
+	conf := ui.speedtestConfig()
+	if req.Direction == "" {
+		req.Direction = SpeedtestBoth
+	}
+	if req.Direction != SpeedtestBoth && req.Direction != SpeedtestDownload && req.Direction != SpeedtestUpload {
+		return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "Invalid direction %q, use both, download or upload", req.Direction)
+	}
+	duration := min(defaultSpeedtestDuration, conf.maxDuration())
+	if req.Duration != 0 {
+		duration = time.Duration(req.Duration) * time.Second
+		if req.Duration < 0 || duration > conf.maxDuration() {
+			return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "duration must be between 1 and %d seconds", int(conf.maxDuration().Seconds()))
+		}
+	}
+	maxBytes := conf.maxBytes()
+	if req.MaxBytes != 0 {
+		if req.MaxBytes < 0 || req.MaxBytes > maxBytes {
+			return nil, apiErrorf(http.StatusBadRequest, ErrCodeBadRequest, "max_bytes must be between 1 and %d", maxBytes)
+		}
+		maxBytes = req.MaxBytes
+	}
+
+	publicKey, err := parsePeerKey(r.PathValue("key"))
+	if err != nil {
+		return nil, err
+	}
+	peer, err := ui.findPeer(currentPrincipal(r), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if peer.Disabled {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer is disabled")
+	}
+	if !peer.IsOnline {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer is offline")
+	}
+	var prefixes []netip.Prefix
+	for _, s := range peer.AllowedIPs {
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	configLock.RLock()
+	subnet, _ := netip.ParsePrefix(ui.config.System.InternalSubnet)
+	configLock.RUnlock()
+	addr := diagnoseTarget(prefixes, subnet)
+	if !addr.IsValid() {
+		return nil, apiErrorf(http.StatusConflict, ErrCodeConflict, "Peer has no tunnel address")
+	}
+
+	select {
+	case ui.speedtestSlot <- struct{}{}:
+		defer func() { <-ui.speedtestSlot }()
+	default:
+		return nil, apiErrorf(http.StatusTooManyRequests, ErrCodeRateLimited, "Another throughput test is running, try again later")
+	}
+	ui.auditRequest(r, AuditSpeedtest, fmt.Sprintf("%s %s %v max %d bytes", publicKey, req.Direction, duration, maxBytes))
+
+	res := ui.runSpeedtest(r.Context(), netip.AddrPortFrom(addr, conf.port()), req.Direction, duration, maxBytes)
+	res.PublicKey = publicKey
+	return res, nil
+}
+
+// handlePeerSpeedtest 处理 POST /api/peers/{key}/speedtest
+func (ui *WebUI) handlePeerSpeedtest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, apiErrorf(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed, use POST"))
+		return
+	}
+	res, err := ui.v1SpeedtestPeer(w, r)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
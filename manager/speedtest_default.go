@@ -0,0 +1,15 @@
+//go:build !linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import "net"
+
+// tcpRetransmits 仅 Linux 支持读取重传数
+func tcpRetransmits(net.Conn) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,205 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSpeedtestFrames(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64 // 发送方上限
+		readMax  int64 // 接收方上限
+		want     int64
+		ok       bool
+	}{
+		{"partial frame", 1000, 1000, 1000, true},
+		{"several frames", 3*speedtestChunk + 7, 4 * speedtestChunk, 3*speedtestChunk + 7, true},
+		{"nothing to send", 0, 1000, 0, true},
+		{"receiver limit", 2 * speedtestChunk, speedtestChunk, speedtestChunk, false},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		sent, err := writeFrames(&buf, time.Now().Add(time.Second), tt.maxBytes)
+		if err != nil || sent != tt.maxBytes {
+			t.Errorf("%s: writeFrames = %d, %v", tt.name, sent, err)
+		}
+		got, _, err := readFrames(&buf, tt.readMax)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%s: readFrames = %d, %v; want %d, ok %v", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+
+	// 超时后只写入结束帧
+	var buf bytes.Buffer
+	if sent, err := writeFrames(&buf, time.Now(), 1<<20); sent != 0 || err != nil || buf.Len() != 4 {
+		t.Errorf("expired deadline: %d, %v, %d bytes", sent, err, buf.Len())
+	}
+	// 截断的数据帧
+	frame := []byte{0, 0, 0, 10, 1, 2, 3}
+	if _, _, err := readFrames(bytes.NewReader(frame), 100); err == nil {
+		t.Error("truncated frame accepted")
+	}
+}
+
+func TestSpeedtestProbesFill(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		sent int
+		rtts map[uint32]time.Duration
+		want SpeedtestDirection
+	}{
+		{"no probes", 0, nil, SpeedtestDirection{}},
+		{"all lost", 4, nil, SpeedtestDirection{Probes: 4, ProbeLoss: 1}},
+		{"ordered by sequence", 4, map[uint32]time.Duration{3: 30 * ms, 0: 10 * ms, 1: 20 * ms}, SpeedtestDirection{Probes: 4, ProbeLoss: 0.25, Latency: 20, Jitter: 10}},
+		{"single reply", 2, map[uint32]time.Duration{0: 1500 * time.Microsecond}, SpeedtestDirection{Probes: 2, ProbeLoss: 0.5, Latency: 1.5}},
+	}
+	for _, tt := range tests {
+		var res SpeedtestDirection
+		p := &speedtestProbes{sent: tt.sent, rtts: tt.rtts}
+		p.fill(&res)
+		if res != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, res, tt.want)
+		}
+	}
+	var res SpeedtestDirection
+	(*speedtestProbes)(nil).stop().fill(&res) // UDP 不可用
+	if res != (SpeedtestDirection{}) {
+		t.Errorf("nil probes: %+v", res)
+	}
+}
+
+// startResponder 在本机回环地址上运行应答端，TCP 与 UDP 使用同一端口
+func (tu *testUI) startResponder() netip.AddrPort {
+	tu.t.Helper()
+	for i := 0; i < 10; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			tu.t.Fatal(err)
+		}
+		pc, err := net.ListenPacket("udp", ln.Addr().String())
+		if err != nil {
+			ln.Close()
+			continue
+		}
+		tu.t.Cleanup(func() {
+			ln.Close()
+			pc.Close()
+		})
+		go tu.acceptSpeedtest(ln, pc)
+		return ln.Addr().(*net.TCPAddr).AddrPort()
+	}
+	tu.t.Fatal("no free port for TCP and UDP")
+	return netip.AddrPort{}
+}
+
+func TestSpeedtestResponder(t *testing.T) {
+	const limit = 256 << 10
+	// 回环地址属于 Peer 的 AllowedIPs，视为经由隧道到达
+	tu := newTestUI(t, func(c *Config) {
+		c.System.Speedtest = SpeedtestConfig{MaxDuration: 1, MaxBytes: limit}
+		c.Peers = []PeerRecord{{PublicKey: testKey(1), AllowedIPs: []string{"127.0.0.1/32"}}}
+	})
+	target := tu.startResponder()
+
+	tests := []struct {
+		name      string
+		direction string
+		maxBytes  int64
+	}{
+		{"download capped by responder", SpeedtestDownload, 1 << 30},
+		{"upload capped by responder", SpeedtestUpload, 1 << 30},
+		{"download capped by request", SpeedtestDownload, 1000},
+	}
+	for _, tt := range tests {
+		d := tu.speedtestDirection(context.Background(), target, tt.direction, 5*time.Second, tt.maxBytes)
+		if d.Error != "" || d.Bytes != min(tt.maxBytes, limit) || !d.Limited || d.BitsPerSecond <= 0 || d.Probes == 0 {
+			t.Errorf("%s: %+v", tt.name, d)
+		}
+	}
+	res := tu.runSpeedtest(context.Background(), target, SpeedtestBoth, time.Second, 1000)
+	if res.Download == nil || res.Upload == nil || res.Download.Error != "" || res.Upload.Error != "" || res.Target != target.String() {
+		t.Errorf("both directions: %+v", res)
+	}
+
+	// 应答端拒绝无法识别的请求
+	for _, hello := range []speedtestHello{
+		{Version: speedtestVersion + 1, Direction: SpeedtestDownload, Duration: 1000, MaxBytes: 1000},
+		{Version: speedtestVersion, Direction: SpeedtestBoth, Duration: 1000, MaxBytes: 1000},
+		{Version: speedtestVersion, Direction: SpeedtestUpload, Duration: 0, MaxBytes: 1000},
+	} {
+		conn, err := net.Dial("tcp", target.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeJSONLine(conn, hello)
+		var resp speedtestHello
+		if err := readJSONLine(bufio.NewReader(conn), &resp); err != nil || resp.Error == "" {
+			t.Errorf("hello %+v: %+v, %v", hello, resp, err)
+		}
+		conn.Close()
+	}
+
+	// 来源不在任何 AllowedIPs 中的连接直接关闭
+	outside := newTestUI(t)
+	d := outside.speedtestDirection(context.Background(), outside.startResponder(), SpeedtestDownload, time.Second, 1000)
+	if d.Error == "" {
+		t.Errorf("connection from outside the tunnel: %+v", d)
+	}
+}
+
+func TestSpeedtestAPI(t *testing.T) {
+	key, camKey := testKey(1), testKey(2)
+	tu := newTestUI(t, func(c *Config) {
+		c.System.Speedtest = SpeedtestConfig{MaxDuration: 5, MaxBytes: 1 << 20}
+		c.Roles = []Role{{Name: "iot-ops", Permissions: []Permission{PermStatusRead, PermPeersWrite}, PeerTags: []string{"iot"}}}
+		c.Peers = []PeerRecord{
+			{PublicKey: key, AllowedIPs: []string{"10.0.0.2/32"}, Tags: []string{"iot"}},
+			{PublicKey: camKey, AllowedIPs: []string{"10.0.0.3/32"}, Tags: []string{"cam"}},
+		}
+	})
+	admin := tu.token("root", RoleAdmin, ScopePeers)
+	reader := tu.token("viewer", RoleViewer, ScopeStatusRead)
+	iot := tu.token("alice", "iot-ops", ScopePeers)
+	path := func(key string) string {
+		return "/api/v1/peers/" + url.PathEscape(key) + "/speedtest"
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"bad direction", admin, path(key), `{"direction":"sideways"}`, http.StatusBadRequest, ErrCodeBadRequest},
+		{"duration over the cap", admin, path(key), `{"duration":6}`, http.StatusBadRequest, ErrCodeBadRequest},
+		{"negative duration", admin, path(key), `{"duration":-1}`, http.StatusBadRequest, ErrCodeBadRequest},
+		{"bytes over the cap", admin, path(key), fmt.Sprintf(`{"max_bytes":%d}`, 1<<20+1), http.StatusBadRequest, ErrCodeBadRequest},
+		{"offline peer", admin, path(key), "", http.StatusConflict, ErrCodeConflict},
+		{"unknown peer", admin, path(testKey(9)), "", http.StatusNotFound, ErrCodeNotFound},
+		{"hidden peer", iot, path(camKey), "", http.StatusNotFound, ErrCodeNotFound},
+		{"read-only token", reader, path(key), "", http.StatusForbidden, ErrCodeInsufficientScope},
+	}
+	for _, tt := range tests {
+		resp, body := tu.bearer(tt.token, http.MethodPost, tt.path, tt.body)
+		if resp.StatusCode != tt.status || errorCode(body) != tt.code {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,709 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// stun.go - STUN (RFC 5389) Binding 应答端与探测
+// 服务端在 stun.port 与 stun.alt_port 上应答 Binding 请求，返回请求方的公网地址 (XOR-MAPPED-ADDRESS)。
+// 探测请求从 WireGuard 监听套接字发出，得到的映射地址就是对端看到的 WireGuard 端点：
+// 客户端模式据此得到自己的公网地址与 NAT 类型，服务端在未配置 public_host / public_port 时据此自动发现。
+
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+const (
+	defaultSTUNPort     = 3478
+	defaultSTUNInterval = 30 * time.Minute
+	stunStartDelay      = 2 * time.Second        // 启动后等待设备就绪再做第一次探测
+	stunRetransmit      = 500 * time.Millisecond // 未收到应答时的重发间隔
+	stunAttempts        = 3                      // 每个服务器的最多发送次数
+	stunSoftware        = "wireguard-go"
+
+	stunHeaderSize     = 20
+	stunMagicCookie    = 0x2112A442
+	stunFingerprintXOR = 0x5354554e
+
+	stunBindingRequest = 0x0001
+	stunBindingSuccess = 0x0101
+	stunBindingError   = 0x0111
+
+	stunAttrMappedAddress     = 0x0001
+	stunAttrErrorCode         = 0x0009
+	stunAttrUnknownAttributes = 0x000A
+	stunAttrXORMappedAddress  = 0x0020
+	stunAttrSoftware          = 0x8022
+	stunAttrFingerprint       = 0x8028
+)
+
+// NAT 类型 (按 RFC 4787 的映射行为划分)
+const (
+	NATNone                = "none"                 // 映射地址就是本机地址与端口，没有 NAT
+	NATEndpointIndependent = "endpoint-independent" // 对不同目的地使用同一映射 (锥形 NAT)，其他 Peer 可按映射地址直连
+	NATEndpointDependent   = "endpoint-dependent"   // 对不同目的地使用不同映射 (对称 NAT)，映射地址只对 STUN 服务器有效
+	NATUnknown             = "unknown"              // 只有一个服务器应答，无法判断映射行为
+	NATBlocked             = "blocked"              // 没有服务器应答 (UDP 被拦截或服务器不可达)
+)
+
+// defaultSTUNServers 服务端自动发现公网地址时默认使用的公共 STUN 服务器
+var defaultSTUNServers = []string{"stun.cloudflare.com:3478", "stun.l.google.com:19302"}
+
+// STUNConfig STUN 应答端与探测
+type STUNConfig struct {
+	Disabled bool     `json:"disabled,omitempty"` // 服务端不启动应答端，修改后需重启
+	Port     uint16   `json:"port,omitempty"`     // 应答端口，默认 3478，修改后需重启
+	AltPort  uint16   `json:"alt_port,omitempty"` // 第二个应答端口，默认 port+1，客户端向两个端口探测以判断 NAT 类型，修改后需重启
+	Servers  []string `json:"servers,omitempty"`  // 探测使用的服务器 (host:port)；客户端默认为上游服务端的 port 与 alt_port，服务端默认为公共 STUN 服务器
+	Interval int      `json:"interval,omitempty"` // 自动探测间隔 (分钟)，0 为默认 30，-1 为关闭
+}
+
+func (c *STUNConfig) port() uint16 {
+	if c.Port == 0 {
+		return defaultSTUNPort
+	}
+	return c.Port
+}
+
+func (c *STUNConfig) altPort() uint16 {
+	if c.AltPort == 0 {
+		return c.port() + 1
+	}
+	return c.AltPort
+}
+
+// interval 返回生效的自动探测间隔，0 表示关闭
+func (c *STUNConfig) interval() time.Duration {
+	switch {
+	case c.Interval < 0:
+		return 0
+	case c.Interval == 0:
+		return defaultSTUNInterval
+	}
+	return time.Duration(c.Interval) * time.Minute
+}
+
+// stunServers 返回探测使用的服务器
+func (c *Config) stunServers() []string {
+	if len(c.System.STUN.Servers) > 0 {
+		return c.System.STUN.Servers
+	}
+	if !c.System.IsClient {
+		return defaultSTUNServers
+	}
+	// 客户端向上游服务端的两个应答端口探测，上游的端口设置需与本机一致
+	for _, p := range c.Peers {
+		host, _, err := net.SplitHostPort(p.Endpoint)
+		if err != nil || host == "" {
+			continue
+		}
+		return []string{
+			net.JoinHostPort(host, strconv.Itoa(int(c.System.STUN.port()))),
+			net.JoinHostPort(host, strconv.Itoa(int(c.System.STUN.altPort()))),
+		}
+	}
+	return nil
+}
+
+// STUNServerResult 单个服务器的探测结果
+type STUNServerResult struct {
+	Server string  `json:"server"`           // 配置的地址
+	Addr   string  `json:"addr,omitempty"`   // 解析后的地址
+	Mapped string  `json:"mapped,omitempty"` // 服务器看到的本机地址
+	RTT    float64 `json:"rtt,omitempty"`    // 毫秒
+	Error  string  `json:"error,omitempty"`
+}
+
+// STUNResult 一次探测的结果
+type STUNResult struct {
+	LocalPort     uint16             `json:"local_port"`       // 探测的源端口 (守护进程中为 WireGuard 监听端口)
+	Mapped        string             `json:"mapped,omitempty"` // 公网映射地址，取第一个应答的服务器
+	NATType       string             `json:"nat_type"`
+	PortPreserved bool               `json:"port_preserved"` // 映射端口与本机端口相同
+	Servers       []STUNServerResult `json:"servers"`
+}
+
+// STUNStatus GET /api/v1/stun
+type STUNStatus struct {
+	Mode           string      `json:"mode"`                      // client / server
+	Responder      []string    `json:"responder,omitempty"`       // 本机应答端的监听地址
+	PublicEndpoint string      `json:"public_endpoint,omitempty"` // 服务端：新客户端使用的 WireGuard 地址
+	Discovered     bool        `json:"discovered,omitempty"`      // 服务端：public_endpoint 含有 STUN 发现的部分
+	Checked        *time.Time  `json:"checked,omitempty"`         // 最近一次探测时间，从未探测时省略
+	Result         *STUNResult `json:"result,omitempty"`
+	Error          string      `json:"error,omitempty"` // 最近一次探测无法进行的原因 (如没有可用的服务器)
+}
+
+// stunState 运行时状态：应答端、进行中的探测与最近一次结果
+type stunState struct {
+	prober    stunProber
+	mu        sync.Mutex
+	responder []string
+	checked   time.Time
+	result    *STUNResult
+	err       string
+}
+
+// ========== 报文 ==========
+
+// stunAttr 报文属性
+type stunAttr struct {
+	typ   uint16
+	value []byte
+}
+
+// stunMessage 解析后的报文
+type stunMessage struct {
+	typ   uint16
+	txID  [12]byte
+	attrs []stunAttr
+}
+
+// isSTUN 快速判断报文是否为 STUN：首两位为 0、魔数匹配、长度一致
+func isSTUN(b []byte) bool {
+	return len(b) >= stunHeaderSize && b[0]&0xC0 == 0 &&
+		binary.BigEndian.Uint32(b[4:]) == stunMagicCookie &&
+		int(binary.BigEndian.Uint16(b[2:]))+stunHeaderSize == len(b)
+}
+
+func parseSTUN(b []byte) (stunMessage, error) {
+	var m stunMessage
+	if !isSTUN(b) {
+		return m, errors.New("not a STUN message")
+	}
+	m.typ = binary.BigEndian.Uint16(b)
+	copy(m.txID[:], b[8:stunHeaderSize])
+	for rest := b[stunHeaderSize:]; len(rest) > 0; {
+		if len(rest) < 4 {
+			return m, errors.New("truncated attribute")
+		}
+		typ, n := binary.BigEndian.Uint16(rest), int(binary.BigEndian.Uint16(rest[2:]))
+		if 4+n > len(rest) {
+			return m, errors.New("truncated attribute")
+		}
+		m.attrs = append(m.attrs, stunAttr{typ, rest[4 : 4+n]})
+		rest = rest[min(len(rest), 4+(n+3)&^3):] // 属性按 4 字节对齐
+	}
+	return m, nil
+}
+
+func (m *stunMessage) attr(typ uint16) ([]byte, bool) {
+	for _, a := range m.attrs {
+		if a.typ == typ {
+			return a.value, true
+		}
+	}
+	return nil, false
+}
+
+// buildSTUN 编码报文，末尾附加 FINGERPRINT
+func buildSTUN(typ uint16, txID [12]byte, attrs ...stunAttr) []byte {
+	b := make([]byte, stunHeaderSize, 128)
+	binary.BigEndian.PutUint16(b, typ)
+	binary.BigEndian.PutUint32(b[4:], stunMagicCookie)
+	copy(b[8:], txID[:])
+	for _, a := range attrs {
+		b = binary.BigEndian.AppendUint16(b, a.typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.value)))
+		b = append(b, a.value...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+	}
+	// FINGERPRINT 的 CRC 覆盖到它之前的内容，但消息长度须已包含它自己
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-stunHeaderSize+8))
+	crc := crc32.ChecksumIEEE(b) ^ stunFingerprintXOR
+	b = binary.BigEndian.AppendUint16(b, stunAttrFingerprint)
+	b = binary.BigEndian.AppendUint16(b, 4)
+	return binary.BigEndian.AppendUint32(b, crc)
+}
+
+// stunAddr 编码 (XOR-)MAPPED-ADDRESS
+func stunAddr(ap netip.AddrPort, txID [12]byte, xor bool) []byte {
+	ip := ap.Addr().Unmap().AsSlice()
+	family := byte(0x01)
+	if len(ip) == net.IPv6len {
+		family = 0x02
+	}
+	b := []byte{0, family, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], ap.Port())
+	b = append(b, ip...)
+	if xor {
+		xorSTUNAddr(b, txID)
+	}
+	return b
+}
+
+// parseSTUNAddr 解码 (XOR-)MAPPED-ADDRESS
+func parseSTUNAddr(v []byte, txID [12]byte, xor bool) (netip.AddrPort, error) {
+	if len(v) != 8 && len(v) != 20 {
+		return netip.AddrPort{}, errors.New("invalid address attribute")
+	}
+	b := slices.Clone(v)
+	if xor {
+		xorSTUNAddr(b, txID)
+	}
+	addr, ok := netip.AddrFromSlice(b[4:])
+	if !ok || (b[1] == 0x01) != addr.Is4() {
+		return netip.AddrPort{}, errors.New("invalid address attribute")
+	}
+	return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(b[2:])), nil
+}
+
+// xorSTUNAddr 端口与魔数高 16 位异或，地址与魔数 (IPv6 再加事务 ID) 异或
+func xorSTUNAddr(b []byte, txID [12]byte) {
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[:], stunMagicCookie)
+	copy(key[4:], txID[:])
+	b[2] ^= key[0]
+	b[3] ^= key[1]
+	for i := 4; i < len(b); i++ {
+		b[i] ^= key[i-4]
+	}
+}
+
+// stunReply 生成对 Binding 请求的应答，非请求或无法解析时返回 nil
+// 请求中带有无法理解的必选属性 (类型小于 0x8000) 时按 RFC 5389 返回 420 错误
+func stunReply(packet []byte, src netip.AddrPort) []byte {
+	m, err := parseSTUN(packet)
+	if err != nil || m.typ != stunBindingRequest {
+		return nil
+	}
+	var unknown []byte
+	for _, a := range m.attrs {
+		if a.typ < 0x8000 {
+			unknown = binary.BigEndian.AppendUint16(unknown, a.typ)
+		}
+	}
+	if unknown != nil {
+		reason := []byte{0, 0, 4, 20}
+		reason = append(reason, "Unknown Attribute"...)
+		return buildSTUN(stunBindingError, m.txID,
+			stunAttr{stunAttrErrorCode, reason},
+			stunAttr{stunAttrUnknownAttributes, unknown},
+			stunAttr{stunAttrSoftware, []byte(stunSoftware)})
+	}
+	src = netip.AddrPortFrom(src.Addr().Unmap(), src.Port())
+	return buildSTUN(stunBindingSuccess, m.txID,
+		stunAttr{stunAttrXORMappedAddress, stunAddr(src, m.txID, true)},
+		stunAttr{stunAttrMappedAddress, stunAddr(src, m.txID, false)},
+		stunAttr{stunAttrSoftware, []byte(stunSoftware)})
+}
+
+// ========== 应答端 ==========
+
+// startSTUNServer 服务端模式下在 port 与 alt_port 上运行应答端，端口被占用时记录错误，不影响启动
+func (ui *WebUI) startSTUNServer() {
+	configLock.RLock()
+	sys := ui.config.System
+	configLock.RUnlock()
+	if sys.IsClient || sys.STUN.Disabled {
+		return
+	}
+	for _, port := range []uint16{sys.STUN.port(), sys.STUN.altPort()} {
+		pc, err := net.ListenPacket("udp", ":"+strconv.Itoa(int(port)))
+		if err != nil {
+			ui.device.GetLogger().Errorf("STUN server listen on :%d failed: %v", port, err)
+			continue
+		}
+		ui.device.GetLogger().Verbosef("STUN server listening on %s", pc.LocalAddr())
+		ui.stun.mu.Lock()
+		ui.stun.responder = append(ui.stun.responder, pc.LocalAddr().String())
+		ui.stun.mu.Unlock()
+		go func() {
+			<-ui.done
+			pc.Close()
+		}()
+		go serveSTUN(pc)
+	}
+}
+
+// serveSTUN 应答 Binding 请求直到 pc 关闭
+func serveSTUN(pc net.PacketConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		udp, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		if reply := stunReply(buf[:n], udp.AddrPort()); reply != nil {
+			pc.WriteTo(reply, from)
+		}
+	}
+}
+
+// ========== 探测 ==========
+
+// stunProber 按事务 ID 把应答交给等待中的探测
+type stunProber struct {
+	mu      sync.Mutex
+	pending map[[12]byte]chan netip.AddrPort
+}
+
+// deliver 处理收到的报文，是等待中的应答时返回 true
+func (p *stunProber) deliver(packet []byte) bool {
+	if !isSTUN(packet) {
+		return false
+	}
+	m, err := parseSTUN(packet)
+	if err != nil || m.typ != stunBindingSuccess {
+		return false
+	}
+	p.mu.Lock()
+	ch, ok := p.pending[m.txID]
+	p.mu.Unlock()
+	if !ok {
+		return false
+	}
+	var mapped netip.AddrPort
+	if v, ok := m.attr(stunAttrXORMappedAddress); ok {
+		mapped, err = parseSTUNAddr(v, m.txID, true)
+	} else if v, ok := m.attr(stunAttrMappedAddress); ok {
+		mapped, err = parseSTUNAddr(v, m.txID, false)
+	} else {
+		err = errors.New("no mapped address")
+	}
+	if err != nil {
+		return true
+	}
+	select {
+	case ch <- mapped:
+	default:
+	}
+	return true
+}
+
+// probe 向各服务器并发发送 Binding 请求并判断 NAT 类型
+func (p *stunProber) probe(ctx context.Context, send func([]byte, netip.AddrPort) error, servers []string, localPort uint16) STUNResult {
+	res := STUNResult{LocalPort: localPort, Servers: make([]STUNServerResult, len(servers))}
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.Servers[i] = p.probeOne(ctx, send, server)
+		}()
+	}
+	wg.Wait()
+	classifyNAT(&res)
+	return res
+}
+
+func (p *stunProber) probeOne(ctx context.Context, send func([]byte, netip.AddrPort) error, server string) STUNServerResult {
+	r := STUNServerResult{Server: server}
+	dst, err := resolveSTUNServer(ctx, server)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Addr = dst.String()
+
+	var txID [12]byte
+	rand.Read(txID[:])
+	ch := make(chan netip.AddrPort, 1)
+	p.mu.Lock()
+	if p.pending == nil {
+		p.pending = make(map[[12]byte]chan netip.AddrPort)
+	}
+	p.pending[txID] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, txID)
+		p.mu.Unlock()
+	}()
+
+	req := buildSTUN(stunBindingRequest, txID, stunAttr{stunAttrSoftware, []byte(stunSoftware)})
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for attempt := 0; ; attempt++ {
+		select {
+		case mapped := <-ch:
+			r.Mapped = mapped.String()
+			r.RTT = roundMillis(float64(time.Since(start).Microseconds()) / 1000)
+			return r
+		case <-ctx.Done():
+			r.Error = ctx.Err().Error()
+			return r
+		case <-timer.C:
+			if attempt == stunAttempts {
+				r.Error = "no response"
+				return r
+			}
+			if err := send(req, dst); err != nil {
+				r.Error = err.Error()
+				return r
+			}
+			timer.Reset(stunRetransmit)
+		}
+	}
+}
+
+// resolveSTUNServer 解析服务器地址，优先 IPv4
+func resolveSTUNServer(ctx context.Context, server string) (netip.AddrPort, error) {
+	host, portStr, err := net.SplitHostPort(server)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid port %q", portStr)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	addr := addrs[0]
+	for _, a := range addrs {
+		if a.Unmap().Is4() {
+			addr = a
+			break
+		}
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
+
+// classifyNAT 比较各服务器看到的映射地址：相同为与目的地无关的映射，不同为与目的地相关的映射 (对称 NAT)
+// 同一解析地址只计一次，只比较与第一个映射同一地址族的结果；映射地址是本机网卡地址且端口不变时判定为没有 NAT
+func classifyNAT(res *STUNResult) {
+	seen := make(map[string]bool)
+	var mapped []netip.AddrPort
+	for _, s := range res.Servers {
+		if s.Mapped == "" || seen[s.Addr] {
+			continue
+		}
+		seen[s.Addr] = true
+		ap, err := netip.ParseAddrPort(s.Mapped)
+		if err == nil && (len(mapped) == 0 || ap.Addr().Is4() == mapped[0].Addr().Is4()) {
+			mapped = append(mapped, ap)
+		}
+	}
+	if len(mapped) == 0 {
+		res.NATType = NATBlocked
+		return
+	}
+	res.Mapped = mapped[0].String()
+	res.PortPreserved = mapped[0].Port() == res.LocalPort
+	switch {
+	case res.PortPreserved && isLocalAddr(mapped[0].Addr()):
+		res.NATType = NATNone
+	case len(mapped) < 2:
+		res.NATType = NATUnknown
+	case slices.ContainsFunc(mapped[1:], func(ap netip.AddrPort) bool { return ap != mapped[0] }):
+		res.NATType = NATEndpointDependent
+	default:
+		res.NATType = NATEndpointIndependent
+	}
+}
+
+// isLocalAddr 地址属于本机网卡
+func isLocalAddr(addr netip.Addr) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			if ip, ok := netip.AddrFromSlice(n.IP); ok && ip.Unmap() == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProbeSTUN 从 pc 向各服务器探测公网映射与 NAT 类型，不依赖守护进程，供命令行单独测试
+func ProbeSTUN(ctx context.Context, pc net.PacketConn, servers []string) STUNResult {
+	var p stunProber
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			p.deliver(buf[:n])
+		}
+	}()
+	var localPort uint16
+	if udp, ok := pc.LocalAddr().(*net.UDPAddr); ok {
+		localPort = uint16(udp.Port)
+	}
+	return p.probe(ctx, func(b []byte, dst netip.AddrPort) error {
+		_, err := pc.WriteTo(b, net.UDPAddrFromAddrPort(dst))
+		return err
+	}, servers, localPort)
+}
+
+// ========== 守护进程 ==========
+
+// startSTUN 注册 WireGuard 端口上的应答处理，启动应答端与自动探测
+func (ui *WebUI) startSTUN() {
+	ui.device.SetStrayPacketHandler(func(packet []byte, _ conn.Endpoint) {
+		ui.stun.prober.deliver(packet)
+	})
+	ui.startSTUNServer()
+	go ui.runSTUN()
+}
+
+// runSTUN 按间隔自动探测：客户端始终探测，服务端只在 public_host 或 public_port 未配置时探测
+func (ui *WebUI) runSTUN() {
+	timer := time.NewTimer(stunStartDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ui.done:
+			return
+		case <-timer.C:
+		}
+		configLock.RLock()
+		sys := ui.config.System
+		configLock.RUnlock()
+		interval := sys.STUN.interval()
+		if interval == 0 {
+			return
+		}
+		if sys.IsClient || sys.PublicHost == "" || sys.PublicPort == 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			ui.probeSTUN(ctx)
+			cancel()
+		}
+		timer.Reset(interval)
+	}
+}
+
+// probeSTUN 从 WireGuard 监听端口探测一次并保存结果，映射地址或 NAT 类型变化时发布事件
+func (ui *WebUI) probeSTUN(ctx context.Context) STUNStatus {
+	configLock.RLock()
+	servers := ui.config.stunServers()
+	configLock.RUnlock()
+
+	var res *STUNResult
+	var errMsg string
+	if len(servers) == 0 {
+		errMsg = "no STUN servers: set stun.servers or enroll with a server first"
+	} else {
+		r := ui.stun.prober.probe(ctx, ui.device.SendRaw, servers, ui.device.GetListenPort())
+		res = &r
+	}
+
+	ui.stun.mu.Lock()
+	prev := ui.stun.result
+	ui.stun.checked, ui.stun.result, ui.stun.err = time.Now(), res, errMsg
+	ui.stun.mu.Unlock()
+
+	if res != nil && (prev == nil || prev.Mapped != res.Mapped || prev.NATType != res.NATType) {
+		ui.device.GetLogger().Verbosef("STUN: public endpoint %s, NAT %s", orNone(res.Mapped), res.NATType)
+		ui.events.Publish(Event{Type: EventPublicEndpoint, Detail: fmt.Sprintf("%s (%s)", orNone(res.Mapped), res.NATType)})
+	}
+	return ui.stunStatus()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// discoveredEndpoint 自动发现的公网地址：端口映射的外部地址优先，其次为 STUN 映射地址
+func (ui *WebUI) discoveredEndpoint() (netip.AddrPort, bool) {
+	if ap, ok := ui.mappedEndpoint(); ok {
+		return ap, true
+	}
+	ui.stun.mu.Lock()
+	defer ui.stun.mu.Unlock()
+	if ui.stun.result == nil {
+		return netip.AddrPort{}, false
+	}
+	ap, err := netip.ParseAddrPort(ui.stun.result.Mapped)
+	return ap, err == nil
+}
+
+// publicEndpoint 新客户端使用的服务端 WireGuard 地址
+// 配置的 public_host / public_port 优先，其次为端口映射或 STUN 发现的地址，最后为请求的 Host 与本机监听端口
+func (ui *WebUI) publicEndpoint(r *http.Request) (endpoint string, discovered bool) {
+	configLock.RLock()
+	host, port, isClient := ui.config.System.PublicHost, ui.config.System.PublicPort, ui.config.System.IsClient
+	configLock.RUnlock()
+	if ap, ok := ui.discoveredEndpoint(); ok && !isClient {
+		if host == "" {
+			host, discovered = ap.Addr().String(), true
+		}
+		if port == 0 {
+			port, discovered = ap.Port(), true
+		}
+	}
+	if host == "" {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	if port == 0 {
+		port = ui.device.GetListenPort()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), discovered
+}
+
+// stunStatus 返回应答端与最近一次探测的状态
+func (ui *WebUI) stunStatus() STUNStatus {
+	configLock.RLock()
+	isClient := ui.config.System.IsClient
+	configLock.RUnlock()
+	st := STUNStatus{Mode: "server"}
+	if isClient {
+		st.Mode = "client"
+	}
+	ui.stun.mu.Lock()
+	st.Responder = slices.Clone(ui.stun.responder)
+	if !ui.stun.checked.IsZero() {
+		checked := ui.stun.checked
+		st.Checked = &checked
+	}
+	st.Result, st.Error = ui.stun.result, ui.stun.err
+	ui.stun.mu.Unlock()
+	return st
+}
+
+// ========== HTTP 接口 ==========
+
+func (ui *WebUI) v1STUN(w http.ResponseWriter, r *http.Request) (any, error) {
+	st := ui.stunStatus()
+	if st.Mode == "server" {
+		st.PublicEndpoint, st.Discovered = ui.publicEndpoint(r)
+	}
+	return st, nil
+}
+
+// v1ProbeSTUN 立即探测一次
+func (ui *WebUI) v1ProbeSTUN(w http.ResponseWriter, r *http.Request) (any, error) {
+	st := ui.probeSTUN(r.Context())
+	if st.Mode == "server" {
+		st.PublicEndpoint, st.Discovered = ui.publicEndpoint(r)
+	}
+	return st, nil
+}
@@ -0,0 +1,240 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSTUNMessage(t *testing.T) {
+	txID := [12]byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+	b := buildSTUN(stunBindingRequest, txID, stunAttr{stunAttrSoftware, []byte("abc")})
+	m, err := parseSTUN(b)
+	if err != nil || m.typ != stunBindingRequest || m.txID != txID {
+		t.Fatalf("parseSTUN = %+v, %v", m, err)
+	}
+	if v, ok := m.attr(stunAttrSoftware); !ok || string(v) != "abc" {
+		t.Errorf("SOFTWARE = %q, %v", v, ok)
+	}
+	// FINGERPRINT 是最后一个属性，CRC 覆盖它之前的全部内容
+	fp, ok := m.attr(stunAttrFingerprint)
+	if !ok || len(b)%4 != 0 || binary.BigEndian.Uint32(fp) != crc32.ChecksumIEEE(b[:len(b)-8])^stunFingerprintXOR {
+		t.Errorf("fingerprint %x in %x", fp, b)
+	}
+
+	truncated := bytes.Clone(b[:stunHeaderSize+2])
+	binary.BigEndian.PutUint16(truncated[2:], 2)
+	overlong := bytes.Clone(b)
+	binary.BigEndian.PutUint16(overlong[stunHeaderSize+2:], 200)
+	for name, packet := range map[string][]byte{
+		"short":            b[:stunHeaderSize-1],
+		"wrong length":     b[:len(b)-4],
+		"bad cookie":       append([]byte{0, 1, 0, 0, 1, 2, 3, 4}, txID[:]...),
+		"rtp-like":         append([]byte{0x80, 1, 0, 0}, b[4:stunHeaderSize]...),
+		"truncated header": truncated,
+		"attribute length": overlong,
+	} {
+		if _, err := parseSTUN(packet); err == nil {
+			t.Errorf("%s: parsed %x", name, packet)
+		}
+	}
+}
+
+func TestSTUNAddr(t *testing.T) {
+	txID := [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	tests := []struct {
+		ap  string
+		xor bool
+	}{
+		{"192.0.2.1:32853", true},
+		{"192.0.2.1:32853", false},
+		{"[2001:db8:1234:5678:11:2233:4455:6677]:32853", true},
+		{"[2001:db8::1]:3478", false},
+	}
+	for _, tt := range tests {
+		ap := netip.MustParseAddrPort(tt.ap)
+		v := stunAddr(ap, txID, tt.xor)
+		if got, err := parseSTUNAddr(v, txID, tt.xor); err != nil || got != ap {
+			t.Errorf("%s xor %v: %v, %v", tt.ap, tt.xor, got, err)
+		}
+	}
+	// RFC 5389 15.2：端口与魔数高 16 位异或，IPv4 地址与魔数异或
+	v := stunAddr(netip.MustParseAddrPort("192.0.2.1:32853"), txID, true)
+	if want := []byte{0, 1, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43}; !bytes.Equal(v, want) {
+		t.Errorf("XOR-MAPPED-ADDRESS = %x, want %x", v, want)
+	}
+	for _, bad := range [][]byte{nil, {0, 1, 0, 1, 1, 2, 3}, {0, 2, 0, 1, 1, 2, 3, 4}} {
+		if _, err := parseSTUNAddr(bad, txID, false); err == nil {
+			t.Errorf("parseSTUNAddr(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestSTUNReply(t *testing.T) {
+	txID := [12]byte{9}
+	src := netip.MustParseAddrPort("[::ffff:203.0.113.5]:40000")
+	tests := []struct {
+		name   string
+		packet []byte
+		typ    uint16 // 0 为不应答
+		attr   uint16
+	}{
+		{"binding request", buildSTUN(stunBindingRequest, txID), stunBindingSuccess, stunAttrXORMappedAddress},
+		{"optional attribute", buildSTUN(stunBindingRequest, txID, stunAttr{stunAttrSoftware, []byte("x")}), stunBindingSuccess, stunAttrXORMappedAddress},
+		{"unknown required attribute", buildSTUN(stunBindingRequest, txID, stunAttr{0x0003, []byte{0, 0, 0, 6}}), stunBindingError, stunAttrUnknownAttributes},
+		{"binding response", buildSTUN(stunBindingSuccess, txID), 0, 0},
+		{"not stun", []byte("hello,from udp!"), 0, 0},
+	}
+	for _, tt := range tests {
+		reply := stunReply(tt.packet, src)
+		if tt.typ == 0 {
+			if reply != nil {
+				t.Errorf("%s: replied %x", tt.name, reply)
+			}
+			continue
+		}
+		m, err := parseSTUN(reply)
+		if err != nil || m.typ != tt.typ || m.txID != txID {
+			t.Errorf("%s: %+v, %v", tt.name, m, err)
+			continue
+		}
+		if _, ok := m.attr(tt.attr); !ok {
+			t.Errorf("%s: attribute %#04x missing", tt.name, tt.attr)
+		}
+	}
+
+	m, _ := parseSTUN(stunReply(buildSTUN(stunBindingRequest, txID), src))
+	v, _ := m.attr(stunAttrXORMappedAddress)
+	if got, err := parseSTUNAddr(v, txID, true); err != nil || got != netip.MustParseAddrPort("203.0.113.5:40000") {
+		t.Errorf("mapped address %v, %v", got, err)
+	}
+}
+
+func TestClassifyNAT(t *testing.T) {
+	server := func(addr, mapped string) STUNServerResult {
+		return STUNServerResult{Addr: addr, Mapped: mapped}
+	}
+	tests := []struct {
+		name    string
+		servers []STUNServerResult
+		mapped  string
+		nat     string
+	}{
+		{"no replies", []STUNServerResult{{Error: "no response"}}, "", NATBlocked},
+		{"one reply", []STUNServerResult{server("198.51.100.1:3478", "203.0.113.5:40000"), {Error: "no response"}}, "203.0.113.5:40000", NATUnknown},
+		{"same mapping", []STUNServerResult{server("198.51.100.1:3478", "203.0.113.5:40000"), server("198.51.100.1:3479", "203.0.113.5:40000")}, "203.0.113.5:40000", NATEndpointIndependent},
+		{"port changes", []STUNServerResult{server("198.51.100.1:3478", "203.0.113.5:40000"), server("198.51.100.1:3479", "203.0.113.5:40001")}, "203.0.113.5:40000", NATEndpointDependent},
+		{"duplicate server", []STUNServerResult{server("198.51.100.1:3478", "203.0.113.5:40000"), server("198.51.100.1:3478", "203.0.113.5:40001")}, "203.0.113.5:40000", NATUnknown},
+		{"other family ignored", []STUNServerResult{server("198.51.100.1:3478", "203.0.113.5:40000"), server("[2001:db8::1]:3478", "[2001:db8::5]:40000")}, "203.0.113.5:40000", NATUnknown},
+		{"local address", []STUNServerResult{server("127.0.0.1:3478", "127.0.0.1:51820")}, "127.0.0.1:51820", NATNone},
+	}
+	for _, tt := range tests {
+		res := STUNResult{LocalPort: 51820, Servers: tt.servers}
+		classifyNAT(&res)
+		if res.Mapped != tt.mapped || res.NATType != tt.nat {
+			t.Errorf("%s: mapped %q, NAT %s", tt.name, res.Mapped, res.NATType)
+		}
+	}
+}
+
+// listenSTUN 在回环地址上运行一个应答端
+func listenSTUN(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go serveSTUN(pc)
+	return pc.LocalAddr().String()
+}
+
+func TestProbeSTUN(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	local := pc.LocalAddr().String()
+
+	// 没有应答的服务器：占用端口后立即关闭
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	silent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	servers := []string{listenSTUN(t), listenSTUN(t), silent.LocalAddr().String()}
+	res := ProbeSTUN(ctx, pc, servers)
+	if res.Mapped != local || res.NATType != NATNone || !res.PortPreserved {
+		t.Errorf("ProbeSTUN = %+v", res)
+	}
+	for i, s := range res.Servers {
+		if ok := i < 2; (s.Mapped == local) != ok || (s.Error == "") != ok || s.Server != servers[i] {
+			t.Errorf("server %d: %+v", i, s)
+		}
+	}
+}
+
+func TestPublicEndpoint(t *testing.T) {
+	tu := newTestUI(t)
+	listenPort := tu.device.GetListenPort()
+	tests := []struct {
+		name       string
+		host       string
+		port       uint16
+		mapped     string
+		want       string
+		discovered bool
+	}{
+		{"request host", "", 0, "", net.JoinHostPort("vpn.example.com", strconv.Itoa(int(listenPort))), false},
+		{"configured", "gw.example.com", 51999, "203.0.113.5:40000", "gw.example.com:51999", false},
+		{"discovered", "", 0, "203.0.113.5:40000", "203.0.113.5:40000", true},
+		{"discovered port only", "gw.example.com", 0, "203.0.113.5:40000", "gw.example.com:40000", true},
+	}
+	for _, tt := range tests {
+		configLock.Lock()
+		tu.config.System.PublicHost, tu.config.System.PublicPort = tt.host, tt.port
+		configLock.Unlock()
+		tu.stun.mu.Lock()
+		tu.stun.result = nil
+		if tt.mapped != "" {
+			tu.stun.result = &STUNResult{Mapped: tt.mapped}
+		}
+		tu.stun.mu.Unlock()
+
+		r := httptest.NewRequest("GET", "http://vpn.example.com:8080/api/v1/stun", nil)
+		got, discovered := tu.publicEndpoint(r)
+		if got != tt.want || discovered != tt.discovered {
+			t.Errorf("%s: %s, %v; want %s, %v", tt.name, got, discovered, tt.want, tt.discovered)
+		}
+	}
+
+	// 客户端模式不使用发现的地址
+	configLock.Lock()
+	tu.config.System.IsClient, tu.config.System.PublicHost, tu.config.System.PublicPort = true, "", 0
+	configLock.Unlock()
+	r := httptest.NewRequest("GET", "http://vpn.example.com:8080/", nil)
+	if got, discovered := tu.publicEndpoint(r); discovered || got != net.JoinHostPort("vpn.example.com", strconv.Itoa(int(listenPort))) {
+		t.Errorf("client mode: %s, %v", got, discovered)
+	}
+
+	conf := &Config{System: SystemConfig{IsClient: true}, Peers: []PeerRecord{{Endpoint: "gw.example.com:51820"}}}
+	if got := conf.stunServers(); !reflect.DeepEqual(got, []string{"gw.example.com:3478", "gw.example.com:3479"}) {
+		t.Errorf("client STUN servers %q", got)
+	}
+}
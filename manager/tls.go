@@ -0,0 +1,454 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// tls.go - WebUI 的 HTTPS 支持
+// 三种证书来源：磁盘文件 (变更后自动重新加载)、自动生成的自签名证书、ACME 自动签发
+
+package manager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS 模式
+const (
+	TLSModeOff        = "off"
+	TLSModeFile       = "file"
+	TLSModeSelfSigned = "self-signed"
+	TLSModeACME       = "acme"
+)
+
+const (
+	certReloadInterval  = 2 * time.Second          // 证书文件变更检查的最小间隔
+	selfSignedValidity  = 2 * 365 * 24 * time.Hour // 自签名证书有效期
+	selfSignedRenewal   = 30 * 24 * time.Hour      // 剩余有效期不足时重新生成
+	selfSignedCertFile  = "webui_selfsigned.crt"
+	selfSignedKeyFile   = "webui_selfsigned.key"
+	acmeCacheDir        = "acme"
+	fingerprintQueryKey = "fp"
+)
+
+// TLSConfig WebUI 的 HTTPS 设置
+type TLSConfig struct {
+	Mode string `json:"mode,omitempty"` // off (默认) | file | self-signed | acme
+
+	CertFile string `json:"cert_file,omitempty"` // file 模式：PEM 证书链
+	KeyFile  string `json:"key_file,omitempty"`  // file 模式：PEM 私钥
+
+	ACMEDomains   []string `json:"acme_domains,omitempty"`   // acme 模式：申请证书的域名
+	ACMEEmail     string   `json:"acme_email,omitempty"`     // acme 模式：账户联系邮箱
+	ACMEDirectory string   `json:"acme_directory,omitempty"` // acme 模式：目录地址，默认 Let's Encrypt
+	ACMECAFile    string   `json:"acme_ca_file,omitempty"`   // acme 模式：额外信任的 ACME 服务端根证书 (本地测试服务器)
+
+	RedirectAddr          string `json:"redirect_addr,omitempty"`           // 明文 HTTP 监听地址 (如 :80)，重定向到 HTTPS，acme 模式下同时应答 HTTP-01 验证
+	HSTSMaxAge            int    `json:"hsts_max_age,omitempty"`            // HSTS 有效期 (秒)，0 为不发送
+	HSTSIncludeSubdomains bool   `json:"hsts_include_subdomains,omitempty"` // HSTS 是否包含子域名
+}
+
+// enabled 判断是否启用 HTTPS
+func (t *TLSConfig) enabled() bool {
+	return t.Mode != "" && t.Mode != TLSModeOff
+}
+
+// TLSInfo 当前 HTTPS 状态，用于展示与生成邀请链接
+type TLSInfo struct {
+	Mode        string    `json:"mode"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // 证书 SHA-256 指纹 (Hex)
+	NotAfter    time.Time `json:"not_after,omitempty"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+}
+
+// certFingerprint 计算证书 DER 的 SHA-256 指纹
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint 统一指纹格式：去掉冒号并转小写
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+// ========== 磁盘证书热加载 ==========
+
+// certReloader 从磁盘加载证书，文件修改后在下一次握手时自动替换
+type certReloader struct {
+	certFile, keyFile string
+	logf              func(format string, args ...any)
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logf func(string, ...any)) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logf: logf}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latestModTime 返回证书与私钥文件中较新的修改时间
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		st, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load 重新读取证书 (调用方持有锁或处于初始化阶段)
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate 实现 tls.Config.GetCertificate
+// 证书与私钥分两次写入时可能暂时不匹配，加载失败则继续使用旧证书，稍后再试
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastCheck) >= certReloadInterval {
+		r.lastCheck = now
+		if modTime, err := r.latestModTime(); err == nil && !modTime.Equal(r.modTime) {
+			if err := r.load(); err != nil {
+				r.logf("Failed to reload TLS certificate, keeping the previous one: %v", err)
+			} else {
+				r.logf("TLS certificate reloaded from %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// current 返回当前使用的证书
+func (r *certReloader) current() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert
+}
+
+// ========== 自签名证书 ==========
+
+// loadOrCreateSelfSigned 读取 dir 下的自签名证书，不存在或即将过期时重新生成
+func loadOrCreateSelfSigned(dir string, hosts []string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, selfSignedCertFile)
+	keyPath := filepath.Join(dir, selfSignedKeyFile)
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Until(leaf.NotAfter) > selfSignedRenewal {
+			cert.Leaf = leaf
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "WireGuard Controller"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert.Leaf, _ = x509.ParseCertificate(der)
+	return cert, nil
+}
+
+// selfSignedHosts 自签名证书包含的主机名与地址
+func (s *SystemConfig) selfSignedHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1", s.WebHost, s.PublicHost}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	return hosts
+}
+
+// ========== ACME ==========
+
+// newACMEManager 创建 ACME 证书管理器，证书缓存在 wg_data/acme 下
+func newACMEManager(conf *TLSConfig, cacheDir string) (*autocert.Manager, error) {
+	if len(conf.ACMEDomains) == 0 {
+		return nil, fmt.Errorf("acme mode requires acme_domains")
+	}
+	client := &acme.Client{DirectoryURL: conf.ACMEDirectory}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+	if conf.ACMECAFile != "" {
+		pemData, err := os.ReadFile(conf.ACMECAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read acme_ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("acme_ca_file contains no certificates")
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+			Timeout: 30 * time.Second,
+		}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(conf.ACMEDomains...),
+		Email:      conf.ACMEEmail,
+		Client:     client,
+	}, nil
+}
+
+// ========== WebUI 接入 ==========
+
+// setupTLS 按配置准备 HTTPS，未启用时返回 nil
+func (ui *WebUI) setupTLS() (*tls.Config, error) {
+	conf := &ui.config.System.TLS
+	logf := ui.device.GetLogger().Verbosef
+	dir := filepath.Dir(dataPath)
+
+	switch conf.Mode {
+	case "", TLSModeOff:
+		return nil, nil
+
+	case TLSModeFile:
+		if conf.CertFile == "" || conf.KeyFile == "" {
+			return nil, fmt.Errorf("tls file mode requires cert_file and key_file")
+		}
+		reloader, err := newCertReloader(conf.CertFile, conf.KeyFile, logf)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		ui.tlsCert = reloader.current
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: reloader.GetCertificate}, nil
+
+	case TLSModeSelfSigned:
+		cert, err := loadOrCreateSelfSigned(dir, ui.config.System.selfSignedHosts())
+		if err != nil {
+			return nil, fmt.Errorf("self-signed certificate: %w", err)
+		}
+		ui.tlsCert = func() *tls.Certificate { return &cert }
+		ui.tlsFingerprint = certFingerprint(cert.Certificate[0])
+		logf("WebUI self-signed certificate SHA-256 fingerprint: %s", ui.tlsFingerprint)
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}, nil
+
+	case TLSModeACME:
+		m, err := newACMEManager(conf, filepath.Join(dir, acmeCacheDir))
+		if err != nil {
+			return nil, err
+		}
+		ui.acme = m
+		tlsConf := m.TLSConfig()
+		tlsConf.MinVersion = tls.VersionTLS12
+		return tlsConf, nil
+	}
+	return nil, fmt.Errorf("unknown tls mode %q", conf.Mode)
+}
+
+// tlsInfo 返回当前 HTTPS 状态
+func (ui *WebUI) tlsInfo() TLSInfo {
+	info := TLSInfo{Mode: ui.config.System.TLS.Mode}
+	if info.Mode == "" {
+		info.Mode = TLSModeOff
+	}
+	if ui.tlsCert == nil {
+		return info
+	}
+	cert := ui.tlsCert()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return info
+	}
+	info.Fingerprint = certFingerprint(cert.Certificate[0])
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		info.NotAfter = leaf.NotAfter
+		info.DNSNames = leaf.DNSNames
+	}
+	return info
+}
+
+// handleTLS 查询 HTTPS 状态与证书指纹
+// GET /api/tls
+func (ui *WebUI) handleTLS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ui.tlsInfo())
+}
+
+// hstsMiddleware 对 HTTPS 请求附加 Strict-Transport-Security 头
+func (ui *WebUI) hstsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf := &ui.config.System.TLS
+		if r.TLS != nil && conf.HSTSMaxAge > 0 {
+			value := "max-age=" + strconv.Itoa(conf.HSTSMaxAge)
+			if conf.HSTSIncludeSubdomains {
+				value += "; includeSubDomains"
+			}
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectHandler 将明文 HTTP 请求重定向到 HTTPS 监听端口
+func (ui *WebUI) redirectHandler() http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(ui.server.Addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// joinURL 生成邀请链接，自签名证书时附带指纹供客户端校验
+func (ui *WebUI) joinURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if h := ui.publicJoinHost(); h != "" {
+		host = h
+	}
+	return ui.inviteURL(scheme, host, token)
+}
+
+// inviteURL 按给定协议与主机拼接邀请链接
+func (ui *WebUI) inviteURL(scheme, host, token string) string {
+	u := fmt.Sprintf("%s://%s/join/%s", scheme, host, token)
+	if ui.tlsFingerprint != "" {
+		u += "?" + fingerprintQueryKey + "=" + ui.tlsFingerprint
+	}
+	return u
+}
+
+// APIHTTPClient 返回命令行等外部调用方访问管理 API 使用的 HTTP 客户端
+// fingerprint 非空时按证书指纹校验服务端 (自签名证书)
+func APIHTTPClient(fingerprint string) *http.Client {
+	return enrollHTTPClient(fingerprint)
+}
+
+// enrollHTTPClient 返回注册请求使用的 HTTP 客户端
+// 提供指纹时不再校验证书链，改为要求服务端证书与指纹完全一致 (用于自签名证书)
+func enrollHTTPClient(fingerprint string) *http.Client {
+	fingerprint = normalizeFingerprint(fingerprint)
+	if fingerprint == "" {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // 由 VerifyConnection 按指纹校验
+				VerifyConnection: func(cs tls.ConnectionState) error {
+					if len(cs.PeerCertificates) == 0 {
+						return fmt.Errorf("server presented no certificate")
+					}
+					if got := certFingerprint(cs.PeerCertificates[0].Raw); got != fingerprint {
+						return fmt.Errorf("server certificate fingerprint mismatch: got %s", got)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
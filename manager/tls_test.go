@@ -0,0 +1,368 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeTestCert 写入一张自签名证书与私钥，返回证书指纹
+func writeTestCert(t *testing.T, certFile, keyFile, name string, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFingerprint(der)
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	cert, err := loadOrCreateSelfSigned(dir, []string{"localhost", "192.0.2.1", "", "vpn.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := cert.Leaf
+	if len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal([]byte{192, 0, 2, 1}) || strings.Join(leaf.DNSNames, ",") != "localhost,vpn.example.com" {
+		t.Errorf("certificate names: %v %v", leaf.IPAddresses, leaf.DNSNames)
+	}
+	if st, err := os.Stat(filepath.Join(dir, selfSignedKeyFile)); err != nil || st.Mode().Perm() != 0600 {
+		t.Errorf("private key file: %v", err)
+	}
+
+	// 重启后复用磁盘上的证书，指纹不变
+	again, err := loadOrCreateSelfSigned(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certFingerprint(again.Certificate[0]) != certFingerprint(cert.Certificate[0]) {
+		t.Error("self-signed certificate regenerated on reload")
+	}
+
+	// 即将过期时重新生成
+	old := writeTestCert(t, filepath.Join(dir, selfSignedCertFile), filepath.Join(dir, selfSignedKeyFile), "old", time.Now().Add(selfSignedRenewal/2))
+	renewed, err := loadOrCreateSelfSigned(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certFingerprint(renewed.Certificate[0]) == old || time.Until(renewed.Leaf.NotAfter) < selfSignedRenewal {
+		t.Error("expiring self-signed certificate not renewed")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := writeTestCert(t, certFile, keyFile, "first", time.Now().Add(time.Hour))
+	r, err := newCertReloader(certFile, keyFile, t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := func() string {
+		r.mu.Lock()
+		r.lastCheck = time.Time{}
+		r.mu.Unlock()
+		cert, _ := r.GetCertificate(nil)
+		return certFingerprint(cert.Certificate[0])
+	}
+	if served() != first {
+		t.Fatal("initial certificate not served")
+	}
+
+	touch := func(d time.Duration) {
+		mtime := time.Now().Add(d)
+		os.Chtimes(certFile, mtime, mtime)
+		os.Chtimes(keyFile, mtime, mtime)
+	}
+	second := writeTestCert(t, certFile, keyFile, "second", time.Now().Add(time.Hour))
+	touch(time.Minute)
+	if served() != second {
+		t.Error("renewed certificate not picked up")
+	}
+
+	// 只更新了证书、私钥尚未写入时继续使用旧证书
+	writeTestCert(t, certFile, "", "third", time.Now().Add(time.Hour))
+	touch(2 * time.Minute)
+	if served() != second {
+		t.Error("mismatched key pair replaced the working certificate")
+	}
+
+	if _, err := newCertReloader(filepath.Join(dir, "missing.crt"), keyFile, t.Logf); err == nil {
+		t.Error("missing certificate accepted")
+	}
+}
+
+func TestFingerprintClient(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	fp := certFingerprint(ts.Certificate().Raw)
+
+	var colons []string
+	for i := 0; i < len(fp); i += 2 {
+		colons = append(colons, strings.ToUpper(fp[i:i+2]))
+	}
+	tests := []struct {
+		fingerprint string
+		ok          bool
+	}{
+		{fp, true},
+		{strings.Join(colons, ":"), true},
+		{strings.Repeat("00", 32), false},
+		{"", false}, // 没有指纹时按系统根证书校验，自签名证书不被信任
+	}
+	for _, tt := range tests {
+		resp, err := enrollHTTPClient(tt.fingerprint).Get(ts.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("fingerprint %q: %v, want ok %v", tt.fingerprint, err, tt.ok)
+		}
+	}
+}
+
+func TestHSTSAndRedirect(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.System.TLS = TLSConfig{Mode: TLSModeSelfSigned, HSTSMaxAge: 3600, HSTSIncludeSubdomains: true}
+	})
+	tu.server.Addr = ":8443"
+
+	handler := tu.hstsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, https := range []bool{false, true} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if https {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		want := ""
+		if https {
+			want = "max-age=3600; includeSubDomains"
+		}
+		if got := w.Header().Get("Strict-Transport-Security"); got != want {
+			t.Errorf("https %v: HSTS %q, want %q", https, got, want)
+		}
+	}
+
+	tests := []struct{ host, want string }{
+		{"vpn.example.com", "https://vpn.example.com:8443/join/abc?x=1"},
+		{"vpn.example.com:80", "https://vpn.example.com:8443/join/abc?x=1"},
+		{"[2001:db8::1]:80", "https://[2001:db8::1]:8443/join/abc?x=1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/join/abc?x=1", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		tu.redirectHandler().ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.want {
+			t.Errorf("redirect for %s: %d %q, want %q", tt.host, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+
+	// 自签名模式下邀请链接带上证书指纹
+	if _, err := tu.setupTLS(); err != nil {
+		t.Fatal(err)
+	}
+	info := tu.tlsInfo()
+	if info.Mode != TLSModeSelfSigned || info.Fingerprint == "" || info.Fingerprint != tu.tlsFingerprint {
+		t.Errorf("tls info %+v", info)
+	}
+	if u := tu.inviteURL("https", "vpn.example.com", "abc"); u != "https://vpn.example.com/join/abc?fp="+info.Fingerprint {
+		t.Errorf("invite URL %q", u)
+	}
+}
+
+// newTestACMEServer 启动只实现签发流程的 ACME 服务端：订单直接处于 ready，
+// 不校验 JWS 签名，收到 CSR 后用临时 CA 签发；返回目录地址与服务端根证书文件
+func newTestACMEServer(t *testing.T) (directory, caFile string) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	var mu sync.Mutex
+	var issued []byte // PEM 证书链
+	mux := http.NewServeMux()
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // 不信任本服务端的客户端会中断握手
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	order := func(status string) map[string]any {
+		o := map[string]any{"status": status, "finalize": srv.URL + "/finalize/1"}
+		if status == "valid" {
+			o["certificate"] = srv.URL + "/cert/1"
+		}
+		return o
+	}
+	reply := func(w http.ResponseWriter, status int, location string, v any) {
+		w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+		if location != "" {
+			w.Header().Set("Location", location)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/dir", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, "", map[string]string{
+			"newNonce":   srv.URL + "/nonce",
+			"newAccount": srv.URL + "/account",
+			"newOrder":   srv.URL + "/order",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusCreated, srv.URL+"/account/1", map[string]string{"status": "valid"})
+	})
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusCreated, srv.URL+"/order/1", order("ready"))
+	})
+	mux.HandleFunc("/finalize/1", func(w http.ResponseWriter, r *http.Request) {
+		// 请求体为 JWS，载荷是 {"csr": base64url(DER)}，格式有误时由 CSR 解析报错
+		var jws struct{ Payload string }
+		var req struct{ CSR string }
+		json.NewDecoder(r.Body).Decode(&jws)
+		payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			reply(w, http.StatusBadRequest, "", map[string]string{"type": "urn:ietf:params:acme:error:badCSR", "detail": err.Error()})
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		leaf, err := x509.CreateCertificate(rand.Reader, tmpl, ca, csr.PublicKey, caKey)
+		if err != nil {
+			reply(w, http.StatusInternalServerError, "", map[string]string{"detail": err.Error()})
+			return
+		}
+		mu.Lock()
+		issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+		mu.Unlock()
+		reply(w, http.StatusOK, srv.URL+"/order/1", order("valid"))
+	})
+	mux.HandleFunc("/cert/1", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(issued)
+	})
+
+	caFile = filepath.Join(t.TempDir(), "acme-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return srv.URL + "/dir", caFile
+}
+
+func TestACMEManager(t *testing.T) {
+	directory, caFile := newTestACMEServer(t)
+	const domain = "vpn.example.com"
+
+	// 不信任 ACME 服务端证书时无法签发
+	untrusted, err := newACMEManager(&TLSConfig{ACMEDomains: []string{domain}, ACMEDirectory: directory}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.GetCertificate(&tls.ClientHelloInfo{ServerName: domain}); err == nil {
+		t.Error("certificate issued by an untrusted ACME server")
+	}
+
+	m, err := newACMEManager(&TLSConfig{ACMEDomains: []string{domain}, ACMEDirectory: directory, ACMECAFile: caFile}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConf := m.TLSConfig()
+	tlsConf.MinVersion = tls.VersionTLS12
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.Listener = tls.NewListener(srv.Listener, tlsConf)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{ServerName: domain, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) != 2 || certs[0].VerifyHostname(domain) != nil || certs[1].Subject.CommonName != "test acme ca" {
+		t.Fatalf("served chain %v", certs)
+	}
+
+	// 不在白名单中的域名不签发
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("certificate issued for a domain outside acme_domains")
+	}
+}
@@ -0,0 +1,245 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// tokens.go - 面向自动化脚本的 API 令牌
+// 令牌明文只在创建时返回一次，磁盘上仅保存 SHA-256 摘要
+
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	apiTokenPrefix = "wgt_"
+
+	// lastUsedPersistInterval 最近使用时间的落盘间隔，避免每个请求都写配置文件
+	lastUsedPersistInterval = time.Minute
+)
+
+// Scope API 令牌的授权范围
+type Scope string
+
+const (
+	ScopeStatusRead Scope = "status:read" // 只读状态
+	ScopePeers      Scope = "peers"       // 对等体管理
+	ScopeInvites    Scope = "invites"     // 邀请码管理
+	ScopeSystem     Scope = "system"      // 系统配置 (含原始 UAPI)
+)
+
+// AllScopes 所有可授予令牌的范围
+var AllScopes = []Scope{ScopeStatusRead, ScopePeers, ScopeInvites, ScopeSystem}
+
+func validScope(s Scope) bool {
+	for _, scope := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken 长期有效的 Bearer 令牌
+type APIToken struct {
+	ID         string     `json:"id"`                     // 公开标识，用于撤销
+	Name       string     `json:"name"`                   // 用途说明
+	Owner      string     `json:"owner"`                  // 创建者账号
+	Hash       string     `json:"hash"`                   // 令牌明文的 SHA-256 (Hex)
+	Scopes     []Scope    `json:"scopes"`                 // 授权范围
+	AllowedIPs []string   `json:"allowed_ips,omitempty"`  // 允许的来源网段，空为不限制
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // 过期时间，空为永不过期
+	CreatedAt  time.Time  `json:"created_at"`             // 创建时间
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // 最近使用时间
+	LastUsedIP string     `json:"last_used_ip,omitempty"` // 最近使用的来源 IP
+
+	persistedAt time.Time // 最近使用信息上次落盘的时间 (仅内存)
+}
+
+// APITokenInfo 对外展示的令牌信息 (不含摘要)
+type APITokenInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner"`
+	Scopes     []Scope    `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// Info 返回可安全序列化的令牌信息
+func (t *APIToken) Info() APITokenInfo {
+	return APITokenInfo{
+		ID:         t.ID,
+		Name:       t.Name,
+		Owner:      t.Owner,
+		Scopes:     t.Scopes,
+		AllowedIPs: t.AllowedIPs,
+		ExpiresAt:  t.ExpiresAt,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+	}
+}
+
+// allowsAddr 判断来源地址是否在令牌的来源限制内
+func (t *APIToken) allowsAddr(addr netip.Addr) bool {
+	if len(t.AllowedIPs) == 0 {
+		return true
+	}
+	for _, cidr := range t.AllowedIPs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseAllowedNetworks 规范化来源限制，单个 IP 视为 /32 或 /128
+func parseAllowedNetworks(list []string) ([]string, error) {
+	var out []string
+	for _, raw := range list {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "/") {
+			addr, err := netip.ParseAddr(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", raw)
+			}
+			raw = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", raw)
+		}
+		out = append(out, prefix.Masked().String())
+	}
+	return out, nil
+}
+
+// CreateAPIToken 创建令牌，返回仅此一次可见的明文
+func (c *Config) CreateAPIToken(owner, name string, scopes []Scope, allowedIPs []string, ttl time.Duration) (string, APITokenInfo, error) {
+	if len(scopes) == 0 {
+		return "", APITokenInfo{}, fmt.Errorf("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if !validScope(s) {
+			return "", APITokenInfo{}, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	networks, err := parseAllowedNetworks(allowedIPs)
+	if err != nil {
+		return "", APITokenInfo{}, err
+	}
+
+	idBytes := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", APITokenInfo{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", APITokenInfo{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+	plain := apiTokenPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	token := APIToken{
+		ID:         id,
+		Name:       strings.TrimSpace(name),
+		Owner:      owner,
+		Hash:       hashAPIToken(plain),
+		Scopes:     scopes,
+		AllowedIPs: networks,
+		CreatedAt:  now,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+	c.APITokens = append(c.APITokens, token)
+	return plain, token.Info(), nil
+}
+
+// ListAPITokens 返回令牌的展示信息，owner 非空时只返回该账号的令牌
+func (c *Config) ListAPITokens(owner string) []APITokenInfo {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	tokens := make([]APITokenInfo, 0, len(c.APITokens))
+	for i := range c.APITokens {
+		if owner == "" || c.APITokens[i].Owner == owner {
+			tokens = append(tokens, c.APITokens[i].Info())
+		}
+	}
+	return tokens
+}
+
+// RevokeAPIToken 按 ID 撤销令牌，owner 非空时只能撤销该账号的令牌
+func (c *Config) RevokeAPIToken(id, owner string) bool {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i, t := range c.APITokens {
+		if t.ID == id && (owner == "" || t.Owner == owner) {
+			c.APITokens = append(c.APITokens[:i], c.APITokens[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAPIToken 校验 Bearer 令牌：摘要、有效期、来源 IP
+// 校验通过时记录最近使用信息，persist 为 true 表示距上次落盘已超过间隔，调用方应保存配置
+func (c *Config) ValidateAPIToken(plain string, remote netip.Addr) (token APIToken, persist bool, err error) {
+	if !strings.HasPrefix(plain, apiTokenPrefix) {
+		return APIToken{}, false, fmt.Errorf("malformed token")
+	}
+	hash := hashAPIToken(plain)
+	now := time.Now()
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i := range c.APITokens {
+		t := &c.APITokens[i]
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+			return APIToken{}, false, fmt.Errorf("token expired")
+		}
+		if !t.allowsAddr(remote) {
+			return APIToken{}, false, fmt.Errorf("source address not allowed")
+		}
+		persist = now.Sub(t.persistedAt) > lastUsedPersistInterval
+		if persist {
+			t.persistedAt = now
+		}
+		t.LastUsedAt = &now
+		t.LastUsedIP = remote.String()
+		return *t, persist, nil
+	}
+	return APIToken{}, false, fmt.Errorf("invalid token")
+}
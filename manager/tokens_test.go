@@ -0,0 +1,150 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAllowedNetworks(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+		ok   bool
+	}{
+		{nil, nil, true},
+		{[]string{" 192.0.2.7 ", ""}, []string{"192.0.2.7/32"}, true},
+		{[]string{"192.0.2.77/24", "2001:db8::1"}, []string{"192.0.2.0/24", "2001:db8::1/128"}, true},
+		{[]string{"192.0.2.0/33"}, nil, false},
+		{[]string{"vpn.example.com"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseAllowedNetworks(tt.in)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAllowedNetworks(%q) = %q, %v; want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidateAPIToken(t *testing.T) {
+	conf := &Config{}
+	if _, _, err := conf.CreateAPIToken("alice", "ci", nil, nil, 0); err == nil {
+		t.Error("created a token without scopes")
+	}
+	if _, _, err := conf.CreateAPIToken("alice", "ci", []Scope{"admin"}, nil, 0); err == nil {
+		t.Error("created a token with an unknown scope")
+	}
+
+	open, info, err := conf.CreateAPIToken("alice", " ci ", []Scope{ScopeStatusRead}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(open, apiTokenPrefix+info.ID+"_") || info.Name != "ci" || info.ExpiresAt != nil {
+		t.Fatalf("token %q, info %+v", open, info)
+	}
+	if conf.APITokens[0].Hash == open || strings.Contains(conf.APITokens[0].Hash, info.ID) {
+		t.Error("token stored in clear")
+	}
+	limited, _, _ := conf.CreateAPIToken("alice", "lan", []Scope{ScopePeers}, []string{"192.0.2.0/24"}, 0)
+	expired, _, _ := conf.CreateAPIToken("alice", "old", []Scope{ScopePeers}, nil, time.Hour)
+	past := time.Now().Add(-time.Minute)
+	conf.APITokens[2].ExpiresAt = &past
+	revoked, revokedInfo, _ := conf.CreateAPIToken("bob", "gone", []Scope{ScopePeers}, nil, 0)
+	if conf.RevokeAPIToken(revokedInfo.ID, "alice") {
+		t.Error("alice revoked bob's token")
+	}
+	if !conf.RevokeAPIToken(revokedInfo.ID, "bob") {
+		t.Error("owner cannot revoke the token")
+	}
+
+	lan := netip.MustParseAddr("192.0.2.10")
+	wan := netip.MustParseAddr("198.51.100.1")
+	tests := []struct {
+		name  string
+		plain string
+		addr  netip.Addr
+		ok    bool
+	}{
+		{"valid", open, wan, true},
+		{"allowed network", limited, lan, true},
+		{"mapped allowed network", limited, netip.MustParseAddr("::ffff:192.0.2.10"), true},
+		{"outside network", limited, wan, false},
+		{"expired", expired, wan, false},
+		{"revoked", revoked, wan, false},
+		{"tampered", open[:len(open)-1] + "x", wan, false},
+		{"no prefix", strings.TrimPrefix(open, apiTokenPrefix), wan, false},
+	}
+	for _, tt := range tests {
+		token, _, err := conf.ValidateAPIToken(tt.plain, tt.addr)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateAPIToken = %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if err == nil && (token.LastUsedAt == nil || token.LastUsedIP != tt.addr.String()) {
+			t.Errorf("%s: last use not recorded: %+v", tt.name, token.Info())
+		}
+	}
+	// 最近使用时间按间隔落盘
+	if _, persist, _ := conf.ValidateAPIToken(open, wan); persist {
+		t.Error("token usage persisted twice within the interval")
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	tu := newTestUI(t)
+	tu.addUser("ops", "longenough", RoleOperator)
+	tu.addUser("watcher", "longenough", RoleViewer)
+	status, _, _ := tu.config.CreateAPIToken("ops", "status", []Scope{ScopeStatusRead}, nil, 0)
+	peers, _, _ := tu.config.CreateAPIToken("ops", "peers", []Scope{ScopePeers}, nil, 0)
+	viewerPeers, _, _ := tu.config.CreateAPIToken("watcher", "peers", []Scope{ScopePeers}, nil, 0)
+	remote, _, _ := tu.config.CreateAPIToken("ops", "remote", []Scope{ScopeStatusRead}, []string{"192.0.2.0/24"}, 0)
+	const newPeer = `{"public_key":"dFQ9wGQLb3GmwlNEUEKpjIeI5GOyimwybi3V5kINm0w=","allowed_ips":["10.0.0.9/32"]}`
+
+	tests := []struct {
+		name         string
+		token        string
+		method, path string
+		body         string
+		status       int
+		code         string
+	}{
+		{"read with status scope", status, http.MethodGet, "/api/v1/status", "", http.StatusOK, ""},
+		{"write with status scope", status, http.MethodPost, "/api/v1/peers", newPeer, http.StatusForbidden, ErrCodeInsufficientScope},
+		{"write with peers scope", peers, http.MethodPost, "/api/v1/peers", newPeer, http.StatusCreated, ""},
+		{"scope beyond owner role", viewerPeers, http.MethodDelete, "/api/v1/peers/dFQ9wGQLb3GmwlNEUEKpjIeI5GOyimwybi3V5kINm0w=", "", http.StatusForbidden, ErrCodeInsufficientScope},
+		{"session-only endpoint", status, http.MethodGet, "/api/v1/tokens", "", http.StatusForbidden, ErrCodeForbidden},
+		{"source not allowed", remote, http.MethodGet, "/api/v1/status", "", http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"unknown token", apiTokenPrefix + "00000000_x", http.MethodGet, "/api/v1/status", "", http.StatusUnauthorized, ErrCodeInvalidToken},
+	}
+	for _, tt := range tests {
+		resp, body := tu.bearer(tt.token, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status || errorCode(body) != tt.code {
+			t.Errorf("%s: %d %s, want %d %q", tt.name, resp.StatusCode, body, tt.status, tt.code)
+		}
+		switch tt.code {
+		case ErrCodeInsufficientScope:
+			if h := resp.Header.Get("WWW-Authenticate"); !strings.Contains(h, `error="insufficient_scope"`) {
+				t.Errorf("%s: WWW-Authenticate %q", tt.name, h)
+			}
+		case ErrCodeInvalidToken:
+			if h := resp.Header.Get("WWW-Authenticate"); !strings.Contains(h, `error="invalid_token"`) {
+				t.Errorf("%s: WWW-Authenticate %q", tt.name, h)
+			}
+		}
+	}
+
+	// 令牌随账号删除一并失效
+	if err := tu.config.RemoveUser("ops"); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := tu.bearer(status, http.MethodGet, "/api/v1/status", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token of removed user: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,340 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// users.go - WebUI 管理员账号存储
+// 密码使用 argon2id 加盐哈希后随 Config 一起持久化，明文密码从不落盘
+
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	defaultAdminUsername = "admin"
+	minPasswordLength    = 8
+
+	// argon2id 参数 (参考 OWASP 推荐的低内存配置，兼顾嵌入式网关)
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024 // KiB
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// User WebUI 管理员账号
+type User struct {
+	Username           string    `json:"username"`             // 登录名
+	PasswordHash       string    `json:"password_hash"`        // argon2id 编码后的密码哈希
+	MustChangePassword bool      `json:"must_change_password"` // 下次登录必须修改密码
+	Role               string    `json:"role,omitempty"`       // 角色名，空为 admin (兼容旧配置)
+	Locale             string    `json:"locale,omitempty"`     // WebUI 语言偏好，空为按浏览器选择
+	CreatedAt          time.Time `json:"created_at"`           // 创建时间
+	UpdatedAt          time.Time `json:"updated_at"`           // 最近一次修改时间
+}
+
+// UserInfo 对外展示的账号信息 (不含密码哈希)
+type UserInfo struct {
+	Username           string    `json:"username"`
+	MustChangePassword bool      `json:"must_change_password"`
+	Role               string    `json:"role"`
+	Locale             string    `json:"locale,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// Info 返回可安全序列化的账号信息
+func (u *User) Info() UserInfo {
+	return UserInfo{
+		Username:           u.Username,
+		MustChangePassword: u.MustChangePassword,
+		Role:               u.roleName(),
+		Locale:             u.Locale,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+	}
+}
+
+// roleName 返回生效的角色名
+func (u *User) roleName() string {
+	if u.Role == "" {
+		return RoleAdmin
+	}
+	return u.Role
+}
+
+// HashPassword 生成 argon2id 编码的密码哈希
+// 格式: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword 校验明文密码与编码哈希是否匹配
+func VerifyPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// validatePassword 检查新密码强度
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return nil
+}
+
+// EnsureAdminUser 首次启动时创建引导管理员账号
+// 初始密码取自 WEBUI_PASSWORD 环境变量 (默认 admin)，并强制首次登录后修改
+func (c *Config) EnsureAdminUser() (bool, error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	if len(c.Users) > 0 {
+		return false, nil
+	}
+
+	password := os.Getenv("WEBUI_PASSWORD")
+	if password == "" {
+		password = "admin"
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	c.Users = append(c.Users, User{
+		Username:           defaultAdminUsername,
+		PasswordHash:       hash,
+		MustChangePassword: true,
+		Role:               RoleAdmin,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+	return true, nil
+}
+
+// FindUser 按用户名查找账号，返回副本
+func (c *Config) FindUser(username string) (User, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, u := range c.Users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// ListUsers 返回所有账号的展示信息
+func (c *Config) ListUsers() []UserInfo {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	users := make([]UserInfo, 0, len(c.Users))
+	for i := range c.Users {
+		users = append(users, c.Users[i].Info())
+	}
+	return users
+}
+
+// Authenticate 校验用户名与密码
+func (c *Config) Authenticate(username, password string) (User, bool) {
+	user, ok := c.FindUser(username)
+	if !ok {
+		// 对不存在的用户同样执行一次哈希，避免通过响应时间枚举用户名
+		VerifyPassword(dummyPasswordHash, password)
+		return User{}, false
+	}
+	if !VerifyPassword(user.PasswordHash, password) {
+		return User{}, false
+	}
+	return user, true
+}
+
+// dummyPasswordHash 用于对不存在的用户做等时比较
+var dummyPasswordHash, _ = HashPassword("wireguard-go/dummy")
+
+// AddUser 新增账号，新账号首次登录必须修改密码
+func (c *Config) AddUser(username, password, role string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username")
+	}
+	if role == "" {
+		role = RoleViewer
+	}
+	if _, ok := c.FindRole(role); !ok {
+		return fmt.Errorf("role %q not found", role)
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for _, u := range c.Users {
+		if u.Username == username {
+			return fmt.Errorf("user %q already exists", username)
+		}
+	}
+	now := time.Now()
+	c.Users = append(c.Users, User{
+		Username:           username,
+		PasswordHash:       hash,
+		MustChangePassword: true,
+		Role:               role,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+	return nil
+}
+
+// SetUserPassword 修改账号密码
+// mustChange 为 true 表示由其他管理员重置，目标用户下次登录仍需自行修改
+func (c *Config) SetUserPassword(username, password string, mustChange bool) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i := range c.Users {
+		if c.Users[i].Username == username {
+			c.Users[i].PasswordHash = hash
+			c.Users[i].MustChangePassword = mustChange
+			c.Users[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return fmt.Errorf("user %q not found", username)
+}
+
+// SetUserLocale 保存账号的 WebUI 语言偏好，返回是否有变化
+func (c *Config) SetUserLocale(username, locale string) (bool, error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i := range c.Users {
+		if c.Users[i].Username == username {
+			if c.Users[i].Locale == locale {
+				return false, nil
+			}
+			c.Users[i].Locale = locale
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("user %q not found", username)
+}
+
+// SetUserRole 修改账号角色，至少保留一个 admin 账号
+func (c *Config) SetUserRole(username, role string) error {
+	if _, ok := c.FindRole(role); !ok {
+		return fmt.Errorf("role %q not found", role)
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i := range c.Users {
+		if c.Users[i].Username == username {
+			if c.Users[i].roleName() == RoleAdmin && role != RoleAdmin && c.adminCount() == 1 {
+				return fmt.Errorf("cannot demote the last admin")
+			}
+			c.Users[i].Role = role
+			c.Users[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return fmt.Errorf("user %q not found", username)
+}
+
+// adminCount 统计管理员账号数量，调用方需持有 configLock
+func (c *Config) adminCount() int {
+	n := 0
+	for i := range c.Users {
+		if c.Users[i].roleName() == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// RemoveUser 删除账号，不允许删除最后一个管理员
+func (c *Config) RemoveUser(username string) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i, u := range c.Users {
+		if u.Username == username {
+			if len(c.Users) == 1 {
+				return fmt.Errorf("cannot remove the last user")
+			}
+			if u.roleName() == RoleAdmin && c.adminCount() == 1 {
+				return fmt.Errorf("cannot remove the last admin")
+			}
+			c.Users = append(c.Users[:i], c.Users[i+1:]...)
+			// 账号删除后其名下的 API 令牌一并失效
+			tokens := c.APITokens[:0]
+			for _, t := range c.APITokens {
+				if t.Owner != username {
+					tokens = append(tokens, t)
+				}
+			}
+			c.APITokens = tokens
+			return nil
+		}
+	}
+	return fmt.Errorf("user %q not found", username)
+}
@@ -0,0 +1,233 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+	if other, _ := HashPassword("correct horse"); other == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+
+	parts := strings.Split(hash, "$")
+	tests := []struct {
+		name     string
+		encoded  string
+		password string
+		want     bool
+	}{
+		{"match", hash, "correct horse", true},
+		{"wrong password", hash, "correct horse!", false},
+		{"empty password", hash, "", false},
+		{"other algorithm", strings.Replace(hash, "argon2id", "argon2i", 1), "correct horse", false},
+		{"other version", strings.Replace(hash, "v=19", "v=16", 1), "correct horse", false},
+		{"changed params", strings.Replace(hash, "t=2", "t=3", 1), "correct horse", false},
+		{"bad salt", strings.Join(append(parts[:4:4], "!!", parts[5]), "$"), "correct horse", false},
+		{"truncated", strings.Join(parts[:5], "$"), "correct horse", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := VerifyPassword(tt.encoded, tt.password); got != tt.want {
+			t.Errorf("%s: VerifyPassword = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddUser(t *testing.T) {
+	conf := &Config{}
+	if err := conf.AddUser("alice", "longenough", ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		username, password, role string
+		ok                       bool
+	}{
+		{"bob", "longenough", RoleOperator, true},
+		{"alice", "longenough", "", false}, // 重名
+		{"bad name", "longenough", "", false},
+		{"", "longenough", "", false},
+		{strings.Repeat("a", 33), "longenough", "", false},
+		{"carol", "short", "", false},
+		{"dave", "longenough", "no-such-role", false},
+	}
+	for _, tt := range tests {
+		err := conf.AddUser(tt.username, tt.password, tt.role)
+		if (err == nil) != tt.ok {
+			t.Errorf("AddUser(%q, %q, %q) = %v, want ok %v", tt.username, tt.password, tt.role, err, tt.ok)
+		}
+	}
+
+	alice, ok := conf.FindUser("alice")
+	if !ok || alice.Role != RoleViewer || !alice.MustChangePassword {
+		t.Errorf("alice = %+v, want viewer that must change password", alice)
+	}
+	if _, ok := conf.Authenticate("alice", "longenough"); !ok {
+		t.Error("alice cannot authenticate")
+	}
+	if _, ok := conf.Authenticate("nobody", "longenough"); ok {
+		t.Error("unknown user authenticated")
+	}
+	if err := conf.RemoveUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.RemoveUser("bob"); err == nil {
+		t.Error("removed the last user")
+	}
+}
+
+func TestLastAdmin(t *testing.T) {
+	conf := &Config{}
+	for _, u := range []struct{ name, role string }{{"root", RoleAdmin}, {"ops", RoleOperator}} {
+		if err := conf.AddUser(u.name, "longenough", u.role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conf.RemoveUser("root"); err == nil {
+		t.Error("removed the last admin")
+	}
+	if err := conf.SetUserRole("root", RoleViewer); err == nil {
+		t.Error("demoted the last admin")
+	}
+	if _, ok := conf.FindUser("root"); !ok {
+		t.Fatal("last admin is gone")
+	}
+
+	// 还有其他管理员时可以删除
+	if err := conf.SetUserRole("ops", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.RemoveUser("root"); err != nil {
+		t.Errorf("remove admin with another admin left: %v", err)
+	}
+	if err := conf.RemoveUser("ops"); err == nil {
+		t.Error("removed the last admin")
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	idle, maxAge := time.Hour, 2*time.Hour
+	s := newSessionStore(func() time.Duration { return idle }, func() time.Duration { return maxAge })
+
+	tests := []struct {
+		name      string
+		lastSeen  time.Duration // 距今
+		createdAt time.Duration
+		valid     bool
+	}{
+		{"fresh", 0, 0, true},
+		{"idle", 61 * time.Minute, 61 * time.Minute, false},
+		{"active but too old", time.Minute, 121 * time.Minute, false},
+		{"active within max age", time.Minute, 119 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		token, err := s.Create("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		sess := s.sessions[sessionKey(token)]
+		sess.lastSeen, sess.createdAt = now.Add(-tt.lastSeen), now.Add(-tt.createdAt)
+		if _, ok := s.Lookup(token); ok != tt.valid {
+			t.Errorf("%s: Lookup = %v, want %v", tt.name, ok, tt.valid)
+		}
+	}
+
+	// 配置中的超时在线修改后立即生效
+	token, _ := s.Create("alice")
+	s.sessions[sessionKey(token)].lastSeen = time.Now().Add(-10 * time.Minute)
+	idle = 5 * time.Minute
+	if _, ok := s.Lookup(token); ok {
+		t.Error("session survived a shortened idle timeout")
+	}
+
+	a, _ := s.Create("alice")
+	b, _ := s.Create("alice")
+	c, _ := s.Create("bob")
+	s.RevokeUser("alice", b)
+	for token, want := range map[string]bool{a: false, b: true, c: true} {
+		if _, ok := s.Lookup(token); ok != want {
+			t.Errorf("after RevokeUser: Lookup = %v, want %v", ok, want)
+		}
+	}
+}
+
+func TestSessionTimeoutFromConfig(t *testing.T) {
+	tu := newTestUI(t)
+	if got := tu.sessionIdleTimeout(); got != defaultSessionIdleTimeout {
+		t.Errorf("default idle timeout = %v", got)
+	}
+	configLock.Lock()
+	tu.config.System.SessionIdleTimeout = 5
+	tu.config.System.SessionMaxAge = 1
+	configLock.Unlock()
+	if l := tu.sessions.limits(); l.idle != 5*time.Minute || l.maxAge != time.Hour {
+		t.Errorf("limits = %+v, want 5m / 1h", l)
+	}
+}
+
+func TestBootstrapLogin(t *testing.T) {
+	tu := newTestUI(t)
+
+	c := tu.newClient()
+	resp, _ := tu.do(c, http.MethodPost, "/login?"+url.Values{"username": {"admin"}, "password": {"wrong"}}.Encode(), "")
+	if loc := resp.Header.Get("Location"); !strings.Contains(loc, "error") {
+		t.Fatalf("wrong password redirected to %q", loc)
+	}
+
+	c = tu.login("admin", "admin")
+	if sess := tu.cookie(c, sessionCookieName); len(sess) != 64 {
+		t.Fatalf("session cookie %q", sess)
+	}
+	// 引导账号修改密码之前不能调用接口
+	resp, body := tu.do(c, http.MethodGet, "/api/v1/status", "")
+	if resp.StatusCode != http.StatusForbidden || errorCode(body) != ErrCodePasswordChangeRequired {
+		t.Fatalf("status before password change: %d %s", resp.StatusCode, body)
+	}
+
+	form := url.Values{
+		csrfFormField:      {tu.cookie(c, csrfCookieName)},
+		"current_password": {"admin"},
+		"new_password":     {"s3cret-pass"},
+		"confirm_password": {"s3cret-pass"},
+	}
+	resp, err := c.PostForm(tu.ts.URL+"/account/password", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+		t.Fatalf("password change: %d -> %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp, body := tu.do(c, http.MethodGet, "/api/v1/status", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after password change: %d %s", resp.StatusCode, body)
+	}
+	if _, ok := tu.config.Authenticate("admin", "admin"); ok {
+		t.Error("old password still accepted")
+	}
+
+	// 注销后会话令牌失效，即使客户端仍保留 Cookie
+	token := tu.cookie(c, sessionCookieName)
+	tu.write(c, http.MethodPost, "/logout", "")
+	stale := tu.newClient()
+	u, _ := url.Parse(tu.ts.URL)
+	stale.Jar.SetCookies(u, []*http.Cookie{{Name: sessionCookieName, Value: token}})
+	if resp, body := tu.do(stale, http.MethodGet, "/api/v1/status", ""); resp.StatusCode != http.StatusUnauthorized || errorCode(body) != ErrCodeUnauthorized {
+		t.Errorf("status after logout: %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,692 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// webhooks.go - 出站 Webhook
+// 订阅事件总线，把匹配的事件以 JSON POST 给订阅地址，请求体用订阅密钥做 HMAC-SHA256 签名；
+// 失败时按指数退避重试，每次投递的结果记入 wg_data/webhooks.log，可按投递 ID 重放
+
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookSecretPrefix  = "whsec_"
+	webhookTimeout       = 10 * time.Second // 单次请求超时
+	webhookRetryBase     = 10 * time.Second // 首次重试间隔，之后每次乘以 3
+	webhookMaxAttempts   = 6                // 含首次投递，约 20 分钟后放弃
+	webhookConcurrency   = 8                // 同时进行的请求数
+	webhookEventBuffer   = 256              // 事件订阅缓冲
+	webhookLogSize       = 500              // 内存中保留、可重放的投递记录条数
+	webhookResponseLimit = 512              // 记录的响应体长度
+)
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// errWebhookNotFound 订阅不存在
+var errWebhookNotFound = errors.New("webhook not found")
+
+// errWebhookPrivateTarget 订阅地址指向本机或内网，未开启 allow_private
+var errWebhookPrivateTarget = errors.New("webhook target is not a public address, set allow_private to deliver to internal hosts")
+
+// Webhook 出站通知订阅
+type Webhook struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	URL          string    `json:"url"`
+	Events       []string  `json:"events,omitempty"` // 事件类型过滤，支持 peer.* 形式的前缀通配，空为全部事件
+	Secret       string    `json:"secret"`           // 签名密钥
+	Enabled      bool      `json:"enabled"`
+	AllowPrivate bool      `json:"allow_private,omitempty"` // 允许投递到本机与内网地址，默认只连接公网地址 (防止 SSRF)
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WebhookInfo 对外展示的订阅信息 (不含密钥)
+type WebhookInfo struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	URL          string    `json:"url"`
+	Events       []string  `json:"events,omitempty"`
+	Enabled      bool      `json:"enabled"`
+	AllowPrivate bool      `json:"allow_private,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Info 返回可安全序列化的订阅信息
+func (h *Webhook) Info() WebhookInfo {
+	return WebhookInfo{
+		ID:           h.ID,
+		Name:         h.Name,
+		URL:          h.URL,
+		Events:       h.Events,
+		Enabled:      h.Enabled,
+		AllowPrivate: h.AllowPrivate,
+		CreatedAt:    h.CreatedAt,
+	}
+}
+
+// matches 判断订阅是否关注该事件类型
+func (h *Webhook) matches(eventType string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, pattern := range h.Events {
+		if pattern == "*" || pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRequest 创建订阅请求体，secret 留空时自动生成
+type WebhookRequest struct {
+	Name         string   `json:"name,omitempty"`
+	URL          string   `json:"url"`
+	Events       []string `json:"events,omitempty"`
+	Secret       string   `json:"secret,omitempty"`
+	Enabled      *bool    `json:"enabled,omitempty"`       // 默认启用
+	AllowPrivate bool     `json:"allow_private,omitempty"` // 允许投递到本机与内网地址
+}
+
+// WebhookUpdateRequest 修改订阅请求体，字段留空表示不修改
+type WebhookUpdateRequest struct {
+	Name         *string   `json:"name,omitempty"`
+	URL          *string   `json:"url,omitempty"`
+	Events       *[]string `json:"events,omitempty"`
+	Secret       *string   `json:"secret,omitempty"`
+	Enabled      *bool     `json:"enabled,omitempty"`
+	AllowPrivate *bool     `json:"allow_private,omitempty"`
+}
+
+// WebhookCreateResponse 创建订阅的响应，密钥仅此一次可见
+type WebhookCreateResponse struct {
+	Secret  string      `json:"secret"`
+	Webhook WebhookInfo `json:"webhook"`
+}
+
+// validateWebhookURL 只接受带主机名的 http/https 地址
+func validateWebhookURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid webhook URL %q, use http:// or https://", raw)
+	}
+	return u.String(), nil
+}
+
+// nonPublicPrefixes IsPrivate 等方法之外不可路由到公网的网段
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// webhookPublicAddr 判断地址能否作为默认的 Webhook 目标
+// 拒绝本机、RFC 1918、ULA、链路本地 (含 169.254.169.254 元数据服务)、组播与未指定地址
+func webhookPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookTarget 创建与修改时提前拒绝明显指向内网的地址 (IP 字面量与 localhost)
+// 域名要到投递时才能解析，由 webhookDialControl 在连接前检查
+func checkWebhookTarget(target string, allowPrivate bool) error {
+	if allowPrivate {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errWebhookPrivateTarget
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !webhookPublicAddr(addr) {
+		return errWebhookPrivateTarget
+	}
+	return nil
+}
+
+// normalizeWebhookEvents 校验事件过滤，接受已知事件类型、前缀通配 (如 peer.*) 与 *
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	var out []string
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if e != "*" && !strings.HasSuffix(e, ".*") && !knownEventType(e) {
+			return nil, fmt.Errorf("unknown event type %q", e)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateWebhook 创建订阅，返回 (可能自动生成的) 密钥
+func (c *Config) CreateWebhook(req WebhookRequest) (string, WebhookInfo, error) {
+	target, err := validateWebhookURL(req.URL)
+	if err != nil {
+		return "", WebhookInfo{}, err
+	}
+	if err := checkWebhookTarget(target, req.AllowPrivate); err != nil {
+		return "", WebhookInfo{}, err
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return "", WebhookInfo{}, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			return "", WebhookInfo{}, err
+		}
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", WebhookInfo{}, err
+	}
+	hook := Webhook{
+		ID:           hex.EncodeToString(id),
+		Name:         strings.TrimSpace(req.Name),
+		URL:          target,
+		Events:       events,
+		Secret:       secret,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+		AllowPrivate: req.AllowPrivate,
+		CreatedAt:    time.Now(),
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+	c.Webhooks = append(c.Webhooks, hook)
+	return secret, hook.Info(), nil
+}
+
+// ListWebhooks 返回订阅列表
+func (c *Config) ListWebhooks() []WebhookInfo {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	hooks := make([]WebhookInfo, 0, len(c.Webhooks))
+	for i := range c.Webhooks {
+		hooks = append(hooks, c.Webhooks[i].Info())
+	}
+	return hooks
+}
+
+// FindWebhook 按 ID 查找订阅
+func (c *Config) FindWebhook(id string) (Webhook, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	for _, hook := range c.Webhooks {
+		if hook.ID == id {
+			return hook, true
+		}
+	}
+	return Webhook{}, false
+}
+
+// UpdateWebhook 修改订阅，未找到时返回 errWebhookNotFound
+func (c *Config) UpdateWebhook(id string, req WebhookUpdateRequest) (WebhookInfo, error) {
+	var target string
+	var events []string
+	var err error
+	if req.URL != nil {
+		if target, err = validateWebhookURL(*req.URL); err != nil {
+			return WebhookInfo{}, err
+		}
+	}
+	if req.Events != nil {
+		if events, err = normalizeWebhookEvents(*req.Events); err != nil {
+			return WebhookInfo{}, err
+		}
+	}
+	if req.Secret != nil && *req.Secret == "" {
+		return WebhookInfo{}, fmt.Errorf("secret must not be empty")
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i := range c.Webhooks {
+		hook := &c.Webhooks[i]
+		if hook.ID != id {
+			continue
+		}
+		// 地址与 allow_private 可能分别修改，按修改后的组合检查
+		newURL, allowPrivate := hook.URL, hook.AllowPrivate
+		if req.URL != nil {
+			newURL = target
+		}
+		if req.AllowPrivate != nil {
+			allowPrivate = *req.AllowPrivate
+		}
+		if err := checkWebhookTarget(newURL, allowPrivate); err != nil {
+			return WebhookInfo{}, err
+		}
+		if req.Name != nil {
+			hook.Name = strings.TrimSpace(*req.Name)
+		}
+		if req.URL != nil {
+			hook.URL = target
+		}
+		if req.Events != nil {
+			hook.Events = events
+		}
+		if req.Secret != nil {
+			hook.Secret = *req.Secret
+		}
+		if req.Enabled != nil {
+			hook.Enabled = *req.Enabled
+		}
+		hook.AllowPrivate = allowPrivate
+		return hook.Info(), nil
+	}
+	return WebhookInfo{}, errWebhookNotFound
+}
+
+// RemoveWebhook 删除订阅
+func (c *Config) RemoveWebhook(id string) bool {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for i, hook := range c.Webhooks {
+		if hook.ID == id {
+			c.Webhooks = append(c.Webhooks[:i], c.Webhooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// webhooksFor 返回关注该事件类型的已启用订阅
+func (c *Config) webhooksFor(eventType string) []Webhook {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	var hooks []Webhook
+	for _, hook := range c.Webhooks {
+		if hook.Enabled && hook.matches(eventType) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// ========== 投递 ==========
+
+// WebhookDelivery 单次事件投递及其重试结果
+type WebhookDelivery struct {
+	ID          string     `json:"id"`
+	WebhookID   string     `json:"webhook_id"`
+	Event       Event      `json:"event"`
+	ReplayOf    string     `json:"replay_of,omitempty"` // 重放时为原投递 ID
+	Status      string     `json:"status"`              // pending / succeeded / failed
+	Attempts    int        `json:"attempts"`
+	StatusCode  int        `json:"status_code,omitempty"` // 最近一次响应的状态码
+	Error       string     `json:"error,omitempty"`       // 最近一次失败原因
+	Response    string     `json:"response,omitempty"`    // 最近一次响应体 (截断)
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+// webhookLog 投递记录：内存保留最近的记录供查询与重放，完成的投递追加写入日志文件
+type webhookLog struct {
+	mu         sync.Mutex
+	path       string
+	deliveries []*WebhookDelivery // 按创建顺序
+}
+
+// webhookLogPath 投递日志与配置文件放在同一目录
+func webhookLogPath() string {
+	return filepath.Join(filepath.Dir(dataPath), "webhooks.log")
+}
+
+// newWebhookLog 读取日志文件中最近的记录；文件过长时只保留这些记录
+func newWebhookLog(path string) (*webhookLog, error) {
+	l := &webhookLog{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines++
+		var d WebhookDelivery
+		if json.Unmarshal(scanner.Bytes(), &d) != nil {
+			continue
+		}
+		l.deliveries = append(l.deliveries, &d)
+		if len(l.deliveries) > webhookLogSize {
+			l.deliveries = l.deliveries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return l, err
+	}
+	if lines > 2*webhookLogSize {
+		return l, l.rewrite()
+	}
+	return l, nil
+}
+
+// rewrite 用内存中的记录重写日志文件
+func (l *webhookLog) rewrite() error {
+	var buf bytes.Buffer
+	for _, d := range l.deliveries {
+		if d.Status != DeliveryPending {
+			data, _ := json.Marshal(d)
+			buf.Write(append(data, '\n'))
+		}
+	}
+	if err := os.WriteFile(l.path+".tmp", buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(l.path+".tmp", l.path)
+}
+
+// add 记录新的投递
+func (l *webhookLog) add(d *WebhookDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, d)
+	if len(l.deliveries) > webhookLogSize {
+		l.deliveries = l.deliveries[1:]
+	}
+}
+
+// update 在锁内修改投递记录，投递完成时追加写入日志文件
+func (l *webhookLog) update(d *WebhookDelivery, fn func(d *WebhookDelivery)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(d)
+	d.UpdatedAt = time.Now()
+	if d.Status == DeliveryPending {
+		return nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// list 返回订阅的投递记录，最新的在前，limit <= 0 为不限制
+func (l *webhookLog) list(webhookID string, limit int) []WebhookDelivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []WebhookDelivery{}
+	for i := len(l.deliveries) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if d := l.deliveries[i]; d.WebhookID == webhookID {
+			out = append(out, *d)
+		}
+	}
+	return out
+}
+
+// find 按 ID 查找投递记录
+func (l *webhookLog) find(webhookID, id string) (WebhookDelivery, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, d := range l.deliveries {
+		if d.ID == id && d.WebhookID == webhookID {
+			return *d, true
+		}
+	}
+	return WebhookDelivery{}, false
+}
+
+// signWebhook 签名为 HMAC-SHA256(secret, "<timestamp>.<body>") 的 Hex
+// 时间戳参与签名，接收方可据此拒绝重放的旧请求
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryable 网络错误、408、429 与 5xx 值得重试，其余状态码视为接收方拒绝
+func webhookRetryable(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// runWebhooks 订阅事件总线，为每个匹配的订阅创建投递
+func (ui *WebUI) runWebhooks() {
+	events, cancel := ui.events.Subscribe(webhookEventBuffer)
+	defer cancel()
+	for {
+		select {
+		case <-ui.done:
+			return
+		case e := <-events:
+			for _, hook := range ui.config.webhooksFor(e.Type) {
+				if _, err := ui.startDelivery(hook.ID, e, ""); err != nil {
+					ui.device.GetLogger().Errorf("Failed to start webhook delivery for %s: %v", hook.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// startDelivery 记录并在后台投递事件
+func (ui *WebUI) startDelivery(webhookID string, e Event, replayOf string) (WebhookDelivery, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return WebhookDelivery{}, err
+	}
+	now := time.Now()
+	d := &WebhookDelivery{
+		ID:        hex.EncodeToString(id),
+		WebhookID: webhookID,
+		Event:     e,
+		ReplayOf:  replayOf,
+		Status:    DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ui.webhookLog.add(d)
+	snapshot := *d
+	go ui.deliver(d)
+	return snapshot, nil
+}
+
+// deliver 投递并按退避间隔重试，直到成功、被拒绝、订阅被删除或停用、或达到次数上限
+func (ui *WebUI) deliver(d *WebhookDelivery) {
+	body, _ := json.Marshal(d.Event)
+	replay := d.ReplayOf != ""
+	wait := webhookRetryBase
+	for attempt := 1; ; attempt++ {
+		hook, ok := ui.config.FindWebhook(d.WebhookID)
+		if !ok || (!hook.Enabled && !replay) {
+			ui.finishDelivery(d, func(d *WebhookDelivery) {
+				d.Status = DeliveryFailed
+				d.Error = "webhook removed or disabled"
+			})
+			return
+		}
+
+		code, resp, err := ui.postWebhook(hook, d, body)
+		ok = err == nil && code >= 200 && code < 300
+		giveUp := !ok && (!webhookRetryable(code) || attempt >= webhookMaxAttempts)
+		ui.finishDelivery(d, func(d *WebhookDelivery) {
+			d.Attempts = attempt
+			d.StatusCode = code
+			d.Response = resp
+			d.Error = ""
+			d.NextAttempt = nil
+			switch {
+			case err != nil:
+				d.Error = err.Error()
+			case !ok:
+				d.Error = "HTTP " + strconv.Itoa(code)
+			}
+			switch {
+			case ok:
+				d.Status = DeliverySucceeded
+			case giveUp:
+				d.Status = DeliveryFailed
+			default:
+				next := time.Now().Add(wait)
+				d.NextAttempt = &next
+			}
+		})
+		if ok || giveUp {
+			return
+		}
+
+		select {
+		case <-ui.done:
+			return
+		case <-time.After(wait):
+		}
+		wait *= 3
+	}
+}
+
+// finishDelivery 更新投递记录，写日志失败只记录错误
+func (ui *WebUI) finishDelivery(d *WebhookDelivery, fn func(d *WebhookDelivery)) {
+	if err := ui.webhookLog.update(d, fn); err != nil {
+		ui.device.GetLogger().Errorf("Failed to write webhook delivery log: %v", err)
+	}
+}
+
+// postWebhook 发送一次请求，返回状态码 (网络错误时为 0) 与截断的响应体
+func (ui *WebUI) postWebhook(hook Webhook, d *WebhookDelivery, body []byte) (int, string, error) {
+	ui.webhookSlots <- struct{}{}
+	defer func() { <-ui.webhookSlots }()
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wireguard-go-webhook/1")
+	req.Header.Set("X-Webhook-ID", hook.ID)
+	req.Header.Set("X-Webhook-Delivery", d.ID)
+	req.Header.Set("X-Webhook-Event", d.Event.Type)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(hook.Secret, timestamp, body))
+	if d.ReplayOf != "" {
+		req.Header.Set("X-Webhook-Replay-Of", d.ReplayOf)
+	}
+
+	client := webhookClient
+	if hook.AllowPrivate {
+		client = webhookPrivateClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, string(snippet), nil
+}
+
+// webhookClient 只连接公网地址；webhookPrivateClient 用于开启 allow_private 的订阅
+var (
+	webhookClient        = newWebhookClient(false)
+	webhookPrivateClient = newWebhookClient(true)
+)
+
+// newWebhookClient 不跟随重定向，避免签名请求被转发到其他地址
+// 只允许公网地址时在连接前检查解析出的 IP (域名可能解析到内网，或在校验后改变解析结果)，
+// 并且不使用环境变量中的代理，否则实际连接的是代理，无法检查目标地址
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = webhookDialControl
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDialControl 拒绝连接非公网地址
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !webhookPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w (%s)", errWebhookPrivateTarget, addrPort.Addr())
+	}
+	return nil
+}
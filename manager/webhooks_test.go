@@ -0,0 +1,220 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookMatches(t *testing.T) {
+	tests := []struct {
+		events []string
+		typ    string
+		want   bool
+	}{
+		{nil, EventPeerAdded, true},
+		{[]string{"*"}, EventInviteCreated, true},
+		{[]string{EventPeerAdded}, EventPeerAdded, true},
+		{[]string{EventPeerAdded}, EventPeerRemoved, false},
+		{[]string{"peer.*"}, EventPeerOnline, true},
+		{[]string{"peer.*"}, EventInviteCreated, false},
+		{[]string{"invite.*", EventPeerOffline}, EventPeerOffline, true},
+	}
+	for _, tt := range tests {
+		h := Webhook{Events: tt.events}
+		if got := h.matches(tt.typ); got != tt.want {
+			t.Errorf("events %q, %s: %v, want %v", tt.events, tt.typ, got, tt.want)
+		}
+	}
+
+	got, err := normalizeWebhookEvents([]string{" peer.* ", "", EventInviteCreated, "*"})
+	if want := []string{"peer.*", EventInviteCreated, "*"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeWebhookEvents = %q, %v; want %q", got, err, want)
+	}
+	if _, err := normalizeWebhookEvents([]string{"peer.deleted"}); err == nil {
+		t.Error("accepted an unknown event type")
+	}
+}
+
+func TestCheckWebhookTarget(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		ok           bool
+	}{
+		{"https://hooks.example.com/wg", false, true},
+		{"http://203.0.113.10:8080/", false, true},
+		{"http://[2001:db8::1]/", false, true},
+		{"http://127.0.0.1/", false, false},
+		{"http://localhost:9000/", false, false},
+		{"http://api.LOCALHOST./", false, false},
+		{"http://10.1.2.3/", false, false},
+		{"http://192.168.1.1/", false, false},
+		{"http://169.254.169.254/latest/meta-data", false, false},
+		{"http://100.64.0.1/", false, false},
+		{"http://[::1]/", false, false},
+		{"http://[fd00::1]/", false, false},
+		{"http://[::ffff:127.0.0.1]/", false, false},
+		{"http://0.0.0.0/", false, false},
+		{"http://127.0.0.1/", true, true},
+	}
+	for _, tt := range tests {
+		err := checkWebhookTarget(tt.url, tt.allowPrivate)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkWebhookTarget(%q, %v) = %v, want ok %v", tt.url, tt.allowPrivate, err, tt.ok)
+		}
+	}
+
+	// 域名解析到内网地址时在连接前拒绝
+	if err := webhookDialControl("tcp", "10.0.0.1:443", nil); !errors.Is(err, errWebhookPrivateTarget) {
+		t.Errorf("webhookDialControl(10.0.0.1) = %v", err)
+	}
+	if err := webhookDialControl("tcp", "203.0.113.10:443", nil); err != nil {
+		t.Errorf("webhookDialControl(203.0.113.10) = %v", err)
+	}
+	if webhookPublicAddr(netip.MustParseAddr("198.18.0.1")) {
+		t.Error("benchmark network treated as public")
+	}
+
+	conf := &Config{}
+	for _, raw := range []string{"ftp://hooks.example.com/", "hooks.example.com", "http:///x", "http://127.0.0.1/"} {
+		if _, _, err := conf.CreateWebhook(WebhookRequest{URL: raw}); err == nil {
+			t.Errorf("CreateWebhook(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestWebhookRetryable(t *testing.T) {
+	for code, want := range map[int]bool{
+		0:   true, // 网络错误
+		200: false,
+		400: false,
+		404: false,
+		408: true,
+		429: true,
+		500: true,
+		503: true,
+	} {
+		if got := webhookRetryable(code); got != want {
+			t.Errorf("webhookRetryable(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+// webhookReceiver 校验签名的接收端，按请求路径返回状态码
+type webhookReceiver struct {
+	t        *testing.T
+	secret   string
+	requests chan *http.Request
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	ts, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	want := signWebhook(rcv.secret, ts, body)
+	if err != nil || !hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte(want)) {
+		rcv.t.Errorf("bad signature %q for timestamp %q", r.Header.Get("X-Webhook-Signature"), r.Header.Get("X-Webhook-Timestamp"))
+	}
+	if signWebhook(rcv.secret, ts+1, body) == want {
+		rcv.t.Error("timestamp not covered by the signature")
+	}
+	rcv.requests <- r
+	code, _ := strconv.Atoi(r.URL.Path[1:])
+	w.WriteHeader(code)
+	io.WriteString(w, "ack")
+}
+
+// waitDelivery 等待投递离开 pending 状态或出现下次重试时间
+func (tu *testUI) waitDelivery(webhookID, id string) WebhookDelivery {
+	tu.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		d, ok := tu.webhookLog.find(webhookID, id)
+		if ok && (d.Status != DeliveryPending || d.NextAttempt != nil) {
+			return d
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tu.t.Fatalf("delivery %s did not finish", id)
+	return WebhookDelivery{}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	tu := newTestUI(t)
+	rcv := &webhookReceiver{t: t, secret: "whsec_test", requests: make(chan *http.Request, 16)}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	disabled := false
+	create := func(path string, enabled *bool) string {
+		_, info, err := tu.config.CreateWebhook(WebhookRequest{URL: srv.URL + path, Secret: rcv.secret, AllowPrivate: true, Enabled: enabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ID
+	}
+	tests := []struct {
+		name     string
+		path     string
+		enabled  *bool
+		replayOf string
+		status   string
+		attempts int
+		retry    bool // 已安排下次重试
+		requests int
+	}{
+		{"success", "/204", nil, "", DeliverySucceeded, 1, false, 1},
+		{"rejected", "/400", nil, "", DeliveryFailed, 1, false, 1},
+		{"server error", "/503", nil, "", DeliveryPending, 1, true, 1},
+		{"disabled", "/204", &disabled, "", DeliveryFailed, 0, false, 0},
+		{"replay of disabled", "/204", &disabled, "0011223344556677", DeliverySucceeded, 1, false, 1},
+	}
+	e := Event{ID: 7, Type: EventPeerAdded, Peer: testKey(1), Time: time.Now()}
+	for _, tt := range tests {
+		id := create(tt.path, tt.enabled)
+		started, err := tu.startDelivery(id, e, tt.replayOf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := tu.waitDelivery(id, started.ID)
+		if d.Status != tt.status || d.Attempts != tt.attempts || (d.NextAttempt != nil) != tt.retry {
+			t.Errorf("%s: %+v", tt.name, d)
+		}
+		for i := 0; i < tt.requests; i++ {
+			r := <-rcv.requests
+			if r.Header.Get("X-Webhook-ID") != id || r.Header.Get("X-Webhook-Delivery") != started.ID ||
+				r.Header.Get("X-Webhook-Event") != EventPeerAdded || r.Header.Get("X-Webhook-Replay-Of") != tt.replayOf {
+				t.Errorf("%s: headers %v", tt.name, r.Header)
+			}
+		}
+	}
+	close(tu.done) // 结束等待重试的投递
+
+	// 完成的投递写入日志，重启后仍可查询与重放
+	l, err := newWebhookLog(webhookLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := 0
+	for _, d := range l.deliveries {
+		if d.Status == DeliveryPending {
+			t.Errorf("pending delivery %s persisted", d.ID)
+		}
+		finished++
+	}
+	if finished != 4 {
+		t.Errorf("%d deliveries in the log, want 4", finished)
+	}
+}
@@ -9,18 +9,21 @@
 package manager
 
 import (
-	"crypto/sha256"
-	"crypto/subtle"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
-	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/crypto/acme/autocert"
 	"golang.zx2c4.com/wireguard/device"
 )
 
@@ -28,17 +31,69 @@ const sessionCookieName = "wg_ui_session"
 
 // PeerInfo 对等体信息结构，用于 JSON 序列化
 type PeerInfo struct {
-	Remark            string   `json:"remark"`             // 备注名
-	PublicKey         string   `json:"public_key"`         // 公钥 (Base64)
-	Endpoint          string   `json:"endpoint"`           // UDP 端点
-	AllowedIPs        []string `json:"allowed_ips"`        // VPN IP 列表
-	LastHandshake     string   `json:"last_handshake"`     // 最后握手时间
-	TxBytes           uint64   `json:"tx_bytes"`           // 发送字节数
-	RxBytes           uint64   `json:"rx_bytes"`           // 接收字节数
-	TotalBytes        uint64   `json:"total_bytes"`        // 累计总流量
-	IsRunning         bool     `json:"is_running"`         // 是否运行中
-	IsOnline          bool     `json:"is_online"`          // 是否在线 (基于握手时间)
-	KeepaliveInterval uint32   `json:"keepalive_interval"` // 保活间隔
+	Remark            string        `json:"remark"`             // 备注名
+	PublicKey         string        `json:"public_key"`         // 公钥 (Base64)
+	Endpoint          string        `json:"endpoint"`           // UDP 端点
+	AllowedIPs        []string      `json:"allowed_ips"`        // VPN IP 列表
+	LastHandshake     string        `json:"last_handshake"`     // 最后握手时间
+	TxBytes           uint64        `json:"tx_bytes"`           // 发送字节数
+	RxBytes           uint64        `json:"rx_bytes"`           // 接收字节数
+	TotalBytes        uint64        `json:"total_bytes"`        // 累计总流量
+	LifetimeTxBytes   uint64        `json:"lifetime_tx_bytes"`  // 历史累计发送字节数 (跨重启)
+	LifetimeRxBytes   uint64        `json:"lifetime_rx_bytes"`  // 历史累计接收字节数 (跨重启)
+	IsRunning         bool          `json:"is_running"`         // 是否运行中
+	IsOnline          bool          `json:"is_online"`          // 是否在线 (基于握手时间)
+	KeepaliveInterval uint32        `json:"keepalive_interval"` // 保活间隔
+	Tags              []string      `json:"tags,omitempty"`     // 标签
+	Disabled          bool          `json:"disabled,omitempty"` // 已停用 (不在设备上)
+	Counters          *PeerCounters `json:"counters,omitempty"` // 报文、丢包与握手计数，已停用的 Peer 没有
+
+	handshake time.Time // 最后握手时间，gRPC 接口使用
+}
+
+// PeerCounters 报文、丢包与握手计数，从 Peer 添加到设备时开始累计
+type PeerCounters struct {
+	TxPackets          uint64    `json:"tx_packets"`          // 发出的 UDP 报文数 (含握手)
+	RxPackets          uint64    `json:"rx_packets"`          // 收到并通过认证的报文数 (含握手与保活)
+	Drops              PeerDrops `json:"drops"`               // 按原因统计的丢包数
+	HandshakesSent     uint64    `json:"handshakes_sent"`     // 发出的握手请求 (含重试)
+	HandshakesReceived uint64    `json:"handshakes_received"` // 收到的有效握手请求
+	HandshakesFailed   uint64    `json:"handshakes_failed"`   // 重试次数用尽，放弃握手
+	Rekeys             uint64    `json:"rekeys"`              // 新会话密钥替换旧密钥的次数
+}
+
+// PeerDrops 按原因统计的丢包数
+type PeerDrops struct {
+	AllowedIPs     uint64 `json:"allowed_ips"`     // 内层源地址不在该 Peer 的 AllowedIPs 中
+	Replay         uint64 `json:"replay"`          // 重放或落在重放窗口之外
+	Decrypt        uint64 `json:"decrypt"`         // 解密或认证失败
+	StagedOverflow uint64 `json:"staged_overflow"` // 等待握手的暂存队列已满
+	NoKeypair      uint64 `json:"no_keypair"`      // 握手失败，没有可用的会话密钥
+	Oversize       uint64 `json:"oversize"`        // 内层包过大，无法封装进一个 UDP 报文
+}
+
+// Total 各原因丢包数之和
+func (d PeerDrops) Total() uint64 {
+	return d.AllowedIPs + d.Replay + d.Decrypt + d.StagedOverflow + d.NoKeypair + d.Oversize
+}
+
+func peerCounters(st device.PeerStats) *PeerCounters {
+	return &PeerCounters{
+		TxPackets: st.TxPackets,
+		RxPackets: st.RxPackets,
+		Drops: PeerDrops{
+			AllowedIPs:     st.DropAllowedIPs,
+			Replay:         st.DropReplay,
+			Decrypt:        st.DropDecrypt,
+			StagedOverflow: st.DropStagedOverflow,
+			NoKeypair:      st.DropNoKeypair,
+			Oversize:       st.DropOversize,
+		},
+		HandshakesSent:     st.HandshakesSent,
+		HandshakesReceived: st.HandshakesReceived,
+		HandshakesFailed:   st.HandshakesFailed,
+		Rekeys:             st.Rekeys,
+	}
 }
 
 // DeviceInfo 设备信息结构，用于 JSON 序列化
@@ -51,136 +106,473 @@ type DeviceInfo struct {
 
 // WebUI HTTP 服务器
 type WebUI struct {
-	device       *device.Device
-	config       *Config
-	server       *http.Server
-	passwordHash [32]byte
-	sessionToken string
+	device   *device.Device
+	config   *Config
+	server   *http.Server
+	sessions *sessionStore
+	guard    *loginGuard
+	audit    *AuditLog
+
+	redirect       *http.Server            // HTTP 跳转 HTTPS (可选)
+	acme           *autocert.Manager       // ACME 证书管理 (acme 模式)
+	tlsCert        func() *tls.Certificate // 当前证书 (file/self-signed 模式)
+	tlsFingerprint string                  // 自签名证书指纹，附加到邀请链接
+
+	admin    *http.Server   // 管理面 (分离模式)
+	adminNet *AdminNet      // netstack 管理地址 (可选)
+	done     chan struct{}  // Stop 时关闭
+	events   *EventBus      // 管理事件
+	metrics  managerMetrics // 管理层计数器 (/metrics)
+	grpc     *grpcServer    // gRPC 控制接口 (可选)
+	history  *historyStore  // Peer 流量与在线历史
+	mqtt     *mqttBridge    // MQTT 信令桥 (可选)
+
+	pages *pageSet // 页面模板与多语言文案
+
+	webhookLog    *webhookLog   // Webhook 投递记录
+	webhookSlots  chan struct{} // 限制同时进行的 Webhook 请求数
+	diagnoseSlots chan struct{} // 限制同时进行的 Peer 诊断数
+	speedtestSlot chan struct{} // 同一时间只进行一个吞吐测试
+	stun          stunState     // STUN 应答端与探测结果
+	portmap       *portMapState // 路由器端口映射 (可选)
+	uapiSocket    string        // UAPI 套接字路径，供健康检查连接
+	healthCache   healthCache   // 最近一次健康检查结果
+
+	shutdownOnce sync.Once // Shutdown 与 Stop 只执行一次
+	shutdownErr  error     // 第一次 Shutdown 的结果
 }
 
 // NewWebUI 创建 Web UI 服务器
 func NewWebUI(dev *device.Device, conf *Config, addr string) *WebUI {
-	password := os.Getenv("WEBUI_PASSWORD")
-	if password == "" {
-		password = "admin" // 生产环境请务必设置环境变量
-	}
-
 	ui := &WebUI{
-		device:       dev,
-		config:       conf,
-		passwordHash: sha256.Sum256([]byte(password)),
-		sessionToken: fmt.Sprintf("%x", sha256.Sum256([]byte(time.Now().String()+password))),
+		device: dev,
+		config: conf,
+		guard:  newLoginGuard(conf.System.LoginIPv6Prefix),
+		audit:  NewAuditLog(auditLogPath()),
+		done:   make(chan struct{}),
+		events: NewEventBus(),
+
+		webhookSlots:  make(chan struct{}, webhookConcurrency),
+		diagnoseSlots: make(chan struct{}, diagnoseConcurrency),
+		speedtestSlot: make(chan struct{}, 1),
+	}
+	history, err := newHistoryStore(historyDir())
+	if err != nil {
+		dev.GetLogger().Errorf("Failed to load peer history state, lifetime totals restart from zero: %v", err)
+	}
+	ui.history = history
+	if ui.webhookLog, err = newWebhookLog(webhookLogPath()); err != nil {
+		dev.GetLogger().Errorf("Failed to load webhook delivery log: %v", err)
+	}
+	if ui.pages, err = loadPages(conf.System.UI.Dir); err != nil {
+		// 定制目录有误时退回内置页面，不影响 API 与隧道
+		dev.GetLogger().Errorf("Failed to load WebUI templates from %q, using built-in pages: %v", conf.System.UI.Dir, err)
+		if ui.pages, err = loadPages(""); err != nil {
+			panic(err)
+		}
+	}
+	ui.sessions = newSessionStore(ui.sessionIdleTimeout, ui.sessionMaxAge)
+
+	// 首次启动：创建引导管理员 (初始密码取自 WEBUI_PASSWORD，默认 admin，首次登录强制修改)
+	if created, err := conf.EnsureAdminUser(); err != nil {
+		dev.GetLogger().Errorf("Failed to create bootstrap admin user: %v", err)
+	} else if created {
+		if err := SaveConfig(conf); err != nil {
+			dev.GetLogger().Errorf("Failed to save bootstrap admin user: %v", err)
+		}
+		dev.GetLogger().Verbosef("Bootstrap WebUI user %q created, password change required on first login", defaultAdminUsername)
 	}
 
 	mux := http.NewServeMux()
+	ui.registerPublicRoutes(mux)
+	ui.registerAdminRoutes(mux)
+	ui.registerAPIV1(mux)
+	handler := ui.legacyAliases(mux)
+
+	// 分离模式：主监听只提供公开入口，管理面单独监听在隧道内
+	if m := &conf.System.Management; m.Split {
+		public := http.NewServeMux()
+		ui.registerPublicRoutes(public)
+		if m.PublicAddr != "" {
+			addr = m.PublicAddr
+		}
+		ui.server = &http.Server{Addr: addr, Handler: ui.hstsMiddleware(public)}
+		ui.admin = &http.Server{Handler: ui.hstsMiddleware(ui.adminPeerMiddleware(ui.corsMiddleware(handler)))}
+	} else {
+		ui.server = &http.Server{Addr: addr, Handler: ui.hstsMiddleware(ui.corsMiddleware(handler))}
+	}
 
-	// 公共接口
-	// 公共接口
-	mux.HandleFunc("/login", ui.handleLogin)
+	return ui
+}
+
+// registerPublicRoutes 注册无需登录的公开入口
+func (ui *WebUI) registerPublicRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/join/", ui.handleJoin)
+	mux.HandleFunc("/api/register", ui.handleRegister) // 通过邀请码鉴权
+	mux.HandleFunc("/ui/static/", ui.handleStatic)     // 定制 Logo 与样式，登录页同样需要
+}
 
-	// 受保护接口 (包装中间件)
-	mux.HandleFunc("/api/status", ui.authMiddleware(ui.handleStatus))
-	mux.HandleFunc("/api/peers", ui.authMiddleware(ui.handlePeers))
-	mux.HandleFunc("/api/peer/add", ui.authMiddleware(ui.handlePeerAdd))
-	mux.HandleFunc("/api/peer/remove", ui.authMiddleware(ui.handlePeerRemove))
-	mux.HandleFunc("/api/config", ui.authMiddleware(ui.handleConfig))
-	mux.HandleFunc("/api/invites/generate", ui.authMiddleware(ui.handleInviteGenerate))
-	mux.HandleFunc("/api/invites/list", ui.authMiddleware(ui.handleInviteList))
-	mux.HandleFunc("/api/invites/remove", ui.authMiddleware(ui.handleInviteRemove))
-	mux.HandleFunc("/api/system/config", ui.authMiddleware(ui.handleSystemConfig))
-	mux.HandleFunc("/api/enroll", ui.authMiddleware(ui.handleEnroll))
-	mux.HandleFunc("/api/register", ui.handleRegister) // 公开接口，通过 Token 鉴权
-	mux.HandleFunc("/api/hello", ui.authMiddleware(ui.handleHello))
-	mux.HandleFunc("/docs", ui.authMiddleware(ui.handleDocs))
-	mux.HandleFunc("/", ui.authMiddleware(ui.handleIndex))
-
-	ui.server = &http.Server{
-		Addr:    addr,
-		Handler: mux,
-	}
+// registerAdminRoutes 注册登录页与受保护的管理接口
+func (ui *WebUI) registerAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/login", ui.handleLogin)
+	mux.HandleFunc("/logout", ui.handleLogout)
+	// 编排系统的存活与就绪探测：无需登录，但只在管理面提供，匿名调用方只看到总体状态
+	mux.HandleFunc("/healthz", ui.handleHealthz)
+	mux.HandleFunc("/readyz", ui.handleReadyz)
 
-	return ui
+	// 受保护接口 (包装中间件)
+	mux.HandleFunc("/api/status", ui.authMiddleware(allow(PermStatusRead), ui.handleStatus))
+	mux.HandleFunc("/api/peers", ui.authMiddleware(allow(PermStatusRead), ui.handlePeers))
+	mux.HandleFunc("/api/peers/{key}/history", ui.authMiddleware(allow(PermStatusRead), ui.handlePeerHistory))
+	mux.HandleFunc("/api/peers/{key}/diagnose", ui.authMiddleware(allow(PermStatusRead), ui.handlePeerDiagnose))
+	mux.HandleFunc("/api/peers/{key}/speedtest", ui.authMiddleware(allow(PermPeersWrite), ui.handlePeerSpeedtest))
+	mux.HandleFunc("/api/peer/add", ui.authMiddleware(allow(PermPeersWrite), ui.handlePeerAdd))
+	mux.HandleFunc("/api/peer/remove", ui.authMiddleware(allow(PermPeersWrite), ui.handlePeerRemove))
+	mux.HandleFunc("/api/peer/tags", ui.authMiddleware(allow(PermPeersWrite), ui.handlePeerTags))
+	mux.HandleFunc("/api/config", ui.authMiddleware(allow(PermConfigRaw), ui.handleConfig))
+	mux.HandleFunc("/api/invites/generate", ui.authMiddleware(allow(PermInvitesWrite), ui.handleInviteGenerate))
+	mux.HandleFunc("/api/invites/list", ui.authMiddleware(allow(PermInvitesRead), ui.handleInviteList))
+	mux.HandleFunc("/api/invites/remove", ui.authMiddleware(allow(PermInvitesWrite), ui.handleInviteRemove))
+	mux.HandleFunc("/api/system/config", ui.authMiddleware(allowRW(PermSystemRead, PermSystemWrite), ui.handleSystemConfig))
+	mux.HandleFunc("/api/enroll", ui.authMiddleware(allow(PermSystemWrite), ui.handleEnroll))
+	mux.HandleFunc("/api/users", ui.authMiddleware(allow(PermUsersManage), ui.handleUsers))
+	mux.HandleFunc("/api/roles", ui.authMiddleware(allow(PermUsersManage), ui.handleRoles))
+	mux.HandleFunc("/api/audit", ui.authMiddleware(allow(PermUsersManage), ui.handleAudit))
+	mux.HandleFunc("/api/tls", ui.authMiddleware(allow(PermStatusRead), ui.handleTLS))
+	mux.HandleFunc("/api/events", ui.authMiddleware(allow(PermStatusRead), ui.handleEvents))
+	mux.HandleFunc("/api/tokens", ui.authMiddleware(allow(permAuthenticated), ui.handleTokens))
+	mux.HandleFunc("/api/me", ui.authMiddleware(allow(permAuthenticated), ui.handleMe))
+	mux.HandleFunc("/metrics", ui.authMiddleware(allow(PermStatusRead), ui.handleMetrics))
+	mux.HandleFunc("/api/hello", ui.authMiddleware(allow(PermStatusRead), ui.handleHello))
+	mux.HandleFunc("/account/password", ui.authMiddleware(allow(permAuthenticated), ui.handlePasswordChange))
+	mux.HandleFunc("/docs", ui.authMiddleware(allow(permAuthenticated), ui.handleDocs))
+	mux.HandleFunc("/", ui.authMiddleware(allow(permAuthenticated), ui.handleIndex))
 }
 
-// authMiddleware 认证中间件
-func (ui *WebUI) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// authMiddleware 认证与授权中间件
+// 支持浏览器会话 Cookie 与 Authorization: Bearer 令牌两种方式，rule 为访问该接口所需的权限
+func (ui *WebUI) authMiddleware(rule access, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie(sessionCookieName)
-		if err != nil || cookie.Value != ui.sessionToken {
-			if strings.HasPrefix(r.URL.Path, "/api/") {
-				w.WriteHeader(http.StatusUnauthorized)
-				json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
-				return
+		var p principal
+		var ok bool
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			p, ok = ui.authenticateToken(w, r, strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+		} else {
+			p, ok = ui.authenticateSession(w, r)
+		}
+		if !ok {
+			return
+		}
+
+		perm := rule.required(r.Method)
+		if err := authorize(&p, perm, remoteAddr(r)); err != nil {
+			if err.Code == ErrCodeInsufficientScope {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, perm))
 			}
-			http.Redirect(w, r, "/login", http.StatusFound)
+			writeForbidden(w, r, err.Code, err.Message)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withPrincipal(r, p))
+	}
+}
+
+// authenticateSession 校验浏览器会话，失败时已写入响应
+func (ui *WebUI) authenticateSession(w http.ResponseWriter, r *http.Request) (principal, bool) {
+	var user User
+	username, sessionToken, ok := "", "", false
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		sessionToken = cookie.Value
+		username, ok = ui.sessions.Lookup(sessionToken)
+	}
+	if ok {
+		// 账号可能已被其他管理员删除
+		user, ok = ui.config.FindUser(username)
+	}
+	var role Role
+	if ok {
+		role, ok = ui.config.FindRole(user.Role)
+	}
+	if !ok {
+		if isAPIRequest(r) {
+			writeAPIError(w, r, apiErrorf(http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized"))
+			return principal{}, false
+		}
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return principal{}, false
+	}
+
+	// 浏览器会自动携带 Cookie，写请求必须额外提交 CSRF 令牌
+	if !checkCSRF(r, sessionToken) {
+		ui.rejectCSRF(w, r, username)
+		return principal{}, false
+	}
+
+	// 引导账号或被重置密码的账号，必须先修改密码才能继续操作
+	if user.MustChangePassword && r.URL.Path != "/account/password" {
+		if isAPIRequest(r) {
+			writeForbidden(w, r, ErrCodePasswordChangeRequired, "Password change required")
+			return principal{}, false
+		}
+		http.Redirect(w, r, "/account/password", http.StatusFound)
+		return principal{}, false
+	}
+	return principal{
+		Username:    username,
+		Role:        role,
+		Permissions: role.Permissions,
+		CSRFToken:   csrfToken(sessionToken),
+	}, true
+}
+
+// authorize 检查认证主体是否可以从 addr 访问需要 perm 权限的接口，HTTP 与 gRPC 共用
+func authorize(p *principal, perm Permission, addr netip.Addr) *APIError {
+	if p.TokenID != "" && perm == permAuthenticated {
+		return apiErrorf(http.StatusForbidden, ErrCodeForbidden, "API tokens cannot access this endpoint")
+	}
+	if !p.Role.allowsAddr(addr) {
+		return apiErrorf(http.StatusForbidden, ErrCodeForbidden, "Access from this network is not allowed for role %s", p.Role.Name)
+	}
+	if !p.can(perm) {
+		code := ErrCodeForbidden
+		if p.TokenID != "" {
+			code = ErrCodeInsufficientScope
+		}
+		return apiErrorf(http.StatusForbidden, code, "Permission %q required", perm)
+	}
+	return nil
+}
+
+// authenticateToken 校验 API 令牌，失败时已写入响应
+func (ui *WebUI) authenticateToken(w http.ResponseWriter, r *http.Request, plain string) (principal, bool) {
+	p, err := ui.tokenPrincipal(plain, remoteAddr(r))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeAPIError(w, r, err)
+		return principal{}, false
+	}
+	return p, true
+}
+
+// tokenPrincipal 校验 API 令牌并返回对应的认证主体
+func (ui *WebUI) tokenPrincipal(plain string, addr netip.Addr) (principal, error) {
+	token, persist, err := ui.config.ValidateAPIToken(plain, addr)
+	var role Role
+	if err == nil {
+		if user, ok := ui.config.FindUser(token.Owner); !ok {
+			err = fmt.Errorf("token owner no longer exists")
+		} else if role, ok = ui.config.FindRole(user.Role); !ok {
+			err = fmt.Errorf("token owner has an unknown role")
+		}
+	}
+	if err != nil {
+		return principal{}, apiErrorf(http.StatusUnauthorized, ErrCodeInvalidToken, "Unauthorized: %v", err)
+	}
+	if persist {
+		if err := SaveConfig(ui.config); err != nil {
+			ui.device.GetLogger().Errorf("Failed to save token usage: %v", err)
+		}
+	}
+	return principal{
+		Username:    token.Owner,
+		TokenID:     token.ID,
+		Role:        role,
+		Permissions: tokenPermissions(&token, &role),
+	}, nil
+}
+
+// isAPIRequest 接口请求 (含 /metrics) 认证失败时返回 JSON 错误而非跳转登录页
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/metrics"
+}
+
+// writeForbidden 返回 403，页面请求返回纯文本
+func writeForbidden(w http.ResponseWriter, r *http.Request, code, msg string) {
+	if isAPIRequest(r) {
+		writeAPIError(w, r, &APIError{Status: http.StatusForbidden, Code: code, Message: msg})
+		return
 	}
+	http.Error(w, msg, http.StatusForbidden)
+}
+
+// setSessionCookie 下发会话 Cookie
+func (ui *WebUI) setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(ui.sessionMaxAge().Seconds()),
+	})
 }
 
 // Start 启动 Web UI 服务器
 func (ui *WebUI) Start() error {
 	ui.device.GetLogger().Verbosef("WebUI server starting on %s", ui.server.Addr)
 
-	// 启动 UDP Echo Server (用于测试 UDP 连通性)
+	// STUN 应答端与公网地址探测 (用于测试 UDP 连通性与 NAT 类型)
+	ui.startSTUN()
+	if err := ui.startPortMap(); err != nil {
+		return fmt.Errorf("port mapping: %w", err)
+	}
+
+	tlsConf, err := ui.setupTLS()
+	if err != nil {
+		return err
+	}
+	ui.server.TLSConfig = tlsConf
 	go func() {
-		addr, err := net.ResolveUDPAddr("udp", ":8090")
-		if err != nil {
-			ui.device.GetLogger().Errorf("UDP Echo define addr error: %v", err)
-			return
+		var err error
+		if tlsConf != nil {
+			err = ui.server.ListenAndServeTLS("", "")
+		} else {
+			err = ui.server.ListenAndServe()
 		}
-		conn, err := net.ListenUDP("udp", addr)
-		if err != nil {
-			ui.device.GetLogger().Errorf("UDP Echo listen error: %v", err)
-			return
+		if err != http.ErrServerClosed {
+			ui.device.GetLogger().Errorf("WebUI server error: %v", err)
 		}
-		defer conn.Close()
-		ui.device.GetLogger().Verbosef("UDP Echo Server listening on :8090")
+	}()
 
-		buf := make([]byte, 1024)
-		for {
-			_, remoteAddr, err := conn.ReadFromUDP(buf)
-			if err != nil {
-				continue
-			}
-			// 回复固定的 Hello 消息
-			conn.WriteToUDP([]byte("hello,from udp!"), remoteAddr)
+	if ui.admin != nil {
+		if err := ui.startAdmin(tlsConf); err != nil {
+			return fmt.Errorf("management listener: %w", err)
 		}
-	}()
+	}
+	if err := ui.startGRPC(tlsConf); err != nil {
+		return fmt.Errorf("gRPC listener: %w", err)
+	}
+	go ui.forwardDeviceEvents(ui.device.Subscribe(0, device.EventHandshakeCompleted, device.EventEndpointChanged, device.EventDeviceUp, device.EventDeviceDown))
+	go ui.watchDevice()
+	go ui.runHistory()
+	go ui.runWebhooks()
+	go ui.runSpeedtestResponder()
+	if err := ui.startMQTT(); err != nil {
+		return fmt.Errorf("MQTT bridge: %w", err)
+	}
+
+	// 明文端口：跳转到 HTTPS，ACME 模式下同时应答 HTTP-01 验证
+	if addr := ui.config.System.TLS.RedirectAddr; tlsConf != nil && addr != "" {
+		handler := ui.redirectHandler()
+		if ui.acme != nil {
+			handler = ui.acme.HTTPHandler(handler)
+		}
+		ui.redirect = &http.Server{Addr: addr, Handler: handler}
+		go func() {
+			if err := ui.redirect.ListenAndServe(); err != http.ErrServerClosed {
+				ui.device.GetLogger().Errorf("WebUI redirect server error: %v", err)
+			}
+		}()
+		ui.device.GetLogger().Verbosef("WebUI HTTP redirect listening on %s", addr)
+	}
+	return nil
+}
+
+// startAdmin 启动管理面监听
+// 隧道地址可能尚未配置到网卡上 (例如客户端尚未入驻)，监听失败时定期重试
+func (ui *WebUI) startAdmin(tlsConf *tls.Config) error {
+	addr, err := ui.config.System.adminListenAddr()
+	if err != nil {
+		return err
+	}
+	ui.admin.Addr = addr
+	ui.admin.TLSConfig = tlsConf
 
 	go func() {
-		if err := ui.server.ListenAndServe(); err != http.ErrServerClosed {
-			ui.device.GetLogger().Errorf("WebUI server error: %v", err)
+		logged := false
+		for {
+			ln, err := ui.listenAdmin(addr)
+			if err == nil {
+				ui.device.GetLogger().Verbosef("WebUI management plane listening on %s", addr)
+				if tlsConf != nil {
+					err = ui.admin.ServeTLS(ln, "", "")
+				} else {
+					err = ui.admin.Serve(ln)
+				}
+				if err != http.ErrServerClosed {
+					ui.device.GetLogger().Errorf("WebUI management server error: %v", err)
+				}
+				return
+			}
+			if !logged {
+				ui.device.GetLogger().Errorf("WebUI management listen on %s failed, retrying: %v", addr, err)
+				logged = true
+			}
+			select {
+			case <-ui.done:
+				return
+			case <-time.After(adminListenRetry):
+			}
 		}
 	}()
 	return nil
 }
 
-// Stop 停止 Web UI 服务器
+// listenAdmin 在隧道地址或 netstack 管理地址上监听
+func (ui *WebUI) listenAdmin(addr string) (net.Listener, error) {
+	if ui.adminNet == nil {
+		return net.Listen("tcp", addr)
+	}
+	ap, err := netip.ParseAddrPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ap.Addr() != ui.adminNet.Addr() {
+		return nil, fmt.Errorf("admin address %s is not the netstack address %s", ap.Addr(), ui.adminNet.Addr())
+	}
+	return ui.adminNet.Listen(ap.Port())
+}
+
+// SetAdminNet 让管理面运行在 netstack 管理地址上，需在 Start 之前调用
+func (ui *WebUI) SetAdminNet(a *AdminNet) {
+	ui.adminNet = a
+}
+
+// Stop 立即停止 Web UI 服务器：不等待进行中的请求，其余步骤同 Shutdown
 func (ui *WebUI) Stop() error {
-	return ui.server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ui.Shutdown(ctx)
+}
+
+// Scheme 返回 WebUI 对外使用的协议 (http 或 https)
+func (ui *WebUI) Scheme() string {
+	if ui.config.System.TLS.enabled() {
+		return "https"
+	}
+	return "http"
 }
 
 // handleStatus 返回设备状态 JSON
 func (ui *WebUI) handleStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	info := ui.getDeviceInfo()
+	info := ui.visibleDeviceInfo(currentPrincipal(r))
 	json.NewEncoder(w).Encode(info)
 }
 
 // handlePeers 返回对等体列表 JSON
 func (ui *WebUI) handlePeers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	info := ui.getDeviceInfo()
+	info := ui.visibleDeviceInfo(currentPrincipal(r))
 	json.NewEncoder(w).Encode(info.Peers)
 }
 
+// visibleDeviceInfo 按当前角色的 Peer 标签范围过滤设备信息
+func (ui *WebUI) visibleDeviceInfo(p principal) DeviceInfo {
+	info := ui.getDeviceInfo()
+	var peers []PeerInfo
+	for _, peer := range info.Peers {
+		if p.canSeePeer(peer.Tags) {
+			peers = append(peers, peer)
+		}
+	}
+	info.Peers = peers
+	info.PeerCount = len(peers)
+	return info
+}
+
 // getDeviceInfo 获取设备完整信息
 func (ui *WebUI) getDeviceInfo() DeviceInfo {
 	dev := ui.device
@@ -197,6 +589,9 @@ func (ui *WebUI) getDeviceInfo() DeviceInfo {
 		peerInfo := ui.getPeerInfo(p)
 		peers = append(peers, peerInfo)
 	})
+	for _, record := range ui.config.DisabledPeers() {
+		peers = append(peers, ui.disabledPeerInfo(record))
+	}
 
 	// 动态排序：优先按在线状态(降序)，再按备注名(升序)
 	sort.Slice(peers, func(i, j int) bool {
@@ -214,6 +609,11 @@ func (ui *WebUI) getDeviceInfo() DeviceInfo {
 	}
 }
 
+// peerOnline 计算是否在线：最后握手在 135 秒内 (WireGuard 默认握手超时约 2 分钟)
+func peerOnline(lastHandshakeNano int64) bool {
+	return lastHandshakeNano > 0 && time.Since(time.Unix(0, lastHandshakeNano)) < 135*time.Second
+}
+
 // getPeerInfo 获取单个对等体信息
 func (ui *WebUI) getPeerInfo(peer *device.Peer) PeerInfo {
 	// 获取公钥
@@ -228,9 +628,10 @@ func (ui *WebUI) getPeerInfo(peer *device.Peer) PeerInfo {
 	// 获取最后握手时间
 	lastHandshakeNano := peer.GetLastHandshakeNano()
 	lastHandshake := "从未"
+	var handshake time.Time
 	if lastHandshakeNano > 0 {
-		t := time.Unix(0, lastHandshakeNano)
-		lastHandshake = t.Format("2006-01-02 15:04:05")
+		handshake = time.Unix(0, lastHandshakeNano)
+		lastHandshake = handshake.Format("2006-01-02 15:04:05")
 	}
 
 	// 获取备注
@@ -239,16 +640,11 @@ func (ui *WebUI) getPeerInfo(peer *device.Peer) PeerInfo {
 		remark = "未命名"
 	}
 
-	tx, rx := peer.GetTrafficStats()
+	stats := peer.GetStats()
+	tx, rx := stats.TxBytes, stats.RxBytes
 
-	// 计算是否在线：最后握手在 135 秒内 (WireGuard 默认握手超时约 2 分钟)
-	isOnline := false
-	if lastHandshakeNano > 0 {
-		since := time.Since(time.Unix(0, lastHandshakeNano))
-		if since < time.Second*135 {
-			isOnline = true
-		}
-	}
+	isOnline := peerOnline(lastHandshakeNano)
+	lifetime := ui.history.lifetime(publicKey, tx, rx)
 
 	return PeerInfo{
 		Remark:            remark,
@@ -259,740 +655,46 @@ func (ui *WebUI) getPeerInfo(peer *device.Peer) PeerInfo {
 		TxBytes:           tx,
 		RxBytes:           rx,
 		TotalBytes:        tx + rx,
+		LifetimeTxBytes:   lifetime.TxBytes,
+		LifetimeRxBytes:   lifetime.RxBytes,
 		IsRunning:         peer.GetIsRunning(),
 		IsOnline:          isOnline,
 		KeepaliveInterval: peer.GetKeepaliveInterval(),
+		Tags:              ui.config.PeerTags(publicKey),
+		Counters:          peerCounters(stats),
+		handshake:         handshake,
+	}
+}
+
+// disabledPeerInfo 已停用 Peer 的信息，只有配置记录与历史累计流量
+func (ui *WebUI) disabledPeerInfo(record PeerRecord) PeerInfo {
+	remark := record.Remark
+	if remark == "" {
+		remark = "未命名"
+	}
+	lifetime := ui.history.lifetime(record.PublicKey, 0, 0)
+	return PeerInfo{
+		Remark:            remark,
+		PublicKey:         record.PublicKey,
+		Endpoint:          record.Endpoint,
+		AllowedIPs:        record.AllowedIPs,
+		LastHandshake:     "从未",
+		LifetimeTxBytes:   lifetime.TxBytes,
+		LifetimeRxBytes:   lifetime.RxBytes,
+		KeepaliveInterval: uint32(record.PersistentKeepalive),
+		Tags:              record.Tags,
+		Disabled:          true,
 	}
 }
 
 // handleIndex 返回 Web 页面
 func (ui *WebUI) handleIndex(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	html := `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>WireGuard 状态监控</title>
-    <script src="https://cdn.jsdelivr.net/npm/qrcode-generator@1.4.4/qrcode.min.js"></script>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body {
-            font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            background: #0f172a;
-            color: #f1f5f9;
-            min-height: 100vh;
-            padding: 40px 20px;
-        }
-        .container { max-width: 1100px; margin: 0 auto; }
-        header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 40px;
-            padding-bottom: 20px;
-            border-bottom: 1px solid #1e293b;
-        }
-        header h1 {
-            font-size: 24px;
-            font-weight: 800;
-            letter-spacing: -0.5px;
-            display: flex;
-            align-items: center;
-            gap: 12px;
-        }
-        header h1 span { color: #38bdf8; }
-        .nav-tabs {
-            display: flex;
-            gap: 10px;
-        }
-        .device-info {
-            background: #1e293b;
-            border-radius: 12px;
-            padding: 20px 24px;
-            margin-bottom: 30px;
-            border: 1px solid #334155;
-            display: grid;
-            grid-template-columns: repeat(auto-fit, minmax(200px, 1fr));
-            gap: 20px;
-        }
-        .info-card h3 {
-            font-size: 12px;
-            text-transform: uppercase;
-            color: #94a3b8;
-            margin-bottom: 8px;
-            letter-spacing: 0.05em;
-        }
-        .info-card p {
-            font-family: 'JetBrains Mono', monospace;
-            font-size: 16px;
-            color: #f8fafc;
-            word-break: break-all;
-        }
-        .tab-btn {
-            background: #1e293b;
-            border: 1px solid #334155;
-            color: #94a3b8;
-            padding: 10px 20px;
-            border-radius: 10px;
-            font-size: 14px;
-            font-weight: 600;
-            cursor: pointer;
-            transition: all 0.2s;
-            margin-right: 8px;
-        }
-        .tab-btn.active {
-            background: #38bdf8;
-            color: #0f172a;
-            border-color: #38bdf8;
-        }
-        .tab-btn:hover:not(.active) {
-            background: #2d3e5a;
-            color: #f8fafc;
-        }
-        .peer-list {
-            display: flex;
-            flex-direction: column;
-            gap: 12px;
-        }
-        .peer-row {
-            background: #1e293b;
-            border-radius: 12px;
-            padding: 16px 24px;
-            border: 1px solid #334155;
-            display: grid;
-            grid-template-columns: 1.5fr 2fr 1.5fr 1fr 1.5fr;
-            align-items: center;
-            gap: 20px;
-            transition: all 0.2s ease;
-        }
-        .peer-row:hover {
-            border-color: #38bdf8;
-            background: #24324d;
-            transform: scale(1.01);
-        }
-        .peer-main {
-            display: flex;
-            align-items: center;
-            gap: 16px;
-        }
-        .status-dot {
-            width: 10px;
-            height: 10px;
-            border-radius: 50%;
-            flex-shrink: 0;
-        }
-        .status-dot.online { background: #22c55e; box-shadow: 0 0 10px #22c55e; }
-        .status-dot.offline { background: transparent; border: 1px solid #475569; }
-        .peer-name {
-            font-weight: 600;
-            font-size: 16px;
-            color: #f8fafc;
-        }
-        .peer-ips {
-            font-size: 13px;
-            color: #94a3b8;
-            font-family: monospace;
-        }
-        .label-small {
-            font-size: 11px;
-            color: #64748b;
-            text-transform: uppercase;
-            margin-bottom: 4px;
-        }
-        .value-small {
-            font-size: 13px;
-            color: #cbd5e1;
-            font-family: monospace;
-        }
-        .traffic-group {
-            display: flex;
-            gap: 16px;
-        }
-        .traffic-box {
-            display: flex;
-            flex-direction: column;
-        }
-        .traffic-val {
-            font-size: 13px;
-            color: #38bdf8;
-            font-weight: 500;
-        }
-        .handshake-time {
-            font-size: 12px;
-            color: #94a3b8;
-        }
-        .refresh-tag {
-            text-align: center;
-            margin-top: 30px;
-            color: #475569;
-            font-size: 12px;
-        }
-        @media (max-width: 900px) {
-            .peer-row {
-                grid-template-columns: 1fr 1fr;
-                gap: 15px;
-            }
-        }
-        /* QR Modal Styles */
-        .modal-overlay {
-            display: none;
-            position: fixed;
-            top: 0; left: 0; width: 100%; height: 100%;
-            background: rgba(0,0,0,0.8);
-            backdrop-filter: blur(8px);
-            z-index: 1000;
-            align-items: center;
-            justify-content: center;
-        }
-        .qr-modal {
-            background: #1e293b;
-            padding: 30px;
-            border-radius: 24px;
-            border: 1px solid #334155;
-            text-align: center;
-            max-width: 350px;
-            width: 90%;
-        }
-        .qr-modal h3 { margin-bottom: 20px; color: #f8fafc; }
-        .qr-modal #qr-container { 
-            background: white; 
-            padding: 15px; 
-            border-radius: 12px; 
-            display: inline-block;
-            margin-bottom: 20px;
-        }
-        .qr-modal #qr-container img { display: block; }
-        .qr-modal .btn-close {
-            background: #334155;
-            color: white;
-            border: none;
-            padding: 10px 20px;
-            border-radius: 10px;
-            cursor: pointer;
-            width: 100%;
-            font-weight: 600;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <header>
-            <h1><span>🛡️</span> WireGuard Controller</h1>
-            <div class="nav-tabs">
-                <button class="tab-btn active" id="tab-status" onclick="switchTab('status')">状态概览</button>
-                <button class="tab-btn" id="tab-peers" onclick="switchTab('peers')">设备列表</button>
-                <button class="tab-btn" id="tab-invites" onclick="switchTab('invites')">邀请管理</button>
-                <button class="tab-btn" id="tab-enroll" onclick="switchTab('enroll')" style="background:rgba(16,185,129,0.1); color:#10b981; border-color:rgba(16,185,129,0.2)">客户端入驻</button>
-            </div>
-        </header>
-
-        <section id="sec-status">
-            <div class="device-info">
-                <div class="info-card">
-                    <h3>服务端公钥</h3>
-                    <p id="dev-pubkey">-</p>
-                </div>
-                <div class="info-card">
-                    <h3>UDP 端口</h3>
-                    <p id="dev-port">-</p>
-                </div>
-                <div class="info-card">
-                    <h3>已连接设备</h3>
-                    <p id="dev-count">-</p>
-                </div>
-            </div>
-            <div style="background: rgba(255,255,255,0.02); padding: 40px; border-radius: 20px; border: 1px solid var(--border); text-align: center; color: #64748b;">
-                <p>母舰运行状态正常。所有配置已持久化至 JSON。</p>
-            </div>
-        </section>
-
-        <section id="sec-peers" style="display:none">
-            <div class="peer-list" id="peer-list">
-                <!-- Peers go here -->
-            </div>
-        </section>
-
-        <section id="sec-invites" style="display:none">
-            <div style="background: rgba(16,185,129,0.05); padding: 24px; border-radius: 16px; border: 1px solid rgba(16,185,129,0.1); margin-bottom: 24px;">
-                <h3 style="margin-bottom: 16px; font-size: 16px; color:#10b981;">🌐 全局分发设置</h3>
-                <div style="display: grid; grid-template-columns: 2fr 1fr 2fr 1fr 1fr auto; gap: 12px; align-items: flex-end;">
-                    <div>
-                        <label style="color:#94a3b8; font-size:12px; margin-bottom:8px; display:block;">WireGuard Host</label>
-                        <input type="text" id="sys-pub-host" placeholder="1.2.3.4" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <div>
-                        <label style="color:#94a3b8; font-size:12px; margin-bottom:8px; display:block;">Port</label>
-                        <input type="number" id="sys-pub-port" placeholder="51820" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <div>
-                        <label style="color:#94a3b8; font-size:12px; margin-bottom:8px; display:block;">Web Portal Host</label>
-                        <input type="text" id="sys-web-host" placeholder="vpn.com" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <div>
-                        <label style="color:#94a3b8; font-size:12px; margin-bottom:8px; display:block;">Port</label>
-                        <input type="number" id="sys-web-port" placeholder="8080" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <div>
-                        <label style="color:#94a3b8; font-size:12px; margin-bottom:8px; display:block;">Keepalive</label>
-                        <input type="number" id="sys-keepalive" placeholder="25" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <button class="btn" style="margin-top:0; width: auto; padding: 12px 24px; background:#10b981;" onclick="saveSystemConfig()">保存</button>
-                </div>
-                <p style="color:#64748b; font-size:12px; margin-top:10px;">地址与端口已分离。Keepalive 为新注册客户端的默认保活间隔(秒)，推荐 25。</p>
-            </div>
-
-            <div style="background: rgba(255,255,255,0.05); padding: 24px; border-radius: 16px; border: 1px solid rgba(255,255,255,0.1); margin-bottom: 24px;">
-                <h3 style="margin-bottom: 16px; font-size: 16px;">🔑 生成新邀请</h3>
-                <div style="display: flex; gap: 12px; align-items: flex-end;">
-                    <div style="flex: 2;">
-                        <input type="text" id="invite-remark" placeholder="备注 (如：老王的手机)" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <div style="width: 100px;">
-                        <input type="number" id="invite-duration" value="24" style="width: 100%; padding: 12px; border-radius: 10px; border: 1px solid #334155; background: #0f172a; color: white;">
-                    </div>
-                    <button class="btn" style="margin-top:0; width: auto; padding: 12px 24px;" onclick="generateInvite()">生成邀请码</button>
-                </div>
-            </div>
-            <div class="peer-list" id="invite-list">
-                <!-- Invites here -->
-            </div>
-        </section>
-
-        <section id="sec-enroll" style="display:none">
-            <div style="max-width: 500px; margin: 30px auto; background: rgba(255,255,255,0.05); padding: 40px; border-radius: 24px; border: 1px solid rgba(255,255,255,0.1); text-align: center;">
-                <h2 style="font-size: 24px; margin-bottom: 20px;">🚀 客户端入驻</h2>
-                <div style="text-align: left; background: rgba(0,0,0,0.2); padding: 15px; border-radius: 12px; margin-bottom: 20px; border: 1px solid rgba(255,255,255,0.05);">
-                    <p style="color:#38bdf8; font-size:13px; font-weight:600; margin-bottom:8px;">💡 操作指南</p>
-                    <p style="color:#94a3b8; font-size:12px; line-height:1.6;">直接粘贴入网链接即可自动解析，或手动输入邀请码和服务器地址。</p>
-                </div>
-
-                <div style="text-align:left; margin-bottom:20px; padding:15px; background:rgba(56,189,248,0.05); border-radius:12px; border:1px solid rgba(56,189,248,0.1);">
-                    <label style="color:#38bdf8; font-size:13px; font-weight:600;">快捷解析链接</label>
-                    <div style="display:flex; gap:10px; margin-top:8px;">
-                        <input type="text" id="enroll-link-input" placeholder="粘贴 http://.../join/... 链接" style="flex:1; padding:12px; border-radius:10px; border:1px solid #334155; background: #0f172a; color: white;">
-                        <button class="tab-btn" style="margin:0; background:#38bdf8; color:#0f172a; border:none; padding:0 15px;" onclick="parseEnrollLink()">解析</button>
-                    </div>
-                </div>
-
-                <div style="height:1px; background:rgba(255,255,255,0.05); margin-bottom:20px;"></div>
-
-                <div style="text-align:left; margin-bottom:15px;">
-                    <label style="color:#94a3b8; font-size:13px; font-weight:600;">邀请码</label>
-                    <input type="text" id="enroll-token" placeholder="示例: ABCD-1234-XYZ" style="width: 100%; padding: 14px; border-radius: 12px; border: 1px solid #334155; background: #0f172a; color: white; margin-top:8px;">
-                </div>
-                
-                <div style="text-align:left; margin-bottom:25px;">
-                    <label style="color:#94a3b8; font-size:13px; font-weight:600;">服务端地址</label>
-                    <input type="text" id="enroll-server" placeholder="例如: 1.2.3.4:8080 或 http://vpn.example.com:8080" style="width: 100%; padding: 14px; border-radius: 12px; border: 1px solid #334155; background: #0f172a; color: white; margin-top:8px;">
-                </div>
-
-                <div style="text-align:left; margin-bottom:25px;">
-                    <label style="color:#94a3b8; font-size:13px; font-weight:600;">服务器 Endpoint</label>
-                    <input type="text" id="enroll-endpoint" placeholder="可选，例如: 1.2.3.4:51820（留空则由服务端下发）" style="width: 100%; padding: 14px; border-radius: 12px; border: 1px solid #334155; background: #0f172a; color: white; margin-top:8px;">
-                </div>
-                
-                <button class="btn" style="margin-top:0;" onclick="goToEnroll()">立即自动入驻</button>
-            </div>
-        </section>
-        
-        <div class="refresh-tag">每 3 秒自动同步数据</div>
-    </div>
-
-    <div class="modal-overlay" id="qr-modal-overlay">
-        <div class="qr-modal">
-            <h3 id="qr-modal-title">邀请入网二维码</h3>
-            <div id="qr-container"></div>
-            <p style="color:#94a3b8; font-size:12px; margin-bottom:20px;">请使用手机 WireGuard 客户端扫码，或浏览器访问链接</p>
-            <button class="btn-close" onclick="closeQRModal()">关闭</button>
-        </div>
-    </div>
-
-    <script>
-        function formatBytes(bytes) {
-            if (bytes === 0) return '0 B';
-            const k = 1024;
-            const sizes = ['B', 'KB', 'MB', 'GB', 'TB'];
-            const i = Math.floor(Math.log(bytes) / Math.log(k));
-            return parseFloat((bytes / Math.pow(k, i)).toFixed(2)) + ' ' + sizes[i];
-        }
-
-        async function initSystemSettings() {
-            try {
-                const res = await fetch('/api/system/config');
-                const config = await res.json();
-                
-                // 仅更新 input，不干扰此时可能正在输入的 activeElement
-                const fields = {
-                    'sys-pub-host': config.public_host || '',
-                    'sys-pub-port': config.public_port || '',
-                    'sys-web-host': config.web_host || '',
-                    'sys-web-port': config.web_port || '',
-                    'sys-keepalive': config.default_keepalive || 25
-                };
-                Object.keys(fields).forEach(id => {
-                    const el = document.getElementById(id);
-                    if (el && document.activeElement !== el) {
-                        el.value = fields[id];
-                    }
-                });
-
-                // 挂载全局配置供渲染邀请链接使用
-                window._sysConfig = config;
-            } catch (e) {
-                console.error('Failed to load system config', e);
-            }
-        }
-
-        function updateStatus() {
-            // 1. 同步设备状态与对等体流量
-            fetch('/api/status')
-                .then(res => res.json())
-                .then(data => {
-                    document.getElementById('dev-pubkey').innerText = data.public_key;
-                    document.getElementById('dev-port').innerText = data.listen_port;
-                    document.getElementById('dev-count').innerText = data.peer_count;
-
-                    const listHtml = data.peers.map(peer => ` + "`" + `
-                        <div class="peer-row" style="grid-template-columns: 1.5fr 2fr 1.5fr 1fr 1fr 1.5fr;">
-                            <div class="peer-main">
-                                <div class="status-dot ${peer.is_online ? 'online' : 'offline'}"></div>
-                                <div>
-                                    <div class="peer-name">${peer.remark || '未命名设备'}</div>
-                                    <div class="peer-ips">${peer.allowed_ips ? peer.allowed_ips.join(', ') : '-'}</div>
-                                </div>
-                            </div>
-                            <div>
-                                <div class="label-small">对等体公钥</div>
-                                <div class="value-small" title="${peer.public_key}">${peer.public_key.substring(0, 12)}...</div>
-                                <div class="label-small" style="margin-top:8px;">实时 Endpoint</div>
-                                <div class="value-small" style="color:#10b981;">${peer.endpoint || '未连接'}</div>
-                            </div>
-                            <div class="traffic-group">
-                                <div class="traffic-box">
-                                    <div class="label-small">发送</div>
-                                    <div class="traffic-val">↑ ${formatBytes(peer.tx_bytes)}</div>
-                                </div>
-                                <div class="traffic-box">
-                                    <div class="label-small">下载</div>
-                                    <div class="traffic-val" style="color:#22c55e;">↓ ${formatBytes(peer.rx_bytes)}</div>
-                                </div>
-                                <div class="traffic-box">
-                                    <div class="label-small">累计总计</div>
-                                    <div class="traffic-val" style="color:#f8fafc; font-weight:700; border-top:1px solid rgba(255,255,255,0.1); margin-top:4px; padding-top:4px;">∑ ${formatBytes(peer.total_bytes)}</div>
-                                </div>
-                            </div>
-                            <div>
-                                <div class="label-small">Keepalive</div>
-                                <div style="display:flex; align-items:center; gap:4px;">
-                                    <input type="number" id="ka-${peer.public_key.substring(0,8)}" value="${peer.keepalive_interval}" min="0" max="65535" style="width:50px; padding:4px; border-radius:6px; border:1px solid #334155; background:#0f172a; color:white; font-size:12px; text-align:center;">
-                                    <span style="color:#64748b; font-size:11px;">秒</span>
-                                    <button class="tab-btn" style="padding:3px 8px; font-size:10px; margin:0; background:rgba(56,189,248,0.1); color:#38bdf8; border-color:rgba(56,189,248,0.2);" onclick="setKeepalive('${peer.public_key}', document.getElementById('ka-${peer.public_key.substring(0,8)}').value)">设</button>
-                                </div>
-                            </div>
-                            <div>
-                                <div class="label-small">最后活跃</div>
-                                <div class="handshake-time">${peer.last_handshake}</div>
-                            </div>
-                            <div style="text-align:right">
-                                <button class="tab-btn" style="background:#ef4444; color:white; border:none; padding:6px 12px; margin:0;" onclick="deletePeer('${peer.public_key}')">移除</button>
-                            </div>
-                        </div>
-                    ` + "`" + `).join('');
-                    document.getElementById('peer-list').innerHTML = listHtml;
-                });
-
-            // 2. 同步邀请码列表 (只更新列表，不碰配置输入框)
-            fetch('/api/invites/list')
-                .then(res => res.json())
-                .then(invites => {
-                    const config = window._sysConfig || {};
-                    let webBase = window.location.origin;
-                    if (config.web_host) {
-                        webBase = (window.location.protocol === 'https:' ? 'https://' : 'http://') + config.web_host;
-                        if (config.web_port && config.web_port !== 80 && config.web_port !== 443) {
-                            webBase += ':' + config.web_port;
-                        }
-                    }
-
-                    const listHtml = (invites || []).map(inv => ` + "`" + `
-                        <div class="peer-row" style="grid-template-columns: 1.5fr 3.5fr 1fr 0.5fr;">
-                            <div>
-                                <div class="peer-name">${inv.remark}</div>
-                                <div class="label-small">${new Date(inv.created_at).toLocaleDateString()} 创建</div>
-                            </div>
-                            <div>
-                                <div class="label-small">一键入网链接</div>
-                                <div style="display:flex; align-items:center; gap:8px;">
-                                    <div class="value-small" style="color:#38bdf8; cursor:pointer; font-size:12px; flex:1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; background: rgba(56,189,248,0.05); padding: 4px 8px; border-radius: 6px;" onclick="copyLink('${webBase}/join/${inv.token}')">${webBase}/join/${inv.token}</div>
-                                    <button class="tab-btn" style="padding:4px 8px; font-size:11px; margin:0; background:rgba(56,189,248,0.1); color:#38bdf8; border-color:rgba(56,189,248,0.2);" onclick="copyLink('${webBase}/join/${inv.token}')">复制</button>
-                                    <button class="tab-btn" style="padding:4px 8px; font-size:11px; margin:0; background:rgba(56,189,248,0.1); color:#38bdf8; border-color:rgba(56,189,248,0.2);" onclick="showInviteQR('${webBase}/join/${inv.token}', '${inv.remark}')">二维码</button>
-                                </div>
-                            </div>
-                            <div>
-                                <div class="label-small">有效至 (24小时内)</div>
-                                <div class="handshake-time" style="color:#f8fafc;">${new Date(inv.expires_at).toLocaleString('zh-CN', {month:'numeric', day:'numeric', hour:'2-digit', minute:'2-digit', second:'2-digit'})}</div>
-                            </div>
-                            <div style="text-align:right">
-                                <button class="tab-btn" style="background:#475569; color:white; border:none; padding:6px 12px; margin:0;" onclick="deleteInvite('${inv.token}')">撤回</button>
-                            </div>
-                        </div>
-                    ` + "`" + `).join('');
-                    document.getElementById('invite-list').innerHTML = listHtml || '<div style="text-align:center; color:#475569; padding:40px;">暂无有效邀请码</div>';
-                });
-        }
-
-        function parseEnrollLink() {
-            const link = document.getElementById('enroll-link-input').value.trim();
-            if (!link) return;
-            try {
-                const url = new URL(link);
-                // 1. 提取服务端地址 (Scheme + Host)
-                const serverAddr = url.origin;
-                document.getElementById('enroll-server').value = serverAddr;
-
-                // 2. 提取 Token (Path 的最后一部分)
-                const parts = url.pathname.split('/');
-                const token = parts[parts.length - 1];
-                if (token) {
-                    document.getElementById('enroll-token').value = token;
-                }
-
-                // 3. 处理可选的 Endpoint 参数
-                const endpoint = url.searchParams.get('endpoint');
-                if (endpoint) {
-                    document.getElementById('enroll-endpoint').value = endpoint;
-                }
-
-                document.getElementById('enroll-link-input').value = '';
-            } catch (e) {
-                alert('链接格式不正确，请确保是完整的 http/https 链接');
-            }
-        }
-
-        async function goToEnroll() {
-            const token = document.getElementById('enroll-token').value.trim();
-            const server = document.getElementById('enroll-server').value.trim();
-            const endpoint = document.getElementById('enroll-endpoint').value.trim();
-            if(!token) return alert('请填入邀请码');
-            if(!server) return alert('请填入服务端地址');
-
-            try {
-                const res = await fetch('/api/enroll', {
-                    method: 'POST',
-                    body: JSON.stringify({ token, server, endpoint })
-                });
-                const data = await res.json();
-                if (data.error) throw new Error(data.error);
-
-                alert('自动入驻成功\nIP: ' + data.config.address + '\nEndpoint: ' + data.config.endpoint);
-                updateStatus();
-            } catch (e) {
-                alert('自动入驻失败: ' + e.message);
-            }
-        }
-
-        function showInviteQR(url, remark) {
-            const qr = qrcode(0, 'M');
-            qr.addData(url);
-            qr.make();
-            document.getElementById('qr-container').innerHTML = qr.createImgTag(6);
-            document.getElementById('qr-modal-title').innerText = remark + ' 的邀请二维码';
-            document.getElementById('qr-modal-overlay').style.display = 'flex';
-        }
-
-        function closeQRModal() {
-            document.getElementById('qr-modal-overlay').style.display = 'none';
-        }
-
-        function switchTab(tab) {
-            ['status', 'peers', 'invites', 'enroll'].forEach(t => {
-                const sec = document.getElementById('sec-' + t);
-                const btn = document.getElementById('tab-' + t);
-                if(sec) sec.style.display = (t === tab ? 'block' : 'none');
-                if(btn) btn.classList.toggle('active', t === tab);
-            });
-            if(tab === 'invites') initSystemSettings();
-        }
-
-
-        async function deletePeer(pubkey) {
-            if (!confirm('确定要移除此设备吗？其连接将被立即断开。')) return;
-            const res = await fetch('/api/peer/remove', {
-                method: 'POST',
-                body: JSON.stringify({ public_key: pubkey })
-            });
-            if (res.ok) updateStatus();
-        }
-
-        async function deleteInvite(token) {
-            const res = await fetch('/api/invites/remove', {
-                method: 'POST',
-                body: JSON.stringify({ token: token })
-            });
-            if (res.ok) updateStatus();
-        }
-
-        async function saveSystemConfig() {
-            const pubHost = document.getElementById('sys-pub-host').value.trim();
-            const pubPort = parseInt(document.getElementById('sys-pub-port').value);
-            const webHost = document.getElementById('sys-web-host').value.trim();
-            const webPort = parseInt(document.getElementById('sys-web-port').value);
-            const keepalive = parseInt(document.getElementById('sys-keepalive').value);
-            
-            const res = await fetch('/api/system/config', {
-                method: 'POST',
-                body: JSON.stringify({ 
-                    public_host: pubHost,
-                    public_port: pubPort || 51820,
-                    web_host: webHost,
-                    web_port: webPort || 8080,
-                    default_keepalive: keepalive || 25
-                })
-            });
-            if (res.ok) {
-                alert('设置已保存');
-                initSystemSettings();
-                updateStatus();
-            }
-        }
-
-        async function generateInvite() {
-            const remark = document.getElementById('invite-remark').value;
-            const duration = parseInt(document.getElementById('invite-duration').value);
-            if (!remark) return alert('请填写备注');
-
-            const res = await fetch('/api/invites/generate', {
-                method: 'POST',
-                body: JSON.stringify({ remark, duration_hours: duration || 24 })
-            });
-            if (res.ok) {
-                document.getElementById('invite-remark').value = '';
-                updateStatus();
-                alert('邀请码生成完成！');
-            }
-        }
-
-        function copyLink(link) {
-            if (navigator.clipboard && window.isSecureContext) {
-                navigator.clipboard.writeText(link).then(() => {
-                    alert('链接已复制到剪贴板');
-                }).catch(err => {
-                    console.error('Clipboard API failed, using fallback:', err);
-                    fallbackCopy(link);
-                });
-            } else {
-                fallbackCopy(link);
-            }
-        }
-
-        function fallbackCopy(text) {
-            const textArea = document.createElement("textarea");
-            textArea.value = text;
-            textArea.style.position = "fixed";
-            textArea.style.left = "-9999px";
-            textArea.style.top = "0";
-            document.body.appendChild(textArea);
-            textArea.focus();
-            textArea.select();
-            try {
-                document.execCommand('copy');
-                alert('链接已复制到剪贴板');
-            } catch (err) {
-                alert('复制失败，请手动选择复制');
-            }
-            document.body.removeChild(textArea);
-        }
-
-        async function setKeepalive(pubkey, val) {
-            const interval = parseInt(val) || 0;
-            const hexKey = Array.from(atob(pubkey), c => c.charCodeAt(0).toString(16).padStart(2,'0')).join('');
-            const config = 'public_key=' + hexKey + '\npersistent_keepalive_interval=' + interval + '\n';
-            try {
-                const res = await fetch('/api/config', {
-                    method: 'POST',
-                    body: JSON.stringify({ config })
-                });
-                if (res.ok) updateStatus();
-                else alert('设置失败');
-            } catch(e) { alert('请求失败: ' + e.message); }
-        }
-
-        initSystemSettings();
-        updateStatus();
-        setInterval(updateStatus, 3000);
-    </script>
-</body>
-</html>`
-
-	fmt.Fprint(w, html)
+	ui.renderPage(w, r, http.StatusOK, "index", nil)
 }
 
 // handleDocs 返回 API 文档页面
 func (ui *WebUI) handleDocs(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	html := `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <title>API 文档 - WireGuard Controller</title>
-    <style>
-        body { font-family: 'Inter', sans-serif; background: #0f172a; color: #f1f5f9; padding: 40px; line-height: 1.6; }
-        .container { max-width: 800px; margin: 0 auto; }
-        h1 { color: #38bdf8; border-bottom: 1px solid #334155; padding-bottom: 10px; }
-        .endpoint { background: #1e293b; border-radius: 8px; padding: 20px; margin-top: 20px; border: 1px solid #334155; }
-        .method { background: #0ea5e9; color: white; padding: 2px 8px; border-radius: 4px; font-weight: bold; font-size: 14px; margin-right: 10px; }
-        .path { font-family: monospace; font-size: 18px; color: #f8fafc; }
-        .desc { margin-top: 10px; color: #94a3b8; }
-        pre { background: #000; padding: 15px; border-radius: 6px; overflow-x: auto; color: #10b981; font-size: 13px; margin-top: 10px; }
-        .back { display: inline-block; margin-bottom: 20px; color: #38bdf8; text-decoration: none; font-size: 14px; }
-        .back:hover { text-decoration: underline; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <a href="/" class="back">← 返回控制面板</a>
-        <h1>📖 接口文档 (API Documentation)</h1>
-        
-        <div class="endpoint">
-            <div><span class="method">GET</span><span class="path">/api/status</span></div>
-            <p class="desc">获取设备的完整状态信息，包括核心公钥、端口以及所有对等体的详细统计。</p>
-            <pre>{
-  "public_key": "...",
-  "listen_port": 38200,
-  "peer_count": 5,
-  "peers": [
-    {
-      "remark": "Debian",
-      "public_key": "...",
-      "endpoint": "10.0.0.3:51820",
-      "allowed_ips": ["10.166.0.3/32"],
-      "tx_bytes": 1024,
-      "rx_bytes": 2048,
-      "last_handshake": "2025-12-30 10:00:00"
-    }
-  ]
-}</pre>
-        </div>
-
-        <div class="endpoint">
-            <div><span class="method">GET</span><span class="path">/api/peers</span></div>
-            <p class="desc">仅返回对等体（Peers）列表数组，适用于轻量级的数据更新。</p>
-            <pre>[
-  { "remark": "iPhone", "public_key": "...", ... },
-  { "remark": "wg-study", "public_key": "...", ... }
-]</pre>
-        </div>
-
-        <div class="endpoint">
-            <div><span class="method">GET</span><span class="path">/docs</span></div>
-            <p class="desc">返回当前你正在阅读的这份文档页面。</p>
-        </div>
-    </div>
-</body>
-</html>`
-	fmt.Fprint(w, html)
+	ui.renderPage(w, r, http.StatusOK, "docs", nil)
 }
 
 // ========== 配置类 API ==========
@@ -1003,13 +705,13 @@ type PeerAddRequest struct {
 	AllowedIPs []string `json:"allowed_ips"`
 	Endpoint   string   `json:"endpoint,omitempty"`
 	Keepalive  int      `json:"persistent_keepalive,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
 }
 
 // handlePeerAdd 添加 Peer
 // POST /api/peer/add
 func (ui *WebUI) handlePeerAdd(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1018,38 +720,15 @@ func (ui *WebUI) handlePeerAdd(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req PeerAddRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, r, err)
 		return
 	}
-
-	// 构建 UAPI 配置字符串
-	var config strings.Builder
-	config.WriteString("public_key=" + req.PublicKey + "\n")
-	if req.Endpoint != "" {
-		config.WriteString("endpoint=" + req.Endpoint + "\n")
-	}
-	if req.Keepalive > 0 {
-		config.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", req.Keepalive))
-	}
-	for _, ip := range req.AllowedIPs {
-		config.WriteString("allowed_ip=" + ip + "\n")
-	}
-
-	// 调用 IpcSet
-	if err := ui.device.IpcSet(config.String()); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	if _, err := ui.addPeer(currentPrincipal(r), req); err != nil {
+		writeAPIError(w, r, err)
 		return
 	}
 
-	// 持久化改动 (Phase 2)
-	ui.config.SyncFromDevice(ui.device)
-	if err := SaveConfig(ui.config); err != nil {
-		ui.device.GetLogger().Errorf("Failed to save config after adding peer: %v", err)
-	}
-
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Peer added successfully"})
 }
 
@@ -1062,7 +741,6 @@ type PeerRemoveRequest struct {
 // POST /api/peer/remove
 func (ui *WebUI) handlePeerRemove(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1071,29 +749,45 @@ func (ui *WebUI) handlePeerRemove(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req PeerRemoveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if err := ui.removePeer(currentPrincipal(r), req.PublicKey); err != nil {
+		writeAPIError(w, r, err)
 		return
 	}
 
-	// 构建 UAPI 配置字符串
-	config := fmt.Sprintf("public_key=%s\nremove=true\n", req.PublicKey)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Peer removed successfully"})
+}
 
-	// 调用 IpcSet
-	if err := ui.device.IpcSet(config); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+// PeerTagsRequest 设置 Peer 标签请求体
+type PeerTagsRequest struct {
+	PublicKey string   `json:"public_key"` // Base64 或 Hex
+	Tags      []string `json:"tags"`
+}
+
+// handlePeerTags 设置 Peer 标签
+// POST /api/peer/tags
+func (ui *WebUI) handlePeerTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed, use POST"})
 		return
 	}
 
-	// 持久化改动 (Phase 2)
-	ui.config.SyncFromDevice(ui.device)
-	if err := SaveConfig(ui.config); err != nil {
-		ui.device.GetLogger().Errorf("Failed to save config after removing peer: %v", err)
+	var req PeerTagsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, r, err)
+		return
 	}
-
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Peer removed successfully"})
+	if err := ui.setPeerTags(currentPrincipal(r), req.PublicKey, req.Tags); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 // ConfigRequest 批量配置请求体
@@ -1105,7 +799,6 @@ type ConfigRequest struct {
 // POST /api/config
 func (ui *WebUI) handleConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1121,7 +814,7 @@ func (ui *WebUI) handleConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 调用 IpcSet
-	if err := ui.device.IpcSet(req.Config); err != nil {
+	if err := ui.applyConfig(req.Config); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
@@ -1133,10 +826,9 @@ func (ui *WebUI) handleConfig(w http.ResponseWriter, r *http.Request) {
 // handleSystemConfig 处理系统配置的 GET/POST
 func (ui *WebUI) handleSystemConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method == http.MethodGet {
-		json.NewEncoder(w).Encode(ui.config.System)
+		json.NewEncoder(w).Encode(ui.systemConfig())
 		return
 	}
 
@@ -1147,15 +839,8 @@ func (ui *WebUI) handleSystemConfig(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
-
-		ui.config.System.PublicHost = newSys.PublicHost
-		ui.config.System.PublicPort = newSys.PublicPort
-		ui.config.System.WebHost = newSys.WebHost
-		ui.config.System.WebPort = newSys.WebPort
-		ui.config.System.DefaultKeepalive = newSys.DefaultKeepalive
-		if err := SaveConfig(ui.config); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		if err := ui.updateSystem(newSys); err != nil {
+			writeAPIError(w, r, err)
 			return
 		}
 
@@ -1170,7 +855,6 @@ func (ui *WebUI) handleSystemConfig(w http.ResponseWriter, r *http.Request) {
 // GET /api/hello
 func (ui *WebUI) handleHello(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	response := map[string]interface{}{
 		"code": 200,
@@ -1183,15 +867,15 @@ func (ui *WebUI) handleHello(w http.ResponseWriter, r *http.Request) {
 
 // InviteGenerateRequest 生成邀请码请求
 type InviteGenerateRequest struct {
-	Remark   string `json:"remark"`
-	Duration int    `json:"duration_hours"` // 有效期（小时）
+	Remark   string   `json:"remark"`
+	Duration int      `json:"duration_hours"` // 有效期（小时）
+	Tags     []string `json:"tags,omitempty"` // 注册后 Peer 自动带上的标签
 }
 
 // handleInviteGenerate 生成邀请码
 // POST /api/invites/generate
 func (ui *WebUI) handleInviteGenerate(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1200,32 +884,19 @@ func (ui *WebUI) handleInviteGenerate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req InviteGenerateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, r, err)
 		return
 	}
-
-	// 彻底修正：确保 Duration 至少为 24 小时，且优先解析 JSON 字段
-	if req.Duration <= 0 {
-		req.Duration = 24
-	}
-
-	token, err := ui.config.GenerateInvite(req.Remark, time.Duration(req.Duration)*time.Hour)
+	inv, err := ui.createInvite(currentPrincipal(r), req)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeAPIError(w, r, err)
 		return
 	}
 
-	// 立即保存
-	if err := SaveConfig(ui.config); err != nil {
-		ui.device.GetLogger().Errorf("Failed to save config after generating invite: %v", err)
-	}
-
 	json.NewEncoder(w).Encode(map[string]string{
-		"token": token,
-		"url":   fmt.Sprintf("http://%s/join/%s", r.Host, token),
+		"token": inv.Token,
+		"url":   ui.joinURL(r, inv.Token),
 	})
 }
 
@@ -1233,40 +904,51 @@ func (ui *WebUI) handleInviteGenerate(w http.ResponseWriter, r *http.Request) {
 // GET /api/invites/list
 func (ui *WebUI) handleInviteList(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	json.NewEncoder(w).Encode(ui.config.Invites)
+	json.NewEncoder(w).Encode(ui.visibleInvites(currentPrincipal(r)))
 }
 
 // handleInviteRemove 撤回邀请码
 // POST /api/invites/remove
 func (ui *WebUI) handleInviteRemove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed, use POST"})
+		return
+	}
+
 	var req struct {
 		Token string `json:"token"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		writeAPIError(w, r, err)
 		return
 	}
-
-	ui.config.RemoveInvite(req.Token)
-	SaveConfig(ui.config)
-	w.WriteHeader(http.StatusOK)
+	if err := ui.removeInvite(currentPrincipal(r), req.Token); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 // RegisterRequest 注册请求
 type RegisterRequest struct {
 	Token     string `json:"token"`
-	Server    string `json:"server,omitempty"`     // 可选，客户端模式用于指定远端注册服务地址
+	Server    string `json:"server,omitempty"`     // 不再支持，设置时拒绝 (远端入驻见 EnrollRequest)
 	PublicKey string `json:"public_key,omitempty"` // 可选，由客户端自生
 	Endpoint  string `json:"endpoint,omitempty"`   // 可选，手动覆盖 Endpoint
+	// 可选，客户端模式下远端使用自签名证书时的 SHA-256 指纹
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 // EnrollRequest 客户端自动入驻请求
 type EnrollRequest struct {
-	Token    string `json:"token"`
-	Server   string `json:"server"`
-	Endpoint string `json:"endpoint,omitempty"`
+	Token       string `json:"token"`
+	Server      string `json:"server"`
+	Endpoint    string `json:"endpoint,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // 远端自签名证书的 SHA-256 指纹
 }
 
 // RegisterResponse 注册成功返回的配置
@@ -1285,7 +967,6 @@ type RegisterResponse struct {
 // POST /api/enroll
 func (ui *WebUI) handleEnroll(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1300,7 +981,7 @@ func (ui *WebUI) handleEnroll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, status, err := ui.remoteEnrollToServer(req.Server, req.Token, req.Endpoint)
+	resp, status, err := ui.remoteEnrollToServer(req.Server, req.Token, req.Endpoint, req.Fingerprint)
 	if err != nil {
 		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -1309,7 +990,7 @@ func (ui *WebUI) handleEnroll(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (ui *WebUI) remoteEnrollToServer(serverRaw, tokenRaw, endpointRaw string) (RegisterResponse, int, error) {
+func (ui *WebUI) remoteEnrollToServer(serverRaw, tokenRaw, endpointRaw, fingerprint string) (RegisterResponse, int, error) {
 	var resp RegisterResponse
 
 	token := strings.TrimSpace(tokenRaw)
@@ -1322,9 +1003,16 @@ func (ui *WebUI) remoteEnrollToServer(serverRaw, tokenRaw, endpointRaw string) (
 		return resp, http.StatusBadRequest, fmt.Errorf("invalid server address: %w", err)
 	}
 
-	joinURL := fmt.Sprintf("%s/join/%s", serverBase, url.PathEscape(token))
+	query := url.Values{}
 	if endpoint := strings.TrimSpace(endpointRaw); endpoint != "" {
-		joinURL += "?endpoint=" + url.QueryEscape(endpoint)
+		query.Set("endpoint", endpoint)
+	}
+	if fp := normalizeFingerprint(fingerprint); fp != "" {
+		query.Set(fingerprintQueryKey, fp)
+	}
+	joinURL := fmt.Sprintf("%s/join/%s", serverBase, url.PathEscape(token))
+	if len(query) > 0 {
+		joinURL += "?" + query.Encode()
 	}
 
 	if err := ui.config.RemoteEnroll(joinURL); err != nil {
@@ -1363,7 +1051,6 @@ func (ui *WebUI) remoteEnrollToServer(serverRaw, tokenRaw, endpointRaw string) (
 // POST /api/register
 func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -1371,6 +1058,21 @@ func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	addr := remoteAddr(r)
+	if !ui.guard.AllowPublic(addr) {
+		ui.audit.Record(AuditEntry{Event: AuditRateLimited, RemoteAddr: addr.String(), Detail: "/api/register"})
+		ui.metrics.registrations.Inc(registerRateLimited)
+		w.Header().Set("Retry-After", strconv.Itoa(int(publicInterval.Seconds())))
+		writeAPIError(w, r, apiErrorf(http.StatusTooManyRequests, ErrCodeRateLimited, "Too many requests"))
+		return
+	}
+	if remaining := ui.guard.Locked(ui.guard.inviteLockKey(addr)); remaining > 0 {
+		ui.metrics.registrations.Inc(registerRateLimited)
+		w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		writeAPIError(w, r, apiErrorf(http.StatusTooManyRequests, ErrCodeRateLimited, "Too many invalid invitation tokens, try again later"))
+		return
+	}
+
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -1378,21 +1080,18 @@ func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 客户端入驻：由本机转发到用户指定的远端服务端执行真实注册
+	// 向远端服务端入驻会改写本机身份并返回私钥，只能经由需要 system 权限的 /api/enroll
 	if strings.TrimSpace(req.Server) != "" {
-		resp, status, err := ui.remoteEnrollToServer(req.Server, req.Token, req.Endpoint)
-		if err != nil {
-			w.WriteHeader(status)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
-		json.NewEncoder(w).Encode(resp)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Remote enrollment is not available here, use /api/v1/enroll"})
 		return
 	}
 
 	// 1. 校验 Token
 	invite, ok := ui.config.ValidateInvite(req.Token)
 	if !ok {
+		ui.inviteFailed(addr, "/api/register")
+		ui.metrics.registrations.Inc(registerInvalidInvite)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid or expired invitation token"})
 		return
@@ -1401,6 +1100,7 @@ func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 	// 2. 分配 IP
 	assignedIP, err := ui.config.GetNextAvailableIP()
 	if err != nil {
+		ui.metrics.registrations.Inc(registerFailed)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "IP Allocation failed: " + err.Error()})
 		return
@@ -1425,6 +1125,7 @@ func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 	uapi += fmt.Sprintf("persistent_keepalive_interval=%d\n", keepalive)
 	if err := ui.device.IpcSet(uapi); err != nil {
+		ui.metrics.registrations.Inc(registerFailed)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to inject into network: " + err.Error()})
 		return
@@ -1440,7 +1141,15 @@ func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 	// 6. 持久化并销毁邀请码
 	ui.config.RemoveInvite(req.Token)
 	ui.config.SyncFromDevice(ui.device)
+	if len(invite.Tags) > 0 {
+		ui.config.SetPeerTags(clientPub, invite.Tags)
+	}
 	SaveConfig(ui.config)
+	ui.guard.Succeed(ui.guard.inviteLockKey(addr))
+	ui.audit.Record(AuditEntry{Event: AuditRegister, RemoteAddr: addr.String(), Detail: fmt.Sprintf("%s %s (%s)", clientPub, assignedIP, invite.Remark)})
+	ui.metrics.registrations.Inc(registerSuccess)
+	ui.events.Publish(Event{Type: EventInviteConsumed, Peer: clientPub, Detail: invite.Remark})
+	ui.events.Publish(Event{Type: EventPeerRegistered, Peer: clientPub, Detail: fmt.Sprintf("%s (%s)", assignedIP, invite.Remark)})
 
 	// 7. 返回响应
 	resp := RegisterResponse{Status: "ok"}
@@ -1449,23 +1158,7 @@ func (ui *WebUI) handleRegister(w http.ResponseWriter, r *http.Request) {
 	resp.Config.PublicKey = ui.device.GetPublicKey()
 	resp.Config.Endpoint = req.Endpoint
 	if resp.Config.Endpoint == "" {
-		if ui.config.System.PublicHost != "" {
-			port := ui.config.System.PublicPort
-			if port == 0 {
-				port = 51820
-			}
-			resp.Config.Endpoint = fmt.Sprintf("%s:%d", ui.config.System.PublicHost, port)
-		}
-		if resp.Config.Endpoint == "" {
-			// fallback 保持不变...
-			// 如果没填，尝试从请求 Host 猜一个
-			host, _, _ := net.SplitHostPort(r.Host)
-			port := ui.config.System.ListenPort
-			if port == 0 {
-				port = 51207
-			}
-			resp.Config.Endpoint = fmt.Sprintf("%s:%d", host, port)
-		}
+		resp.Config.Endpoint, _ = ui.publicEndpoint(r)
 	}
 	allowedIPs := ui.config.System.InternalSubnet
 	if allowedIPs == "" {
@@ -1500,371 +1193,102 @@ func normalizeEnrollServer(raw string) (string, error) {
 	return fmt.Sprintf("%s://%s", u.Scheme, u.Host), nil
 }
 
+// inviteFailed 记录一次无效邀请码尝试，同一来源连续失败将被临时锁定
+// 日志中不记录邀请码本身，避免把猜测值或真实邀请码写入日志
+func (ui *WebUI) inviteFailed(addr netip.Addr, path string) {
+	ui.audit.Record(AuditEntry{Event: AuditInviteInvalid, RemoteAddr: addr.String(), Detail: path})
+	if d := ui.guard.Fail(ui.guard.inviteLockKey(addr)); d > 0 {
+		ui.audit.Record(AuditEntry{Event: AuditLockout, RemoteAddr: addr.String(), Detail: "invite attempts locked for " + d.String()})
+		ui.device.GetLogger().Errorf("Invite attempts from %s locked for %v", addr, d)
+	}
+}
+
 // handleJoin 处理邀请入网引导页
 // GET /join/{token}
 func (ui *WebUI) handleJoin(w http.ResponseWriter, r *http.Request) {
 	// 1. 精准提取
 	token := strings.TrimPrefix(r.URL.Path, "/join/")
 	token = strings.Trim(token, " /")
-	serverOverride := r.URL.Query().Get("server")
 
-	// 2. 校验
-	inviteRemark := "远端服务端"
-	if strings.TrimSpace(serverOverride) == "" {
-		invite, ok := ui.config.ValidateInvite(token)
-		if !ok {
-			ui.device.GetLogger().Errorf("邀请码无效或已过期: [%s]", token)
-			ui.renderErrorPage(w, "邀请无效", "该邀请码已过期、已被使用或根本不存在。")
-			return
-		}
-		inviteRemark = invite.Remark
-	}
-
-	html := `
-<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>加入网络 - WireGuard</title>
-    <script src="https://cdn.jsdelivr.net/npm/qrcode-generator@1.4.4/qrcode.min.js"></script>
-    <style>
-        :root {
-            --primary: #00d2ff;
-            --bg: #0f172a;
-            --glass: rgba(255, 255, 255, 0.05);
-            --border: rgba(255, 255, 255, 0.1);
-        }
-        * { box-sizing: border-box; margin: 0; padding: 0; font-family: 'Inter', system-ui, sans-serif; }
-        body { background: var(--bg); color: white; min-height: 100vh; display: flex; align-items: center; justify-content: center; padding: 20px; }
-        .glass-card { background: var(--glass); backdrop-filter: blur(20px); border: 1px solid var(--border); border-radius: 24px; padding: 40px; width: 100%; max-width: 500px; box-shadow: 0 25px 50px -12px rgba(0,0,0,0.5); text-align: center; }
-        .logo { font-size: 32px; font-weight: 800; margin-bottom: 10px; background: linear-gradient(45deg, #00d2ff, #3a7bd5); -webkit-background-clip: text; -webkit-text-fill-color: transparent; }
-        .remark { color: #94a3b8; margin-bottom: 30px; font-size: 14px; }
-        .btn { background: linear-gradient(45deg, #00d2ff, #3a7bd5); color: white; border: none; padding: 14px 28px; border-radius: 12px; font-weight: 600; cursor: pointer; transition: 0.3s; width: 100%; margin-top: 20px; }
-        .btn:hover { transform: translateY(-2px); box-shadow: 0 10px 20px rgba(0, 210, 255, 0.3); }
-        .btn:disabled { opacity: 0.5; cursor: not-allowed; }
-        .config-box { background: rgba(0,0,0,0.3); border-radius: 12px; padding: 20px; margin-top: 30px; text-align: left; display: none; border: 1px solid var(--border); }
-        .config-header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 15px; }
-        .qr-area { display: flex; justify-content: center; margin: 20px 0; background: white; padding: 15px; border-radius: 12px; }
-        pre { font-family: 'JetBrains Mono', monospace; font-size: 12px; color: #38bdf8; overflow-x: auto; white-space: pre-wrap; word-break: break-all; margin-top: 15px; border-top: 1px solid var(--border); padding-top: 15px; }
-        .tab-nav { display: flex; gap: 10px; margin-bottom: 15px; border-bottom: 1px solid var(--border); padding-bottom: 10px; }
-        .tab-item { cursor: pointer; color: #64748b; font-size: 14px; padding: 5px 10px; border-radius: 6px; }
-        .tab-item.active { color: var(--primary); background: rgba(0, 210, 255, 0.1); }
-    </style>
-</head>
-<body>
-    <div class="glass-card">
-        <div class="logo">WireGuard</div>
-        <div class="remark">您受邀加入网络：<strong>` + inviteRemark + `</strong></div>
-        
-        <div id="action-area">
-            <p style="color: #94a3b8; font-size: 14px; line-height: 1.6;">点击下方按钮，母舰将为您自动生成私钥并分配内网 IP。注册成功后，您将获得完整的 WireGuard 配置。</p>
-            <button class="btn" id="reg-btn" onclick="register()">立即加入网络</button>
-        </div>
-
-        <div id="config-area" class="config-box">
-            <div class="config-header">
-                <span style="font-weight: 600; color: var(--primary);">入网配置已就绪</span>
-                <button onclick="copyConf()" style="background:none; border:none; color:#94a3b8; cursor:pointer; font-size:12px;">复制文本</button>
-            </div>
-            
-            <div class="tab-nav">
-                <div class="tab-item active" onclick="showTab('qr', event)">手机扫码</div>
-                <div class="tab-item" onclick="showTab('text', event)">手动配置</div>
-            </div>
-
-            <div id="tab-qr" class="qr-area">
-                <div id="qrcode"></div>
-            </div>
-            
-            <div id="tab-text" style="display:none">
-                <pre id="conf-text"></pre>
-            </div>
-
-            <p style="margin-top: 15px; font-size: 12px; color: #64748b;">请妥善保管您的私钥，由于服务器不存储私钥，丢失后需联系管理员重新注销并入驻。</p>
-        </div>
-    </div>
-
-    <script>
-        let configData = null;
-
-        async function register() {
-            const btn = document.getElementById('reg-btn');
-            btn.disabled = true;
-            btn.innerText = '正在入驻...';
-
-            try {
-                const params = new URLSearchParams(window.location.search);
-                const payload = { token: '` + token + `' };
-                const server = (params.get('server') || '').trim();
-                const endpoint = (params.get('endpoint') || '').trim();
-                if (server) payload.server = server;
-                if (endpoint) payload.endpoint = endpoint;
-
-                const res = await fetch('/api/register', {
-                    method: 'POST',
-                    body: JSON.stringify(payload)
-                });
-                const data = await res.json();
-                
-                if (data.error) throw new Error(data.error);
-                
-                configData = data.config;
-                renderResult();
-            } catch (e) {
-                alert('注册失败: ' + e.message);
-                btn.disabled = false;
-                btn.innerText = '立即加入网络';
-            }
-        }
-
-        function renderResult() {
-            document.getElementById('action-area').style.display = 'none';
-            document.getElementById('config-area').style.display = 'block';
-            
-            const conf = "[Interface]\n" +
-                         "PrivateKey = " + configData.private_key + "\n" +
-                         "Address = " + configData.address + "\n" +
-                         "DNS = 114.114.114.114\n\n" +
-                         "[Peer]\n" +
-                         "PublicKey = " + configData.public_key + "\n" +
-                         "Endpoint = " + configData.endpoint + "\n" +
-                         "AllowedIPs = " + configData.allowed_ips.join(', ') + "\n" +
-                         "PersistentKeepalive = 25";
-            
-            document.getElementById('conf-text').innerText = conf;
-
-            // 生成二维码
-            const qr = qrcode(0, 'M');
-            qr.addData(conf);
-            qr.make();
-            document.getElementById('qrcode').innerHTML = qr.createImgTag(5);
-        }
-
-        function showTab(tab, event) {
-            document.getElementById('tab-qr').style.display = tab === 'qr' ? 'flex' : 'none';
-            document.getElementById('tab-text').style.display = tab === 'text' ? 'block' : 'none';
-            document.querySelectorAll('.tab-item').forEach(el => el.classList.remove('active'));
-            event.target.classList.add('active');
-        }
-
-        function copyConf() {
-            const text = document.getElementById('conf-text').innerText;
-            if (navigator.clipboard && window.isSecureContext) {
-                navigator.clipboard.writeText(text).then(() => {
-                    alert('已复制到剪贴板');
-                }).catch(() => fallbackCopy(text));
-            } else {
-                fallbackCopy(text);
-            }
-        }
-
-        function fallbackCopy(text) {
-            const textArea = document.createElement("textarea");
-            textArea.value = text;
-            textArea.style.position = "fixed";
-            textArea.style.left = "-9999px";
-            textArea.style.top = "0";
-            document.body.appendChild(textArea);
-            textArea.focus();
-            textArea.select();
-            try {
-                document.execCommand('copy');
-                alert('已复制到剪贴板');
-            } catch (err) {
-                alert('复制失败，请手动选择复制');
-            }
-            document.body.removeChild(textArea);
-        }
-    </script>
-</body>
-</html>
-`
-	fmt.Fprint(w, html)
-}
+	// 2. 限流与校验
+	addr := remoteAddr(r)
+	if !ui.guard.AllowPublic(addr) || ui.guard.Locked(ui.guard.inviteLockKey(addr)) > 0 {
+		ui.audit.Record(AuditEntry{Event: AuditRateLimited, RemoteAddr: addr.String(), Detail: "/join/"})
+		ui.renderErrorPage(w, r, http.StatusTooManyRequests, "error.rate_limited.title", "error.rate_limited")
+		return
+	}
+	invite, ok := ui.config.ValidateInvite(token)
+	if !ok {
+		ui.inviteFailed(addr, "/join/")
+		ui.renderErrorPage(w, r, http.StatusOK, "error.invalid_invite.title", "error.invalid_invite")
+		return
+	}
 
-// renderErrorPage 渲染美化的错误页
-func (ui *WebUI) renderErrorPage(w http.ResponseWriter, title, msg string) {
-	html := `
-<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <title>发生错误 - WireGuard</title>
-    <style>
-        body { background: #0f172a; color: white; height: 100vh; display: flex; align-items: center; justify-content: center; font-family: system-ui; }
-        .card { background: rgba(255,255,255,0.05); padding: 40px; border-radius: 20px; border: 1px solid rgba(255,255,255,0.1); text-align: center; }
-        h1 { color: #ef4444; margin-bottom: 20px; }
-        p { color: #94a3b8; }
-    </style>
-</head>
-<body>
-    <div class="card">
-        <h1>` + title + `</h1>
-        <p>` + msg + `</p>
-    </div>
-</body>
-</html>
-`
-	fmt.Fprint(w, html)
+	// 备注与邀请码均由模板按上下文转义
+	ui.renderPage(w, r, http.StatusOK, "join", struct{ Remark, Token string }{invite.Remark, token})
 }
 
 // handleLogin 处理登录逻辑和显示登录页
 func (ui *WebUI) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
+		username := strings.TrimSpace(r.FormValue("username"))
 		password := r.FormValue("password")
-		hash := sha256.Sum256([]byte(password))
-
-		if subtle.ConstantTimeCompare(hash[:], ui.passwordHash[:]) == 1 {
-			http.SetCookie(w, &http.Cookie{
-				Name:     sessionCookieName,
-				Value:    ui.sessionToken,
-				Path:     "/",
-				HttpOnly: true,
-				MaxAge:   86400 * 7, // 7 天有效
-			})
-			http.Redirect(w, r, "/", http.StatusFound)
+		addr := remoteAddr(r)
+		keys := []string{userLockKey(username), ui.guard.addrLockKey(addr)}
+
+		if !ui.guard.AllowLogin(addr) {
+			ui.audit.Record(AuditEntry{Event: AuditRateLimited, Actor: username, RemoteAddr: addr.String(), Detail: "/login"})
+			http.Redirect(w, r, "/login?error=rate", http.StatusFound)
+			return
+		}
+		// 锁定期间不再校验密码，避免锁定期内仍可试探
+		if remaining := ui.guard.Locked(keys...); remaining > 0 {
+			ui.audit.Record(AuditEntry{Event: AuditLoginFailure, Actor: username, RemoteAddr: addr.String(), Detail: "locked out"})
+			http.Redirect(w, r, "/login?error=locked", http.StatusFound)
+			return
+		}
+
+		user, ok := ui.config.Authenticate(username, password)
+		if !ok {
+			ui.audit.Record(AuditEntry{Event: AuditLoginFailure, Actor: username, RemoteAddr: addr.String()})
+			if d := ui.guard.Fail(keys...); d > 0 {
+				ui.audit.Record(AuditEntry{Event: AuditLockout, Actor: username, RemoteAddr: addr.String(), Detail: "locked for " + d.String()})
+				ui.device.GetLogger().Errorf("WebUI login locked for %v after repeated failures (user %q, from %s)", d, username, addr)
+			}
+			http.Redirect(w, r, "/login?error=1", http.StatusFound)
+			return
+		}
+		ui.guard.Succeed(keys...)
+		token, err := ui.sessions.Create(user.Username)
+		if err != nil {
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
 			return
 		}
-		http.Redirect(w, r, "/login?error=1", http.StatusFound)
+		ui.audit.Record(AuditEntry{Event: AuditLoginSuccess, Actor: user.Username, RemoteAddr: addr.String()})
+		ui.setSessionCookie(w, r, token)
+		ui.setCSRFCookie(w, r, token)
+		if user.MustChangePassword {
+			http.Redirect(w, r, "/account/password", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	errorMsg := ""
-	if r.URL.Query().Get("error") != "" {
-		errorMsg = `<div style="background:rgba(239, 68, 68, 0.1); color:#ef4444; padding:12px; border-radius:8px; margin-bottom:20px; font-size:14px; text-align:center; border:1px solid rgba(239, 68, 68, 0.2);">密码错误，请重试</div>`
-	}
-
-	fmt.Fprint(w, `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>登录 - WireGuard Controller</title>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body {
-            font-family: 'Inter', -apple-system, sans-serif;
-            background: #0f172a;
-            height: 100vh;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            color: #f1f5f9;
-        }
-        .login-card {
-            background: rgba(30, 41, 59, 0.7);
-            backdrop-filter: blur(12px);
-            padding: 40px;
-            border-radius: 20px;
-            border: 1px solid rgba(255, 255, 255, 0.1);
-            width: 100%;
-            max-width: 400px;
-            box-shadow: 0 25px 50px -12px rgba(0, 0, 0, 0.5);
-        }
-        h2 { text-align: center; margin-bottom: 8px; color: #38bdf8; font-size: 24px; }
-        p.subtitle { text-align: center; color: #64748b; font-size: 14px; margin-bottom: 30px; }
-        input {
-            width: 100%;
-            padding: 12px 16px;
-            background: rgba(15, 23, 42, 0.5);
-            border: 1px solid #334155;
-            border-radius: 8px;
-            color: #fff;
-            font-size: 16px;
-            margin-bottom: 20px;
-            outline: none;
-            transition: border-color 0.2s;
-        }
-        input:focus { border-color: #38bdf8; }
-        button {
-            width: 100%;
-            padding: 12px;
-            background: #0ea5e9;
-            color: white;
-            border: none;
-            border-radius: 8px;
-            font-size: 16px;
-            font-weight: 600;
-            cursor: pointer;
-            transition: background 0.2s;
-        }
-        button:hover { background: #0284c7; }
-        .footer { text-align: center; margin-top: 24px; font-size: 12px; color: #475569; }
-    </style>
-</head>
-<body>
-    <div class="login-card">
-        <h2>🛡️ 身份验证</h2>
-        <p class="subtitle">请输入访问密码以继续</p>
-        `+errorMsg+`
-        <form method="POST">
-            <input type="password" name="password" placeholder="访问密码" autofocus required>
-            <button type="submit">立即登录</button>
-        </form>
-        <div class="footer">Userspace WireGuard Controller</div>
-    </div>
-</body>
-</html>`)
+	var errorKey string
+	if e := r.URL.Query().Get("error"); e != "" {
+		errorKey = "login.error.invalid"
+		switch e {
+		case "locked":
+			errorKey = "login.error.locked"
+		case "rate":
+			errorKey = "login.error.rate"
+		}
+	}
+	ui.renderPage(w, r, http.StatusOK, "login", struct{ Error string }{errorKey})
 }
 
 // renderJoinPortal 渲染通用的入驻门户页面 (不带 Token)
-func (ui *WebUI) renderJoinPortal(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	html := `
-<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>入驻门户 - WireGuard 母舰</title>
-    <style>
-        :root { --primary: #00d2ff; --bg: #0f172a; --glass: rgba(255, 255, 255, 0.05); }
-        body { background: var(--bg); color: white; min-height: 100vh; display: flex; align-items: center; justify-content: center; padding: 20px; font-family: system-ui; }
-        .glass-card { background: var(--glass); backdrop-filter: blur(20px); border: 1px solid rgba(255, 255, 255, 0.1); border-radius: 24px; padding: 40px; width: 100%; max-width: 450px; text-align: center; }
-        .title { font-size: 28px; font-weight: 800; margin-bottom: 30px; }
-        input { width: 100%; padding: 14px; border-radius: 12px; border: 1px solid rgba(255,255,255,0.1); background: rgba(0,0,0,0.2); color: white; font-size: 16px; margin-bottom: 20px; text-align: center; letter-spacing: 2px; }
-        .btn { background: linear-gradient(45deg, #00d2ff, #3a7bd5); color: white; border: none; padding: 14px; border-radius: 12px; font-weight: 600; cursor: pointer; width: 100%; transition: 0.3s; }
-        .btn:hover { transform: translateY(-2px); box-shadow: 0 10px 20px rgba(0, 210, 255, 0.3); }
-    </style>
-</head>
-<body>
-    <div class="glass-card">
-        <div class="title">🚀 欢迎加入网络</div>
-        
-        <div style="text-align: left; background: rgba(0,0,0,0.2); padding: 15px; border-radius: 12px; margin-bottom: 25px; border: 1px solid rgba(255,255,255,0.05);">
-            <p style="color:#38bdf8; font-size:13px; font-weight:600; margin-bottom:8px;">💡 使用说明</p>
-            <ol style="color:#94a3b8; font-size:12px; padding-left:18px; line-height:1.6;">
-                <li>请输入管理员发放的 <strong>12 位邀请码</strong>。</li>
-                <li><strong>服务器地址</strong> 必须手动填写 (格式如 <code>ip:51820</code>)。</li>
-                <li>提交后将自动为您生成 WireGuard 配置信息。</li>
-            </ol>
-        </div>
-
-        <p style="color:#94a3b8; font-size:13px; margin-bottom:10px; font-weight:600;">邀请码</p>
-        <input type="text" id="token" placeholder="示例: ABCD-1234-XYZ" autocomplete="off">
-        
-        <p style="color:#94a3b8; font-size:13px; margin-top:10px; margin-bottom:10px; font-weight:600;">服务器公网地址 (Endpoint)</p>
-        <input type="text" id="endpoint" placeholder="例如: 1.2.3.4:51820" autocomplete="off">
-        
-        <button class="btn" onclick="go()">立即入驻网络</button>
-    </div>
-    <script>
-        function go() {
-            const token = document.getElementById('token').value.trim();
-            const endpoint = document.getElementById('endpoint').value.trim();
-            if(!token) return alert('请填入邀请码');
-            if(!endpoint) return alert('请填入服务器 Endpoint 地址');
-            
-            let url = '/join/' + token;
-            url += '?endpoint=' + encodeURIComponent(endpoint);
-            window.location.href = url;
-        }
-        document.getElementById('token').onkeypress = (e) => e.key === 'Enter' && go();
-        document.getElementById('endpoint').onkeypress = (e) => e.key === 'Enter' && go();
-    </script>
-</body>
-</html>`
-	fmt.Fprint(w, html)
+func (ui *WebUI) renderJoinPortal(w http.ResponseWriter, r *http.Request) {
+	ui.renderPage(w, r, http.StatusOK, "portal", nil)
 }
@@ -0,0 +1,319 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// webui_account.go - 账号相关接口：注销、修改密码、账号、角色与 API 令牌管理
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleLogout 注销当前会话
+// POST /logout
+func (ui *WebUI) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		username, ok := ui.sessions.Lookup(cookie.Value)
+		if ok && !checkCSRF(r, cookie.Value) {
+			ui.rejectCSRF(w, r, username)
+			return
+		}
+		ui.sessions.Revoke(cookie.Value)
+		if ok {
+			ui.audit.Record(AuditEntry{Event: AuditLogout, Actor: username, RemoteAddr: remoteAddr(r).String()})
+		}
+	}
+	ui.setCSRFCookie(w, r, "")
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// handlePasswordChange 修改当前账号密码 (首次登录强制进入)
+// GET/POST /account/password
+func (ui *WebUI) handlePasswordChange(w http.ResponseWriter, r *http.Request) {
+	username := currentUser(r)
+
+	if r.Method == http.MethodPost {
+		current := r.FormValue("current_password")
+		newPassword := r.FormValue("new_password")
+		confirm := r.FormValue("confirm_password")
+
+		errKey := ""
+		if _, ok := ui.config.Authenticate(username, current); !ok {
+			errKey = "password.error.wrong_current"
+		} else if newPassword != confirm {
+			errKey = "password.error.mismatch"
+		} else if newPassword == current {
+			errKey = "password.error.unchanged"
+		} else if err := ui.config.SetUserPassword(username, newPassword, false); err != nil {
+			errKey = "password.error.weak"
+		}
+		if errKey != "" {
+			ui.renderPasswordPage(w, r, errKey)
+			return
+		}
+
+		if err := SaveConfig(ui.config); err != nil {
+			ui.device.GetLogger().Errorf("Failed to save config after password change: %v", err)
+		}
+		// 密码修改后注销该账号在其他地方的会话，仅保留当前会话
+		keep := ""
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			keep = cookie.Value
+		}
+		ui.sessions.RevokeUser(username, keep)
+		ui.auditRequest(r, AuditPasswordChange, "")
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	ui.renderPasswordPage(w, r, "")
+}
+
+// renderPasswordPage 渲染修改密码页面，errKey 为错误提示的文案键
+func (ui *WebUI) renderPasswordPage(w http.ResponseWriter, r *http.Request, errKey string) {
+	user, _ := ui.config.FindUser(currentUser(r))
+	ui.renderPage(w, r, http.StatusOK, "password", struct {
+		MustChange           bool
+		Error                string
+		CSRFField, CSRFToken string
+		MinLength            int
+	}{user.MustChangePassword, errKey, csrfFormField, currentPrincipal(r).CSRFToken, minPasswordLength})
+}
+
+// UserRequest 账号管理请求体
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// handleUsers 管理员账号管理
+// GET    /api/users  列出账号
+// POST   /api/users  新增账号 (新账号首次登录需修改密码，默认角色 viewer)
+// PUT    /api/users  重置密码和/或修改角色 (重置他人密码后对方需重新修改)
+// DELETE /api/users  删除账号
+func (ui *WebUI) handleUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(ui.config.ListUsers())
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = ui.createUser(r, req.Username, req.Password, req.Role)
+	case http.MethodPut:
+		err = ui.updateUser(r, req.Username, req.Password, req.Role)
+	case http.MethodDelete:
+		err = ui.removeUser(r, req.Username)
+	}
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	if err := SaveConfig(ui.config); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ui.auditRequest(r, AuditUserChange, fmt.Sprintf("%s %s role=%q password_reset=%t", r.Method, req.Username, req.Role, req.Password != ""))
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// TokenCreateRequest 创建 API 令牌请求体
+type TokenCreateRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []Scope  `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 有效期（天），0 为永不过期
+	AllowedIPs    []string `json:"allowed_ips,omitempty"`     // 来源 IP/网段限制
+}
+
+// TokenCreateResponse 创建成功返回，明文令牌仅此一次可见
+type TokenCreateResponse struct {
+	Token string       `json:"token"`
+	Info  APITokenInfo `json:"info"`
+}
+
+// handleTokens API 令牌管理 (仅限浏览器会话)
+// GET    /api/tokens  列出令牌
+// POST   /api/tokens  创建令牌
+// DELETE /api/tokens  撤销令牌 {"id": "..."}
+func (ui *WebUI) handleTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// 普通账号只能查看和撤销自己的令牌，具备 users.manage 权限的账号可管理全部令牌
+	owner := currentUser(r)
+	p := currentPrincipal(r)
+	if p.can(PermUsersManage) {
+		owner = ""
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(ui.config.ListAPITokens(owner))
+
+	case http.MethodPost:
+		var req TokenCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		if req.ExpiresInDays < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "expires_in_days must not be negative"})
+			return
+		}
+		ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+		plain, info, err := ui.config.CreateAPIToken(currentUser(r), req.Name, req.Scopes, req.AllowedIPs, ttl)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if err := SaveConfig(ui.config); err != nil {
+			ui.config.RevokeAPIToken(info.ID, "")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		ui.auditRequest(r, AuditTokenChange, fmt.Sprintf("create %s %v", info.ID, info.Scopes))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(TokenCreateResponse{Token: plain, Info: info})
+
+	case http.MethodDelete:
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		if !ui.config.RevokeAPIToken(req.ID, owner) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Token not found"})
+			return
+		}
+		if err := SaveConfig(ui.config); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		ui.auditRequest(r, AuditTokenChange, "revoke "+req.ID)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// handleRoles 角色管理
+// GET    /api/roles  列出内置与自定义角色
+// POST   /api/roles  新增或更新自定义角色
+// DELETE /api/roles  删除自定义角色 {"name": "..."}
+func (ui *WebUI) handleRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(ui.config.ListRoles())
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var role Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	var err error
+	if r.Method == http.MethodPost {
+		if err := ui.checkRole(r, role); err != nil {
+			writeAPIError(w, r, err)
+			return
+		}
+		err = ui.config.SaveRole(role)
+	} else {
+		err = ui.config.RemoveRole(role.Name)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err := SaveConfig(ui.config); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ui.auditRequest(r, AuditRoleChange, r.Method+" "+role.Name)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// MeResponse 当前登录账号信息，WebUI 据此隐藏无权限的操作
+type MeResponse struct {
+	Username    string       `json:"username"`
+	Role        string       `json:"role"`
+	Permissions []Permission `json:"permissions"`
+	PeerTags    []string     `json:"peer_tags,omitempty"`
+	Locale      string       `json:"locale,omitempty"` // WebUI 语言偏好 (页面上通过 ?lang= 切换)
+}
+
+// handleMe 返回当前登录账号的角色与权限
+// GET /api/me
+func (ui *WebUI) handleMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	p := currentPrincipal(r)
+	user, _ := ui.config.FindUser(p.Username)
+	json.NewEncoder(w).Encode(MeResponse{
+		Username:    p.Username,
+		Role:        p.Role.Name,
+		Permissions: p.Permissions,
+		PeerTags:    p.Role.PeerTags,
+		Locale:      user.Locale,
+	})
+}
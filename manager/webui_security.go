@@ -0,0 +1,119 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// webui_security.go - 跨域白名单与 CSRF 防护
+// 跨域仅对 system.cors_origins 中列出的来源放行；
+// 使用会话 Cookie 的写请求必须携带与会话绑定的 CSRF 令牌 (双重提交)，Bearer 令牌请求不受影响
+
+package manager
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	csrfCookieName = "wg_ui_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// csrfToken 由会话令牌派生 CSRF 令牌
+// 攻击页面读不到会话 Cookie，也就无法构造出匹配的令牌；会话轮换后旧令牌随之失效
+func csrfToken(sessionToken string) string {
+	sum := sha256.Sum256([]byte("csrf:" + sessionToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// setCSRFCookie 下发前端脚本可读的 CSRF Cookie
+func (ui *WebUI) setCSRFCookie(w http.ResponseWriter, r *http.Request, sessionToken string) {
+	value, maxAge := "", -1
+	if sessionToken != "" {
+		value, maxAge = csrfToken(sessionToken), int(ui.sessionMaxAge().Seconds())
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    value,
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   maxAge,
+	})
+}
+
+// safeMethod 判断请求方法是否不改变状态
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkCSRF 校验写请求携带的 CSRF 令牌 (请求头或表单字段)
+func checkCSRF(r *http.Request, sessionToken string) bool {
+	if safeMethod(r.Method) {
+		return true
+	}
+	got := r.Header.Get(csrfHeaderName)
+	if got == "" {
+		got = r.PostFormValue(csrfFormField)
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(csrfToken(sessionToken))) == 1
+}
+
+// rejectCSRF 返回 403 并记录审计
+func (ui *WebUI) rejectCSRF(w http.ResponseWriter, r *http.Request, username string) {
+	ui.audit.Record(AuditEntry{
+		Event:      AuditCSRFRejected,
+		Actor:      username,
+		RemoteAddr: remoteAddr(r).String(),
+		Detail:     r.Method + " " + r.URL.Path,
+	})
+	writeForbidden(w, r, ErrCodeCSRF, "CSRF token missing or invalid")
+}
+
+// corsAllowed 判断来源是否在跨域白名单中
+func (ui *WebUI) corsAllowed(origin string) bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	for _, allowed := range ui.config.System.CORSOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware 按白名单回应跨域请求
+// 跨域调用只能使用 Bearer 令牌，因此不返回 Allow-Credentials
+func (ui *WebUI) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := ui.corsAllowed(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		// 预检请求
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				writeForbidden(w, r, ErrCodeForbidden, "Origin not allowed")
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	tu := newTestUI(t)
+	tu.addUser("alice", "longenough", RoleOperator)
+	c := tu.login("alice", "longenough")
+	token := tu.token("bob", RoleOperator, ScopeInvites)
+	const body = `{"remark":"kiosk"}`
+
+	tests := []struct {
+		name   string
+		header []string
+		status int
+	}{
+		{"missing token", nil, http.StatusForbidden},
+		{"wrong token", []string{csrfHeaderName, csrfToken("other-session")}, http.StatusForbidden},
+		{"header token", []string{csrfHeaderName, tu.cookie(c, csrfCookieName)}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		resp, body := tu.do(c, http.MethodPost, "/api/v1/invites", body, tt.header...)
+		if resp.StatusCode != tt.status || (tt.status == http.StatusForbidden && errorCode(body) != ErrCodeCSRF) {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+	// 读请求与 Bearer 令牌不需要 CSRF 令牌
+	if resp, _ := tu.do(c, http.MethodGet, "/api/v1/invites", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("session GET: %d", resp.StatusCode)
+	}
+	if resp, _ := tu.bearer(token, http.MethodPost, "/api/v1/invites", body); resp.StatusCode != http.StatusCreated {
+		t.Errorf("bearer POST: %d", resp.StatusCode)
+	}
+
+	var rejected int
+	for _, e := range tu.audit.Recent(20) {
+		if e.Event == AuditCSRFRejected && e.Actor == "alice" {
+			rejected++
+		}
+	}
+	if rejected != 2 {
+		t.Errorf("%d CSRF rejections audited, want 2", rejected)
+	}
+
+	// 注销同样需要 CSRF 令牌，否则第三方页面可以强制注销
+	if resp, _ := tu.do(c, http.MethodPost, "/logout", ""); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("logout without CSRF token: %d", resp.StatusCode)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tu := newTestUI(t, func(c *Config) {
+		c.System.CORSOrigins = []string{"https://ops.example/"}
+	})
+	token := tu.token("bob", RoleViewer, ScopeStatusRead)
+
+	tests := []struct {
+		name      string
+		method    string
+		origin    string
+		preflight bool
+		status    int
+		allowed   bool
+	}{
+		{"allowed preflight", http.MethodOptions, "https://ops.example", true, http.StatusNoContent, true},
+		{"allowed preflight other case", http.MethodOptions, "https://OPS.example", true, http.StatusNoContent, true},
+		{"denied preflight", http.MethodOptions, "https://evil.example", true, http.StatusForbidden, false},
+		{"allowed request", http.MethodGet, "https://ops.example", false, http.StatusOK, true},
+		{"denied request", http.MethodGet, "https://evil.example", false, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		header := []string{"Origin", tt.origin, "Authorization", "Bearer " + token}
+		if tt.preflight {
+			header = append(header, "Access-Control-Request-Method", http.MethodGet)
+		}
+		resp, body := tu.do(nil, tt.method, "/api/v1/status", "", header...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); (got == tt.origin) != tt.allowed || (got != "" && got != tt.origin) {
+			t.Errorf("%s: Access-Control-Allow-Origin %q", tt.name, got)
+		}
+		if resp.Header.Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("%s: credentials allowed", tt.name)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn/bindtest"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/tuntest"
+)
+
+// testUI 测试用的 WebUI：内存 TUN 与 Bind，配置、审计与历史写入临时目录，不调用 Start
+type testUI struct {
+	*WebUI
+	t  *testing.T
+	ts *httptest.Server
+}
+
+// newTestUI 创建测试 WebUI，setup 在设备应用配置与创建 WebUI 之前修改配置
+func newTestUI(t *testing.T, setup ...func(*Config)) *testUI {
+	t.Helper()
+	oldPath := dataPath
+	dataPath = filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("WEBUI_PASSWORD", "")
+
+	conf, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.EnsureIdentity()
+	for _, f := range setup {
+		f(conf)
+	}
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), bindtest.NewChannelBinds()[0], device.NewLogger(device.LogLevelError, ""))
+	if err := conf.ApplyToDevice(dev); err != nil {
+		t.Fatal(err)
+	}
+	tu := &testUI{WebUI: NewWebUI(dev, conf, "127.0.0.1:0"), t: t}
+	tu.ts = httptest.NewServer(tu.server.Handler)
+	t.Cleanup(func() {
+		tu.ts.Close()
+		dev.Close()
+		dataPath = oldPath
+	})
+	return tu
+}
+
+// addUser 新增一个无需修改密码即可使用的账号
+func (tu *testUI) addUser(username, password, role string) {
+	tu.t.Helper()
+	if err := tu.config.AddUser(username, password, role); err != nil {
+		tu.t.Fatal(err)
+	}
+	if err := tu.config.SetUserPassword(username, password, false); err != nil {
+		tu.t.Fatal(err)
+	}
+}
+
+// newClient 返回带 Cookie 的客户端，不跟随跳转
+func (tu *testUI) newClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar:           jar,
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// login 登录并返回持有会话的客户端
+func (tu *testUI) login(username, password string) *http.Client {
+	tu.t.Helper()
+	c := tu.newClient()
+	resp, err := c.PostForm(tu.ts.URL+"/login", url.Values{"username": {username}, "password": {password}})
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || strings.Contains(loc, "error") {
+		tu.t.Fatalf("login %q: status %d, location %q", username, resp.StatusCode, loc)
+	}
+	return c
+}
+
+// cookie 读取客户端保存的 Cookie
+func (tu *testUI) cookie(c *http.Client, name string) string {
+	u, _ := url.Parse(tu.ts.URL)
+	for _, ck := range c.Jar.Cookies(u) {
+		if ck.Name == name {
+			return ck.Value
+		}
+	}
+	return ""
+}
+
+// do 发送请求并读取响应体，header 为成对的名称与值
+func (tu *testUI) do(c *http.Client, method, path, body string, header ...string) (*http.Response, string) {
+	tu.t.Helper()
+	req, err := http.NewRequest(method, tu.ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	if c == nil {
+		c = tu.newClient()
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// write 以会话发送写请求，自动带上 CSRF 令牌
+func (tu *testUI) write(c *http.Client, method, path, body string) (*http.Response, string) {
+	tu.t.Helper()
+	return tu.do(c, method, path, body, csrfHeaderName, tu.cookie(c, csrfCookieName))
+}
+
+// bearer 以 API 令牌发送请求
+func (tu *testUI) bearer(token, method, path, body string) (*http.Response, string) {
+	tu.t.Helper()
+	return tu.do(nil, method, path, body, "Authorization", "Bearer "+token)
+}
+
+// errorCode 解析 /api/v1 错误信封中的错误码
+func errorCode(body string) string {
+	var env ErrorEnvelope
+	json.Unmarshal([]byte(body), &env)
+	return env.Error.Code
+}
+
+// testKey 返回第 n 个测试用 Peer 公钥 (标准 Base64)
+func testKey(n byte) string {
+	key := make([]byte, device.NoisePublicKeySize)
+	for i := range key {
+		key[i] = n + byte(i)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// token 为指定角色新建账号并返回其 API 令牌
+func (tu *testUI) token(username, role string, scopes ...Scope) string {
+	tu.t.Helper()
+	tu.addUser(username, "longenough", role)
+	plain, _, err := tu.config.CreateAPIToken(username, "test", scopes, nil, 0)
+	if err != nil {
+		tu.t.Fatal(err)
+	}
+	return plain
+}
@@ -0,0 +1,387 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// Package mqtt 精简的 MQTT 3.1.1 客户端，供管理端的信令桥使用。
+//
+// 只实现信令需要的部分：QoS 0/1 的发布与订阅、遗嘱消息、保活，以及断线后按退避间隔自动重连。
+// 会话总是 clean session，订阅在每次连上后重新发送；不支持 QoS 2 (订阅时请求的 QoS 不超过 1，代理会降级)。
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeepAlive = 60 * time.Second
+	connectTimeout   = 10 * time.Second
+	ackTimeout       = 10 * time.Second // 等待 PUBACK / SUBACK 的时间
+	writeTimeout     = 10 * time.Second
+	maxBackoff       = time.Minute
+)
+
+// ErrNotConnected 当前没有与代理的连接
+var ErrNotConnected = errors.New("mqtt: not connected")
+
+// Message 一条应用消息
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte // 0 或 1
+	Retain  bool
+}
+
+// Handler 处理收到的消息，每条消息在独立的 goroutine 中调用
+type Handler func(Message)
+
+// Options 客户端设置
+type Options struct {
+	Broker    string        // tcp://host:1883、tls://host:8883 (也接受 mqtt://、mqtts://、ssl://)
+	ClientID  string        // 为空时由代理分配
+	Username  string        // 可选
+	Password  string        // 可选
+	KeepAlive time.Duration // 心跳间隔，0 为 60 秒
+	TLSConfig *tls.Config   // tls:// 时使用，nil 为系统默认
+	Will      *Message      // 遗嘱消息，连接异常断开时由代理发布
+
+	// OnConnect 每次连上并完成订阅后调用，可用来发布上线状态
+	OnConnect func(*Client)
+	// Logf 输出连接状态，nil 时不输出
+	Logf func(format string, args ...any)
+}
+
+// subscription 订阅及其处理函数
+type subscription struct {
+	filter  string
+	qos     byte
+	handler Handler
+}
+
+// Client MQTT 客户端
+type Client struct {
+	opts Options
+
+	mu      sync.Mutex
+	conn    net.Conn
+	subs    []subscription
+	nextID  uint16
+	pending map[uint16]chan struct{} // 等待 PUBACK / SUBACK 的报文 ID
+
+	writeMu sync.Mutex
+}
+
+// NewClient 创建客户端，调用 Run 后开始连接
+func NewClient(opts Options) *Client {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = defaultKeepAlive
+	}
+	return &Client{opts: opts, pending: make(map[uint16]chan struct{})}
+}
+
+func (c *Client) logf(format string, args ...any) {
+	if c.opts.Logf != nil {
+		c.opts.Logf(format, args...)
+	}
+}
+
+// Subscribe 注册订阅，已连接时立即发送，之后每次重连都会重新订阅
+func (c *Client) Subscribe(filter string, qos byte, handler Handler) error {
+	c.mu.Lock()
+	c.subs = append(c.subs, subscription{filter: filter, qos: min(qos, 1), handler: handler})
+	connected := c.conn != nil
+	c.mu.Unlock()
+	if !connected {
+		return nil
+	}
+	return c.subscribe(filter, min(qos, 1))
+}
+
+// Connected 判断当前是否已连上代理
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Publish 发布消息；QoS 1 时等待代理确认
+func (c *Client) Publish(msg Message) error {
+	msg.QoS = min(msg.QoS, 1)
+	if msg.QoS == 0 {
+		return c.write(publishPacket(msg, 0, false))
+	}
+	id, ack, err := c.expect()
+	if err != nil {
+		return err
+	}
+	defer c.forget(id)
+	if err := c.write(publishPacket(msg, id, false)); err != nil {
+		return err
+	}
+	return c.wait(ack)
+}
+
+// Run 连接代理并保持连接，断线后按退避间隔重连，直到 ctx 结束
+// ctx 结束时发送 DISCONNECT，代理不会发布遗嘱
+func (c *Client) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		c.logf("MQTT connection to %s lost: %v, retrying in %v", c.opts.Broker, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// dial 按地址的 scheme 建立 TCP 或 TLS 连接
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(c.opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	useTLS := false
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if !useTLS {
+		return dialer.DialContext(ctx, "tcp", host)
+	}
+	conf := c.opts.TLSConfig
+	if conf == nil {
+		conf = &tls.Config{}
+	}
+	if conf.ServerName == "" {
+		conf = conf.Clone()
+		conf.ServerName = u.Hostname()
+	}
+	return (&tls.Dialer{NetDialer: dialer, Config: conf}).DialContext(ctx, "tcp", host)
+}
+
+// session 一次连接的生命周期：CONNECT、订阅、保活，返回断开原因
+func (c *Client) session(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	conn.SetDeadline(time.Now().Add(connectTimeout))
+	if _, err := conn.Write(connectPacket(&c.opts)); err != nil {
+		return err
+	}
+	p, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if p.kind != packetConnack || len(p.body) != 2 {
+		return fmt.Errorf("unexpected packet type %d, want CONNACK", p.kind)
+	}
+	if code := p.body[1]; code != 0 {
+		return fmt.Errorf("connection refused: %s", connackReason(code))
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn = conn
+	subs := append([]subscription(nil), c.subs...)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	readErr := make(chan error, 1)
+	go func() { readErr <- c.readLoop(conn, r) }()
+
+	for _, sub := range subs {
+		if err := c.subscribe(sub.filter, sub.qos); err != nil {
+			return fmt.Errorf("subscribe %s: %w", sub.filter, err)
+		}
+	}
+	c.logf("MQTT connected to %s", c.opts.Broker)
+	if c.opts.OnConnect != nil {
+		go c.opts.OnConnect(c)
+	}
+
+	ping := time.NewTicker(c.opts.KeepAlive * 3 / 4)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.write(encodePacket(packetDisconnect, 0, nil))
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case <-ping.C:
+			if err := c.write(encodePacket(packetPingreq, 0, nil)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readLoop 读取报文直到出错；超过 1.5 倍心跳间隔没有收到任何报文 (含 PINGRESP) 视为断线
+func (c *Client) readLoop(conn net.Conn, r *bufio.Reader) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		p, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+		switch p.kind {
+		case packetPublish:
+			msg, id, err := parsePublish(p)
+			if err != nil {
+				return err
+			}
+			if msg.QoS > 0 {
+				if err := c.write(idPacket(packetPuback, 0, id)); err != nil {
+					return err
+				}
+			}
+			c.dispatch(msg)
+		case packetPuback, packetSuback:
+			if len(p.body) < 2 {
+				return errMalformed
+			}
+			id := uint16(p.body[0])<<8 | uint16(p.body[1])
+			if p.kind == packetSuback && len(p.body) > 2 && p.body[2] == 0x80 {
+				c.logf("MQTT subscription %d rejected by broker", id)
+			}
+			c.mu.Lock()
+			if ch, ok := c.pending[id]; ok {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+		case packetPingresp:
+		default:
+			return fmt.Errorf("unexpected packet type %d", p.kind)
+		}
+	}
+}
+
+// dispatch 把消息交给所有匹配的订阅
+func (c *Client) dispatch(msg Message) {
+	c.mu.Lock()
+	var handlers []Handler
+	for _, sub := range c.subs {
+		if Match(sub.filter, msg.Topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	c.mu.Unlock()
+	for _, h := range handlers {
+		go h(msg)
+	}
+}
+
+// subscribe 发送 SUBSCRIBE 并等待 SUBACK
+func (c *Client) subscribe(filter string, qos byte) error {
+	id, ack, err := c.expect()
+	if err != nil {
+		return err
+	}
+	defer c.forget(id)
+	if err := c.write(subscribePacket(id, filter, qos)); err != nil {
+		return err
+	}
+	return c.wait(ack)
+}
+
+// expect 分配报文 ID 并登记等待确认
+func (c *Client) expect() (uint16, chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return 0, nil, ErrNotConnected
+	}
+	for {
+		c.nextID++
+		if _, busy := c.pending[c.nextID]; c.nextID != 0 && !busy {
+			break
+		}
+	}
+	ch := make(chan struct{})
+	c.pending[c.nextID] = ch
+	return c.nextID, ch, nil
+}
+
+func (c *Client) forget(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) wait(ack chan struct{}) error {
+	select {
+	case <-ack:
+		return nil
+	case <-time.After(ackTimeout):
+		return errors.New("mqtt: timed out waiting for acknowledgement")
+	}
+}
+
+// write 发送一个完整报文
+func (c *Client) write(b []byte) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.Write(b)
+	return err
+}
+
+// connackReason CONNACK 返回码的说明 (§3.2.2.3)
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
@@ -0,0 +1,358 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker 进程内的最小代理：CONNECT、SUBSCRIBE、QoS 0/1 PUBLISH、保留消息与遗嘱
+type testBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	sessions map[*brokerSession]struct{}
+	retained map[string]Message
+}
+
+type brokerSession struct {
+	id      string
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters []string
+	will    *Message
+}
+
+func (s *brokerSession) write(b []byte) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.Write(b)
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{ln: ln, sessions: make(map[*brokerSession]struct{}), retained: make(map[string]Message)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *testBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// close 关闭监听与所有连接
+func (b *testBroker) close() {
+	b.ln.Close()
+	b.dropAll()
+}
+
+// dropAll 断开所有连接
+func (b *testBroker) dropAll() {
+	b.drop("")
+}
+
+// drop 断开指定客户端 (空为全部) 的连接，模拟网络中断，遗嘱照常发布
+func (b *testBroker) drop(clientID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		if clientID == "" || s.id == clientID {
+			s.conn.Close()
+		}
+	}
+}
+
+func (b *testBroker) publish(msg Message) {
+	b.mu.Lock()
+	if msg.Retain {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+	}
+	var targets []*brokerSession
+	for s := range b.sessions {
+		for _, f := range s.filters {
+			if Match(f, msg.Topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	msg.Retain = false
+	for _, s := range targets {
+		s.write(publishPacket(msg, 1, false))
+	}
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	p, err := readPacket(r)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+	s := &brokerSession{conn: conn}
+	cr := reader{b: p.body}
+	cr.string() // 协议名
+	cr.byte()   // 协议级别
+	flags := cr.byte()
+	cr.uint16() // 保活
+	s.id = cr.string()
+	if flags&0x04 != 0 {
+		s.will = &Message{Topic: cr.string(), Payload: cr.bytes(), QoS: (flags >> 3) & 0x03, Retain: flags&0x20 != 0}
+	}
+	if cr.err != nil {
+		return
+	}
+	s.write(encodePacket(packetConnack, 0, []byte{0, 0}))
+
+	b.mu.Lock()
+	b.sessions[s] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+		if s.will != nil {
+			b.publish(*s.will)
+		}
+	}()
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.kind {
+		case packetSubscribe:
+			sr := reader{b: p.body}
+			id := sr.uint16()
+			filter := sr.string()
+			qos := sr.byte()
+			if sr.err != nil {
+				return
+			}
+			b.mu.Lock()
+			s.filters = append(s.filters, filter)
+			var retained []Message
+			for topic, msg := range b.retained {
+				if Match(filter, topic) {
+					retained = append(retained, msg)
+				}
+			}
+			b.mu.Unlock()
+			s.write(encodePacket(packetSuback, 0, []byte{byte(id >> 8), byte(id), qos}))
+			for _, msg := range retained {
+				s.write(publishPacket(msg, 1, false))
+			}
+		case packetPublish:
+			msg, id, err := parsePublish(p)
+			if err != nil {
+				return
+			}
+			if msg.QoS > 0 {
+				s.write(idPacket(packetPuback, 0, id))
+			}
+			b.publish(msg)
+		case packetPuback:
+		case packetPingreq:
+			s.write(encodePacket(packetPingresp, 0, nil))
+		case packetDisconnect:
+			s.will = nil
+			return
+		}
+	}
+}
+
+// startClient 启动客户端并等待连上代理且完成订阅，setup 可在连接前注册订阅
+func startClient(t *testing.T, opts Options, setup func(*Client)) *Client {
+	connected := make(chan struct{}, 1)
+	onConnect := opts.OnConnect
+	opts.OnConnect = func(c *Client) {
+		if onConnect != nil {
+			onConnect(c)
+		}
+		select {
+		case connected <- struct{}{}:
+		default:
+		}
+	}
+	c := NewClient(opts)
+	if setup != nil {
+		setup(c)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+	}
+	return c
+}
+
+func receive(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return Message{}
+}
+
+// brokerURL 设置 MQTT_TEST_BROKER 时对真实代理 (如本地 mosquitto) 运行，否则使用进程内代理
+func brokerURL(t *testing.T) string {
+	if url := os.Getenv("MQTT_TEST_BROKER"); url != "" {
+		return url
+	}
+	return newTestBroker(t).url()
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"iot/dev1/cmd", "iot/dev1/cmd", true},
+		{"iot/+/status", "iot/dev1/status", true},
+		{"iot/+/status", "iot/dev1/cmd", false},
+		{"iot/+/status", "iot/a/b/status", false},
+		{"iot/#", "iot", true},
+		{"iot/#", "iot/dev1/status", true},
+		{"#", "iot/dev1", true},
+		{"+/+", "iot/dev1", true},
+		{"+", "iot/dev1", false},
+		{"#", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+		{"iot/dev1", "iot/dev1/cmd", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	payload := make([]byte, 200000) // 剩余长度需要 3 个字节
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	in := Message{Topic: "iot/dev1/status", Payload: payload, QoS: 1, Retain: true}
+	buf := publishPacket(in, 0x1234, false)
+	p, err := readPacket(bufio.NewReader(&byteReader{b: buf}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, id, err := parsePublish(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0x1234 || out.Topic != in.Topic || out.QoS != 1 || !out.Retain || string(out.Payload) != string(in.Payload) {
+		t.Fatalf("round trip mismatch: id=%#x topic=%q qos=%d retain=%v len=%d", id, out.Topic, out.QoS, out.Retain, len(out.Payload))
+	}
+}
+
+type byteReader struct{ b []byte }
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, net.ErrClosed
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	url := brokerURL(t)
+	got := make(chan Message, 4)
+	startClient(t, Options{Broker: url, ClientID: "test-sub"}, func(c *Client) {
+		c.Subscribe("test/+/cmd", 1, func(m Message) { got <- m })
+	})
+
+	pub := startClient(t, Options{Broker: url, ClientID: "test-pub"}, nil)
+	for _, qos := range []byte{0, 1} {
+		if err := pub.Publish(Message{Topic: "test/dev1/cmd", Payload: []byte(`{"action":"vpn_up"}`), QoS: qos}); err != nil {
+			t.Fatalf("publish QoS %d: %v", qos, err)
+		}
+		msg := receive(t, got)
+		if msg.Topic != "test/dev1/cmd" || string(msg.Payload) != `{"action":"vpn_up"}` {
+			t.Fatalf("unexpected message %q %q", msg.Topic, msg.Payload)
+		}
+	}
+}
+
+func TestWillAndReconnect(t *testing.T) {
+	broker := newTestBroker(t)
+	status := make(chan Message, 8)
+	startClient(t, Options{Broker: broker.url(), ClientID: "test-watcher"}, func(c *Client) {
+		c.Subscribe("test/dev1/status", 1, func(m Message) { status <- m })
+	})
+
+	connects := make(chan struct{}, 4)
+	dev := NewClient(Options{
+		Broker:   broker.url(),
+		ClientID: "test-dev1",
+		Will:     &Message{Topic: "test/dev1/status", Payload: []byte("offline"), QoS: 1, Retain: true},
+		OnConnect: func(c *Client) {
+			c.Publish(Message{Topic: "test/dev1/status", Payload: []byte("online"), QoS: 1, Retain: true})
+			connects <- struct{}{}
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dev.Run(ctx)
+
+	<-connects
+	if msg := receive(t, status); string(msg.Payload) != "online" {
+		t.Fatalf("got %q, want online", msg.Payload)
+	}
+
+	// 网络中断：代理发布遗嘱，设备自动重连后重新上报
+	broker.drop("test-dev1")
+	deadline := time.After(10 * time.Second)
+	seen := map[string]bool{}
+	for !seen["offline"] || !seen["online"] {
+		select {
+		case msg := <-status:
+			seen[string(msg.Payload)] = true
+		case <-deadline:
+			t.Fatalf("after reconnect saw %v, want offline and online", seen)
+		}
+	}
+}
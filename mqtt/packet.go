@@ -0,0 +1,242 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 控制报文类型 (MQTT 3.1.1 §2.2.1)
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+)
+
+// maxPacketSize 可接受的最大报文长度 (剩余长度字段的上限为 256MB，这里收紧)
+const maxPacketSize = 16 << 20
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// packet 解码后的控制报文
+type packet struct {
+	kind  byte
+	flags byte // 固定头低 4 位
+	body  []byte
+}
+
+// readPacket 读取一个完整的控制报文
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	var length, shift int
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		if i == 4 {
+			return packet{}, errMalformed
+		}
+		length |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf("mqtt: packet of %d bytes exceeds limit", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+// encodePacket 加上固定头
+func encodePacket(kind, flags byte, body []byte) []byte {
+	out := []byte{kind<<4 | flags&0x0f}
+	n := len(body)
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// reader 按顺序读取报文的可变头与载荷
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uint16() uint16 {
+	if r.err != nil || len(r.b) < 2 {
+		r.err = errMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := int(r.uint16())
+	if r.err != nil || len(r.b) < n {
+		r.err = errMalformed
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errMalformed
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+// connectPacket CONNECT 报文，会话总是 clean session
+func connectPacket(opts *Options) []byte {
+	flags := byte(0x02) // clean session
+	if opts.Will != nil {
+		flags |= 0x04 | (opts.Will.QoS&0x03)<<3
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // 协议级别 4 = 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive.Seconds()))
+	body = appendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = appendString(body, opts.Will.Topic)
+		body = appendBytes(body, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+	return encodePacket(packetConnect, 0, body)
+}
+
+// publishPacket PUBLISH 报文，QoS 0 时忽略 id
+func publishPacket(msg Message, id uint16, dup bool) []byte {
+	flags := (msg.QoS & 0x03) << 1
+	if msg.Retain {
+		flags |= 0x01
+	}
+	if dup {
+		flags |= 0x08
+	}
+	body := appendString(nil, msg.Topic)
+	if msg.QoS > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return encodePacket(packetPublish, flags, append(body, msg.Payload...))
+}
+
+// parsePublish 解码 PUBLISH 报文，返回消息与报文 ID (QoS 0 时为 0)
+func parsePublish(p packet) (Message, uint16, error) {
+	r := reader{b: p.body}
+	msg := Message{
+		Topic:  r.string(),
+		QoS:    (p.flags >> 1) & 0x03,
+		Retain: p.flags&0x01 != 0,
+	}
+	var id uint16
+	if msg.QoS > 0 {
+		id = r.uint16()
+	}
+	if r.err != nil {
+		return Message{}, 0, r.err
+	}
+	msg.Payload = r.b
+	return msg, id, nil
+}
+
+func idPacket(kind, flags byte, id uint16) []byte {
+	return encodePacket(kind, flags, binary.BigEndian.AppendUint16(nil, id))
+}
+
+// subscribePacket SUBSCRIBE 报文，固定头标志位必须为 0010
+func subscribePacket(id uint16, filter string, qos byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	return encodePacket(packetSubscribe, 0x02, append(body, qos))
+}
+
+// Match 判断主题是否匹配订阅过滤器，支持 + (单层) 与 # (多层) 通配符
+func Match(filter, topic string) bool {
+	// 以 $ 开头的系统主题不被以通配符开头的过滤器匹配 (§4.7.2)
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
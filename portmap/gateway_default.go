@@ -0,0 +1,18 @@
+//go:build !linux
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package portmap
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// defaultGateway 其它平台不自动探测，需在 Config.Gateway 中指定
+func defaultGateway() (netip.Addr, error) {
+	return netip.Addr{}, errors.Join(ErrNoGateway, errors.New("gateway must be configured on this platform"))
+}
@@ -0,0 +1,61 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package portmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const rtfGateway = 0x2
+
+// defaultGateway 从 /proc/net/route 读取 IPv4 默认路由的网关，多条时取 metric 最小的
+func defaultGateway() (netip.Addr, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer f.Close()
+	return parseRoutes(bufio.NewScanner(f))
+}
+
+func parseRoutes(s *bufio.Scanner) (netip.Addr, error) {
+	var best netip.Addr
+	bestMetric := uint64(1<<64 - 1)
+	s.Scan() // 表头
+	for s.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(s.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfGateway == 0 {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[6], 10, 64)
+		if best.IsValid() && metric >= bestMetric {
+			continue
+		}
+		// 内核按主机字节序 (小端) 输出
+		var ip [4]byte
+		binary.BigEndian.PutUint32(ip[:], binary.LittleEndian.Uint32(raw))
+		best, bestMetric = netip.AddrFrom4(ip), metric
+	}
+	if !best.IsValid() {
+		return best, ErrNoGateway
+	}
+	return best, nil
+}
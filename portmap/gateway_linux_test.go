@@ -0,0 +1,27 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package portmap
+
+import (
+	"bufio"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	const routes = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"wlan0\t00000000\t0101A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+		"eth0\t00000000\t0100000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+		"eth0\t0000000A\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n"
+	gw, err := parseRoutes(bufio.NewScanner(strings.NewReader(routes)))
+	if err != nil || gw != netip.MustParseAddr("10.0.0.1") {
+		t.Fatalf("gateway = %v, %v", gw, err)
+	}
+	if _, err := parseRoutes(bufio.NewScanner(strings.NewReader(routes[:strings.Index(routes, "wlan0")]))); err != ErrNoGateway {
+		t.Fatalf("err = %v", err)
+	}
+}
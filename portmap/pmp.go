@@ -0,0 +1,189 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package portmap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// PCP 与 NAT-PMP 共用网关的 UDP 5351 端口，以首字节的版本号区分
+const (
+	pmpVersion = 0
+	pcpVersion = 2
+
+	pmpOpExternalAddr = 0
+	pmpOpMapUDP       = 1
+	pcpOpMap          = 1
+	opResponse        = 0x80
+
+	pmpResultUnsupportedVersion = 1
+	pcpResultUnsupportedVersion = 1
+
+	pcpHeaderSize = 24
+	pcpMapSize    = 36
+	protoUDP      = 17
+
+	pmpInitialTimeout = 250 * time.Millisecond // RFC 6886 的首次重发间隔，之后加倍
+	pmpAttempts       = 4
+)
+
+func randRead(b []byte) {
+	rand.Read(b)
+}
+
+// pmpExchange 发送请求并等待网关的应答，按 RFC 6886 的间隔重发
+// accept 校验应答 (操作码、nonce 等)，不匹配的报文忽略
+func pmpExchange(ctx context.Context, gw netip.AddrPort, req []byte, accept func([]byte) bool) ([]byte, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(gw))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, 1100)
+	timeout := pmpInitialTimeout
+	for attempt := 0; attempt < pmpAttempts; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					break
+				}
+				// 网关未监听时常见 ICMP 端口不可达
+				return nil, errUnsupported
+			}
+			if accept(buf[:n]) {
+				return buf[:n], nil
+			}
+		}
+		timeout *= 2
+	}
+	return nil, errors.New("no response from gateway")
+}
+
+// ========== NAT-PMP ==========
+
+// mapNATPMP 申请 (lifetime 为 0 时删除) 映射，并查询外部地址
+func (m *Mapper) mapNATPMP(ctx context.Context, gw netip.Addr, port uint16, lifetime time.Duration) (*Mapping, error) {
+	dst := netip.AddrPortFrom(gw, m.cfg.pmpPort())
+	req := make([]byte, 12)
+	req[0], req[1] = pmpVersion, pmpOpMapUDP
+	binary.BigEndian.PutUint16(req[4:], port)
+	if lifetime > 0 {
+		binary.BigEndian.PutUint16(req[6:], port) // 建议外部端口与内部相同
+	}
+	binary.BigEndian.PutUint32(req[8:], uint32(lifetime/time.Second))
+	resp, err := pmpExchange(ctx, dst, req, func(b []byte) bool {
+		return len(b) >= 4 && b[0] == pmpVersion && b[1] == opResponse|pmpOpMapUDP
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := pmpResult(resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 16 || binary.BigEndian.Uint16(resp[8:]) != port {
+		return nil, errors.New("malformed NAT-PMP response")
+	}
+	mapping := &Mapping{Lifetime: time.Duration(binary.BigEndian.Uint32(resp[12:])) * time.Second}
+	extPort := binary.BigEndian.Uint16(resp[10:])
+	if lifetime == 0 {
+		return mapping, nil
+	}
+
+	// 外部地址需要单独查询，失败时只返回端口
+	resp, err = pmpExchange(ctx, dst, []byte{pmpVersion, pmpOpExternalAddr}, func(b []byte) bool {
+		return len(b) >= 4 && b[0] == pmpVersion && b[1] == opResponse|pmpOpExternalAddr
+	})
+	var ext netip.Addr
+	if err == nil && pmpResult(resp) == nil && len(resp) >= 12 {
+		ext = netip.AddrFrom4([4]byte(resp[8:12]))
+	}
+	mapping.External = netip.AddrPortFrom(ext, extPort)
+	return mapping, nil
+}
+
+func pmpResult(resp []byte) error {
+	switch code := binary.BigEndian.Uint16(resp[2:]); code {
+	case 0:
+		return nil
+	case pmpResultUnsupportedVersion:
+		return errUnsupported
+	default:
+		return fmt.Errorf("NAT-PMP result code %d", code)
+	}
+}
+
+// ========== PCP ==========
+
+// mapPCP 发送 MAP 请求 (lifetime 为 0 时删除)，外部地址在应答中给出
+func (m *Mapper) mapPCP(ctx context.Context, gw netip.Addr, port uint16, lifetime time.Duration) (*Mapping, error) {
+	local, err := localAddrFor(gw, m.cfg.pmpPort())
+	if err != nil {
+		return nil, err
+	}
+	req := make([]byte, pcpHeaderSize+pcpMapSize)
+	req[0], req[1] = pcpVersion, pcpOpMap
+	binary.BigEndian.PutUint32(req[4:], uint32(lifetime/time.Second))
+	client := local.As16() // IPv4 以 IPv4 映射的 IPv6 地址表示
+	copy(req[8:24], client[:])
+	op := req[pcpHeaderSize:]
+	copy(op[0:12], m.pcpNonce[:])
+	op[12] = protoUDP
+	binary.BigEndian.PutUint16(op[16:], port)
+	if lifetime > 0 {
+		binary.BigEndian.PutUint16(op[18:], port)
+	}
+	if local.Is4() {
+		// 建议外部地址全零：IPv4 时为 ::ffff:0.0.0.0
+		op[30], op[31] = 0xff, 0xff
+	}
+
+	resp, err := pmpExchange(ctx, netip.AddrPortFrom(gw, m.cfg.pmpPort()), req, func(b []byte) bool {
+		if len(b) >= 4 && b[0] == pmpVersion {
+			return true // 只支持 NAT-PMP 的网关以版本 0 应答 "不支持的版本"
+		}
+		return len(b) >= pcpHeaderSize+pcpMapSize && b[0] == pcpVersion && b[1] == opResponse|pcpOpMap &&
+			[12]byte(b[pcpHeaderSize:pcpHeaderSize+12]) == m.pcpNonce
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] == pmpVersion {
+		return nil, errUnsupported
+	}
+	switch code := resp[3]; code {
+	case 0:
+	case pcpResultUnsupportedVersion:
+		return nil, errUnsupported
+	default:
+		return nil, fmt.Errorf("PCP result code %d", code)
+	}
+	op = resp[pcpHeaderSize:]
+	ext := netip.AddrFrom16([16]byte(op[20:36])).Unmap()
+	return &Mapping{
+		External: netip.AddrPortFrom(ext, binary.BigEndian.Uint16(op[18:])),
+		Lifetime: time.Duration(binary.BigEndian.Uint32(resp[4:])) * time.Second,
+	}, nil
+}
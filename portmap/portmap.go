@@ -0,0 +1,280 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// Package portmap 在家用路由器上为 WireGuard 监听端口申请 UDP 端口映射，使外部可以直接连入。
+//
+// 依次尝试 PCP (RFC 6887)、NAT-PMP (RFC 6886) 与 UPnP-IGD (WANIPConnection / WANPPPConnection)，
+// 成功后在租期过半时续期，失败时按退避间隔重试，停止时删除映射。
+package portmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	ProtocolPCP    = "pcp"
+	ProtocolNATPMP = "nat-pmp"
+	ProtocolUPnP   = "upnp"
+
+	DefaultLifetime    = 2 * time.Hour
+	defaultPMPPort     = 5351
+	defaultSSDPAddr    = "239.255.255.250:1900"
+	defaultDescription = "wireguard-go"
+
+	minRenew     = time.Second      // 续期间隔下限，防止网关给出极短租期时忙等
+	minRetry     = 30 * time.Second // 映射失败后的首次重试间隔
+	maxRetry     = 10 * time.Minute
+	unmapTimeout = 5 * time.Second // 停止时删除映射的最长时间
+)
+
+// DefaultProtocols 默认的尝试顺序
+var DefaultProtocols = []string{ProtocolPCP, ProtocolNATPMP, ProtocolUPnP}
+
+var (
+	// ErrNoGateway 找不到默认网关
+	ErrNoGateway = errors.New("portmap: no default gateway")
+	// errUnsupported 网关不支持该协议，尝试下一个
+	errUnsupported = errors.New("not supported by gateway")
+)
+
+// Mapping 一个已建立的映射
+type Mapping struct {
+	Protocol     string
+	Gateway      netip.Addr
+	InternalPort uint16
+	External     netip.AddrPort // 外部地址与端口，外部地址未知时 Addr 无效
+	Lifetime     time.Duration  // 网关给出的租期，0 为永久 (部分 UPnP 网关只支持永久映射)
+	Expires      time.Time      // 永久映射为零值
+}
+
+// Config 映射设置，零值使用默认值
+type Config struct {
+	Gateway     netip.Addr    // 网关地址，无效时取默认路由的网关
+	Protocols   []string      // 尝试顺序，默认 DefaultProtocols
+	Lifetime    time.Duration // 申请的租期，默认 DefaultLifetime
+	Description string        // UPnP 映射描述
+
+	PMPPort  uint16 // PCP / NAT-PMP 端口，默认 5351，测试时指向本地模拟网关
+	SSDPAddr string // UPnP 发现地址，默认 239.255.255.250:1900
+
+	Logf func(format string, args ...any) // 可选的日志
+}
+
+func (c *Config) lifetime() time.Duration {
+	if c.Lifetime <= 0 {
+		return DefaultLifetime
+	}
+	return c.Lifetime
+}
+
+func (c *Config) pmpPort() uint16 {
+	if c.PMPPort == 0 {
+		return defaultPMPPort
+	}
+	return c.PMPPort
+}
+
+func (c *Config) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// Validate 检查协议名
+func (c *Config) Validate() error {
+	for _, p := range c.Protocols {
+		if !slices.Contains(DefaultProtocols, p) {
+			return fmt.Errorf("portmap: unknown protocol %q, use %q, %q or %q", p, ProtocolPCP, ProtocolNATPMP, ProtocolUPnP)
+		}
+	}
+	return nil
+}
+
+// Mapper 维护一个 UDP 端口映射
+type Mapper struct {
+	cfg  Config
+	port func() uint16
+
+	mu      sync.Mutex
+	current *Mapping
+	err     error
+
+	pcpNonce [12]byte    // PCP 续期与删除须使用同一 nonce
+	upnp     *upnpTarget // 找到的 UPnP 控制地址，失败时重新发现
+}
+
+// NewMapper 创建 Mapper，port 返回当前的内部端口 (端口变化时在下次续期时改映射新端口)
+func NewMapper(cfg Config, port func() uint16) *Mapper {
+	if len(cfg.Protocols) == 0 {
+		cfg.Protocols = DefaultProtocols
+	}
+	if cfg.Description == "" {
+		cfg.Description = defaultDescription
+	}
+	if cfg.SSDPAddr == "" {
+		cfg.SSDPAddr = defaultSSDPAddr
+	}
+	m := &Mapper{cfg: cfg, port: port}
+	randRead(m.pcpNonce[:])
+	return m
+}
+
+// Mapping 返回当前的映射与最近一次失败的原因
+func (m *Mapper) Mapping() (*Mapping, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == nil {
+		return nil, m.err
+	}
+	cur := *m.current
+	return &cur, m.err
+}
+
+// Run 建立映射并续期，直到 ctx 结束后删除映射
+// 映射建立、外部地址变化或失败时调用 onChange (失败时 mapping 为 nil)，可为 nil
+func (m *Mapper) Run(ctx context.Context, onChange func(mapping *Mapping, err error)) {
+	if onChange == nil {
+		onChange = func(*Mapping, error) {}
+	}
+	retry := minRetry
+	for {
+		mapping, err := m.mapOnce(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		var wait time.Duration
+		if err != nil {
+			m.mu.Lock()
+			changed := m.current != nil || m.err == nil || m.err.Error() != err.Error()
+			m.current, m.err = nil, err
+			m.mu.Unlock()
+			if changed {
+				onChange(nil, err)
+			}
+			wait, retry = retry, min(retry*2, maxRetry)
+		} else {
+			m.mu.Lock()
+			prev := m.current
+			m.current, m.err = mapping, nil
+			m.mu.Unlock()
+			if prev == nil || prev.External != mapping.External || prev.Protocol != mapping.Protocol {
+				onChange(mapping, nil)
+			}
+			retry = minRetry
+			wait = max(mapping.Lifetime/2, minRenew)
+			if mapping.Lifetime == 0 {
+				wait = m.cfg.lifetime() / 2
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+			continue
+		}
+		break
+	}
+
+	m.mu.Lock()
+	cur := m.current
+	m.current = nil
+	m.mu.Unlock()
+	if cur == nil {
+		return
+	}
+	uctx, cancel := context.WithTimeout(context.Background(), unmapTimeout)
+	defer cancel()
+	if err := m.unmap(uctx, cur); err != nil {
+		m.cfg.logf("portmap: remove %s mapping for port %d failed: %v", cur.Protocol, cur.InternalPort, err)
+	} else {
+		m.cfg.logf("portmap: removed %s mapping for port %d", cur.Protocol, cur.InternalPort)
+	}
+}
+
+// mapOnce 按顺序尝试各协议，上次成功的协议优先；内部端口变化时先删除旧映射
+func (m *Mapper) mapOnce(ctx context.Context) (*Mapping, error) {
+	port := m.port()
+	if port == 0 {
+		return nil, errors.New("portmap: device is not listening")
+	}
+	gw := m.cfg.Gateway
+	if !gw.IsValid() {
+		var err error
+		if gw, err = defaultGateway(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	prev := m.current
+	m.mu.Unlock()
+	protocols := m.cfg.Protocols
+	if prev != nil {
+		if prev.InternalPort != port || prev.Gateway != gw {
+			m.unmap(ctx, prev)
+		} else {
+			protocols = append([]string{prev.Protocol}, slices.DeleteFunc(slices.Clone(protocols), func(p string) bool { return p == prev.Protocol })...)
+		}
+	}
+
+	var errs []error
+	for _, proto := range protocols {
+		var mapping *Mapping
+		var err error
+		switch proto {
+		case ProtocolPCP:
+			mapping, err = m.mapPCP(ctx, gw, port, m.cfg.lifetime())
+		case ProtocolNATPMP:
+			mapping, err = m.mapNATPMP(ctx, gw, port, m.cfg.lifetime())
+		case ProtocolUPnP:
+			mapping, err = m.mapUPnP(ctx, gw, port, m.cfg.lifetime())
+		default:
+			err = errUnsupported
+		}
+		if err == nil {
+			mapping.Protocol, mapping.Gateway, mapping.InternalPort = proto, gw, port
+			if mapping.Lifetime > 0 {
+				mapping.Expires = time.Now().Add(mapping.Lifetime)
+			}
+			return mapping, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", proto, err))
+	}
+	return nil, fmt.Errorf("portmap: no protocol succeeded via %s: %w", gw, errors.Join(errs...))
+}
+
+// unmap 删除映射
+func (m *Mapper) unmap(ctx context.Context, mapping *Mapping) error {
+	switch mapping.Protocol {
+	case ProtocolPCP:
+		_, err := m.mapPCP(ctx, mapping.Gateway, mapping.InternalPort, 0)
+		return err
+	case ProtocolNATPMP:
+		_, err := m.mapNATPMP(ctx, mapping.Gateway, mapping.InternalPort, 0)
+		return err
+	case ProtocolUPnP:
+		return m.unmapUPnP(ctx, mapping)
+	}
+	return errUnsupported
+}
+
+// localAddrFor 本机访问网关时使用的源地址 (不发送数据)
+func localAddrFor(gw netip.Addr, port uint16) (netip.Addr, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(gw, port)))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
@@ -0,0 +1,340 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway 进程内的模拟网关：PCP / NAT-PMP 应答与 UPnP-IGD (SSDP + SOAP)
+type fakeGateway struct {
+	pmp      *net.UDPConn
+	ssdp     *net.UDPConn
+	http     *httptest.Server
+	external netip.Addr
+
+	pcp           bool // false 时对 PCP 请求以 NAT-PMP "不支持的版本" 应答
+	permanentOnly bool // UPnP 只接受永久映射
+
+	mu       sync.Mutex
+	requests map[string]int    // 各协议收到的映射请求数
+	mappings map[uint16]uint32 // 外部端口 -> 租期 (秒)
+}
+
+func newFakeGateway(t *testing.T, pcp bool) *fakeGateway {
+	listen := func() *net.UDPConn {
+		pc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+		return pc
+	}
+	g := &fakeGateway{
+		pmp:      listen(),
+		ssdp:     listen(),
+		external: netip.MustParseAddr("203.0.113.7"),
+		pcp:      pcp,
+		requests: make(map[string]int),
+		mappings: make(map[uint16]uint32),
+	}
+	g.http = httptest.NewServer(http.HandlerFunc(g.serveHTTP))
+	t.Cleanup(g.http.Close)
+	go g.servePMP()
+	go g.serveSSDP()
+	return g
+}
+
+func (g *fakeGateway) config() Config {
+	return Config{
+		Gateway:  netip.MustParseAddr("127.0.0.1"),
+		PMPPort:  uint16(g.pmp.LocalAddr().(*net.UDPAddr).Port),
+		SSDPAddr: g.ssdp.LocalAddr().String(),
+	}
+}
+
+func (g *fakeGateway) record(proto string, port uint16, lifetime uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests[proto]++
+	if lifetime == 0 {
+		delete(g.mappings, port)
+	} else {
+		g.mappings[port] = lifetime
+	}
+}
+
+func (g *fakeGateway) state() (map[string]int, map[uint16]uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	requests, mappings := make(map[string]int), make(map[uint16]uint32)
+	for k, v := range g.requests {
+		requests[k] = v
+	}
+	for k, v := range g.mappings {
+		mappings[k] = v
+	}
+	return requests, mappings
+}
+
+func (g *fakeGateway) servePMP() {
+	buf := make([]byte, 1100)
+	for {
+		n, from, err := g.pmp.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		req := buf[:n]
+		var resp []byte
+		switch {
+		case req[0] == pcpVersion && !g.pcp:
+			resp = []byte{pmpVersion, opResponse | req[1], 0, pmpResultUnsupportedVersion, 0, 0, 0, 0}
+		case req[0] == pcpVersion && n >= pcpHeaderSize+pcpMapSize:
+			op := req[pcpHeaderSize:]
+			port := binary.BigEndian.Uint16(op[16:])
+			lifetime := binary.BigEndian.Uint32(req[4:])
+			g.record(ProtocolPCP, port, lifetime)
+			resp = make([]byte, pcpHeaderSize+pcpMapSize)
+			resp[0], resp[1] = pcpVersion, opResponse|pcpOpMap
+			binary.BigEndian.PutUint32(resp[4:], lifetime)
+			copy(resp[pcpHeaderSize:], op)
+			binary.BigEndian.PutUint16(resp[pcpHeaderSize+18:], port)
+			ext := g.external.As16()
+			copy(resp[pcpHeaderSize+20:], ext[:])
+		case req[0] == pmpVersion && req[1] == pmpOpExternalAddr:
+			resp = make([]byte, 12)
+			resp[1] = opResponse | pmpOpExternalAddr
+			ext := g.external.As4()
+			copy(resp[8:], ext[:])
+		case req[0] == pmpVersion && req[1] == pmpOpMapUDP && n >= 12:
+			port := binary.BigEndian.Uint16(req[4:])
+			lifetime := binary.BigEndian.Uint32(req[8:])
+			g.record(ProtocolNATPMP, port, lifetime)
+			resp = make([]byte, 16)
+			resp[1] = opResponse | pmpOpMapUDP
+			binary.BigEndian.PutUint16(resp[8:], port)
+			binary.BigEndian.PutUint16(resp[10:], port)
+			binary.BigEndian.PutUint32(resp[12:], lifetime)
+		default:
+			continue
+		}
+		g.pmp.WriteToUDPAddrPort(resp, from)
+	}
+}
+
+func (g *fakeGateway) serveSSDP() {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := g.ssdp.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(string(buf[:n]), "M-SEARCH") {
+			continue
+		}
+		resp := "HTTP/1.1 200 OK\r\nST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+			"LOCATION: " + g.http.URL + "/rootDesc.xml\r\n\r\n"
+		g.ssdp.WriteToUDPAddrPort([]byte(resp), from)
+	}
+}
+
+const fakeDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device><deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<serviceList><service>
+<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<controlURL>/ctl/IPConn</controlURL>
+</service></serviceList>
+</device></deviceList></device></deviceList></device></root>`
+
+func (g *fakeGateway) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/rootDesc.xml" {
+		io.WriteString(w, fakeDescription)
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/ctl/IPConn" {
+		http.NotFound(w, r)
+		return
+	}
+	args, _ := soapValues(r.Body)
+	action := r.Header.Get("SOAPAction")
+	action = strings.Trim(action[strings.LastIndex(action, "#")+1:], `"`)
+	reply := func(body string) {
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+			`<u:%sResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">%s</u:%sResponse></s:Body></s:Envelope>`, action, body, action)
+	}
+	var port uint16
+	fmt.Sscan(args["NewExternalPort"], &port)
+	switch action {
+	case "AddPortMapping":
+		if args["NewProtocol"] != "UDP" || args["NewInternalClient"] != "127.0.0.1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var lease uint32
+		fmt.Sscan(args["NewLeaseDuration"], &lease)
+		if g.permanentOnly && lease != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>`+
+				`<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>725</errorCode>`+
+				`<errorDescription>OnlyPermanentLeasesSupported</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+			return
+		}
+		g.record(ProtocolUPnP, port, max(lease, 1))
+		reply("")
+	case "DeletePortMapping":
+		g.record(ProtocolUPnP, port, 0)
+		reply("")
+	case "GetExternalIPAddress":
+		reply("<NewExternalIPAddress>" + g.external.String() + "</NewExternalIPAddress>")
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// runMapper 运行 Mapper 直到收到第一个结果，返回结果与停止函数 (停止后映射已删除)
+func runMapper(t *testing.T, cfg Config, port uint16) (*Mapper, *Mapping, error, func()) {
+	t.Helper()
+	m := NewMapper(cfg, func() uint16 { return port })
+	type result struct {
+		mapping *Mapping
+		err     error
+	}
+	results := make(chan result, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx, func(mapping *Mapping, err error) { results <- result{mapping, err} })
+	}()
+	stop := func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Run did not return")
+		}
+	}
+	t.Cleanup(stop)
+	select {
+	case r := <-results:
+		return m, r.mapping, r.err, stop
+	case <-time.After(10 * time.Second):
+		t.Fatal("no mapping result")
+	}
+	return nil, nil, nil, nil
+}
+
+func TestPCP(t *testing.T) {
+	g := newFakeGateway(t, true)
+	cfg := g.config()
+	cfg.Lifetime = 2 * time.Second
+	m, mapping, err, stop := runMapper(t, cfg, 51820)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Protocol != ProtocolPCP || mapping.External != netip.MustParseAddrPort("203.0.113.7:51820") || mapping.Lifetime != 2*time.Second {
+		t.Fatalf("mapping = %+v", mapping)
+	}
+	if cur, _ := m.Mapping(); cur == nil || cur.External != mapping.External {
+		t.Fatalf("Mapping() = %+v", cur)
+	}
+
+	// 租期过半时续期
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		requests, _ := g.state()
+		if requests[ProtocolPCP] >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mapping not renewed: %v", requests)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	stop()
+	if _, mappings := g.state(); len(mappings) != 0 {
+		t.Fatalf("mapping not removed: %v", mappings)
+	}
+	if cur, _ := m.Mapping(); cur != nil {
+		t.Fatalf("Mapping() after stop = %+v", cur)
+	}
+}
+
+func TestNATPMPFallback(t *testing.T) {
+	g := newFakeGateway(t, false)
+	_, mapping, err, stop := runMapper(t, g.config(), 51820)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Protocol != ProtocolNATPMP || mapping.External != netip.MustParseAddrPort("203.0.113.7:51820") || mapping.Lifetime != DefaultLifetime {
+		t.Fatalf("mapping = %+v", mapping)
+	}
+	if requests, mappings := g.state(); requests[ProtocolPCP] != 0 || mappings[51820] == 0 {
+		t.Fatalf("requests = %v, mappings = %v", requests, mappings)
+	}
+	stop()
+	if _, mappings := g.state(); len(mappings) != 0 {
+		t.Fatalf("mapping not removed: %v", mappings)
+	}
+}
+
+func TestUPnP(t *testing.T) {
+	g := newFakeGateway(t, true)
+	g.permanentOnly = true
+	cfg := g.config()
+	cfg.Protocols = []string{ProtocolUPnP}
+	_, mapping, err, stop := runMapper(t, cfg, 51820)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Protocol != ProtocolUPnP || mapping.External != netip.MustParseAddrPort("203.0.113.7:51820") || mapping.Lifetime != 0 || !mapping.Expires.IsZero() {
+		t.Fatalf("mapping = %+v", mapping)
+	}
+	if _, mappings := g.state(); mappings[51820] == 0 {
+		t.Fatalf("mappings = %v", mappings)
+	}
+	stop()
+	if _, mappings := g.state(); len(mappings) != 0 {
+		t.Fatalf("mapping not removed: %v", mappings)
+	}
+}
+
+func TestNoGateway(t *testing.T) {
+	// 网关未监听：PCP / NAT-PMP 都失败，报告错误
+	pc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+	cfg := Config{
+		Gateway:   netip.MustParseAddr("127.0.0.1"),
+		PMPPort:   uint16(port),
+		Protocols: []string{ProtocolPCP, ProtocolNATPMP},
+	}
+	m, mapping, err, _ := runMapper(t, cfg, 51820)
+	if mapping != nil || err == nil || !strings.Contains(err.Error(), ProtocolNATPMP) {
+		t.Fatalf("mapping = %+v, err = %v", mapping, err)
+	}
+	if cur, lastErr := m.Mapping(); cur != nil || lastErr == nil {
+		t.Fatalf("Mapping() = %+v, %v", cur, lastErr)
+	}
+}
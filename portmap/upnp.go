@@ -0,0 +1,324 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package portmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpTimeout = 2 * time.Second // 等待 SSDP 应答的时间
+	soapTimeout = 5 * time.Second
+
+	upnpErrOnlyPermanentLease = 725 // OnlyPermanentLeasesSupported
+)
+
+// 按优先级排列的 WAN 连接服务
+var upnpServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnpTarget 网关上可用的 WAN 连接服务
+type upnpTarget struct {
+	gateway    netip.Addr
+	service    string
+	controlURL string
+	local      netip.Addr // 本机在该网关下的地址，作为 NewInternalClient
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+type upnpRoot struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// findService 在设备树中按 upnpServices 的顺序查找服务
+func (d *upnpDevice) findService() (service, controlURL string) {
+	best := len(upnpServices)
+	var walk func(d *upnpDevice)
+	walk = func(d *upnpDevice) {
+		for _, s := range d.Services {
+			for i, want := range upnpServices[:best] {
+				if strings.TrimSpace(s.ServiceType) == want {
+					best, service, controlURL = i, want, strings.TrimSpace(s.ControlURL)
+					break
+				}
+			}
+		}
+		for i := range d.Devices {
+			walk(&d.Devices[i])
+		}
+	}
+	walk(d)
+	return service, controlURL
+}
+
+// mapUPnP 用 AddPortMapping 申请映射并查询外部地址，租期不被支持时改用永久映射
+func (m *Mapper) mapUPnP(ctx context.Context, gw netip.Addr, port uint16, lifetime time.Duration) (*Mapping, error) {
+	target := m.upnp
+	if target == nil || target.gateway != gw {
+		var err error
+		if target, err = m.discoverUPnP(ctx, gw); err != nil {
+			return nil, err
+		}
+		m.upnp = target
+	}
+	lease := uint32(lifetime / time.Second)
+	_, err := target.call(ctx, "AddPortMapping", upnpMappingArgs(port, port, target.local, m.cfg.Description, lease))
+	var soapErr *upnpError
+	if errors.As(err, &soapErr) && soapErr.Code == upnpErrOnlyPermanentLease {
+		lease = 0
+		_, err = target.call(ctx, "AddPortMapping", upnpMappingArgs(port, port, target.local, m.cfg.Description, 0))
+	}
+	if err != nil {
+		m.upnp = nil // 下次重新发现，网关可能已重启换了控制地址
+		return nil, err
+	}
+	mapping := &Mapping{
+		External: netip.AddrPortFrom(netip.Addr{}, port),
+		Lifetime: time.Duration(lease) * time.Second,
+	}
+	if resp, err := target.call(ctx, "GetExternalIPAddress", nil); err == nil {
+		if ip, err := netip.ParseAddr(resp["NewExternalIPAddress"]); err == nil {
+			mapping.External = netip.AddrPortFrom(ip.Unmap(), port)
+		}
+	}
+	return mapping, nil
+}
+
+func (m *Mapper) unmapUPnP(ctx context.Context, mapping *Mapping) error {
+	target := m.upnp
+	if target == nil {
+		return errors.New("UPnP gateway unknown")
+	}
+	_, err := target.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(mapping.External.Port()))},
+		{"NewProtocol", "UDP"},
+	})
+	return err
+}
+
+func upnpMappingArgs(internal, external uint16, local netip.Addr, desc string, lease uint32) [][2]string {
+	return [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(external))},
+		{"NewProtocol", "UDP"},
+		{"NewInternalPort", strconv.Itoa(int(internal))},
+		{"NewInternalClient", local.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", desc},
+		{"NewLeaseDuration", strconv.FormatUint(uint64(lease), 10)},
+	}
+}
+
+// discoverUPnP 发送 SSDP M-SEARCH，只接受网关自身发出且 LOCATION 指向网关的应答
+func (m *Mapper) discoverUPnP(ctx context.Context, gw netip.Addr) (*upnpTarget, error) {
+	ssdp, err := net.ResolveUDPAddr("udp4", m.cfg.SSDPAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + defaultSSDPAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err := conn.WriteToUDP([]byte(req), ssdp); err != nil {
+		return nil, err
+	}
+	local, err := localAddrFor(gw, uint16(ssdp.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(ssdpTimeout))
+	buf := make([]byte, 2048)
+	var lastErr error = errUnsupported
+	tried := map[string]bool{}
+	for {
+		n, from, err := conn.ReadFromUDPAddrPort(buf)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, lastErr
+		}
+		if from.Addr().Unmap() != gw {
+			continue
+		}
+		location := ssdpLocation(buf[:n])
+		if location == "" || tried[location] {
+			continue
+		}
+		tried[location] = true
+		u, err := url.Parse(location)
+		if err != nil || u.Hostname() != gw.String() {
+			continue
+		}
+		service, control, err := fetchUPnPDescription(ctx, u)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return &upnpTarget{gateway: gw, service: service, controlURL: control, local: local}, nil
+	}
+}
+
+// ssdpLocation 取出 SSDP 应答中的 LOCATION 头
+func ssdpLocation(resp []byte) string {
+	for _, line := range strings.Split(string(resp), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "location") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// fetchUPnPDescription 读取设备描述，返回 WAN 连接服务与其控制地址
+func fetchUPnPDescription(ctx context.Context, location *url.URL) (service, controlURL string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, soapTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("device description: %s", resp.Status)
+	}
+	var root upnpRoot
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return "", "", fmt.Errorf("device description: %w", err)
+	}
+	service, control := root.Device.findService()
+	if service == "" {
+		return "", "", errors.New("gateway has no WAN connection service")
+	}
+	base := location
+	if root.URLBase != "" {
+		if u, err := url.Parse(strings.TrimSpace(root.URLBase)); err == nil {
+			base = u
+		}
+	}
+	ref, err := url.Parse(control)
+	if err != nil {
+		return "", "", err
+	}
+	abs := base.ResolveReference(ref)
+	if abs.Hostname() != location.Hostname() {
+		return "", "", errors.New("control URL points outside the gateway")
+	}
+	return service, abs.String(), nil
+}
+
+// upnpError SOAP 错误应答中的 UPnPError
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// call 调用 SOAP 动作，返回应答中各叶子元素的文本
+func (t *upnpTarget) call(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + t.service + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	ctx, cancel := context.WithTimeout(ctx, soapTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+t.service+"#"+action+`"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	values, err := soapValues(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		if code, convErr := strconv.Atoi(values["errorCode"]); err == nil && convErr == nil {
+			return nil, &upnpError{Code: code, Description: values["errorDescription"]}
+		}
+		return nil, fmt.Errorf("%s: %s", action, resp.Status)
+	}
+	return values, err
+}
+
+// soapValues 把应答中的叶子元素按本地名收集起来，足以读取 UPnP 的输出参数与错误
+func soapValues(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	dec := xml.NewDecoder(r)
+	var name string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			name = tok.Name.Local
+			text.Reset()
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			if name == tok.Name.Local {
+				values[name] = strings.TrimSpace(text.String())
+			}
+			name = ""
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+// 通用的按键令牌桶限流器
+// Ratelimiter 专为握手包设计，速率固定且只能按 IP 限流；
+// Keyed 是它的泛化版本：速率、突发量可配置，键可以是 IP、用户名等任意可比较类型。
+// 过期条目在 Allow 时顺带回收，不需要后台协程，也不需要 Close。
+
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+type keyedEntry struct {
+	lastTime time.Time
+	tokens   int64
+}
+
+type Keyed[K comparable] struct {
+	mu      sync.Mutex
+	timeNow func() time.Time
+
+	cost   int64         // 每次请求消耗的令牌 (纳秒)
+	max    int64         // 令牌桶容量
+	idle   time.Duration // 桶被补满后闲置多久可以回收
+	lastGC time.Time
+	table  map[K]*keyedEntry
+}
+
+// NewKeyed 创建限流器：每个键每 interval 恢复一次请求额度，最多积攒 burst 次
+func NewKeyed[K comparable](interval time.Duration, burst int) *Keyed[K] {
+	if burst < 1 {
+		burst = 1
+	}
+	cost := interval.Nanoseconds()
+	return &Keyed[K]{
+		timeNow: time.Now,
+		cost:    cost,
+		max:     cost * int64(burst),
+		idle:    time.Duration(cost * int64(burst)),
+		table:   make(map[K]*keyedEntry),
+	}
+}
+
+// cleanup 回收已经补满令牌的条目 (调用方持有锁)
+func (rate *Keyed[K]) cleanup(now time.Time) {
+	if now.Sub(rate.lastGC) < garbageCollectTime {
+		return
+	}
+	rate.lastGC = now
+	for key, entry := range rate.table {
+		if now.Sub(entry.lastTime) > rate.idle {
+			delete(rate.table, key)
+		}
+	}
+}
+
+// Allow 消耗一次额度，额度不足时返回 false
+func (rate *Keyed[K]) Allow(key K) bool {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+
+	now := rate.timeNow()
+	rate.cleanup(now)
+
+	entry := rate.table[key]
+	if entry == nil {
+		rate.table[key] = &keyedEntry{
+			lastTime: now,
+			tokens:   rate.max - rate.cost,
+		}
+		return true
+	}
+
+	entry.tokens += now.Sub(entry.lastTime).Nanoseconds()
+	entry.lastTime = now
+	if entry.tokens > rate.max {
+		entry.tokens = rate.max
+	}
+	if entry.tokens >= rate.cost {
+		entry.tokens -= rate.cost
+		return true
+	}
+	return false
+}
+
+// Reset 清除某个键的限流状态 (例如登录成功后)
+func (rate *Keyed[K]) Reset(key K) {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+	delete(rate.table, key)
+}
+
+// Len 返回当前跟踪的键数量
+func (rate *Keyed[K]) Len() int {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+	return len(rate.table)
+}
@@ -0,0 +1,52 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2025 WireGuard LLC. All Rights Reserved.
+ */
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyed(t *testing.T) {
+	now := time.Unix(0, 0)
+	rate := NewKeyed[string](time.Minute, 3)
+	rate.timeNow = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !rate.Allow("alice") {
+			t.Fatalf("request %d within burst denied", i)
+		}
+	}
+	if rate.Allow("alice") {
+		t.Fatal("request after burst allowed")
+	}
+	if !rate.Allow("bob") {
+		t.Fatal("independent key denied")
+	}
+
+	now = now.Add(30 * time.Second)
+	if rate.Allow("alice") {
+		t.Fatal("allowed before a full interval elapsed")
+	}
+	now = now.Add(30 * time.Second)
+	if !rate.Allow("alice") {
+		t.Fatal("denied after a full interval elapsed")
+	}
+	if rate.Allow("alice") {
+		t.Fatal("allowed more than one refilled request")
+	}
+
+	rate.Reset("alice")
+	if !rate.Allow("alice") {
+		t.Fatal("denied after reset")
+	}
+
+	now = now.Add(time.Hour)
+	rate.Allow("carol")
+	if n := rate.Len(); n != 1 {
+		t.Fatalf("expected idle entries to be collected, %d remain", n)
+	}
+}